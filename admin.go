@@ -0,0 +1,224 @@
+package speed
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/performancecopilot/speed/bytewriter"
+	"github.com/pkg/errors"
+)
+
+// maxAdminRequestSize limits the bodies of requests to the admin handler
+const maxAdminRequestSize = 64 << 10
+
+// Flush synchronously writes the MMV file of a started client to disk, and pushes
+// it, or checkpoints its counters, for clients created with WithRemoteWrite or
+// WithPersistence.
+func (c *PCPClient) Flush() error {
+	c.mutex.Lock()
+
+	if c.writer == nil {
+		c.mutex.Unlock()
+		return errors.New("cannot flush a client that is not mapped")
+	}
+
+	if mw, ok := c.writer.(*bytewriter.MemoryMappedWriter); ok {
+		if err := mw.Flush(); err != nil {
+			c.mutex.Unlock()
+			return errors.Wrap(err, "cannot flush the MMV file")
+		}
+	}
+
+	var (
+		name string
+		data []byte
+	)
+
+	if c.remote != nil {
+		var err error
+		if name, data, err = c.remoteSnapshot(); err != nil {
+			c.mutex.Unlock()
+			return err
+		}
+	}
+
+	c.mutex.Unlock()
+
+	// pushing does not lock the client, so a slow endpoint does not block it
+	if data != nil {
+		if err := c.remote.push(name, data); err != nil {
+			return err
+		}
+	}
+
+	if c.persistence != nil {
+		// checkpointing reads the samples, which locks the client
+		return c.Checkpoint()
+	}
+
+	return nil
+}
+
+// Remap stops and starts a started client, recreating its MMV file with a new
+// generation, for example, to recover from the file being removed by a cleanup job.
+// Metrics can be updated while the client is remapped, updates made while it is
+// stopped are written when it starts again.
+func (c *PCPClient) Remap() error {
+	if err := c.Stop(); err != nil {
+		return err
+	}
+
+	return c.Start()
+}
+
+// Reset resets the registered metric with the passed name, if it is a Resetter.
+func (c *PCPClient) Reset(name string) error {
+	c.r.metricslock.RLock()
+	m, ok := c.r.metrics[name]
+	c.r.metricslock.RUnlock()
+
+	if !ok {
+		return errors.Errorf("metric %v is not registered", name)
+	}
+
+	r, ok := m.(Resetter)
+	if !ok {
+		return errors.Errorf("metric %v of type %T cannot be reset", name, m)
+	}
+
+	return r.Reset()
+}
+
+// AdminMetric describes a metric listed by the admin handler.
+type AdminMetric struct {
+	CatalogEntry
+	Level   string `json:"level"`
+	Enabled bool   `json:"enabled"` // by both the level and the filter of the client
+}
+
+// AdminFilter is the body of a request setting the filter of a client through the
+// admin handler, see GlobFilter. A filter without patterns enables all metrics.
+type AdminFilter struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// AdminHandler returns a handler for controlling the client at runtime, with the
+// following endpoints, relative to where it is mounted, usually with http.StripPrefix
+//
+//	GET  /metrics                lists all metrics as JSON AdminMetrics
+//	GET  /level, PUT /level      gets and sets the level, see LevelHandler
+//	PUT  /filter                 sets the filter to a JSON AdminFilter
+//	PUT  /refresh                sets the refresh interval to a duration like "5s"
+//	POST /flush                  flushes the client, see Flush
+//	POST /remap                  remaps the client, see Remap
+//	POST /reset?metric=<name>    resets a metric, see Reset
+//
+// All requests go through the passed auth middleware, which should reject the ones
+// that are not allowed to control the client. It is required, a handler that anyone
+// who can reach it may use has to be asked for explicitly with InsecureNoAuth.
+func (c *PCPClient) AdminHandler(auth func(http.Handler) http.Handler) (http.Handler, error) {
+	if auth == nil {
+		return nil, errors.New("the admin handler needs an auth middleware, pass InsecureNoAuth to allow all requests")
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", adminMethod(http.MethodGet, c.adminMetrics))
+	mux.Handle("/level", c.LevelHandler())
+	mux.Handle("/filter", adminMethod(http.MethodPut, c.adminFilter))
+	mux.Handle("/refresh", adminMethod(http.MethodPut, c.adminRefresh))
+	mux.Handle("/flush", adminMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) error {
+		return c.Flush()
+	}))
+	mux.Handle("/remap", adminMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) error {
+		return c.Remap()
+	}))
+	mux.Handle("/reset", adminMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) error {
+		return c.Reset(r.URL.Query().Get("metric"))
+	}))
+
+	return auth(mux), nil
+}
+
+// InsecureNoAuth is an auth middleware letting all requests through, for handlers
+// like AdminHandler and RemoteWriteHandler that are only reachable by trusted callers,
+// for example, on a listener bound to the loopback interface.
+func InsecureNoAuth(next http.Handler) http.Handler { return next }
+
+// adminMethod makes a handler for an admin operation accepting only the passed method,
+// responding with no content on success, and with the error otherwise
+func adminMethod(method string, op func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "only "+method+" is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := op(w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if method != http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+func (c *PCPClient) adminMetrics(w http.ResponseWriter, r *http.Request) error {
+	catalog := c.r.Catalog()
+
+	c.r.metricslock.RLock()
+	ans := make([]AdminMetric, 0, len(catalog))
+	for _, e := range catalog {
+		level := NormalLevel
+		if m, ok := c.r.metrics[e.Name]; ok {
+			level = metricLevel(m)
+		}
+
+		ans = append(ans, AdminMetric{e, level.String(), c.enabled(e.Name, level)})
+	}
+	c.r.metricslock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(ans)
+}
+
+func (c *PCPClient) adminFilter(w http.ResponseWriter, r *http.Request) error {
+	var f AdminFilter
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize)).Decode(&f); err != nil {
+		return errors.Wrap(err, "cannot decode the filter")
+	}
+
+	if len(f.Allow) == 0 && len(f.Deny) == 0 {
+		c.SetFilter(nil)
+		return nil
+	}
+
+	filter, err := GlobFilter(f.Allow, f.Deny)
+	if err != nil {
+		return err
+	}
+
+	c.SetFilter(filter)
+	return nil
+}
+
+func (c *PCPClient) adminRefresh(w http.ResponseWriter, r *http.Request) error {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminRequestSize))
+	if err != nil {
+		return errors.Wrap(err, "cannot read the refresh interval")
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(string(body)))
+	if err != nil {
+		return errors.Wrap(err, "invalid refresh interval")
+	}
+
+	return c.SetRefreshInterval(d)
+}
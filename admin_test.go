@@ -0,0 +1,194 @@
+package speed
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestAdminHandler(t *testing.T) {
+	c, err := NewPCPClient("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "app.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MustRegister(counter)
+
+	queue := c.MustRegisterString("app.debug.queue", int64(0), Int64Type, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+	if err = queue.Apply(WithLevel(DebugLevel)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.BindFunc("app.bound", func() int64 { return 1 }, InstantSemantics, OneUnit); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	authorized := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	if _, err = c.AdminHandler(nil); err == nil {
+		t.Error("expected an error creating an admin handler without auth")
+	}
+
+	h, err := c.AdminHandler(authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "secret")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized request to be rejected, got %v", w.Code)
+	}
+
+	w = serve(http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the metrics to be listed, got %v %v", w.Code, w.Body.String())
+	}
+
+	var metrics []AdminMetric
+	if err = json.NewDecoder(w.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics) != 3 || metrics[1].Name != "app.debug.queue" || metrics[1].Level != "debug" || metrics[1].Enabled {
+		t.Errorf("expected the debug metric to be listed as disabled, got %+v", metrics)
+	}
+
+	if w = serve(http.MethodPut, "/filter", `{"deny": ["app.requests"]}`); w.Code != http.StatusNoContent {
+		t.Errorf("expected the filter to be set, got %v %v", w.Code, w.Body.String())
+	}
+
+	if c.enabled("app.requests", NormalLevel) {
+		t.Error("expected app.requests to be disabled by the filter")
+	}
+
+	if w = serve(http.MethodPut, "/filter", `{}`); w.Code != http.StatusNoContent || !c.enabled("app.requests", NormalLevel) {
+		t.Errorf("expected an empty filter to enable all metrics, got %v", w.Code)
+	}
+
+	if w = serve(http.MethodPut, "/filter", `{"allow": ["["]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid pattern to be rejected, got %v", w.Code)
+	}
+
+	if w = serve(http.MethodPut, "/level", "debug"); w.Code != http.StatusNoContent || c.Level() != DebugLevel {
+		t.Errorf("expected the level to be set, got %v", w.Code)
+	}
+
+	if w = serve(http.MethodPut, "/refresh", "5s"); w.Code != http.StatusNoContent || c.RefreshInterval() != 5*time.Second {
+		t.Errorf("expected the refresh interval to be set, got %v, %v", w.Code, c.RefreshInterval())
+	}
+
+	if w = serve(http.MethodPut, "/refresh", "-1s"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a negative refresh interval to be rejected, got %v", w.Code)
+	}
+
+	counter.MustInc(3)
+	if w = serve(http.MethodPost, "/reset?metric=app.requests", ""); w.Code != http.StatusNoContent || counter.Val() != 0 {
+		t.Errorf("expected the counter to be reset, got %v, %v", w.Code, counter.Val())
+	}
+
+	if w = serve(http.MethodPost, "/reset?metric=app.debug.queue", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected resetting a metric that is not a Resetter to fail, got %v", w.Code)
+	}
+
+	if w = serve(http.MethodPost, "/flush", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected the client to be flushed, got %v %v", w.Code, w.Body.String())
+	}
+
+	generation := c.generation
+	if w = serve(http.MethodPost, "/remap", ""); w.Code != http.StatusNoContent || c.generation == generation {
+		t.Errorf("expected the client to be remapped, got %v %v", w.Code, w.Body.String())
+	}
+
+	if w = serve(http.MethodGet, "/flush", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET to be rejected for flush, got %v", w.Code)
+	}
+}
+
+func TestRemapConcurrentUpdates(t *testing.T) {
+	c, err := NewPCPClient("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "app.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MustRegister(counter)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	h, err := c.AdminHandler(InsecureNoAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the counter is updated while the client is remapped
+	done, stopped := make(chan struct{}), make(chan int64)
+	go func() {
+		var incs int64
+		for {
+			select {
+			case <-done:
+				stopped <- incs
+				return
+			default:
+				counter.Up()
+				incs++
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/remap", nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("expected the client to be remapped, got %v %v", w.Code, w.Body.String())
+		}
+	}
+
+	close(done)
+	incs := <-stopped
+
+	if v := counter.Val(); v != incs {
+		t.Errorf("expected the counter to be %v, got %v", incs, v)
+	}
+
+	_, _, metrics, values, instances, _, strs, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, instances, strs, c, t)
+}
@@ -0,0 +1,227 @@
+package speed
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Batch collects metric mutations made while handling a request, so they can be
+// applied together with Commit once the request succeeds, or discarded with Rollback
+// if it fails, instead of leaving the metrics half updated.
+//
+// Mutations are validated as they are added to the batch, and all of them are validated
+// again before Commit applies any, so a Commit cannot fail halfway on a mutation that
+// became invalid in the meantime, like an increment of a retired instance. Commits of
+// batches mutating the same metrics do not interleave, but readers can still observe
+// a commit in progress.
+type Batch struct {
+	mutex sync.Mutex
+	ops   []batchOp
+}
+
+// batchOp is a mutation of a metric in a batch
+type batchOp struct {
+	metric       Metric
+	check, apply func() error
+}
+
+// NewBatch creates a new empty Batch.
+func NewBatch() *Batch { return &Batch{} }
+
+// add adds a mutation of a metric, which is checked again by check before committing
+func (b *Batch) add(m Metric, check, apply func() error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.ops = append(b.ops, batchOp{m, check, apply})
+}
+
+// checkValue checks if a value can be set on a metric
+func checkValue(m Metric, val interface{}) error {
+	if dm, ok := m.(describedMetric); ok {
+		_, err := dm.desc().coerce(val)
+		return err
+	}
+
+	if !m.Type().IsCompatible(val) {
+		return errors.Errorf("value %v(%T) is incompatible with MetricType %v", val, val, m.Type())
+	}
+
+	return nil
+}
+
+// checkInstance checks if an instance metric has an instance
+func checkInstance(instances []string, instance string) error {
+	for _, i := range instances {
+		if i == instance {
+			return nil
+		}
+	}
+
+	return errors.Errorf("%v is not an instance of this metric", instance)
+}
+
+// Set adds setting the value of a singleton metric to the batch.
+func (b *Batch) Set(m SingletonMetric, val interface{}) error {
+	check := func() error { return checkValue(m, val) }
+	if err := check(); err != nil {
+		return err
+	}
+
+	b.add(m, check, func() error { return m.Set(val) })
+	return nil
+}
+
+// SetInstance adds setting the value of an instance of an instance metric to the batch.
+func (b *Batch) SetInstance(m InstanceMetric, val interface{}, instance string) error {
+	check := func() error {
+		if err := checkValue(m, val); err != nil {
+			return err
+		}
+
+		return checkInstance(m.Instances(), instance)
+	}
+
+	if err := check(); err != nil {
+		return err
+	}
+
+	b.add(m, check, func() error { return m.SetInstance(val, instance) })
+	return nil
+}
+
+// Inc adds incrementing a counter to the batch.
+func (b *Batch) Inc(c Counter, inc int64) error {
+	if inc < 0 {
+		return errors.New("increments should be non-negative")
+	}
+
+	b.add(c, nil, func() error { return c.Inc(inc) })
+	return nil
+}
+
+// IncInstance adds incrementing an instance of a counter vector to the batch.
+func (b *Batch) IncInstance(c CounterVector, inc int64, instance string) error {
+	if inc < 0 {
+		return errors.New("increments should be non-negative")
+	}
+
+	check := func() error {
+		_, err := c.Val(instance)
+		return err
+	}
+
+	if err := check(); err != nil {
+		return err
+	}
+
+	b.add(c, check, func() error { return c.Inc(inc, instance) })
+	return nil
+}
+
+// Add adds incrementing a gauge by a possibly negative value to the batch.
+func (b *Batch) Add(g Gauge, val float64) {
+	b.add(g, nil, func() error { return g.Inc(val) })
+}
+
+// Record adds recording a value in a histogram to the batch.
+// The value is not validated against the range of the histogram until Commit.
+func (b *Batch) Record(h Histogram, val int64) {
+	check := func() error {
+		if val < h.Low() || val > h.High() {
+			return errors.Errorf("value %v is out of the range [%v, %v] of the histogram", val, h.Low(), h.High())
+		}
+
+		return nil
+	}
+
+	m, _ := h.(Metric)
+	b.add(m, check, func() error { return h.Record(val) })
+}
+
+// Len returns the number of pending mutations.
+func (b *Batch) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.ops)
+}
+
+// Commit validates all pending mutations, then applies them in the order they were
+// added, and empties the batch. If any mutation is invalid, none is applied.
+func (b *Batch) Commit() error {
+	b.mutex.Lock()
+	ops := b.ops
+	b.ops = nil
+	b.mutex.Unlock()
+
+	// checked before locking, as a commit from a callback of an update of a metric
+	// could be waiting for a commit holding the lock of the metric, and mapping a
+	// lazily started client locks its metrics
+	for i, op := range ops {
+		if dm, ok := op.metric.(describedMetric); ok {
+			if err := dm.desc().prepare(); err != nil {
+				return errors.Wrapf(err, "batch mutation %v of %v is invalid, no mutation was applied", i+1, len(ops))
+			}
+		}
+	}
+
+	defer lockBatchMetrics(ops)()
+
+	for i, op := range ops {
+		if op.check == nil {
+			continue
+		}
+
+		if err := op.check(); err != nil {
+			return errors.Wrapf(err, "batch mutation %v of %v is invalid, no mutation was applied", i+1, len(ops))
+		}
+	}
+
+	for i, op := range ops {
+		if err := op.apply(); err != nil {
+			return errors.Wrapf(err, "batch failed after applying %v of %v mutations", i, len(ops))
+		}
+	}
+
+	return nil
+}
+
+// lockBatchMetrics locks the commits of all metrics mutated by a batch, in the order of
+// their addresses so concurrent commits cannot deadlock, returning a function unlocking them
+func lockBatchMetrics(ops []batchOp) func() {
+	seen := make(map[*pcpMetricDesc]bool)
+	var descs []*pcpMetricDesc
+
+	for _, op := range ops {
+		if dm, ok := op.metric.(describedMetric); ok && !seen[dm.desc()] {
+			seen[dm.desc()] = true
+			descs = append(descs, dm.desc())
+		}
+	}
+
+	sort.Slice(descs, func(i, j int) bool {
+		return reflect.ValueOf(descs[i]).Pointer() < reflect.ValueOf(descs[j]).Pointer()
+	})
+
+	for _, d := range descs {
+		d.commitMutex.Lock()
+	}
+
+	return func() {
+		for _, d := range descs {
+			d.commitMutex.Unlock()
+		}
+	}
+}
+
+// Rollback discards all pending mutations.
+func (b *Batch) Rollback() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.ops = nil
+}
@@ -0,0 +1,149 @@
+package speed
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := NewPCPSingletonMetric(int32(0), "test.status", Int32Type, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gauge, err := NewPCPGauge(1, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBatch()
+
+	if err = b.Inc(counter, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = b.IncInstance(vector, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = b.Set(status, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Add(gauge, -0.5)
+
+	if err = b.Set(status, "five"); err == nil {
+		t.Error("expected an error adding an incompatible value")
+	}
+
+	if err = b.IncInstance(vector, 1, "b"); err == nil {
+		t.Error("expected an error adding an increment to an unknown instance")
+	}
+
+	if err = b.Inc(counter, -1); err == nil {
+		t.Error("expected an error adding a negative counter increment")
+	}
+
+	if b.Len() != 4 {
+		t.Errorf("expected 4 pending mutations, got %v", b.Len())
+	}
+
+	if counter.Val() != 0 {
+		t.Error("expected no mutation to be applied before Commit")
+	}
+
+	if err = b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := vector.Val("a"); counter.Val() != 2 || v != 1 || status.Val() != int32(5) || gauge.Val() != 0.5 {
+		t.Errorf("expected all mutations to be applied, got %v, %v, %v and %v", counter.Val(), v, status.Val(), gauge.Val())
+	}
+
+	if err = b.Inc(counter, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Rollback()
+
+	if err = b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if counter.Val() != 2 {
+		t.Errorf("expected rolled back mutations to be discarded, got %v", counter.Val())
+	}
+}
+
+func TestBatchCommitValidatesFirst(t *testing.T) {
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewPCPHistogram("test.latency", 0, 100, 3, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBatch()
+	if err = b.Inc(counter, 1); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(h, 1000)
+
+	if err = b.Commit(); err == nil {
+		t.Fatal("expected an error committing a value out of the range of the histogram")
+	}
+
+	if v := counter.Val(); v != 0 {
+		t.Errorf("expected no mutation to be applied, got a counter of %v", v)
+	}
+
+	// concurrent commits of the same metrics do not interleave or deadlock
+	other, err := NewPCPCounter(0, "test.other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			b := NewBatch()
+			first, second := counter, other
+			if i%2 == 0 {
+				first, second = other, counter
+			}
+
+			if err := b.Inc(first, 1); err != nil {
+				t.Error(err)
+			}
+
+			if err := b.Inc(second, 1); err != nil {
+				t.Error(err)
+			}
+
+			if err := b.Commit(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if counter.Val() != 10 || other.Val() != 10 {
+		t.Errorf("expected both counters to be 10, got %v and %v", counter.Val(), other.Val())
+	}
+}
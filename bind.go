@@ -0,0 +1,148 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRefreshInterval is how often the functions bound with BindFunc
+// are evaluated, unless set with WithRefreshInterval.
+const DefaultRefreshInterval = time.Second
+
+// WithRefreshInterval sets how often the client evaluates the functions bound
+// with BindFunc and BindValue while it is started.
+func WithRefreshInterval(d time.Duration) ClientOption {
+	return func(c *PCPClient) error {
+		if d <= 0 {
+			return errors.New("refresh interval must be positive")
+		}
+
+		c.refreshInterval = d
+		return nil
+	}
+}
+
+// SetRefreshInterval changes how often the client evaluates the functions bound with
+// BindFunc and BindValue. Unlike WithRefreshInterval, it can be used while the client
+// is started.
+func (c *PCPClient) SetRefreshInterval(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("refresh interval must be positive")
+	}
+
+	c.mutex.Lock()
+	c.refreshInterval = d
+	bindings := c.bindings
+	c.mutex.Unlock()
+
+	if bindings != nil {
+		bindings.setInterval(d)
+	}
+
+	return nil
+}
+
+// RefreshInterval returns how often the client evaluates bound functions.
+func (c *PCPClient) RefreshInterval() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.refreshInterval
+}
+
+// boundFuncs is the collector evaluating all functions bound to a client
+type boundFuncs struct {
+	mutex   sync.Mutex
+	funcs   []boundFunc
+	handler func(error) // reports failures, see WithPanicHandler
+}
+
+type boundFunc struct {
+	name string
+	f    func() interface{}
+}
+
+// Describe sends nothing, the metrics are registered by BindValue
+func (b *boundFuncs) Describe(chan<- Desc) {}
+
+func (b *boundFuncs) Collect(r Recorder) {
+	b.mutex.Lock()
+	funcs := b.funcs
+	b.mutex.Unlock()
+
+	for _, bf := range funcs {
+		val, err := bf.call()
+		if err == nil {
+			err = r.Record(bf.name, val)
+		}
+
+		if err != nil && b.handler != nil {
+			b.handler(errors.Wrapf(err, "bound metric %v", bf.name))
+		}
+	}
+}
+
+// call evaluates a bound function, isolating the client from its panics
+func (bf boundFunc) call() (val interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic evaluating the bound function: %v", r)
+		}
+	}()
+
+	return bf.f(), nil
+}
+
+// BindFunc registers a singleton Int64Type metric whose value is the result of
+// calling f, for example, the length of a queue. Unlike metrics that are set by
+// the code they instrument, f is only called when the client refreshes bound
+// metrics, once on every Start and then every refresh interval, see WithRefreshInterval.
+//
+// A panic in f does not affect the client, the metric keeps its last value,
+// and the panic is reported to the handler set with WithPanicHandler, if any.
+func (c *PCPClient) BindFunc(name string, f func() int64, s MetricSemantics, u MetricUnit, desc ...string) error {
+	if f == nil {
+		return errors.New("bound function cannot be nil")
+	}
+
+	return c.BindValue(name, func() interface{} { return f() }, Int64Type, s, u, desc...)
+}
+
+// BindValue is BindFunc for functions returning a value of any of the metric types,
+// like an expvar.Func, which can be passed as is. The returned values are converted
+// to the passed type like values passed to Set.
+func (c *PCPClient) BindValue(name string, f func() interface{}, t MetricType, s MetricSemantics, u MetricUnit, desc ...string) error {
+	if f == nil {
+		return errors.New("bound function cannot be nil")
+	}
+
+	m, err := NewPCPSingletonMetric(t.zero(), name, t, s, u, desc...)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err = c.Register(m); err != nil {
+		return err
+	}
+
+	if c.bindings == nil {
+		b := &boundFuncs{handler: c.r.panicHandler}
+
+		c.bindings = &collectorRunner{collector: b, interval: c.refreshInterval, metrics: make(map[string]PCPMetric)}
+		c.collectors = append(c.collectors, c.bindings)
+	}
+
+	c.bindings.metrics[name] = m
+
+	b := c.bindings.collector.(*boundFuncs)
+	b.mutex.Lock()
+	b.funcs = append(b.funcs, boundFunc{name, f})
+	b.mutex.Unlock()
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package speed
+
+import (
+	"expvar"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBindFunc(t *testing.T) {
+	c, err := NewPCPClient("test", WithRefreshInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var depth, calls int64
+	if err = c.BindFunc("test.queue.depth", func() int64 {
+		atomic.AddInt64(&calls, 1)
+		return atomic.LoadInt64(&depth)
+	}, InstantSemantics, OneUnit); err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt64(&calls) != 0 {
+		t.Error("expected the bound function not to be called before starting")
+	}
+
+	atomic.StoreInt64(&depth, 3)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	m := c.bindings.metrics["test.queue.depth"].(*PCPSingletonMetric)
+	if m.Val() != int64(3) {
+		t.Errorf("expected the value to be refreshed on start, got %v", m.Val())
+	}
+
+	atomic.StoreInt64(&depth, 5)
+	if !waitFor(func() bool { return m.Val() == int64(5) }) {
+		t.Errorf("expected the value to be refreshed periodically, got %v", m.Val())
+	}
+
+	if err = c.BindFunc("test.late", func() int64 { return 0 }, InstantSemantics, OneUnit); err == nil {
+		t.Error("expected an error binding a function to a started client")
+	}
+}
+
+func TestBindValuePanics(t *testing.T) {
+	var reported int64
+	c, err := NewPCPClient("test", WithoutLocalFile(), WithPanicHandler(func(error) {
+		atomic.AddInt64(&reported, 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.BindValue("test.panics", func() interface{} { panic("boom") }, Int64Type, InstantSemantics, OneUnit); err != nil {
+		t.Fatal(err)
+	}
+
+	// an expvar.Func can be bound as is
+	if err = c.BindValue("test.expvar", expvar.Func(func() interface{} { return 2.5 }), DoubleType, InstantSemantics, OneUnit); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if atomic.LoadInt64(&reported) != 1 {
+		t.Errorf("expected the panic to be reported once, got %v", atomic.LoadInt64(&reported))
+	}
+
+	if v := c.bindings.metrics["test.expvar"].(*PCPSingletonMetric).Val(); v != 2.5 {
+		t.Errorf("expected the expvar value to be 2.5, got %v", v)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.BindFunc("test.nil", nil, InstantSemantics, OneUnit); err == nil {
+		t.Error("expected an error binding a nil function")
+	}
+
+	if _, err = NewPCPClient("test", WithRefreshInterval(0)); err == nil {
+		t.Error("expected an error creating a client with a zero refresh interval")
+	}
+}
@@ -0,0 +1,161 @@
+package speed
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PCPBitField implements a metric storing status flags as the bits of a uint64 value.
+//
+// The meaning of the bits can optionally be passed on construction, in which case
+// it is appended to the long description of the metric as
+// "bits: 0=degraded, 1=read_only", so monitors can decode the flags.
+type PCPBitField struct {
+	*pcpSingletonMetric
+	mutex sync.RWMutex
+	bits  map[uint]string
+}
+
+// NewPCPBitField creates a new PCPBitField instance with an initial value and an
+// optional mapping of bit positions to their meanings.
+// Optionally it can also take a couple of description strings that are used as
+// short and long descriptions respectively.
+// Internally it creates a PCP SingletonMetric with Uint64Type, DiscreteSemantics
+// and OneUnit.
+func NewPCPBitField(val uint64, name string, bits map[uint]string, desc ...string) (*PCPBitField, error) {
+	d, err := newpcpMetricDesc(name, Uint64Type, DiscreteSemantics, OneUnit, desc...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bits) > 0 {
+		m := make(map[int]string, len(bits))
+		for n, meaning := range bits {
+			if n >= 64 {
+				return nil, errors.Errorf("bit %v is out of range for a 64 bit value", n)
+			}
+
+			m[int(n)] = meaning
+		}
+
+		d.longDescription = mappingHelp(d.longDescription, "bits", m)
+		if len(d.longDescription) >= StringLength {
+			return nil, errors.Errorf("the long description with the bit meanings is longer than %v", StringLength-1)
+		}
+	}
+
+	sm, err := newpcpSingletonMetric(val, d)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &PCPBitField{pcpSingletonMetric: sm, bits: make(map[uint]string, len(bits))}
+	for n, meaning := range bits {
+		b.bits[n] = meaning
+	}
+
+	return b, nil
+}
+
+// Bits returns the mapping of bit positions to their meanings.
+func (b *PCPBitField) Bits() map[uint]string {
+	ans := make(map[uint]string, len(b.bits))
+	for n, meaning := range b.bits {
+		ans[n] = meaning
+	}
+	return ans
+}
+
+// Val returns the current value of the bitfield.
+func (b *PCPBitField) Val() uint64 {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.val.(uint64)
+}
+
+// Set sets all the bits of the bitfield at once.
+func (b *PCPBitField) Set(val uint64) error {
+	if err := b.prepare(); err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.set(val)
+}
+
+// MustSet is a Set that panics on failure.
+func (b *PCPBitField) MustSet(val uint64) {
+	if err := b.Set(val); err != nil {
+		b.fail(err)
+	}
+}
+
+// SetBit sets the nth bit of the bitfield.
+func (b *PCPBitField) SetBit(n uint) error {
+	if err := b.prepare(); err != nil {
+		return err
+	}
+
+	if n >= 64 {
+		return errors.Errorf("bit %v is out of range for a 64 bit value", n)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.set(b.val.(uint64) | 1<<n)
+}
+
+// MustSetBit is a SetBit that panics on failure.
+func (b *PCPBitField) MustSetBit(n uint) {
+	if err := b.SetBit(n); err != nil {
+		b.fail(err)
+	}
+}
+
+// ClearBit clears the nth bit of the bitfield.
+func (b *PCPBitField) ClearBit(n uint) error {
+	if err := b.prepare(); err != nil {
+		return err
+	}
+
+	if n >= 64 {
+		return errors.Errorf("bit %v is out of range for a 64 bit value", n)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.set(b.val.(uint64) &^ (1 << n))
+}
+
+// MustClearBit is a ClearBit that panics on failure.
+func (b *PCPBitField) MustClearBit(n uint) {
+	if err := b.ClearBit(n); err != nil {
+		b.fail(err)
+	}
+}
+
+// TestBit returns true if the nth bit of the bitfield is set,
+// bits out of range are never set.
+func (b *PCPBitField) TestBit(n uint) bool {
+	if n >= 64 {
+		return false
+	}
+
+	return b.Val()&(1<<n) != 0
+}
+
+// Format implements fmt.Formatter, writing the value in hexadecimal.
+func (b *PCPBitField) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, b.name, func(plus bool) string {
+		return b.formatWith(fmt.Sprintf("%#x", b.Val()), plus)
+	})
+}
+
+func (b *PCPBitField) String() string { return fmt.Sprint(b) }
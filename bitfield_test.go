@@ -0,0 +1,53 @@
+package speed
+
+import (
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestBitField(t *testing.T) {
+	if _, err := NewPCPBitField(0, "test.flags", map[uint]string{64: "overflow"}); err == nil {
+		t.Error("expected an error mapping a bit out of range")
+	}
+
+	b, err := NewPCPBitField(0, "test.flags", map[uint]string{0: "degraded", 3: "read_only"}, "status flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if help := "bits: 0=degraded, 3=read_only"; b.LongDescription() != help {
+		t.Errorf("expected the long description to be %q, got %q", help, b.LongDescription())
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(b)
+	c.MustStart()
+	defer c.MustStop()
+
+	b.MustSetBit(0)
+	b.MustSetBit(3)
+	b.MustClearBit(0)
+
+	if err = b.SetBit(64); err == nil {
+		t.Error("expected an error setting a bit out of range")
+	}
+
+	if b.TestBit(0) || !b.TestBit(3) || b.TestBit(64) {
+		t.Errorf("expected only bit 3 to be set, got %b", b.Val())
+	}
+
+	_, _, m, v, _, _, _, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot create dump, error: %v", err)
+	}
+
+	off, _ := findMetric(b, m)
+	if _, val := findSingletonValue(off, v); val == nil || val.Val != 8 {
+		t.Errorf("expected the written value to be 8, got %v", val)
+	}
+}
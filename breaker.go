@@ -0,0 +1,136 @@
+package speed
+
+import (
+	"github.com/pkg/errors"
+)
+
+// BreakerState is an enumerated type for the states of a circuit breaker.
+type BreakerState int32
+
+// Possible values for a BreakerState
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var breakerLabels = map[int32]string{
+	int32(BreakerClosed):   "closed",
+	int32(BreakerOpen):     "open",
+	int32(BreakerHalfOpen): "half-open",
+}
+
+func (s BreakerState) String() string {
+	if l, ok := breakerLabels[int32(s)]; ok {
+		return l
+	}
+
+	return "unknown"
+}
+
+// BreakerReporter defines the calls circuit breaker libraries make to report
+// what their breakers do, for example from the OnStateChange callback of
+// sony/gobreaker, mapping the library's states to a BreakerState.
+type BreakerReporter interface {
+	// reports that the named breaker changed state
+	StateChanged(name string, from, to BreakerState) error
+
+	// reports that the named breaker rejected a call
+	Rejected(name string) error
+}
+
+// CircuitBreakerAdapter is a BreakerReporter exporting per breaker the current state
+// as "<prefix>.state", with the states mapped as 0=closed, 1=open and 2=half-open
+// like a PCPEnum, the number of times the breaker tripped open as "<prefix>.trips",
+// and the number of calls it rejected as "<prefix>.rejected", so all services
+// export their breakers under the same names.
+//
+// The breakers have to be declared on construction, as instances cannot be added
+// once a mapping is active.
+type CircuitBreakerAdapter struct {
+	state           *PCPInstanceMetric
+	trips, rejected *PCPCounterVector
+}
+
+// NewCircuitBreakerAdapter creates a new CircuitBreakerAdapter for the passed breakers,
+// all initially closed, with all metrics under the passed prefix.
+func NewCircuitBreakerAdapter(prefix string, breakers ...string) (*CircuitBreakerAdapter, error) {
+	if prefix == "" {
+		return nil, errors.New("circuit breaker adapter prefix cannot be empty")
+	}
+
+	if len(breakers) == 0 {
+		return nil, errors.New("circuit breaker adapter needs at least one breaker")
+	}
+
+	indom, err := NewPCPInstanceDomain(prefix+".breaker.indom", breakers, "circuit breakers")
+	if err != nil {
+		return nil, err
+	}
+
+	a := &CircuitBreakerAdapter{}
+	if a.state, err = NewPCPInstanceMetric(
+		zeroInstances(breakers, int32(BreakerClosed)), prefix+".state",
+		indom, Int32Type, DiscreteSemantics, OneUnit,
+		"current state of the circuit breaker", enumHelp("", breakerLabels),
+	); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(breakers))
+	for _, b := range breakers {
+		counts[b] = 0
+	}
+
+	if a.trips, err = NewPCPCounterVector(counts, prefix+".trips", "number of times the circuit breaker opened"); err != nil {
+		return nil, err
+	}
+
+	if a.rejected, err = NewPCPCounterVector(counts, prefix+".rejected", "number of calls rejected by the circuit breaker"); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Metrics returns all the metrics exported by the adapter.
+func (a *CircuitBreakerAdapter) Metrics() []Metric {
+	return []Metric{a.state, a.trips, a.rejected}
+}
+
+// Register registers all metrics of the adapter with the passed client.
+func (a *CircuitBreakerAdapter) Register(c Client) error {
+	for _, m := range a.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StateChanged records the new state of a breaker, counting a trip if it opened.
+func (a *CircuitBreakerAdapter) StateChanged(name string, from, to BreakerState) error {
+	if _, ok := breakerLabels[int32(to)]; !ok {
+		return errors.Errorf("invalid circuit breaker state %v", int32(to))
+	}
+
+	if !a.state.Indom().HasInstance(name) {
+		return errors.Errorf("%v is not a declared circuit breaker", name)
+	}
+
+	if err := a.state.SetInstance(int32(to), name); err != nil {
+		return err
+	}
+
+	if to == BreakerOpen && from != BreakerOpen {
+		return a.trips.Inc(1, name)
+	}
+
+	return nil
+}
+
+// Rejected records a call rejected by a breaker.
+func (a *CircuitBreakerAdapter) Rejected(name string) error {
+	return a.rejected.Inc(1, name)
+}
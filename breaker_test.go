@@ -0,0 +1,73 @@
+package speed
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCircuitBreakerAdapter(t *testing.T) {
+	a, err := NewCircuitBreakerAdapter("test.breakers", "db", "payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var _ BreakerReporter = a
+
+	if !strings.HasSuffix(a.state.LongDescription(), "values: 0=closed, 1=open, 2=half-open") {
+		t.Errorf("expected the states in the long description, got %q", a.state.LongDescription())
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	for _, s := range [][2]BreakerState{
+		{BreakerClosed, BreakerOpen},
+		{BreakerOpen, BreakerHalfOpen},
+		{BreakerHalfOpen, BreakerOpen},
+	} {
+		if err = a.StateChanged("db", s[0], s[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = a.Rejected("db"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := a.state.ValInstance("db"); v.(int32) != int32(BreakerOpen) {
+		t.Errorf("expected db to be open, got %v", v)
+	}
+
+	if v, _ := a.trips.Val("db"); v != 2 {
+		t.Errorf("expected db to trip twice, got %v", v)
+	}
+
+	if v, _ := a.rejected.Val("db"); v != 1 {
+		t.Errorf("expected 1 rejected call, got %v", v)
+	}
+
+	if v, _ := a.state.ValInstance("payments"); v.(int32) != int32(BreakerClosed) {
+		t.Errorf("expected payments to be closed, got %v", v)
+	}
+
+	if err = a.StateChanged("unknown", BreakerClosed, BreakerOpen); err == nil {
+		t.Error("expected an error for an undeclared breaker")
+	}
+
+	if err = a.StateChanged("db", BreakerOpen, BreakerState(7)); err == nil {
+		t.Error("expected an error for an invalid state")
+	}
+
+	if BreakerHalfOpen.String() != "half-open" {
+		t.Errorf("unexpected label %v", BreakerHalfOpen)
+	}
+}
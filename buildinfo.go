@@ -0,0 +1,82 @@
+//go:build go1.18
+// +build go1.18
+
+package speed
+
+import (
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+)
+
+// RegisterBuildInfo registers discrete metrics describing the running binary with the
+// passed client, so dashboards can correlate performance with deployed versions:
+//
+// - build.module_version: the version of the main module
+//
+// - build.vcs_revision: the version control revision the binary was built from
+//
+// - build.vcs_time: the time of that revision, in RFC3339 format
+//
+// - build.vcs_modified: 1 if the working tree had local modifications, otherwise 0
+//
+// - build.go_version: the version of go the binary was built with
+//
+// Values missing from the build info, for example when built outside of
+// version control, are exported as empty strings.
+func RegisterBuildInfo(c Client) error {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return errors.New("build info is not available in this binary")
+	}
+
+	metrics, err := newBuildInfoMetrics(info)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newBuildInfoMetrics(info *debug.BuildInfo) ([]Metric, error) {
+	settings := make(map[string]string)
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+
+	modified := uint32(0)
+	if settings["vcs.modified"] == "true" {
+		modified = 1
+	}
+
+	var ans []Metric
+
+	for _, s := range []struct{ name, val, desc string }{
+		{"module_version", info.Main.Version, "version of the main module"},
+		{"vcs_revision", settings["vcs.revision"], "version control revision of the build"},
+		{"vcs_time", settings["vcs.time"], "time of the version control revision"},
+		{"go_version", info.GoVersion, "go version used for the build"},
+	} {
+		m, err := NewPCPSingletonMetric(s.val, "build."+s.name, StringType, DiscreteSemantics, OneUnit, s.desc)
+		if err != nil {
+			return nil, err
+		}
+		ans = append(ans, m)
+	}
+
+	m, err := NewPCPSingletonMetric(
+		modified, "build.vcs_modified", Uint32Type, DiscreteSemantics, OneUnit,
+		"whether the build had local modifications",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ans, m), nil
+}
@@ -0,0 +1,57 @@
+//go:build go1.18
+// +build go1.18
+
+package speed
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildInfoMetrics(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.18",
+		Main:      debug.Module{Path: "example.com/app", Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "abcdef"},
+			{Key: "vcs.time", Value: "2022-03-15T10:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	metrics, err := newBuildInfoMetrics(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"build.module_version": "v1.2.3",
+		"build.vcs_revision":   "abcdef",
+		"build.vcs_time":       "2022-03-15T10:00:00Z",
+		"build.go_version":     "go1.18",
+		"build.vcs_modified":   uint32(1),
+	}
+
+	if len(metrics) != len(expected) {
+		t.Fatalf("expected %v metrics, got %v", len(expected), len(metrics))
+	}
+
+	for _, m := range metrics {
+		if v := m.(*PCPSingletonMetric).Val(); v != expected[m.Name()] {
+			t.Errorf("expected %v to be %v, got %v", m.Name(), expected[m.Name()], v)
+		}
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = RegisterBuildInfo(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Registry().HasMetric("build.go_version") {
+		t.Error("expected the build info to be registered")
+	}
+}
@@ -3,6 +3,9 @@ package bytewriter
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
+	"sync/atomic"
+	"unsafe"
 
 	"github.com/pkg/errors"
 )
@@ -55,11 +58,32 @@ func (w *ByteWriter) MustWrite(data []byte, offset int) int {
 }
 
 // WriteVal writes an arbitrary value to the buffer
+//
+// 32 and 64 bit values at offsets aligned to their size are written with a
+// single atomic store, so a concurrent reader, including another process
+// reading a mapped file, never sees a partially written value, and sees
+// all writes made before it.
 func (w *ByteWriter) WriteVal(val interface{}, offset int) (int, error) {
 	if s, isString := val.(string); isString {
 		return w.WriteString(s, offset)
 	}
 
+	// the fixed size numeric types take the fast path, without encoding/binary
+	switch v := val.(type) {
+	case int32:
+		return w.writeUint32(uint32(v), offset)
+	case uint32:
+		return w.writeUint32(v, offset)
+	case float32:
+		return w.writeUint32(math.Float32bits(v), offset)
+	case int64:
+		return w.writeUint64(uint64(v), offset)
+	case uint64:
+		return w.writeUint64(v, offset)
+	case float64:
+		return w.writeUint64(math.Float64bits(v), offset)
+	}
+
 	buf := bytes.NewBuffer(make([]byte, 0))
 
 	err := binary.Write(buf, byteOrder, val)
@@ -70,6 +94,63 @@ func (w *ByteWriter) WriteVal(val interface{}, offset int) (int, error) {
 	return w.Write(buf.Bytes(), offset)
 }
 
+// WriteUint64At writes a uint64 at offset, with a single atomic store if the offset
+// is aligned to 8 bytes. It is the fast path for writing 64 bit values, which
+// does not allocate.
+func (w *ByteWriter) WriteUint64At(offset int, val uint64) error {
+	if offset < 0 || offset+8 > w.Len() {
+		return errors.Errorf("cannot write 8 bytes at offset %v", offset)
+	}
+
+	p := unsafe.Pointer(&w.buffer[offset])
+	if uintptr(p)%8 != 0 {
+		byteOrder.PutUint64(w.buffer[offset:], val)
+		return nil
+	}
+
+	// stored as the bytes of the encoded value, whatever order the machine loads them in
+	var v uint64
+	byteOrder.PutUint64((*[8]byte)(unsafe.Pointer(&v))[:], val)
+	atomic.StoreUint64((*uint64)(p), v)
+
+	return nil
+}
+
+// WriteUint32At writes a uint32 at offset, with a single atomic store if the offset
+// is aligned to 4 bytes. It is the fast path for writing 32 bit values, which
+// does not allocate.
+func (w *ByteWriter) WriteUint32At(offset int, val uint32) error {
+	if offset < 0 || offset+4 > w.Len() {
+		return errors.Errorf("cannot write 4 bytes at offset %v", offset)
+	}
+
+	p := unsafe.Pointer(&w.buffer[offset])
+	if uintptr(p)%4 != 0 {
+		byteOrder.PutUint32(w.buffer[offset:], val)
+		return nil
+	}
+
+	var v uint32
+	byteOrder.PutUint32((*[4]byte)(unsafe.Pointer(&v))[:], val)
+	atomic.StoreUint32((*uint32)(p), v)
+
+	return nil
+}
+
+func (w *ByteWriter) writeUint32(val uint32, offset int) (int, error) {
+	if err := w.WriteUint32At(offset, val); err != nil {
+		return -1, err
+	}
+	return offset + 4, nil
+}
+
+func (w *ByteWriter) writeUint64(val uint64, offset int) (int, error) {
+	if err := w.WriteUint64At(offset, val); err != nil {
+		return -1, err
+	}
+	return offset + 8, nil
+}
+
 // MustWriteVal panics if WriteVal fails
 func (w *ByteWriter) MustWriteVal(val interface{}, offset int) int {
 	if off, err := w.WriteVal(val, offset); err != nil {
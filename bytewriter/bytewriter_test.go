@@ -1,6 +1,10 @@
 package bytewriter
 
-import "testing"
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
 
 func TestWriteInt32(t *testing.T) {
 	cases := []int32{0, 10, 100, 200, 1000, 10000, 10000000, 1000000000, 2147483647}
@@ -126,3 +130,109 @@ func TestOffset(t *testing.T) {
 		return
 	}
 }
+
+func TestWriteValAtomic(t *testing.T) {
+	w := NewByteWriter(16)
+
+	// aligned 64 bit values are stored atomically
+	off, err := w.WriteVal(uint64(0x0102030405060708), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if off != 16 {
+		t.Errorf("expected to write up to 16, got %v", off)
+	}
+
+	// unaligned values fall back to plain writes
+	if _, err = w.WriteVal(uint32(0x0a0b0c0d), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0, 0x0d, 0x0c, 0x0b, 0x0a, 0, 0, 0, 8, 7, 6, 5, 4, 3, 2, 1}
+	for i, b := range expected {
+		if w.buffer[i] != b {
+			t.Errorf("pos: %v, expected: %v, got %v", i, b, w.buffer[i])
+		}
+	}
+
+	if _, err = w.WriteVal(uint64(1), 12); err == nil {
+		t.Error("expected an error writing past the end")
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	w := NewByteWriter(16)
+
+	if err := w.WriteUint64At(0, 0x0102030405060708); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteUint32At(9, 0x0a0b0c0d); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{8, 7, 6, 5, 4, 3, 2, 1, 0, 0x0d, 0x0c, 0x0b, 0x0a, 0, 0, 0}
+	for i, b := range expected {
+		if w.buffer[i] != b {
+			t.Errorf("pos: %v, expected: %v, got %v", i, b, w.buffer[i])
+		}
+	}
+
+	if err := w.WriteUint64At(9, 1); err == nil {
+		t.Error("expected an error writing past the end")
+	}
+
+	if err := w.WriteUint32At(-1, 1); err == nil {
+		t.Error("expected an error writing at a negative offset")
+	}
+}
+
+func TestWriteValFloat(t *testing.T) {
+	w := NewByteWriter(12)
+
+	off, err := w.WriteVal(float32(1.5), 0)
+	if err != nil || off != 4 {
+		t.Fatalf("expected to write up to 4, got %v, %v", off, err)
+	}
+
+	off, err = w.WriteVal(-2.25, off)
+	if err != nil || off != 12 {
+		t.Fatalf("expected to write up to 12, got %v, %v", off, err)
+	}
+
+	if v := math.Float32frombits(binary.LittleEndian.Uint32(w.buffer[0:])); v != 1.5 {
+		t.Errorf("expected 1.5, got %v", v)
+	}
+
+	if v := math.Float64frombits(binary.LittleEndian.Uint64(w.buffer[4:])); v != -2.25 {
+		t.Errorf("expected -2.25, got %v", v)
+	}
+}
+
+func BenchmarkWriteVal(b *testing.B) {
+	w := NewByteWriter(8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = w.WriteVal(uint64(i), 0)
+	}
+}
+
+func BenchmarkWriteValBinary(b *testing.B) {
+	// a type without a fast path, that goes through encoding/binary
+	type value struct{ V uint64 }
+
+	w := NewByteWriter(8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = w.WriteVal(value{uint64(i)}, 0)
+	}
+}
+
+func BenchmarkWriteUint64At(b *testing.B) {
+	w := NewByteWriter(8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = w.WriteUint64At(0, uint64(i))
+	}
+}
@@ -77,3 +77,8 @@ func (b *MemoryMappedWriter) Unmap(removefile bool) error {
 
 	return nil
 }
+
+// Flush synchronously writes the contents of the mapping to the file on disk
+func (b *MemoryMappedWriter) Flush() error {
+	return mmap.MMap(b.buffer).Flush()
+}
@@ -0,0 +1,125 @@
+package bytewriter
+
+import "github.com/pkg/errors"
+
+// Section describes a block of fixed size records in a file composed by a Builder
+type Section struct {
+	Name  string
+	Count int // number of records in the section
+	Size  int // size of a single record in bytes
+	Align int // alignment of the start of the section, 0 or 1 for none
+
+	// Offset is resolved by the Builder when the section is added
+	Offset int
+}
+
+// Len returns the size of the section in bytes
+func (s Section) Len() int { return s.Count * s.Size }
+
+// End returns the offset right after the section
+func (s Section) End() int { return s.Offset + s.Len() }
+
+// Record returns the offset of the i'th record in the section
+func (s Section) Record(i int) (int, error) {
+	if i < 0 || i >= s.Count {
+		return -1, errors.Errorf("section %v has %v records, cannot get record %v", s.Name, s.Count, i)
+	}
+
+	return s.Offset + i*s.Size, nil
+}
+
+// Builder composes a file from sections laid out one after the other in the order
+// they are added, resolving the offset of each section, so users of the file
+// never need to add up section sizes themselves.
+type Builder struct {
+	sections []Section
+	index    map[string]int
+	length   int
+}
+
+// NewBuilder creates a new Builder with the passed sections
+func NewBuilder(sections ...Section) (*Builder, error) {
+	b := &Builder{index: make(map[string]int)}
+
+	for _, s := range sections {
+		if _, err := b.Add(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Add adds a section at the end of the file, padding the file up to the alignment
+// of the section, and returns the section with its offset resolved
+func (b *Builder) Add(s Section) (Section, error) {
+	if s.Name == "" {
+		return Section{}, errors.New("section name cannot be empty")
+	}
+
+	if _, present := b.index[s.Name]; present {
+		return Section{}, errors.Errorf("section %v is already present", s.Name)
+	}
+
+	if s.Count < 0 || s.Size < 0 {
+		return Section{}, errors.Errorf("section %v cannot have %v records of %v bytes", s.Name, s.Count, s.Size)
+	}
+
+	if s.Align < 0 || (s.Align > 1 && s.Align&(s.Align-1) != 0) {
+		return Section{}, errors.Errorf("alignment of section %v must be a power of 2, got %v", s.Name, s.Align)
+	}
+
+	s.Offset = b.length
+	if s.Align > 1 {
+		s.Offset = (s.Offset + s.Align - 1) &^ (s.Align - 1)
+	}
+
+	b.index[s.Name] = len(b.sections)
+	b.sections = append(b.sections, s)
+	b.length = s.End()
+
+	return s, nil
+}
+
+// MustAdd panics if Add fails
+func (b *Builder) MustAdd(s Section) Section {
+	s, err := b.Add(s)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Section returns the section with the passed name
+func (b *Builder) Section(name string) (Section, bool) {
+	i, present := b.index[name]
+	if !present {
+		return Section{}, false
+	}
+
+	return b.sections[i], true
+}
+
+// Offset returns the offset of the section with the passed name, or -1 if there is
+// no such section
+func (b *Builder) Offset(name string) int {
+	s, present := b.Section(name)
+	if !present {
+		return -1
+	}
+
+	return s.Offset
+}
+
+// Sections returns all sections in the order they are laid out
+func (b *Builder) Sections() []Section {
+	ans := make([]Section, len(b.sections))
+	copy(ans, b.sections)
+	return ans
+}
+
+// Len returns the size of the composed file in bytes
+func (b *Builder) Len() int { return b.length }
+
+// NewWriter creates a ByteWriter large enough for the composed file
+func (b *Builder) NewWriter() *ByteWriter { return NewByteWriter(b.length) }
@@ -0,0 +1,83 @@
+package bytewriter
+
+import "testing"
+
+func TestBuilder(t *testing.T) {
+	b, err := NewBuilder(
+		Section{Name: "header", Count: 1, Size: 5},
+		Section{Name: "values", Count: 3, Size: 8, Align: 8},
+		Section{Name: "empty", Count: 0, Size: 16, Align: 8},
+		Section{Name: "strings", Count: 2, Size: 3},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		offset, end int
+	}{
+		{"header", 0, 5},
+		{"values", 8, 32},
+		{"empty", 32, 32},
+		{"strings", 32, 38},
+	}
+
+	for _, c := range cases {
+		s, ok := b.Section(c.name)
+		if !ok {
+			t.Errorf("expected section %v", c.name)
+			continue
+		}
+
+		if s.Offset != c.offset || s.End() != c.end {
+			t.Errorf("expected section %v at [%v, %v), got [%v, %v)", c.name, c.offset, c.end, s.Offset, s.End())
+		}
+	}
+
+	if b.Len() != 38 {
+		t.Errorf("expected a length of 38, got %v", b.Len())
+	}
+
+	if b.NewWriter().Len() != 38 {
+		t.Errorf("expected a writer of 38 bytes")
+	}
+
+	if off := b.Offset("none"); off != -1 {
+		t.Errorf("expected -1 for a missing section, got %v", off)
+	}
+
+	if names := b.Sections(); len(names) != 4 || names[3].Name != "strings" {
+		t.Errorf("expected the sections in order, got %v", names)
+	}
+
+	s, _ := b.Section("values")
+	if off, err := s.Record(2); err != nil || off != 24 {
+		t.Errorf("expected the third value at 24, got %v, %v", off, err)
+	}
+
+	if _, err := s.Record(3); err == nil {
+		t.Error("expected an error getting a record past the end")
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	b, _ := NewBuilder(Section{Name: "header", Count: 1, Size: 8})
+
+	cases := []Section{
+		{Name: "", Count: 1, Size: 1},
+		{Name: "header", Count: 1, Size: 1},
+		{Name: "negative", Count: -1, Size: 1},
+		{Name: "unaligned", Count: 1, Size: 1, Align: 3},
+	}
+
+	for _, s := range cases {
+		if _, err := b.Add(s); err == nil {
+			t.Errorf("expected an error adding %+v", s)
+		}
+	}
+
+	if b.Len() != 8 {
+		t.Errorf("expected failed adds to leave the length at 8, got %v", b.Len())
+	}
+}
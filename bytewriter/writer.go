@@ -38,6 +38,9 @@ type Writer interface {
 	WriteFloat32(float32, int) (int, error)
 	WriteFloat64(float64, int) (int, error)
 
+	WriteUint32At(offset int, val uint32) error
+	WriteUint64At(offset int, val uint64) error
+
 	MustWrite([]byte, int) int
 	MustWriteVal(interface{}, int) int
 	MustWriteString(string, int) int
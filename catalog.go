@@ -0,0 +1,166 @@
+package speed
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/performancecopilot/speed/mmvdump"
+	"github.com/pkg/errors"
+)
+
+// CatalogEntry is a machine readable description of a metric,
+// for generating documentation or validating dashboards.
+type CatalogEntry struct {
+	Name      string           `json:"name"`
+	Type      MetricType       `json:"type"`
+	Semantics MetricSemantics  `json:"semantics"`
+	Unit      string           `json:"unit"`
+	ShortHelp string           `json:"short_help,omitempty"`
+	LongHelp  string           `json:"long_help,omitempty"`
+	Indom     *CatalogIndom    `json:"indom,omitempty"`
+	Values    map[int32]string `json:"values,omitempty"` // labels of the values of a PCPEnum
+}
+
+// CatalogIndom describes the instance domain of a metric in a CatalogEntry.
+type CatalogIndom struct {
+	ID        uint32   `json:"id"`
+	Name      string   `json:"name,omitempty"` // not available when read from an MMV file
+	Instances []string `json:"instances"`
+}
+
+// Catalog returns a description of all metrics in the registry, sorted by name.
+func (r *PCPRegistry) Catalog() []CatalogEntry {
+	r.metricslock.RLock()
+	defer r.metricslock.RUnlock()
+
+	ans := make([]CatalogEntry, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		e := CatalogEntry{
+			Name:      m.Name(),
+			Type:      m.Type(),
+			Semantics: m.Semantics(),
+			Unit:      m.Unit().String(),
+			ShortHelp: m.ShortDescription(),
+			LongHelp:  m.LongDescription(),
+		}
+
+		if indom := m.Indom(); indom != nil {
+			instances := indom.Instances()
+			sort.Strings(instances)
+			e.Indom = &CatalogIndom{indom.ID(), indom.Name(), instances}
+		}
+
+		if enum, ok := m.(*PCPEnum); ok {
+			e.Values = enum.Labels()
+		}
+
+		ans = append(ans, e)
+	}
+
+	sort.Slice(ans, func(i, j int) bool { return ans[i].Name < ans[j].Name })
+	return ans
+}
+
+// ReadCatalog returns a description of all metrics in the passed MMV file contents,
+// sorted by name.
+func ReadCatalog(data []byte) ([]CatalogEntry, error) {
+	_, _, metrics, _, instances, indoms, strs, err := mmvdump.Dump(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the MMV file")
+	}
+
+	indomsBySerial := make(map[uint32]*CatalogIndom)
+	for off, indom := range indoms {
+		ci := &CatalogIndom{ID: indom.Serial}
+		for _, i := range instances {
+			if i.Indom() != off {
+				continue
+			}
+
+			ci.Instances = append(ci.Instances, instanceName(i, strs))
+		}
+
+		sort.Strings(ci.Instances)
+		indomsBySerial[indom.Serial] = ci
+	}
+
+	ans := make([]CatalogEntry, 0, len(metrics))
+	for _, m := range metrics {
+		e := CatalogEntry{
+			Name:      metricName(m, strs),
+			Type:      MetricType(m.Typ()),
+			Semantics: MetricSemantics(m.Sem()),
+			Unit:      unitFromPMAPI(uint32(m.Unit())).String(),
+			ShortHelp: mmvString(strs, m.ShortText()),
+			LongHelp:  mmvString(strs, m.LongText()),
+		}
+
+		if e.Type == Int32Type && e.Semantics == DiscreteSemantics {
+			e.Values = parseEnumHelp(e.LongHelp)
+		}
+
+		if m.Indom() != mmvdump.NoIndom {
+			indom, ok := indomsBySerial[uint32(m.Indom())]
+			if !ok {
+				return nil, errors.Errorf("metric %v has an unknown instance domain %v", e.Name, m.Indom())
+			}
+			e.Indom = indom
+		}
+
+		ans = append(ans, e)
+	}
+
+	sort.Slice(ans, func(i, j int) bool { return ans[i].Name < ans[j].Name })
+	return ans, nil
+}
+
+// mmvString returns the string at the passed offset of an MMV file,
+// or a blank string for a 0 or unknown offset
+func mmvString(strs map[uint64]*mmvdump.String, off uint64) string {
+	if off == 0 {
+		return ""
+	}
+
+	s, ok := strs[off]
+	if !ok {
+		return ""
+	}
+
+	return cString(s.Payload[:])
+}
+
+// metricName returns the name of a metric read from an MMV file of either version
+func metricName(m mmvdump.Metric, strs map[uint64]*mmvdump.String) string {
+	if m1, ok := m.(*mmvdump.Metric1); ok {
+		return cString(m1.Name[:])
+	}
+
+	return mmvString(strs, m.(*mmvdump.Metric2).Name)
+}
+
+// instanceName returns the name of an instance read from an MMV file of either version
+func instanceName(i mmvdump.Instance, strs map[uint64]*mmvdump.String) string {
+	if i1, ok := i.(*mmvdump.Instance1); ok {
+		return cString(i1.External[:])
+	}
+
+	return mmvString(strs, i.(*mmvdump.Instance2).External)
+}
+
+// cString returns the contents of a null terminated string
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// unitFromPMAPI creates a MetricUnit from its PMAPI representation,
+// returning the plain constants for simple units, like ParseUnit
+func unitFromPMAPI(repr uint32) MetricUnit {
+	d := decodeUnit(&metricUnit{repr})
+	return newParsedUnit(
+		[3]int8{d.spaceDim, d.timeDim, d.countDim},
+		[3]int8{d.spaceScale, d.timeScale, d.countScale},
+	)
+}
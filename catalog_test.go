@@ -0,0 +1,66 @@
+package speed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter", "a counter", "a counter for testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indom, err := NewPCPInstanceDomain("test.indom", []string{"b", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rate, err := NewPCPInstanceMetric(
+		Instances{"a": 1.0, "b": 2.0}, "test.rate", indom,
+		DoubleType, InstantSemantics, MegabyteUnit.Time(SecondUnit, -1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a long name makes the client write MMV version 2
+	long, err := NewPCPSingletonMetric(int32(0), "test."+strings.Repeat("x", MaxV1NameLength), Int32Type, DiscreteSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []Metric{counter, rate, long} {
+		c.MustRegister(m)
+	}
+
+	expected := []CatalogEntry{
+		{"test.counter", Int64Type, CounterSemantics, "OneUnit", "a counter", "a counter for testing", nil, nil},
+		{"test.rate", DoubleType, InstantSemantics, "MegabyteUnit^1SecondUnit^-1", "", "", &CatalogIndom{indom.ID(), "test.indom", []string{"a", "b"}}, nil},
+		{long.Name(), Int32Type, DiscreteSemantics, "OneUnit", "", "", nil, nil},
+	}
+
+	if catalog := c.Registry().Catalog(); !reflect.DeepEqual(catalog, expected) {
+		t.Errorf("expected catalog %+v, got %+v", expected, catalog)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	catalog, err := ReadCatalog(c.writer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// instance domain names are not written to MMV files
+	expected[1].Indom.Name = ""
+	if !reflect.DeepEqual(catalog, expected) {
+		t.Errorf("expected catalog %+v, got %+v", expected, catalog)
+	}
+}
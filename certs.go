@@ -0,0 +1,213 @@
+package speed
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CertExpiryInterval is the interval certificate expiry is meant to be collected at,
+// see RegisterCollector.
+const CertExpiryInterval = 24 * time.Hour
+
+// CertExpiryCollector is a Collector exporting the number of days until certificates
+// expire as "<prefix>.days_remaining", with an instance for every certificate.
+// The value goes negative once a certificate has expired.
+//
+// Certificate files are read again on every collection, so renewed certificates
+// are picked up. If a certificate cannot be read, its value is left unchanged,
+// and the error is available from Err.
+type CertExpiryCollector struct {
+	prefix    string
+	instances []string
+
+	// returns the certificate of an instance
+	certs map[string]func() (*x509.Certificate, error)
+
+	mutex sync.Mutex
+	err   error
+
+	now func() time.Time
+}
+
+// NewCertExpiryCollector creates a new CertExpiryCollector for the PEM encoded
+// certificate files at the passed paths, which also name the instances.
+// Only the first certificate in every file is considered.
+func NewCertExpiryCollector(prefix string, files ...string) (*CertExpiryCollector, error) {
+	if len(files) == 0 {
+		return nil, errors.New("certificate expiry collector needs at least one file")
+	}
+
+	col, err := newCertExpiryCollector(prefix, len(files))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if _, ok := col.certs[f]; ok {
+			return nil, errors.Errorf("certificate file %v passed twice", f)
+		}
+
+		col.add(f, readCertFile(f))
+	}
+
+	return col, nil
+}
+
+// NewTLSConfigExpiryCollector creates a new CertExpiryCollector for the certificates
+// of the passed configuration, named by the common name or first DNS name of the
+// certificate, or its index in the configuration if it has neither.
+//
+// The certificates are looked up by index on every collection, so replacing
+// a certificate in the configuration is picked up, adding one is not.
+func NewTLSConfigExpiryCollector(prefix string, config *tls.Config) (*CertExpiryCollector, error) {
+	if config == nil || len(config.Certificates) == 0 {
+		return nil, errors.New("certificate expiry collector needs a configuration with certificates")
+	}
+
+	col, err := newCertExpiryCollector(prefix, len(config.Certificates))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range config.Certificates {
+		cert, err := leaf(&config.Certificates[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse certificate %v", i)
+		}
+
+		name := certName(cert, i)
+		if _, ok := col.certs[name]; ok {
+			name = strconv.Itoa(i)
+		}
+
+		col.add(name, configCert(config, i))
+	}
+
+	return col, nil
+}
+
+func newCertExpiryCollector(prefix string, n int) (*CertExpiryCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("certificate expiry collector prefix cannot be empty")
+	}
+
+	return &CertExpiryCollector{
+		prefix:    prefix,
+		instances: make([]string, 0, n),
+		certs:     make(map[string]func() (*x509.Certificate, error), n),
+		now:       time.Now,
+	}, nil
+}
+
+func (col *CertExpiryCollector) add(instance string, cert func() (*x509.Certificate, error)) {
+	col.instances = append(col.instances, instance)
+	col.certs[instance] = cert
+}
+
+// readCertFile returns a function reading the first certificate of a PEM file
+func readCertFile(file string) func() (*x509.Certificate, error) {
+	return func() (*x509.Certificate, error) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			var block *pem.Block
+			if block, data = pem.Decode(data); block == nil {
+				return nil, errors.Errorf("no certificate found in %v", file)
+			}
+
+			if block.Type == "CERTIFICATE" {
+				return x509.ParseCertificate(block.Bytes)
+			}
+		}
+	}
+}
+
+// configCert returns a function returning the certificate at an index of a configuration
+func configCert(config *tls.Config, i int) func() (*x509.Certificate, error) {
+	return func() (*x509.Certificate, error) {
+		if i >= len(config.Certificates) {
+			return nil, errors.Errorf("certificate %v was removed from the configuration", i)
+		}
+
+		return leaf(&config.Certificates[i])
+	}
+}
+
+// leaf returns the parsed leaf of a certificate chain
+func leaf(c *tls.Certificate) (*x509.Certificate, error) {
+	if c.Leaf != nil {
+		return c.Leaf, nil
+	}
+
+	if len(c.Certificate) == 0 {
+		return nil, errors.New("empty certificate chain")
+	}
+
+	return x509.ParseCertificate(c.Certificate[0])
+}
+
+// certName names a certificate by its subject
+func certName(cert *x509.Certificate, i int) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+
+	return strconv.Itoa(i)
+}
+
+// Describe describes the metric exported by the collector.
+func (col *CertExpiryCollector) Describe(ch chan<- Desc) {
+	ch <- Desc{
+		Name:      col.prefix + ".days_remaining",
+		Type:      DoubleType,
+		Semantics: InstantSemantics,
+		Unit:      OneUnit,
+		Instances: col.instances,
+		ShortHelp: "number of days until the certificate expires",
+	}
+}
+
+// Collect records the number of days until every certificate expires.
+func (col *CertExpiryCollector) Collect(r Recorder) {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	col.err = nil
+	now := col.now()
+
+	for _, i := range col.instances {
+		cert, err := col.certs[i]()
+		if err != nil {
+			col.err = errors.Wrapf(err, "cannot read certificate %v", i)
+			continue
+		}
+
+		days := cert.NotAfter.Sub(now).Hours() / 24
+		if err := r.RecordInstance(col.prefix+".days_remaining", i, days); err != nil {
+			col.err = err
+		}
+	}
+}
+
+// Err returns the last error encountered reading a certificate during the
+// last collection, or nil if all certificates were read.
+func (col *CertExpiryCollector) Err() error {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	return col.err
+}
@@ -0,0 +1,139 @@
+package speed
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert creates a self signed certificate for name, expiring at notAfter
+func testCert(t *testing.T, name string, notAfter time.Time) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertExpiryCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	file := filepath.Join(dir, "cert.pem")
+	cert := testCert(t, "example.com", now.Add(30*24*time.Hour))
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	if err = ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := filepath.Join(dir, "missing.pem")
+
+	if _, err = NewCertExpiryCollector("test.certs", file, file); err == nil {
+		t.Error("expected an error passing a file twice")
+	}
+
+	col, err := NewCertExpiryCollector("test.certs", file, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.now = func() time.Time { return now }
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.RegisterCollector(col, CertExpiryInterval); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	m := c.r.metrics["test.certs.days_remaining"].(*PCPInstanceMetric)
+	if v, _ := m.ValInstance(file); v.(float64) != 30 {
+		t.Errorf("expected 30 days remaining, got %v", v)
+	}
+
+	if col.Err() == nil {
+		t.Error("expected an error for the missing certificate file")
+	}
+
+	col.now = func() time.Time { return now.Add(31 * 24 * time.Hour) }
+	col.Collect(c.collectors[0])
+	if v, _ := m.ValInstance(file); v.(float64) != -1 {
+		t.Errorf("expected the certificate to have expired a day ago, got %v", v)
+	}
+}
+
+func TestTLSConfigExpiryCollector(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	config := &tls.Config{Certificates: []tls.Certificate{
+		testCert(t, "a.example.com", now.Add(10*24*time.Hour)),
+		testCert(t, "a.example.com", now.Add(20*24*time.Hour)),
+	}}
+
+	col, err := NewTLSConfigExpiryCollector("test.tls", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.now = func() time.Time { return now }
+
+	if len(col.instances) != 2 || col.instances[0] != "a.example.com" || col.instances[1] != "1" {
+		t.Fatalf("unexpected instances %v", col.instances)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.RegisterCollector(col, CertExpiryInterval); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	m := c.r.metrics["test.tls.days_remaining"].(*PCPInstanceMetric)
+	for i, expected := range map[string]float64{"a.example.com": 10, "1": 20} {
+		if v, _ := m.ValInstance(i); v.(float64) != expected {
+			t.Errorf("expected %v days remaining for %v, got %v", expected, i, v)
+		}
+	}
+
+	if col.Err() != nil {
+		t.Error(col.Err())
+	}
+
+	if _, err = NewTLSConfigExpiryCollector("test.tls", &tls.Config{}); err == nil {
+		t.Error("expected an error for a configuration without certificates")
+	}
+}
@@ -0,0 +1,121 @@
+package speed
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// cgroupStats is a snapshot of the limits and cpu throttling of the cgroup of the current process
+type cgroupStats struct {
+	cpuQuota, cpuPeriod int64  // cfs quota and period in microseconds, the quota is -1 if unlimited
+	memoryLimit         int64  // memory limit in bytes, -1 if unlimited
+	periods, throttled  uint64 // elapsed and throttled cfs periods
+	throttledTime       uint64 // total time throttled in nanoseconds
+}
+
+// CgroupCollector is a Collector exporting GOMAXPROCS along with the cpu quota and
+// period, the memory limit and the cpu throttling of the cgroup of the current process,
+// as read from cgroupfs, which explain a lot of the performance of processes in
+// containers, for example, a GOMAXPROCS larger than the cpu quota shows up as throttling.
+//
+// Both cgroup v1 and v2 are supported, unlimited quotas and limits are exported as -1.
+// All metrics are created under the subtree passed to NewCgroupCollector.
+type CgroupCollector struct {
+	prefix string
+	root   string // mount point of cgroupfs
+
+	mutex sync.Mutex
+	err   error
+}
+
+// NewCgroupCollector creates a new CgroupCollector with all metrics created under
+// the passed prefix, for example, passing "app.cgroup" creates "app.cgroup.gomaxprocs",
+// "app.cgroup.cpu.quota", "app.cgroup.cpu.period", "app.cgroup.memory.limit",
+// "app.cgroup.cpu.periods", "app.cgroup.cpu.throttled" and "app.cgroup.cpu.throttled_time".
+func NewCgroupCollector(prefix string) (*CgroupCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("cgroup collector prefix cannot be empty")
+	}
+
+	return &CgroupCollector{prefix: prefix, root: "/sys/fs/cgroup"}, nil
+}
+
+// Describe describes the metrics exported by the collector.
+func (col *CgroupCollector) Describe(ch chan<- Desc) {
+	ch <- Desc{
+		Name: col.prefix + ".gomaxprocs", Type: Int32Type, Semantics: DiscreteSemantics, Unit: OneUnit,
+		ShortHelp: "maximum number of cpus executing Go code simultaneously",
+	}
+
+	for _, d := range []struct {
+		name, help string
+		unit       MetricUnit
+	}{
+		{"cpu.quota", "cpu time the cgroup can use every period", MicrosecondUnit},
+		{"cpu.period", "length of the cpu quota period of the cgroup", MicrosecondUnit},
+		{"memory.limit", "memory limit of the cgroup", ByteUnit},
+	} {
+		ch <- Desc{
+			Name: col.prefix + "." + d.name, Type: Int64Type, Semantics: DiscreteSemantics, Unit: d.unit,
+			ShortHelp: d.help,
+		}
+	}
+
+	for _, d := range []struct {
+		name, help string
+		unit       MetricUnit
+	}{
+		{"cpu.periods", "number of elapsed cpu quota periods", OneUnit},
+		{"cpu.throttled", "number of periods the cgroup was throttled in", OneUnit},
+		{"cpu.throttled_time", "total time the cgroup was throttled for", NanosecondUnit},
+	} {
+		ch <- Desc{
+			Name: col.prefix + "." + d.name, Type: Uint64Type, Semantics: CounterSemantics, Unit: d.unit,
+			ShortHelp: d.help,
+		}
+	}
+}
+
+// Collect records GOMAXPROCS and the current state of the cgroup.
+func (col *CgroupCollector) Collect(r Recorder) {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	col.err = col.collect(r)
+}
+
+func (col *CgroupCollector) collect(r Recorder) error {
+	if err := r.Record(col.prefix+".gomaxprocs", int32(runtime.GOMAXPROCS(0))); err != nil {
+		return err
+	}
+
+	s, err := readCgroupStats(col.root)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range []struct {
+		name string
+		val  interface{}
+	}{
+		{"cpu.quota", s.cpuQuota}, {"cpu.period", s.cpuPeriod}, {"memory.limit", s.memoryLimit},
+		{"cpu.periods", s.periods}, {"cpu.throttled", s.throttled}, {"cpu.throttled_time", s.throttledTime},
+	} {
+		if err := r.Record(col.prefix+"."+v.name, v.val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Err returns the error encountered during the last collection, if any,
+// like on platforms without cgroups.
+func (col *CgroupCollector) Err() error {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	return col.err
+}
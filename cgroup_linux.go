@@ -0,0 +1,196 @@
+package speed
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// memory limits from this value up mean unlimited in cgroup v1,
+// which reports the largest page aligned int64
+const cgroupV1Unlimited = 1 << 62
+
+func readCgroupStats(root string) (*cgroupStats, error) {
+	self, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+
+	return readCgroup(root, string(self))
+}
+
+// readCgroup reads the stats of the cgroup a process is in, given the mount point of
+// cgroupfs and the contents of /proc/[pid]/cgroup. Files of controllers that are not
+// enabled for the cgroup are treated as unlimited.
+func readCgroup(root, self string) (*cgroupStats, error) {
+	paths, err := parseProcCgroup(self)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &cgroupStats{cpuQuota: -1, memoryLimit: -1}
+
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		// cgroup v2, a single hierarchy with the empty controller list
+		dir := cgroupDir(root, paths[""])
+
+		if err := readCgroupFile(filepath.Join(dir, "cpu.max"), func(data string) error {
+			fields := strings.Fields(data)
+			if len(fields) != 2 {
+				return errors.Errorf("invalid cpu.max %q", data)
+			}
+
+			if s.cpuQuota, err = parseCgroupLimit(fields[0]); err != nil {
+				return err
+			}
+
+			s.cpuPeriod, err = strconv.ParseInt(fields[1], 10, 64)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+
+		if err := readCgroupFile(filepath.Join(dir, "memory.max"), func(data string) (err error) {
+			s.memoryLimit, err = parseCgroupLimit(data)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+
+		// v2 reports the throttled time in microseconds
+		err := readCgroupCPUStat(filepath.Join(dir, "cpu.stat"), s, "throttled_usec", 1000)
+		return s, err
+	}
+
+	cpu := cgroupDir(filepath.Join(root, "cpu"), paths["cpu"])
+	if err := readCgroupFile(filepath.Join(cpu, "cpu.cfs_quota_us"), func(data string) (err error) {
+		s.cpuQuota, err = strconv.ParseInt(data, 10, 64)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := readCgroupFile(filepath.Join(cpu, "cpu.cfs_period_us"), func(data string) (err error) {
+		s.cpuPeriod, err = strconv.ParseInt(data, 10, 64)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	memory := cgroupDir(filepath.Join(root, "memory"), paths["memory"])
+	if err := readCgroupFile(filepath.Join(memory, "memory.limit_in_bytes"), func(data string) (err error) {
+		if s.memoryLimit, err = strconv.ParseInt(data, 10, 64); s.memoryLimit >= cgroupV1Unlimited {
+			s.memoryLimit = -1
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return s, readCgroupCPUStat(filepath.Join(cpu, "cpu.stat"), s, "throttled_time", 1)
+}
+
+// parseProcCgroup returns the cgroup paths by controller from the contents of
+// /proc/[pid]/cgroup, the path of the cgroup v2 hierarchy is under the empty controller
+func parseProcCgroup(self string) (map[string]string, error) {
+	ans := make(map[string]string)
+
+	for _, line := range strings.Split(strings.TrimSpace(self), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			return nil, errors.Errorf("invalid /proc cgroup line %q", line)
+		}
+
+		if fields[1] == "" {
+			ans[""] = fields[2]
+			continue
+		}
+
+		for _, c := range strings.Split(fields[1], ",") {
+			ans[c] = fields[2]
+		}
+	}
+
+	return ans, nil
+}
+
+// cgroupDir returns the directory of a cgroup in a hierarchy mounted at root, which
+// is root itself when the process is in a cgroup namespace, as in most containers
+func cgroupDir(root, path string) string {
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(dir); err != nil {
+		return root
+	}
+
+	return dir
+}
+
+// readCgroupFile passes the trimmed contents of a file to parse, ignoring missing files
+func readCgroupFile(file string, parse func(string) error) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := parse(strings.TrimSpace(string(data))); err != nil {
+		return errors.Wrapf(err, "cannot parse %v", file)
+	}
+
+	return nil
+}
+
+// parseCgroupLimit parses a cgroup v2 limit, which is either a number or max
+func parseCgroupLimit(data string) (int64, error) {
+	if data == "max" {
+		return -1, nil
+	}
+
+	return strconv.ParseInt(data, 10, 64)
+}
+
+// readCgroupCPUStat reads the throttling statistics from a cpu.stat file,
+// with the throttled time under key, in units of scale nanoseconds
+func readCgroupCPUStat(file string, s *cgroupStats, key string, scale uint64) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "cannot parse %v", file)
+		}
+
+		switch fields[0] {
+		case "nr_periods":
+			s.periods = v
+		case "nr_throttled":
+			s.throttled = v
+		case key:
+			s.throttledTime = v * scale
+		}
+	}
+
+	return scanner.Err()
+}
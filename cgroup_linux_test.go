@@ -0,0 +1,135 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCgroupFiles writes files with their contents under root
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	for name, data := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadCgroup(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		self  string
+		stats cgroupStats
+	}{
+		{
+			"v2", map[string]string{
+				"cgroup.controllers":     "cpu memory",
+				"app.slice/cpu.max":      "50000 100000\n",
+				"app.slice/memory.max":   "536870912\n",
+				"app.slice/cpu.stat":     "usage_usec 100\nnr_periods 20\nnr_throttled 5\nthrottled_usec 3000\n",
+				"other.slice/memory.max": "1024\n",
+			},
+			"0::/app.slice\n",
+			cgroupStats{50000, 100000, 536870912, 20, 5, 3000000},
+		},
+		{
+			"v2 unlimited in a namespace", map[string]string{
+				"cgroup.controllers": "cpu memory",
+				"cpu.max":            "max 100000\n",
+				"memory.max":         "max\n",
+			},
+			"0::/\n",
+			cgroupStats{-1, 100000, -1, 0, 0, 0},
+		},
+		{
+			"v1", map[string]string{
+				"cpu/docker/abc/cpu.cfs_quota_us":         "200000\n",
+				"cpu/docker/abc/cpu.cfs_period_us":        "100000\n",
+				"cpu/docker/abc/cpu.stat":                 "nr_periods 7\nnr_throttled 2\nthrottled_time 12345\n",
+				"memory/docker/abc/memory.limit_in_bytes": "9223372036854771712\n",
+			},
+			"12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n",
+			cgroupStats{200000, 100000, -1, 7, 2, 12345},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "speed")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			writeCgroupFiles(t, root, c.files)
+
+			s, err := readCgroup(root, c.self)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *s != c.stats {
+				t.Errorf("expected %+v, got %+v", c.stats, *s)
+			}
+		})
+	}
+
+	if _, err := readCgroup(os.TempDir(), "invalid"); err == nil {
+		t.Error("expected an error for an invalid /proc cgroup file")
+	}
+}
+
+func TestCgroupCollector(t *testing.T) {
+	col, err := NewCgroupCollector("test.cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu",
+		"cpu.max":            "25000 100000",
+	})
+	col.root = root
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.RegisterCollector(col, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = col.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := c.r.metrics["test.cgroup.cpu.quota"].(*PCPSingletonMetric).Val().(int64); v != 25000 {
+		t.Errorf("expected a quota of 25000, got %v", v)
+	}
+
+	if v := c.r.metrics["test.cgroup.memory.limit"].(*PCPSingletonMetric).Val().(int64); v != -1 {
+		t.Errorf("expected no memory limit, got %v", v)
+	}
+
+	if v := c.r.metrics["test.cgroup.gomaxprocs"].(*PCPSingletonMetric).Val().(int32); v < 1 {
+		t.Errorf("expected GOMAXPROCS to be positive, got %v", v)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package speed
+
+import "github.com/pkg/errors"
+
+func readCgroupStats(string) (*cgroupStats, error) {
+	return nil, errors.New("cgroup statistics are only supported on linux")
+}
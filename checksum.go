@@ -0,0 +1,31 @@
+package speed
+
+import "github.com/performancecopilot/speed/mmvdump"
+
+// ChecksumLength is the byte length of the checksum trailer written by WithChecksum.
+const ChecksumLength = int(mmvdump.ChecksumLength)
+
+// WithChecksum makes the client write a CRC-32 of the metadata of the MMV file,
+// i.e. everything except values and strings, after its last section, which mmvdump
+// verifies, so corrupted files are reported instead of producing garbage values.
+//
+// The MMV header has no unused space, so the checksum is a trailer that readers
+// unaware of it, like pmdammv, ignore.
+func WithChecksum() ClientOption {
+	return func(c *PCPClient) error {
+		c.checksum = true
+		return nil
+	}
+}
+
+// writeChecksum writes the checksum trailer, once everything else except the
+// second generation number is written
+func (c *PCPClient) writeChecksum() {
+	data := c.writer.Bytes()
+	off := len(data) - ChecksumLength
+
+	crc := mmvdump.Checksum(data, uint64(c.r.valuesoffset))
+
+	off = c.writer.MustWriteString(mmvdump.ChecksumMagic, off)
+	_ = c.writer.MustWriteUint32(crc, off)
+}
@@ -0,0 +1,55 @@
+package speed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestChecksum(t *testing.T) {
+	c, err := NewPCPClient("test", WithChecksum(), WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterString("test.a[x,y]", Instances{"x": 1, "y": 2}, Int32Type, InstantSemantics, OneUnit).(*PCPInstanceMetric)
+	c.MustRegisterString("test.b", "hello", StringType, InstantSemantics, OneUnit)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	data := c.writer.Bytes()
+	if len(data) != c.Length() {
+		t.Fatalf("expected %v bytes, got %v", c.Length(), len(data))
+	}
+
+	if string(data[len(data)-ChecksumLength:len(data)-4]) != mmvdump.ChecksumMagic {
+		t.Error("expected a checksum trailer at the end of the file")
+	}
+
+	l, err := c.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = l.Check(data); err != nil {
+		t.Errorf("expected the layout to match the file, got %v", err)
+	}
+
+	// values and flags are not covered
+	m.MustSetInstance(3, "x")
+	data[28] ^= byte(ProcessFlag)
+
+	if _, _, _, _, _, _, _, err = mmvdump.Dump(data); err != nil {
+		t.Errorf("expected the checksum to match after updating values and flags, got %v", err)
+	}
+
+	// corrupt the type of the first metric
+	corrupted := append([]byte(nil), data...)
+	corrupted[l.Metrics[0].Offset+MaxV1NameLength+1+4]++
+
+	if _, _, _, _, _, _, _, err = mmvdump.Dump(corrupted); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+}
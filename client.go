@@ -1,10 +1,12 @@
 package speed
 
 import (
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -101,12 +103,46 @@ const (
 
 // PCPClient implements a client that can generate instrumentation for PCP
 type PCPClient struct {
+	droppedWrites uint64 // number of failed writes dropped by the write policy, first for atomic alignment
+
 	mutex sync.Mutex
 
 	loc       string  // absolute location of the mmv file
 	clusterID uint32  // cluster identifier for the writer
 	flag      MMVFlag // write flag
 
+	generation int64 // generation of the last mapping
+	lazy       bool  // defer the mapping on Start until the first write
+	deferred   bool  // started lazily and not mapped yet
+
+	maxStringLength int  // maximum length of written strings, see WithMaxStringLength
+	noHelp          bool // omit descriptions, see WithoutHelpText
+	checksum        bool // write a checksum trailer, see WithChecksum
+	deterministic   bool // see WithDeterministicOutput
+	maxFileSize     int  // see WithMaxFileSize
+
+	existingFile ExistingFilePolicy // handling of an existing MMV file on Start
+	collectors   []*collectorRunner // see RegisterCollector
+
+	bindings        *collectorRunner // evaluates bound functions, see BindFunc
+	persistence     *collectorRunner // checkpoints counters, see WithPersistence
+	refreshInterval time.Duration    // see WithRefreshInterval
+	defaults        MetricDefaults   // see SetDefaults
+	prefix          string           // prepended to registered names, see WithPrefix
+
+	remote       *remoteWriter     // optional pushing of the MMV file, see WithRemoteWrite
+	noFile       bool              // keep the MMV file in memory, see WithoutLocalFile
+	labels       map[string]string // attached to all metrics by exporters, see WithLabels
+	discoveryDir string            // where to write a discovery file, see WithDiscovery
+	layoutFile   bool              // persist the layout next to the MMV file, see WithPersistedLayout
+	logger       *log.Logger       // where snapshots are logged, see WithLogger
+
+	level       int32              // most verbose MetricLevel written, accessed atomically, see SetLevel
+	filter      atomic.Value       // holds the MetricFilter deciding which values are written, see SetFilter
+	writePolicy WritePolicy        // handling of failed value writes
+	budget      *overheadBudget    // optional limit on the time spent writing values
+	verifier    *semanticsVerifier // optional checks of written values, see WithSemanticsVerifier
+
 	r *PCPRegistry // current registry
 
 	writer bytewriter.Writer
@@ -118,24 +154,64 @@ type PCPClient struct {
 	stringoffsetc   chan int
 }
 
+// ClientOption configures optional behaviour of a PCPClient on construction.
+type ClientOption func(*PCPClient) error
+
+// WithPanicHandler makes the Must methods of all metrics registered with the client,
+// like MustSet and MustInc, call the passed handler with the error instead of panicking,
+// so a metrics bug cannot crash a service in production. Without it, they keep panicking,
+// which is usually preferable during development.
+func WithPanicHandler(h func(error)) ClientOption {
+	return func(c *PCPClient) error {
+		if h == nil {
+			return errors.New("panic handler cannot be nil")
+		}
+
+		c.r.panicHandler = h
+		return nil
+	}
+}
+
+// WithLazyStart defers creating the MMV file on Start until one of the registered
+// metrics is first updated, so processes that set up instrumentation
+// but never do any work do not leave behind mappings with initial values only.
+func WithLazyStart() ClientOption {
+	return func(c *PCPClient) error {
+		c.lazy = true
+		return nil
+	}
+}
+
 // NewPCPClient initializes a new PCPClient object
-func NewPCPClient(name string) (*PCPClient, error) {
-	return NewPCPClientWithRegistry(name, NewPCPRegistry())
+func NewPCPClient(name string, opts ...ClientOption) (*PCPClient, error) {
+	return NewPCPClientWithRegistry(name, NewPCPRegistry(), opts...)
 }
 
 // NewPCPClientWithRegistry initializes a new PCPClient object with the given registry
-func NewPCPClientWithRegistry(name string, registry *PCPRegistry) (*PCPClient, error) {
+func NewPCPClientWithRegistry(name string, registry *PCPRegistry, opts ...ClientOption) (*PCPClient, error) {
 	fileLocation, err := mmvFileLocation(name)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get a location for storing MMV file")
 	}
 
-	return &PCPClient{
-		loc:       fileLocation,
-		r:         registry,
-		clusterID: hash(name, PCPClusterIDBitLength),
-		flag:      ProcessFlag,
-	}, nil
+	c := &PCPClient{
+		loc:             fileLocation,
+		r:               registry,
+		clusterID:       hash(name, PCPClusterIDBitLength),
+		flag:            ProcessFlag,
+		maxStringLength: StringLength - 1,
+		maxFileSize:     MaxFileSize,
+		refreshInterval: DefaultRefreshInterval,
+		defaults:        initialDefaults,
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
 }
 
 // Registry returns a writer's registry
@@ -163,15 +239,27 @@ func (c *PCPClient) tocCount() int {
 		ans += 2
 	}
 
-	if c.r.StringCount() > 0 {
+	if c.stringCount() > 0 {
 		ans++
 	}
 
 	return ans
 }
 
-// Length returns the byte length of data in the mmv file written by the current writer
+// Length returns the byte length of data in the mmv file written by the current writer,
+// or 0 if the registry cannot be laid out in one
 func (c *PCPClient) Length() int {
+	b, err := c.sections()
+	if err != nil {
+		return 0
+	}
+
+	return b.Len()
+}
+
+// sections lays out the mmv file of the client, the header and the tocs first,
+// then one section per toc entry, then the checksum, if any
+func (c *PCPClient) sections() (*bytewriter.Builder, error) {
 	var (
 		InstanceLength = Instance1Length
 		MetricLength   = Metric1Length
@@ -182,49 +270,205 @@ func (c *PCPClient) Length() int {
 		MetricLength = Metric2Length
 	}
 
-	return HeaderLength +
-		(c.tocCount() * TocLength) +
-		(c.r.InstanceCount() * InstanceLength) +
-		(c.r.InstanceDomainCount() * InstanceDomainLength) +
-		(c.r.MetricCount() * MetricLength) +
-		(c.r.ValuesCount() * ValueLength) +
-		(c.r.StringCount() * StringLength)
+	// all blocks are 8 byte multiples, so aligning sections to 8 bytes adds no
+	// padding, but keeps 64 bit values aligned if that ever changes
+	b, err := bytewriter.NewBuilder(
+		bytewriter.Section{Name: "header", Count: 1, Size: HeaderLength, Align: 8},
+		bytewriter.Section{Name: "toc", Count: c.tocCount(), Size: TocLength, Align: 8},
+		bytewriter.Section{Name: "indoms", Count: c.r.InstanceDomainCount(), Size: InstanceDomainLength, Align: 8},
+		bytewriter.Section{Name: "instances", Count: c.r.InstanceCount(), Size: InstanceLength, Align: 8},
+		bytewriter.Section{Name: "metrics", Count: c.r.MetricCount(), Size: MetricLength, Align: 8},
+		bytewriter.Section{Name: "values", Count: c.r.ValuesCount(), Size: ValueLength, Align: 8},
+		bytewriter.Section{Name: "strings", Count: c.stringCount(), Size: StringLength, Align: 8},
+	)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot lay out the mmv file")
+	}
+
+	if c.checksum {
+		if _, err = b.Add(bytewriter.Section{Name: "checksum", Count: 1, Size: ChecksumLength}); err != nil {
+			return nil, errors.Wrap(err, "cannot lay out the mmv file")
+		}
+	}
+
+	return b, nil
 }
 
 // Start dumps existing registry data
+//
+// A stopped client can be started again, which recreates the mapping with the
+// current values of all metrics in the registry, including metrics registered
+// while it was stopped, under a new generation.
+//
+// With WithLazyStart, the mapping is only created on the first update of a value.
 func (c *PCPClient) Start() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	l := c.Length()
+	if !c.r.mapped {
+		if c.persistence != nil {
+			if err := c.restoreCheckpoint(); err != nil {
+				return err
+			}
+		}
+
+		// collected before mapping, so the values are written by it
+		c.collect()
+
+		// the existing file of a lazily started client is handled now too, so the
+		// values restored from it are in place before an update maps the client
+		if c.lazy && !c.noFile {
+			if err := c.handleExistingFile(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.lazy {
+		c.deferStart()
+		c.startCollectors()
+		return nil
+	}
+
+	if err := c.mapAndStart(true); err != nil {
+		return err
+	}
+
+	c.startCollectors()
+	return nil
+}
+
+// deferStart makes the first update of any metric map the client, see
+// pcpMetricDesc.prepare.
+func (c *PCPClient) deferStart() {
+	c.setLazyStart(c.startDeferred)
+	c.deferred = true
+	c.r.mapped = true
+}
+
+// startDeferred maps a lazily started client, if it is not mapped yet. It is called
+// by updates before they lock their metric, as mapping locks all metrics.
+func (c *PCPClient) startDeferred() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.deferred {
+		return nil
+	}
+
+	if err := c.mapAndStart(false); err != nil {
+		return err
+	}
+
+	c.deferred = false
+	c.setLazyStart(nil)
+	return nil
+}
 
-	writer, err := bytewriter.NewMemoryMappedWriter(c.loc, l)
+// setLazyStart sets the function mapping the client on the next update of any of
+// its metrics, or clears it when passed nil.
+func (c *PCPClient) setLazyStart(start func() error) {
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	for _, m := range c.r.metrics {
+		if dm, ok := m.(describedMetric); ok {
+			dm.desc().setLazyStart(start)
+		}
+	}
+}
+
+// mapAndStart maps a client, handling an existing MMV file first if asked to.
+func (c *PCPClient) mapAndStart(existing bool) error {
+	if err := c.mapWriter(existing); err != nil {
+		return err
+	}
+
+	if c.discoveryDir != "" {
+		if err := c.writeDiscovery(); err != nil {
+			_ = c.unmap()
+			return err
+		}
+	}
+
+	if c.remote != nil {
+		c.remote.start(c)
+	}
+
+	return nil
+}
+
+// mapWriter creates the writer of the mapping and writes the registry to it,
+// handling an existing MMV file first if asked to.
+func (c *PCPClient) mapWriter(existing bool) error {
+	b, err := c.sections()
 	if err != nil {
-		return errors.Wrap(err, "cannot create MemoryMappedBuffer in client")
+		return err
+	}
+
+	l := b.Len()
+	if err = checkLimit("file size", 0, l, c.maxFileSize); err != nil {
+		return err
+	}
+
+	if c.noFile {
+		c.writer = bytewriter.NewByteWriter(l)
+	} else {
+		if existing {
+			if err := c.handleExistingFile(); err != nil {
+				return err
+			}
+		}
+
+		writer, err := bytewriter.NewMemoryMappedWriter(c.loc, l)
+		if err != nil {
+			return errors.Wrap(err, "cannot create MemoryMappedBuffer in client")
+		}
+
+		c.writer = writer
 	}
 
-	c.writer = writer
-	c.start()
+	c.start(b)
 	c.r.mapped = true
+
+	if c.layoutFile && !c.noFile {
+		if err := c.writeLayoutFile(); err != nil {
+			_ = c.unmap()
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (c *PCPClient) start() {
-	var (
-		InstanceLength = Instance1Length
-		MetricLength   = Metric1Length
-	)
+// remap recreates the mapping of a started client, which is locked, around a change
+// of its layout by f, under a new generation. Unlike Stop and Start, it leaves the
+// collectors, pushes, checkpoints and the discovery file alone.
+func (c *PCPClient) remap(f func() error) error {
+	if err := c.unmap(); err != nil {
+		return err
+	}
 
-	if c.r.version2 {
-		InstanceLength = Instance2Length
-		MetricLength = Metric2Length
+	err := f()
+	if merr := c.mapWriter(false); err == nil {
+		err = merr
+	}
+
+	return err
+}
+
+// start writes the registry to the writer, laid out in the sections of b
+func (c *PCPClient) start(b *bytewriter.Builder) {
+	if c.deterministic {
+		c.zero()
 	}
 
-	c.r.indomoffset = HeaderLength + TocLength*c.tocCount()
-	c.r.instanceoffset = c.r.indomoffset + InstanceDomainLength*c.r.InstanceDomainCount()
-	c.r.metricsoffset = c.r.instanceoffset + InstanceLength*c.r.InstanceCount()
-	c.r.valuesoffset = c.r.metricsoffset + MetricLength*c.r.MetricCount()
-	c.r.stringsoffset = c.r.valuesoffset + ValueLength*c.r.ValuesCount()
+	c.r.indomoffset = b.Offset("indoms")
+	c.r.instanceoffset = b.Offset("instances")
+	c.r.metricsoffset = b.Offset("metrics")
+	c.r.valuesoffset = b.Offset("values")
+	c.r.stringsoffset = b.Offset("strings")
 
 	if c.r.InstanceDomainCount() > 0 {
 		c.instanceoffsetc, c.indomoffsetc = make(chan int, 1), make(chan int, 1)
@@ -240,7 +484,7 @@ func (c *PCPClient) start() {
 		c.valueoffsetc <- c.r.valuesoffset
 	}
 
-	if c.r.StringCount() > 0 {
+	if c.stringCount() > 0 {
 		c.stringoffsetc = make(chan int, 1)
 		c.stringoffsetc <- c.r.stringsoffset
 	}
@@ -269,7 +513,12 @@ func (c *PCPClient) start() {
 	gen, g2off := <-genc, <-g2offc
 	wg.Wait()
 
-	// must *always* be the last thing to happen
+	if c.checksum {
+		c.writeChecksum()
+	}
+
+	// must *always* be the last thing to happen, the write is an atomic
+	// store, so monitors seeing it also see everything written before it
 	_ = c.writer.MustWriteInt64(gen, g2off)
 }
 
@@ -286,8 +535,9 @@ func (c *PCPClient) writeHeaderBlock(genc chan int64, g2offc chan int) {
 		pos = c.writer.MustWriteUint32(1, 4)
 	}
 
-	// generation
-	gen := time.Now().Unix()
+	gen := c.nextGeneration()
+	c.generation = gen
+
 	pos = c.writer.MustWriteInt64(gen, pos)
 
 	g2off := pos
@@ -300,7 +550,7 @@ func (c *PCPClient) writeHeaderBlock(genc chan int64, g2offc chan int) {
 	pos = c.writer.MustWriteInt32(int32(c.flag), pos)
 
 	// process identifier
-	pos = c.writer.MustWriteInt32(int32(os.Getpid()), pos)
+	pos = c.writer.MustWriteInt32(c.pid(), pos)
 
 	// cluster identifier
 	_ = c.writer.MustWriteUint32(c.clusterID, pos)
@@ -358,10 +608,10 @@ func (c *PCPClient) writeTocBlock() {
 	tocpos += TocLength
 
 	// strings toc
-	if c.r.StringCount() > 0 {
+	if c.stringCount() > 0 {
 		go func(pos int) {
 			// 5 is the identifier for strings
-			c.writeSingleToc(pos, 5, c.r.StringCount(), c.r.stringsoffset)
+			c.writeSingleToc(pos, 5, c.stringCount(), c.r.stringsoffset)
 			wg.Done()
 		}(tocpos)
 	}
@@ -375,24 +625,20 @@ func (c *PCPClient) writeSingleToc(pos, identifier, count, offset int) {
 	_ = c.writer.MustWriteUint64(uint64(offset), pos)
 }
 
+// writeInstanceDomains writes all instance domains and their instances in order of
+// their names, so the same registry is always laid out the same way
 func (c *PCPClient) writeInstanceDomains() {
-	var wg sync.WaitGroup
-	wg.Add(c.r.InstanceDomainCount())
-
-	for _, indom := range c.r.instanceDomains {
-		go func(indom *PCPInstanceDomain) {
-			c.writeInstanceDomain(indom)
-			wg.Done()
-		}(indom)
+	for _, indom := range c.r.sortedInstanceDomains() {
+		c.writeInstanceDomain(indom)
 	}
-
-	wg.Wait()
 }
 
 func (c *PCPClient) writeInstanceDomain(indom *PCPInstanceDomain) {
 	off := <-c.indomoffsetc
 	c.indomoffsetc <- off + InstanceDomainLength
 
+	indom.offset = off
+
 	InstanceLength := Instance1Length
 	if c.r.version2 {
 		InstanceLength = Instance2Length
@@ -402,41 +648,19 @@ func (c *PCPClient) writeInstanceDomain(indom *PCPInstanceDomain) {
 	ioff := <-c.instanceoffsetc
 	c.instanceoffsetc <- ioff + InstanceLength*indom.InstanceCount()
 
-	var wg sync.WaitGroup
-	wg.Add(indom.InstanceCount())
-
 	off = c.writer.MustWriteUint32(indom.id, off)
 	off = c.writer.MustWriteInt32(int32(indom.InstanceCount()), off)
 	off = c.writer.MustWriteInt64(int64(ioff), off)
 
-	for _, i := range indom.instances {
-		go func(i *pcpInstance, offset int) {
-			c.writeInstance(i, inoff, offset)
-			wg.Done()
-		}(i, ioff)
-		ioff += InstanceLength
-	}
-
-	so, lo := 0, 0
-
-	if indom.shortDescription != "" {
-		so = <-c.stringoffsetc
-		c.stringoffsetc <- so + StringLength
-
-		c.writer.MustWriteString(indom.shortDescription, so)
-	}
-
-	if indom.longDescription != "" {
-		lo = <-c.stringoffsetc
-		c.stringoffsetc <- lo + StringLength
-
-		c.writer.MustWriteString(indom.longDescription, lo)
-	}
+	so, lo := c.writeHelp(indom.shortDescription, indom.longDescription)
 
 	off = c.writer.MustWriteUint64(uint64(so), off)
 	_ = c.writer.MustWriteUint64(uint64(lo), off)
 
-	wg.Wait()
+	for _, i := range indom.sortedInstances() {
+		c.writeInstance(i, inoff, ioff)
+		ioff += InstanceLength
+	}
 }
 
 func (c *PCPClient) writeInstance(i *pcpInstance, indomoff int, off int) {
@@ -457,101 +681,104 @@ func (c *PCPClient) writeInstance(i *pcpInstance, indomoff int, off int) {
 	}
 }
 
+// writeMetrics writes all metrics and their values in order of their names,
+// so the same registry is always laid out the same way
+//
+// Each metric is locked while its update closures are installed, one at a time, as
+// updates of a metric can lock others, like the companions of its rollups.
 func (c *PCPClient) writeMetrics() {
-	var wg sync.WaitGroup
-
-	launchSingletonMetric := func(metric *pcpSingletonMetric) {
-		go func() {
-			c.writeSingletonMetric(metric)
-			wg.Done()
-		}()
-	}
-
-	launchInstanceMetric := func(metric *pcpInstanceMetric) {
-		go func() {
-			c.writeInstanceMetric(metric)
-			wg.Done()
-		}()
+	for _, m := range c.r.sortedMetrics() {
+		c.writeMetric(m)
 	}
+}
 
-	wg.Add(c.r.MetricCount())
-	for _, m := range c.r.metrics {
-		switch metric := m.(type) {
-		case *PCPSingletonMetric:
-			launchSingletonMetric(metric.pcpSingletonMetric)
-		case *PCPCounter:
-			launchSingletonMetric(metric.pcpSingletonMetric)
-		case *PCPGauge:
-			launchSingletonMetric(metric.pcpSingletonMetric)
-		case *PCPTimer:
-			launchSingletonMetric(metric.pcpSingletonMetric)
-		case *PCPInstanceMetric:
-			launchInstanceMetric(metric.pcpInstanceMetric)
-		case *PCPCounterVector:
-			launchInstanceMetric(metric.pcpInstanceMetric)
-		case *PCPGaugeVector:
-			launchInstanceMetric(metric.pcpInstanceMetric)
-		case *PCPHistogram:
-			launchInstanceMetric(metric.pcpInstanceMetric)
-		}
+func (c *PCPClient) writeMetric(m PCPMetric) {
+	defer lockMetric(m)()
+
+	switch metric := m.(type) {
+	case *PCPConstMetric:
+		c.writeConstMetric(metric)
+	case *PCPSingletonMetric:
+		c.writeSingletonMetric(metric.pcpSingletonMetric)
+	case *PCPCounter:
+		c.writeSingletonMetric(metric.pcpSingletonMetric)
+	case *PCPGauge:
+		c.writeSingletonMetric(metric.pcpSingletonMetric)
+	case *PCPTimer:
+		c.writeSingletonMetric(metric.pcpSingletonMetric)
+	case *PCPEnum:
+		c.writeSingletonMetric(metric.pcpSingletonMetric)
+	case *PCPBitField:
+		c.writeSingletonMetric(metric.pcpSingletonMetric)
+	case *PCPPercentage:
+		c.writeSingletonMetric(metric.pcpSingletonMetric)
+	case *PCPInstanceMetric:
+		c.writeInstanceMetric(metric.pcpInstanceMetric)
+	case *PCPCounterVector:
+		c.writeInstanceMetric(metric.pcpInstanceMetric)
+	case *PCPGaugeVector:
+		c.writeInstanceMetric(metric.pcpInstanceMetric)
+	case *PCPHistogram:
+		c.writeInstanceMetric(metric.pcpInstanceMetric)
+	case *PCPSLO:
+		c.writeInstanceMetric(metric.pcpInstanceMetric)
 	}
-
-	wg.Wait()
 }
 
 func (c *PCPClient) writeSingletonMetric(m *pcpSingletonMetric) {
-	var wg sync.WaitGroup
-	wg.Add(2)
-
 	doff := <-c.metricoffsetc
+	c.writeMetricDesc(m.pcpMetricDesc, m.Indom(), doff)
 
-	go func() {
-		c.writeMetricDesc(m.pcpMetricDesc, m.Indom(), doff)
-		wg.Done()
-	}()
+	off := <-c.valueoffsetc
+	c.valueoffsetc <- off + ValueLength
+
+	m.offset = off
+	m.update = c.writeValue(m.name, m.t, m.val, off, c.attacher(m.unassigned(), off, doff))
+
+	off = c.writer.MustWriteInt64(int64(attachedMetric(m.unassigned(), doff)), off+MaxDataValueSize)
+	_ = c.writer.MustWriteInt64(0, off)
+}
+
+// writeConstMetric writes the metric and its value once, without keeping
+// an update closure for it.
+func (c *PCPClient) writeConstMetric(m *PCPConstMetric) {
+	doff := <-c.metricoffsetc
+	c.writeMetricDesc(m.pcpMetricDesc, nil, doff)
 
 	off := <-c.valueoffsetc
 	c.valueoffsetc <- off + ValueLength
 
-	go func(offset int) {
-		m.update = c.writeValue(m.t, m.val, offset)
-		wg.Done()
-	}(off)
+	m.offset = off
+	_ = c.valueUpdate(m.t, off)(m.val)
 
 	off = c.writer.MustWriteInt64(int64(doff), off+MaxDataValueSize)
 	_ = c.writer.MustWriteInt64(0, off)
-
-	wg.Wait()
 }
 
 func (c *PCPClient) writeInstanceMetric(m *pcpInstanceMetric) {
-	var wg sync.WaitGroup
-	wg.Add(1 + m.Indom().InstanceCount())
-
 	doff := <-c.metricoffsetc
+	c.writeMetricDesc(m.pcpMetricDesc, m.Indom(), doff)
 
-	go func() {
-		c.writeMetricDesc(m.pcpMetricDesc, m.Indom(), doff)
-		wg.Done()
-	}()
+	indom := c.r.instanceDomain(m.indom.Name())
 
-	for name, i := range m.indom.instances {
+	for _, i := range indom.sortedInstances() {
 		off := <-c.valueoffsetc
 		c.valueoffsetc <- off + ValueLength
 
-		go func(i *instanceValue, offset int) {
-			i.update = c.writeValue(m.t, i.val, offset)
-			wg.Done()
-		}(m.vals[name], off)
+		v := m.vals[i.name]
+		unassigned := m.noInitialValue && !v.assigned
+
+		v.offset = off
+		v.update = c.writeValue(m.name, m.t, v.val, off, c.attacher(unassigned, off, doff))
 
-		off = c.writer.MustWriteInt64(int64(doff), off+MaxDataValueSize)
+		off = c.writer.MustWriteInt64(int64(attachedMetric(unassigned, doff)), off+MaxDataValueSize)
 		_ = c.writer.MustWriteInt64(int64(i.offset), off)
 	}
-
-	wg.Wait()
 }
 
 func (c *PCPClient) writeMetricDesc(desc *pcpMetricDesc, indom *PCPInstanceDomain, off int) {
+	desc.offset = off
+
 	if c.r.version2 {
 		c.metricoffsetc <- off + Metric2Length
 
@@ -580,40 +807,68 @@ func (c *PCPClient) writeMetricDesc(desc *pcpMetricDesc, indom *PCPInstanceDomai
 
 	off = c.writer.MustWriteInt32(0, off)
 
-	so, lo := 0, 0
+	so, lo := c.writeHelp(desc.shortDescription, desc.longDescription)
+
+	off = c.writer.MustWriteUint64(uint64(so), off)
+	_ = c.writer.MustWriteUint64(uint64(lo), off)
+}
+
+// writeHelp writes the short and long descriptions of a metric or an instance domain,
+// returning their offsets, which are 0 for blank or omitted descriptions.
+func (c *PCPClient) writeHelp(short, long string) (so, lo int) {
+	if c.noHelp {
+		return 0, 0
+	}
 
-	if desc.shortDescription != "" {
+	if short != "" {
 		so = <-c.stringoffsetc
 		c.stringoffsetc <- so + StringLength
 
-		c.writer.MustWriteString(desc.shortDescription, so)
+		c.writer.MustWriteString(c.truncate(short), so)
 	}
 
-	if desc.longDescription != "" {
+	if long != "" {
 		lo = <-c.stringoffsetc
 		c.stringoffsetc <- lo + StringLength
 
-		c.writer.MustWriteString(desc.longDescription, lo)
+		c.writer.MustWriteString(c.truncate(long), lo)
 	}
 
-	off = c.writer.MustWriteUint64(uint64(so), off)
-	_ = c.writer.MustWriteUint64(uint64(lo), off)
+	return so, lo
 }
 
-func (c *PCPClient) writeValue(t MetricType, val interface{}, offset int) updateClosure {
-	if t == StringType {
-		pos := c.writer.MustWriteUint64(StringLength-1, offset)
+func (c *PCPClient) writeValue(name string, t MetricType, val interface{}, offset int, attach func()) updateClosure {
+	update := c.valueUpdate(t, offset)
+	_ = update(val)
 
-		offset = <-c.stringoffsetc
-		c.stringoffsetc <- offset + StringLength
+	if attach != nil {
+		update = attaching(update, attach)
+	}
+
+	m, registered := c.r.metrics[name]
 
-		c.writer.MustWriteUint64(uint64(offset), pos)
+	// callbacks run holding the lock of the metric, see pcpMetricDesc.callback
+	var md *pcpMetricDesc
+	if dm, ok := m.(describedMetric); ok {
+		md = dm.desc()
 	}
 
-	update := newupdateClosure(offset, c.writer)
-	_ = update(val)
+	update = c.writePolicy.wrap(name, md, update, &c.droppedWrites)
+
+	if c.budget != nil {
+		update = c.budget.wrap(name, offset, update)
+	}
+
+	if c.verifier != nil && registered {
+		update = c.verifier.wrap(name, md, m.Semantics(), offset, update)
+	}
 
-	return update
+	level := NormalLevel
+	if registered {
+		level = metricLevel(m)
+	}
+
+	return c.filtering(name, level, update)
 }
 
 // MustStart is a start that panics
@@ -625,21 +880,83 @@ func (c *PCPClient) MustStart() {
 
 // Stop removes existing mapping and cleans up
 func (c *PCPClient) Stop() error {
+	if c.remote != nil {
+		// pushing locks the client, so this cannot happen under the lock
+		c.remote.stop()
+	}
+
+	// collecting can map a lazily started client, which locks it
+	c.stopCollectors()
+
+	if c.persistence != nil {
+		// checkpointing reads the samples, which locks the client
+		_ = c.Checkpoint()
+	}
+
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
 
+	// a final push with the latest values, once the client is unlocked
+	var (
+		name  string
+		final []byte
+	)
+
+	if c.remote != nil && c.r.mapped && !c.deferred {
+		name, final, _ = c.remoteSnapshot()
+	}
+
+	err := c.stopMapping()
+	c.mutex.Unlock()
+
+	if final != nil {
+		_ = c.remote.push(name, final)
+	}
+
+	return err
+}
+
+// stopMapping stops a started client, which is locked.
+func (c *PCPClient) stopMapping() error {
 	if !c.r.mapped {
 		return errors.New("trying to stop an already stopped mapping")
 	}
 
+	if c.deferred {
+		c.detachMetrics()
+		c.deferred = false
+		c.r.mapped = false
+		return nil
+	}
+
+	if c.discoveryDir != "" {
+		_ = c.removeDiscovery()
+	}
+
+	return c.unmap()
+}
+
+// unmap releases the mapping of a started client.
+func (c *PCPClient) unmap() error {
 	c.stop()
+	c.detachMetrics()
+
+	if c.budget != nil {
+		c.budget.stop()
+	}
 
 	c.r.mapped = false
 
-	err := c.writer.(*bytewriter.MemoryMappedWriter).Unmap(EraseFileOnStop)
+	writer := c.writer
 	c.writer = nil
-	if err != nil {
-		return errors.Wrap(err, "client: error unmapping MemoryMappedBuffer")
+
+	if mw, ok := writer.(*bytewriter.MemoryMappedWriter); ok {
+		if err := mw.Unmap(EraseFileOnStop); err != nil {
+			return errors.Wrap(err, "client: error unmapping MemoryMappedBuffer")
+		}
+
+		if EraseFileOnStop && c.layoutFile {
+			_ = os.Remove(c.layoutPath())
+		}
 	}
 
 	return nil
@@ -651,6 +968,32 @@ func (c *PCPClient) stop() {
 	c.stringoffsetc = nil
 }
 
+// detachMetrics drops the update closures of all metrics, so values set while the
+// client is stopped are only kept in memory, and written on the next Start. Each
+// metric is locked while its closures are dropped, so once this returns, no update
+// writes to the current writer anymore and it can be unmapped.
+func (c *PCPClient) detachMetrics() {
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	for _, m := range c.r.metrics {
+		c.detachMetric(m)
+	}
+}
+
+func (c *PCPClient) detachMetric(m PCPMetric) {
+	defer lockMetric(m)()
+
+	if bm, ok := m.(boundMetric); ok {
+		bm.detach()
+	}
+
+	if dm, ok := m.(describedMetric); ok {
+		dm.desc().offset = 0
+		dm.desc().setLazyStart(nil)
+	}
+}
+
 // MustStop is a stop that panics
 func (c *PCPClient) MustStop() {
 	if err := c.Stop(); err != nil {
@@ -659,7 +1002,19 @@ func (c *PCPClient) MustStop() {
 }
 
 // Register is simply a shorthand for Registry().AddMetric
-func (c *PCPClient) Register(m Metric) error { return c.r.AddMetric(m) }
+//
+// Metrics cannot be registered under ContributionRoot, which is reserved for Contribute.
+func (c *PCPClient) Register(m Metric) error {
+	if reserved(c.prefix + m.Name()) {
+		return errors.Errorf("metric %v is under the subtree reserved for contributed metrics", m.Name())
+	}
+
+	if c.prefix != "" {
+		return c.registerPrefixed(m)
+	}
+
+	return c.r.AddMetric(m)
+}
 
 // MustRegister is simply a Register that can panic
 func (c *PCPClient) MustRegister(m Metric) {
@@ -682,6 +1037,11 @@ func (c *PCPClient) MustRegisterIndom(indom InstanceDomain) {
 
 // RegisterString is simply a shorthand for Registry().AddMetricByString
 func (c *PCPClient) RegisterString(str string, val interface{}, t MetricType, s MetricSemantics, u MetricUnit) (Metric, error) {
+	str = c.prefix + str
+	if reserved(str) {
+		return nil, errors.Errorf("metric %v is under the subtree reserved for contributed metrics", str)
+	}
+
 	return c.r.AddMetricByString(str, val, t, s, u)
 }
 
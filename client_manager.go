@@ -0,0 +1,207 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClientTemplate registers the metrics exported for a single key of a ClientManager
+// with a newly created client, before it is started.
+//
+// Metrics can only be registered with one client at a time, so a template
+// registers fresh metrics, or clones of shared ones, for every call.
+type ClientTemplate func(key string, c *PCPClient) error
+
+// ClientManager maintains a separate PCPClient, and hence a separate MMV file, for every
+// key passed to Client, for example for daemons exporting metrics per tenant or shard.
+//
+// The client for a key is created on first use, named "<name>.<key>", and stopped
+// once it has not been used for the idle duration, if expiry is running.
+type ClientManager struct {
+	mutex    sync.Mutex
+	name     string
+	template ClientTemplate
+	idle     time.Duration
+	clients  map[string]*managedClient
+
+	stop, done chan struct{}
+	now        func() time.Time
+}
+
+type managedClient struct {
+	c        *PCPClient
+	lastUsed time.Time
+}
+
+// NewClientManager creates a new ClientManager whose clients are named after the passed
+// name, get their metrics from the passed template and expire after being idle for the
+// passed duration, with 0 meaning they never expire.
+func NewClientManager(name string, template ClientTemplate, idle time.Duration) (*ClientManager, error) {
+	if name == "" {
+		return nil, errors.New("client manager name cannot be empty")
+	}
+
+	if template == nil {
+		return nil, errors.New("client manager needs a template")
+	}
+
+	if idle < 0 {
+		return nil, errors.New("idle duration cannot be negative")
+	}
+
+	return &ClientManager{
+		name:     name,
+		template: template,
+		idle:     idle,
+		clients:  make(map[string]*managedClient),
+		now:      time.Now,
+	}, nil
+}
+
+// Client returns the running client for the passed key,
+// creating, populating and starting it if it does not exist yet.
+func (m *ClientManager) Client(key string) (*PCPClient, error) {
+	if key == "" {
+		return nil, errors.New("client key cannot be empty")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if mc, present := m.clients[key]; present {
+		mc.lastUsed = m.now()
+		return mc.c, nil
+	}
+
+	c, err := NewPCPClient(m.name + "." + key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create a client for %v", key)
+	}
+
+	if err = m.template(key, c); err != nil {
+		return nil, errors.Wrapf(err, "cannot apply the template for %v", key)
+	}
+
+	if err = c.Start(); err != nil {
+		return nil, errors.Wrapf(err, "cannot start the client for %v", key)
+	}
+
+	m.clients[key] = &managedClient{c, m.now()}
+	return c, nil
+}
+
+// Keys returns the keys that currently have a client.
+func (m *ClientManager) Keys() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ans := make([]string, 0, len(m.clients))
+	for k := range m.clients {
+		ans = append(ans, k)
+	}
+	return ans
+}
+
+// Remove stops and forgets the client for the passed key.
+func (m *ClientManager) Remove(key string) error {
+	m.mutex.Lock()
+	mc, present := m.clients[key]
+	delete(m.clients, key)
+	m.mutex.Unlock()
+
+	if !present {
+		return errors.Errorf("no client for %v", key)
+	}
+
+	return mc.c.Stop()
+}
+
+// Expire stops and forgets all clients that have been idle for longer than the idle
+// duration, returning the expired keys.
+func (m *ClientManager) Expire() []string {
+	if m.idle == 0 {
+		return nil
+	}
+
+	m.mutex.Lock()
+	now := m.now()
+
+	var expired []*PCPClient
+	var keys []string
+	for k, mc := range m.clients {
+		if now.Sub(mc.lastUsed) > m.idle {
+			expired = append(expired, mc.c)
+			keys = append(keys, k)
+			delete(m.clients, k)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, c := range expired {
+		_ = c.Stop()
+	}
+
+	return keys
+}
+
+// Start starts expiring idle clients at the passed interval.
+func (m *ClientManager) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("expiry interval must be positive")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.stop != nil {
+		return errors.New("client manager is already running")
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	m.stop, m.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				m.Expire()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops expiring idle clients, and stops all the clients.
+func (m *ClientManager) Stop() error {
+	m.mutex.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+
+	clients := m.clients
+	m.clients = make(map[string]*managedClient)
+	m.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	var err error
+	for k, mc := range clients {
+		if serr := mc.c.Stop(); serr != nil && err == nil {
+			err = errors.Wrapf(serr, "cannot stop the client for %v", k)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,86 @@
+package speed
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestClientManager(t *testing.T) {
+	counters := make(map[string]*PCPCounter)
+
+	m, err := NewClientManager("test.manager", func(key string, c *PCPClient) error {
+		counter, err := NewPCPCounter(0, "requests")
+		if err != nil {
+			return err
+		}
+
+		counters[key] = counter
+		return c.Register(counter)
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	a, err := m.Client("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, _ := m.Client("a"); again != a {
+		t.Error("expected the same client to be returned for the same key")
+	}
+
+	now = now.Add(30 * time.Second)
+
+	if _, err = m.Client("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counters) != 2 || counters["a"] == counters["b"] {
+		t.Errorf("expected the template to be applied once per key, got %v", counters)
+	}
+
+	if _, err = m.Client("c/d"); err == nil {
+		t.Error("expected an error creating a client with a path separator in the key")
+	}
+
+	now = now.Add(45 * time.Second)
+
+	if expired := m.Expire(); len(expired) != 1 || expired[0] != "a" {
+		t.Errorf("expected a to expire, got %v", expired)
+	}
+
+	if keys := m.Keys(); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("expected only b to be left, got %v", keys)
+	}
+
+	if _, err = m.Client("a"); err != nil {
+		t.Fatalf("expected a to be recreated, got %v", err)
+	}
+
+	keys := m.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("expected a and b, got %v", keys)
+	}
+
+	if err = m.Start(0); err == nil {
+		t.Error("expected an error starting with a zero interval")
+	}
+
+	if err = m.Start(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Keys()) != 0 {
+		t.Errorf("expected all clients to be stopped, got %v", m.Keys())
+	}
+}
@@ -447,6 +447,56 @@ func TestUpdatingSingletonMetric(t *testing.T) {
 	}
 }
 
+func TestRestart(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := c.MustRegisterString("test.counter", int64(1), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+
+	h, _, _, _, _, _, _, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+	gen := h.G1
+
+	c.MustStop()
+
+	// values set and metrics registered while stopped are written on the next start
+	counter.MustSet(int64(2))
+	gauge := c.MustRegisterString("test.gauge", 4.2, DoubleType, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	h, _, metrics, values, instances, _, strings, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	if h.G1 <= gen {
+		t.Errorf("expected the generation to be bumped from %v, got %v", gen, h.G1)
+	}
+
+	if len(metrics) != 2 {
+		t.Errorf("expected 2 metrics to be written, got %v", len(metrics))
+	}
+
+	matchMetricsAndValues(metrics, values, instances, strings, c, t)
+
+	counter.MustSet(int64(3))
+	gauge.MustSet(4.3)
+
+	_, _, metrics, values, instances, _, strings, err = mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, instances, strings, c, t)
+}
+
 func matchInstance(i mmvdump.Instance, pi *pcpInstance, id *PCPInstanceDomain, indoms map[uint64]*mmvdump.InstanceDomain, strings map[uint64]*mmvdump.String, t *testing.T) {
 	off, _ := findInstanceDomain(id, indoms)
 	if i.Indom() != off {
@@ -505,6 +555,47 @@ func matchInstancesAndInstanceDomains(
 	}
 }
 
+func TestDeterministicLayout(t *testing.T) {
+	metrics := []string{
+		"test.a[x,y,z]",
+		"test.b[x,y,z]",
+		"test.c",
+		"test.d[p,q]",
+		"test.e",
+	}
+
+	layout := func(order []int) []byte {
+		c, err := NewPCPClient("test", WithoutLocalFile(), WithDeterministicOutput())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, i := range order {
+			var val interface{} = Instances{"x": "1", "y": "2", "z": "3"}
+			switch {
+			case i == 3:
+				val = Instances{"p": "4", "q": "5"}
+			case i == 2 || i == 4:
+				val = "6"
+			}
+
+			c.MustRegisterString(metrics[i], val, StringType, InstantSemantics, OneUnit)
+		}
+
+		c.MustStart()
+		defer c.MustStop()
+
+		return append([]byte(nil), c.writer.Bytes()...)
+	}
+
+	expected := layout([]int{0, 1, 2, 3, 4})
+	for _, order := range [][]int{{4, 3, 2, 1, 0}, {2, 0, 4, 1, 3}} {
+		if got := layout(order); string(got) != string(expected) {
+			t.Errorf("expected the same layout when registering metrics in the order %v", order)
+		}
+	}
+}
+
 func TestWritingInstanceMetric(t *testing.T) {
 	c, err := NewPCPClient("test")
 	if err != nil {
@@ -1214,3 +1305,73 @@ func TestHistogram(t *testing.T) {
 		}
 	}
 }
+
+func TestHistogramsAcrossClients(t *testing.T) {
+	hs := make([]*PCPHistogram, 3)
+	for i := range hs {
+		h, err := NewPCPHistogram(fmt.Sprintf("test.hist%v", i), 0, 100, 5, OneUnit)
+		if err != nil {
+			t.Fatalf("cannot create metric, error: %v", err)
+		}
+		hs[i] = h
+	}
+
+	if hs[0].Indom() == hs[1].Indom() {
+		t.Error("expected histograms not to share an instance domain")
+	}
+
+	c1, err := NewPCPClient("test1")
+	if err != nil {
+		t.Fatalf("cannot create client, error: %v", err)
+	}
+
+	c2, err := NewPCPClient("test2")
+	if err != nil {
+		t.Fatalf("cannot create client, error: %v", err)
+	}
+
+	// register an unrelated indom in the second client,
+	// so the instances end up at different offsets
+	other, err := NewPCPInstanceDomain("test.other", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("cannot create indom, error: %v", err)
+	}
+
+	c2.MustRegisterIndom(other)
+	c1.MustRegister(hs[0])
+	c1.MustRegister(hs[1])
+	c2.MustRegister(hs[2])
+
+	if c1.Registry().InstanceDomainCount() != 1 {
+		t.Errorf("expected the histograms to share a single indom in a registry, got %v", c1.Registry().InstanceDomainCount())
+	}
+
+	c1.MustStart()
+	defer c1.MustStop()
+
+	c2.MustStart()
+	defer c2.MustStop()
+
+	for _, c := range []struct {
+		c *PCPClient
+		h *PCPHistogram
+	}{{c1, hs[1]}, {c2, hs[2]}} {
+		c.h.MustRecord(42)
+
+		_, _, m, v, _, _, _, err := mmvdump.Dump(c.c.writer.Bytes())
+		if err != nil {
+			t.Fatalf("cannot create dump, error: %v", err)
+		}
+
+		off := c.c.r.instanceDomain("histogram").instances["max"].offset
+		moff, _ := findMetric(c.h, m)
+		_, dv := findInstanceValue(moff, uint64(off), v)
+		if dv == nil {
+			t.Fatalf("expected a value for the max instance of %v", c.h.Name())
+		}
+
+		if val, _ := mmvdump.FixedVal(uint64(dv.Val), mmvdump.DoubleType); val != float64(42) {
+			t.Errorf("expected max of %v to be 42, got %v", c.h.Name(), val)
+		}
+	}
+}
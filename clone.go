@@ -0,0 +1,247 @@
+package speed
+
+import (
+	"sync"
+	"sync/atomic"
+
+	histogram "github.com/codahale/hdrhistogram"
+)
+
+// Cloning creates copies of metrics and instance domains that hold the same
+// description and current values, but are not bound to any client, so they can
+// be registered with a different client than the original, for example to
+// export the same set of metrics in a separate MMV file per tenant.
+//
+// Values set on a clone are independent of the values set on the original.
+
+// Clone returns a detached copy of the instance domain.
+func (indom *PCPInstanceDomain) Clone() *PCPInstanceDomain {
+	indom.mutex.RLock()
+	defer indom.mutex.RUnlock()
+
+	ans := &PCPInstanceDomain{
+		id:               indom.id,
+		name:             indom.name,
+		instances:        make(map[string]*pcpInstance, len(indom.instances)),
+		shortDescription: indom.shortDescription,
+		longDescription:  indom.longDescription,
+	}
+
+	for name, i := range indom.instances {
+		ans.instances[name] = &pcpInstance{name: name, id: i.id}
+	}
+
+	return ans
+}
+
+func (h *historyRing) clone() *historyRing {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return &historyRing{
+		entries: append([]HistoryEntry(nil), h.entries...),
+		next:    h.next,
+		full:    h.full,
+	}
+}
+
+func (md *pcpMetricDesc) clone() *pcpMetricDesc {
+	ans := *md
+	ans.commitMutex = new(sync.Mutex)
+	ans.registered = 0
+	ans.lazyStart = atomic.Value{}
+
+	if md.history != nil {
+		ans.history = md.history.clone()
+	}
+
+	// the weights of a clone do not affect the metrics they weight
+	ans.weighting = nil
+
+	ans.companions = nil
+	if md.epoch != nil {
+		ans.epoch = md.epoch.Clone()
+		ans.companions = append(ans.companions, ans.epoch)
+	}
+
+	if md.dropped != nil {
+		ans.dropped = md.dropped.Clone()
+		ans.companions = append(ans.companions, ans.dropped)
+	}
+
+	if md.ttl != nil {
+		// the clone starts tracking afresh, so none of its values are stale
+		count := md.ttl.count.Clone()
+		count.val = uint32(0)
+
+		ans.ttl = newttlTracker(md.ttl.ttl, count)
+		ans.companions = append(ans.companions, ans.ttl.count)
+	}
+
+	return &ans
+}
+
+func (m *pcpSingletonMetric) clone() *pcpSingletonMetric {
+	return &pcpSingletonMetric{m.pcpMetricDesc.clone(), m.val, nil, 0, m.assigned}
+}
+
+func (m *pcpInstanceMetric) clone() *pcpInstanceMetric {
+	vals := make(map[string]*instanceValue, len(m.vals))
+	for name, v := range m.vals {
+		vals[name] = newinstanceValue(v.val)
+		vals[name].assigned = v.assigned
+	}
+
+	desc := m.pcpMetricDesc.clone()
+	desc.instanceValues = vals
+
+	if m.rollup != nil {
+		rollups := make([]rollup, len(m.rollup.rollups))
+		for i, r := range m.rollup.rollups {
+			rollups[i] = rollup{r.kind, r.metric.Clone()}
+			desc.companions = append(desc.companions, rollups[i].metric)
+		}
+
+		desc.rollup = newrollupTracker(vals, rollups)
+	}
+
+	if m.weighted != nil {
+		desc.weighted = m.weighted.clone()
+		desc.companions = append(desc.companions, desc.weighted.metric)
+	}
+
+	return &pcpInstanceMetric{desc, m.indom.Clone(), vals}
+}
+
+// Clone returns a detached copy of the metric.
+func (m *PCPSingletonMetric) Clone() *PCPSingletonMetric {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return &PCPSingletonMetric{pcpSingletonMetric: m.pcpSingletonMetric.clone()}
+}
+
+// Clone returns a detached copy of the metric.
+func (m *PCPConstMetric) Clone() *PCPConstMetric {
+	return &PCPConstMetric{m.pcpMetricDesc.clone(), m.val, 0}
+}
+
+// Clone returns a detached copy of the metric.
+func (e *PCPEnum) Clone() *PCPEnum {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return &PCPEnum{pcpSingletonMetric: e.pcpSingletonMetric.clone(), labels: e.labels, values: e.values}
+}
+
+// Clone returns a detached copy of the metric.
+func (b *PCPBitField) Clone() *PCPBitField {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return &PCPBitField{pcpSingletonMetric: b.pcpSingletonMetric.clone(), bits: b.bits}
+}
+
+// Clone returns a detached copy of the metric.
+func (p *PCPPercentage) Clone() *PCPPercentage {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return &PCPPercentage{pcpSingletonMetric: p.pcpSingletonMetric.clone()}
+}
+
+// Clone returns a detached copy of the metric.
+func (c *PCPCounter) Clone() *PCPCounter {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return &PCPCounter{pcpSingletonMetric: c.pcpSingletonMetric.clone()}
+}
+
+// Clone returns a detached copy of the metric.
+func (g *PCPGauge) Clone() *PCPGauge {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return &PCPGauge{pcpSingletonMetric: g.pcpSingletonMetric.clone()}
+}
+
+// Clone returns a detached copy of the metric, including a running timer.
+func (t *PCPTimer) Clone() *PCPTimer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return &PCPTimer{
+		pcpSingletonMetric: t.pcpSingletonMetric.clone(),
+		started:            t.started,
+		since:              t.since,
+	}
+}
+
+// Clone returns a detached copy of the metric, along with a copy of its instance domain.
+func (m *PCPInstanceMetric) Clone() *PCPInstanceMetric {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return &PCPInstanceMetric{pcpInstanceMetric: m.pcpInstanceMetric.clone()}
+}
+
+// Clone returns a detached copy of the metric.
+func (c *PCPCounterVector) Clone() *PCPCounterVector {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return &PCPCounterVector{pcpInstanceMetric: c.pcpInstanceMetric.clone()}
+}
+
+// Clone returns a detached copy of the metric.
+func (g *PCPGaugeVector) Clone() *PCPGaugeVector {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return &PCPGaugeVector{pcpInstanceMetric: g.pcpInstanceMetric.clone()}
+}
+
+// Clone returns a detached copy of the histogram, including all recorded values.
+func (h *PCPHistogram) Clone() *PCPHistogram {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var b histogramBackend
+	switch v := h.h.(type) {
+	case *histogram.Histogram:
+		b = histogram.Import(v.Export())
+	case *tdigest:
+		b = v.clone()
+	}
+
+	return &PCPHistogram{pcpInstanceMetric: h.pcpInstanceMetric.clone(), h: b}
+}
+
+func (t *tdigest) clone() *tdigest {
+	ans := *t
+	ans.centroids = append([]centroid(nil), t.centroids...)
+	ans.buffer = append(make([]centroid, 0, cap(t.buffer)), t.buffer...)
+	return &ans
+}
+
+// Clone returns a detached copy of the SLO, including all observations.
+func (s *PCPSLO) Clone() *PCPSLO {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	windows := make([]*sloWindow, len(s.windows))
+	for i, w := range s.windows {
+		windows[i] = &sloWindow{w.name, w.width, append([]sloBucket(nil), w.buckets...)}
+	}
+
+	return &PCPSLO{
+		pcpInstanceMetric: s.pcpInstanceMetric.clone(),
+		target:            s.target,
+		threshold:         s.threshold,
+		good:              s.good,
+		bad:               s.bad,
+		windows:           windows,
+		now:               s.now,
+	}
+}
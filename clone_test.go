@@ -0,0 +1,110 @@
+package speed
+
+import (
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestCloneAcrossClients(t *testing.T) {
+	counter, err := NewPCPCounter(10, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPGaugeVector(map[string]float64{"a": 1, "b": 2}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1, err := NewPCPClient("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, err := NewPCPClient("test2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1.MustRegister(counter)
+	c1.MustRegister(vector)
+	c1.MustStart()
+	defer c1.MustStop()
+
+	counterClone, vectorClone := counter.Clone(), vector.Clone()
+	if counterClone.Val() != 10 {
+		t.Errorf("expected the clone to start at 10, got %v", counterClone.Val())
+	}
+
+	if vectorClone.Indom() == vector.Indom() {
+		t.Error("expected the clone to have its own instance domain")
+	}
+
+	c2.MustRegister(counterClone)
+	c2.MustRegister(vectorClone)
+	c2.MustStart()
+	defer c2.MustStop()
+
+	counter.Inc(1)
+	counterClone.Inc(5)
+	vector.MustSet(3, "a")
+	vectorClone.MustSet(4, "a")
+
+	if counter.Val() != 11 || counterClone.Val() != 15 {
+		t.Errorf("expected independent values 11 and 15, got %v and %v", counter.Val(), counterClone.Val())
+	}
+
+	for _, c := range []struct {
+		client  *PCPClient
+		counter *PCPCounter
+		vector  *PCPGaugeVector
+	}{{c1, counter, vector}, {c2, counterClone, vectorClone}} {
+		_, _, m, v, i, id, s, err := mmvdump.Dump(c.client.writer.Bytes())
+		if err != nil {
+			t.Fatalf("cannot create dump, error: %v", err)
+		}
+
+		matchMetricsAndValues(m, v, i, s, c.client, t)
+		matchInstancesAndInstanceDomains(i, id, s, c.client, t)
+	}
+}
+
+func TestCloneHistogram(t *testing.T) {
+	for _, h := range []*PCPHistogram{
+		newTestHistogram(t, false),
+		newTestHistogram(t, true),
+	} {
+		h.MustRecord(10)
+
+		clone := h.Clone()
+		clone.MustRecord(90)
+
+		if h.Max() != 10 {
+			t.Errorf("expected the original to be unaffected by the clone, got max %v", h.Max())
+		}
+
+		if clone.Min() != 10 || clone.Max() != 90 {
+			t.Errorf("expected the clone to have min 10 and max 90, got %v and %v", clone.Min(), clone.Max())
+		}
+	}
+}
+
+func newTestHistogram(t *testing.T, tdigest bool) *PCPHistogram {
+	var (
+		h   *PCPHistogram
+		err error
+	)
+
+	if tdigest {
+		h, err = NewPCPTDigestHistogram("test.hist", 0, 100, DefaultTDigestCompression, OneUnit)
+	} else {
+		h, err = NewPCPHistogram("test.hist", 0, 100, 5, OneUnit)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
@@ -0,0 +1,67 @@
+// speedcat prints a description of all metrics exported in an MMV file,
+// as JSON or as a table, for generating documentation or validating dashboards.
+//
+// MMV files are written to $PCP_TMP_DIR/mmv, named after the client.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/performancecopilot/speed"
+)
+
+var table = flag.Bool("table", false, "print a table instead of JSON")
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		fmt.Println("usage: speedcat [-table] <file>")
+		return
+	}
+
+	d, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	catalog, err := speed.ReadCatalog(d)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *table {
+		err = writeTable(catalog)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(catalog)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeTable(catalog []speed.CatalogEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "NAME\tTYPE\tSEMANTICS\tUNIT\tINSTANCES\tHELP")
+	for _, e := range catalog {
+		instances := "-"
+		if e.Indom != nil {
+			instances = strings.Join(e.Indom.Instances, ",")
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", e.Name, e.Type, e.Semantics, e.Unit, instances, e.ShortHelp)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,174 @@
+package speed
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// CoercionPolicy defines how values passed to Set are converted to the
+// MetricType of a metric.
+type CoercionPolicy int
+
+// Possible values for a CoercionPolicy
+const (
+	// DefaultCoercion resolves untyped constants, i.e. int, uint and float64,
+	// to a metric type of the same kind, and requires other values to match the
+	// metric type exactly. This is the behaviour of metrics without WithCoercion.
+	DefaultCoercion CoercionPolicy = iota
+
+	// StrictCoercion requires the value to be of the exact go type
+	// of the metric type, for example int32 for Int32Type.
+	StrictCoercion
+
+	// NumericCoercion converts any numeric value to the metric type, across integer
+	// and floating point kinds, as long as the value is representable without loss.
+	// Values that cannot be converted exactly are handled as in DefaultCoercion.
+	NumericCoercion
+)
+
+// WithCoercion sets the policy used for converting values passed to Set.
+// The initial value passed to the constructor is always resolved using
+// DefaultCoercion.
+func WithCoercion(p CoercionPolicy) MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if p < DefaultCoercion || p > NumericCoercion {
+			return errors.Errorf("invalid coercion policy %d", p)
+		}
+
+		md.coercion = p
+		return nil
+	}
+}
+
+// coerce converts the passed value to the metric type following the metric's policy
+func (md *pcpMetricDesc) coerce(val interface{}) (interface{}, error) {
+	switch md.coercion {
+	case StrictCoercion:
+		if !md.t.isExact(val) {
+			return nil, errors.Errorf("value %v(%T) is not of MetricType %v", val, val, md.t)
+		}
+		return val, nil
+	case NumericCoercion:
+		if v, ok := md.t.convert(val); ok {
+			return v, nil
+		}
+	}
+
+	if !md.t.IsCompatible(val) {
+		return nil, errors.Errorf("value %v(%T) is incompatible with MetricType %v", val, val, md.t)
+	}
+
+	return md.t.resolve(val), nil
+}
+
+// isExact checks if the go type of the value is the one stored for the MetricType
+func (m MetricType) isExact(val interface{}) bool {
+	switch val.(type) {
+	case int32:
+		return m == Int32Type
+	case int64:
+		return m == Int64Type
+	case uint32:
+		return m == Uint32Type
+	case uint64:
+		return m == Uint64Type
+	case float32:
+		return m == FloatType
+	case float64:
+		return m == DoubleType
+	case string:
+		return m == StringType
+	}
+	return false
+}
+
+const maxExactFloat = 1 << 53
+
+// convert converts any numeric value to the MetricType,
+// failing if the value cannot be represented exactly
+func (m MetricType) convert(val interface{}) (interface{}, bool) {
+	var (
+		i       int64
+		u       uint64
+		f       float64
+		signed  = true
+		integer = true
+	)
+
+	switch v := widen(val).(type) {
+	case int:
+		i = int64(v)
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint:
+		u, signed = uint64(v), false
+	case uint32:
+		u, signed = uint64(v), false
+	case uint64:
+		u, signed = v, false
+	case float32:
+		f, integer = float64(v), false
+	case float64:
+		f, integer = v, false
+	default:
+		return nil, false
+	}
+
+	if !integer {
+		if f != math.Trunc(f) || math.IsInf(f, 0) {
+			return m.convertFloat(f)
+		}
+
+		switch {
+		case f >= math.MinInt64 && f < math.MaxInt64:
+			i = int64(f)
+		case f >= 0 && f < math.MaxUint64:
+			u, signed = uint64(f), false
+		default:
+			return m.convertFloat(f)
+		}
+	}
+
+	if signed && i >= 0 {
+		u = uint64(i)
+	} else if !signed && u <= math.MaxInt64 {
+		i, signed = int64(u), true
+	}
+
+	switch m {
+	case Int32Type:
+		return int32(i), signed && i >= math.MinInt32 && i <= math.MaxInt32
+	case Int64Type:
+		return i, signed
+	case Uint32Type:
+		return uint32(u), (!signed || i >= 0) && u <= math.MaxUint32
+	case Uint64Type:
+		return u, !signed || i >= 0
+	case FloatType, DoubleType:
+		// integers beyond 2^53 cannot be represented exactly by a float64
+		if signed && (i > maxExactFloat || i < -maxExactFloat) || !signed && u > maxExactFloat {
+			return nil, false
+		}
+
+		if signed {
+			return m.convertFloat(float64(i))
+		}
+		return m.convertFloat(float64(u))
+	}
+
+	return nil, false
+}
+
+// convertFloat converts a float64 to a floating point MetricType
+func (m MetricType) convertFloat(f float64) (interface{}, bool) {
+	switch m {
+	case FloatType:
+		return float32(f), math.IsNaN(f) || math.IsInf(f, 0) || float64(float32(f)) == f
+	case DoubleType:
+		return f, true
+	}
+	return nil, false
+}
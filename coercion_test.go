@@ -0,0 +1,66 @@
+package speed
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoercionPolicies(t *testing.T) {
+	cases := []struct {
+		p      CoercionPolicy
+		t      MetricType
+		val    interface{}
+		result interface{} // nil if the value is rejected
+	}{
+		{DefaultCoercion, DoubleType, 10, nil},
+		{DefaultCoercion, Int64Type, 10, int64(10)},
+		{DefaultCoercion, FloatType, 1.5, float32(1.5)},
+
+		{StrictCoercion, Int64Type, 10, nil},
+		{StrictCoercion, Int64Type, int64(10), int64(10)},
+		{StrictCoercion, FloatType, 1.5, nil},
+		{StrictCoercion, DoubleType, 1.5, 1.5},
+
+		{NumericCoercion, DoubleType, 10, float64(10)},
+		{NumericCoercion, FloatType, int64(3), float32(3)},
+		{NumericCoercion, Int32Type, 3.0, int32(3)},
+		{NumericCoercion, Int32Type, 3.5, nil},
+		{NumericCoercion, Uint32Type, int64(-1), nil},
+		{NumericCoercion, Uint64Type, int8(7), uint64(7)},
+		{NumericCoercion, Int64Type, uint64(math.MaxUint64), nil},
+		{NumericCoercion, Int32Type, int64(math.MaxInt32 + 1), nil},
+		{NumericCoercion, DoubleType, int64(1<<53 + 1), nil},
+		{NumericCoercion, StringType, 10, nil},
+	}
+
+	zeros := map[MetricType]interface{}{
+		Int32Type: int32(0), Int64Type: int64(0), Uint32Type: uint32(0), Uint64Type: uint64(0),
+		FloatType: float32(0), DoubleType: float64(0), StringType: "",
+	}
+
+	for _, c := range cases {
+		m, err := NewPCPSingletonMetric(zeros[c.t], "test.coercion", c.t, InstantSemantics, OneUnit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = m.Apply(WithCoercion(c.p)); err != nil {
+			t.Fatal(err)
+		}
+
+		err = m.Set(c.val)
+		switch {
+		case c.result == nil && err == nil:
+			t.Errorf("expected setting %v(%T) on %v with policy %v to fail, got %v(%T)", c.val, c.val, c.t, c.p, m.Val(), m.Val())
+		case c.result != nil && err != nil:
+			t.Errorf("expected setting %v(%T) on %v with policy %v to succeed, got %v", c.val, c.val, c.t, c.p, err)
+		case c.result != nil && m.Val() != c.result:
+			t.Errorf("expected setting %v(%T) on %v with policy %v to give %v(%T), got %v(%T)", c.val, c.val, c.t, c.p, c.result, c.result, m.Val(), m.Val())
+		}
+	}
+
+	m, _ := NewPCPSingletonMetric(10, "test.coercion", Int32Type, InstantSemantics, OneUnit)
+	if err := m.Apply(WithCoercion(CoercionPolicy(42))); err == nil {
+		t.Error("expected an error applying an invalid coercion policy")
+	}
+}
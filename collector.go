@@ -0,0 +1,251 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Desc describes a metric exported by a Collector.
+type Desc struct {
+	Name      string
+	Type      MetricType
+	Semantics MetricSemantics
+	Unit      MetricUnit
+	Instances []string // nil for singleton metrics
+
+	ShortHelp, LongHelp string
+}
+
+// Recorder receives the values collected by a Collector.
+type Recorder interface {
+	// sets the value of a singleton metric described by the collector
+	Record(name string, val interface{}) error
+
+	// sets the value of an instance of an instance metric described by the collector
+	RecordInstance(name, instance string, val interface{}) error
+}
+
+// Collector defines the contract for reusable collectors, like the collectors
+// of the Prometheus client, which describe the metrics they export once, and
+// are then periodically asked to collect their values, see RegisterCollector.
+type Collector interface {
+	// sends the descriptions of all metrics exported by the collector,
+	// the channel is closed by the caller when Describe returns
+	Describe(chan<- Desc)
+
+	// records the current values of the metrics described by the collector
+	Collect(Recorder)
+}
+
+// zero returns the zero value of a MetricType
+func (m MetricType) zero() interface{} {
+	switch m {
+	case Int32Type:
+		return int32(0)
+	case Uint32Type:
+		return uint32(0)
+	case Int64Type:
+		return int64(0)
+	case Uint64Type:
+		return uint64(0)
+	case FloatType:
+		return float32(0)
+	case DoubleType:
+		return float64(0)
+	}
+
+	return ""
+}
+
+// newDescribedMetric creates a metric for a description, with zero values
+func newDescribedMetric(d Desc) (PCPMetric, error) {
+	desc := []string{d.ShortHelp, d.LongHelp}
+
+	if d.Instances == nil {
+		return NewPCPSingletonMetric(d.Type.zero(), d.Name, d.Type, d.Semantics, d.Unit, desc...)
+	}
+
+	indom, err := NewPCPInstanceDomain(d.Name+".indom", d.Instances)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPCPInstanceMetric(zeroInstances(d.Instances, d.Type.zero()), d.Name, indom, d.Type, d.Semantics, d.Unit, desc...)
+}
+
+// collectorRunner periodically collects the values of a registered Collector
+type collectorRunner struct {
+	collector Collector
+	interval  time.Duration
+	metrics   map[string]PCPMetric
+
+	mutex      sync.Mutex
+	quit, done chan struct{}
+}
+
+func (r *collectorRunner) Record(name string, val interface{}) error {
+	m, ok := r.metrics[name].(*PCPSingletonMetric)
+	if !ok {
+		return errors.Errorf("%v is not a singleton metric described by the collector", name)
+	}
+
+	return m.Set(val)
+}
+
+func (r *collectorRunner) RecordInstance(name, instance string, val interface{}) error {
+	m, ok := r.metrics[name].(*PCPInstanceMetric)
+	if !ok {
+		return errors.Errorf("%v is not an instance metric described by the collector", name)
+	}
+
+	return m.SetInstance(val, instance)
+}
+
+func (r *collectorRunner) start() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.quit != nil {
+		return
+	}
+
+	quit, done := make(chan struct{}), make(chan struct{})
+	r.quit, r.done = quit, done
+	interval := r.interval
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				r.collector.Collect(r)
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+func (r *collectorRunner) stop() {
+	r.mutex.Lock()
+	quit, done := r.quit, r.done
+	r.quit, r.done = nil, nil
+	r.mutex.Unlock()
+
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+}
+
+// setInterval changes the collection interval, restarting the collection if it is running
+func (r *collectorRunner) setInterval(d time.Duration) {
+	r.mutex.Lock()
+	running := r.quit != nil
+	r.mutex.Unlock()
+
+	if running {
+		r.stop()
+	}
+
+	r.mutex.Lock()
+	r.interval = d
+	r.mutex.Unlock()
+
+	if running {
+		r.start()
+	}
+}
+
+// RegisterCollector registers the metrics described by the collector, and makes the
+// client collect their values every interval while it is started, as well as once
+// on every Start, so the values are current from the beginning.
+//
+// Like metrics, collectors have to be registered before the client is started.
+func (c *PCPClient) RegisterCollector(col Collector, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("collection interval must be positive")
+	}
+
+	descs := make(chan Desc)
+	go func() {
+		col.Describe(descs)
+		close(descs)
+	}()
+
+	var ds []Desc
+	for d := range descs {
+		ds = append(ds, d)
+	}
+
+	r := &collectorRunner{collector: col, interval: interval, metrics: make(map[string]PCPMetric, len(ds))}
+	for _, d := range ds {
+		if _, ok := r.metrics[d.Name]; ok {
+			return errors.Errorf("collector describes metric %v more than once", d.Name)
+		}
+
+		m, err := newDescribedMetric(d)
+		if err != nil {
+			return errors.Wrapf(err, "cannot create collected metric %v", d.Name)
+		}
+
+		r.metrics[d.Name] = m
+	}
+
+	for _, m := range r.metrics {
+		if c.r.HasMetric(c.prefix + m.Name()) {
+			return errors.Errorf("collected metric %v is already registered", c.prefix+m.Name())
+		}
+	}
+
+	for _, d := range ds {
+		if err := c.Register(r.metrics[d.Name]); err != nil {
+			return err
+		}
+	}
+
+	c.mutex.Lock()
+	c.collectors = append(c.collectors, r)
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// collect collects the values of all collectors once
+func (c *PCPClient) collect() {
+	for _, r := range c.collectors {
+		r.collector.Collect(r)
+	}
+}
+
+// startCollectors starts the periodic collection of all collectors
+func (c *PCPClient) startCollectors() {
+	for _, r := range c.collectors {
+		r.start()
+	}
+
+	if c.persistence != nil {
+		c.persistence.start()
+	}
+}
+
+// stopCollectors stops the periodic collection of all collectors
+func (c *PCPClient) stopCollectors() {
+	c.mutex.Lock()
+	collectors := c.collectors
+	c.mutex.Unlock()
+
+	for _, r := range collectors {
+		r.stop()
+	}
+
+	if c.persistence != nil {
+		c.persistence.stop()
+	}
+}
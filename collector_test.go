@@ -0,0 +1,104 @@
+package speed
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCollector struct {
+	collections int64
+	err         error
+}
+
+func (t *testCollector) Describe(ch chan<- Desc) {
+	ch <- Desc{Name: "test.collections", Type: Int64Type, Semantics: CounterSemantics, Unit: OneUnit, ShortHelp: "collections"}
+	ch <- Desc{Name: "test.queues", Type: Uint32Type, Semantics: InstantSemantics, Unit: OneUnit, Instances: []string{"a", "b"}}
+}
+
+func (t *testCollector) Collect(r Recorder) {
+	n := atomic.AddInt64(&t.collections, 1)
+
+	if err := r.Record("test.collections", n); err != nil {
+		t.err = err
+	}
+
+	if err := r.RecordInstance("test.queues", "b", uint32(n*2)); err != nil {
+		t.err = err
+	}
+}
+
+type duplicateCollector struct{}
+
+func (duplicateCollector) Describe(ch chan<- Desc) {
+	ch <- Desc{Name: "test.dup", Type: Int32Type, Semantics: InstantSemantics, Unit: OneUnit}
+	ch <- Desc{Name: "test.dup", Type: Int32Type, Semantics: InstantSemantics, Unit: OneUnit}
+}
+
+func (duplicateCollector) Collect(Recorder) {}
+
+func TestRegisterCollector(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col := &testCollector{}
+	if err = c.RegisterCollector(col, 0); err == nil {
+		t.Error("expected an error registering a collector with a zero interval")
+	}
+
+	if err = c.RegisterCollector(duplicateCollector{}, time.Second); err == nil {
+		t.Error("expected an error registering a collector describing a metric twice")
+	}
+
+	if c.Registry().HasMetric("test.dup") {
+		t.Error("expected nothing to be registered for an invalid collector")
+	}
+
+	if err = c.RegisterCollector(col, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.RegisterCollector(&testCollector{}, time.Second); err == nil {
+		t.Error("expected an error registering a collector for metrics that are already registered")
+	}
+
+	c.MustStart()
+
+	// the first collection happens on Start
+	collections := c.r.metrics["test.collections"].(*PCPSingletonMetric)
+	if collections.Val().(int64) < 1 {
+		t.Error("expected the collector to be collected on Start")
+	}
+
+	if !waitFor(func() bool { return atomic.LoadInt64(&col.collections) >= 3 }) {
+		t.Fatal("expected the collector to be collected periodically")
+	}
+
+	c.MustStop()
+
+	n := atomic.LoadInt64(&col.collections)
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt64(&col.collections) != n {
+		t.Error("expected collection to stop with the client")
+	}
+
+	if col.err != nil {
+		t.Errorf("unexpected error recording values: %v", col.err)
+	}
+
+	queues := c.r.metrics["test.queues"].(*PCPInstanceMetric)
+	if v, _ := queues.ValInstance("b"); v != uint32(n*2) {
+		t.Errorf("expected the instance b to be %v, got %v", n*2, v)
+	}
+
+	r := c.collectors[0]
+	if err = r.Record("test.queues", uint32(1)); err == nil {
+		t.Error("expected an error recording an instance metric as a singleton")
+	}
+
+	if err = r.RecordInstance("test.unknown", "a", uint32(1)); err == nil {
+		t.Error("expected an error recording an unknown metric")
+	}
+}
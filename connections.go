@@ -0,0 +1,144 @@
+package speed
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OtherEndpoint is the instance that connections to undeclared endpoints are counted under
+const OtherEndpoint = "other"
+
+// MessageDirection is an enumerated type for the direction of a message on a connection.
+type MessageDirection int
+
+// Possible values for a MessageDirection
+const (
+	Inbound MessageDirection = iota
+	Outbound
+)
+
+// ConnectionMetrics instruments servers with long lived connections, like WebSocket
+// or streaming servers, which request middleware cannot instrument, exporting per
+// endpoint the number of connected clients, the number of connections accepted,
+// and the number of messages received and sent. The total number of connected
+// clients is exported as "<prefix>.connected.sum".
+//
+// The endpoints have to be declared on construction, as instances cannot be added
+// once a mapping is active. Connections to other endpoints are counted under OtherEndpoint.
+type ConnectionMetrics struct {
+	mutex     sync.Mutex
+	endpoints map[string]bool
+
+	connected   *PCPGaugeVector
+	connections *PCPCounterVector
+	in, out     *PCPCounterVector
+}
+
+// NewConnectionMetrics creates a new ConnectionMetrics with all metrics under the passed prefix.
+func NewConnectionMetrics(prefix string, endpoints ...string) (*ConnectionMetrics, error) {
+	if prefix == "" {
+		return nil, errors.New("connection metrics prefix cannot be empty")
+	}
+
+	m := &ConnectionMetrics{endpoints: make(map[string]bool, len(endpoints))}
+
+	gauges := map[string]float64{OtherEndpoint: 0}
+	counts := map[string]int64{OtherEndpoint: 0}
+	for _, e := range endpoints {
+		if e == OtherEndpoint || m.endpoints[e] {
+			return nil, errors.Errorf("endpoint %v declared twice", e)
+		}
+
+		m.endpoints[e] = true
+		gauges[e], counts[e] = 0, 0
+	}
+
+	var err error
+	if m.connected, err = NewPCPGaugeVector(gauges, prefix+".connected", "number of connected clients"); err != nil {
+		return nil, err
+	}
+
+	if err = m.connected.Apply(WithRollup(SumRollup)); err != nil {
+		return nil, err
+	}
+
+	if m.connections, err = NewPCPCounterVector(counts, prefix+".connections", "number of accepted connections"); err != nil {
+		return nil, err
+	}
+
+	if m.in, err = NewPCPCounterVector(counts, prefix+".messages.in", "number of messages received"); err != nil {
+		return nil, err
+	}
+
+	if m.out, err = NewPCPCounterVector(counts, prefix+".messages.out", "number of messages sent"); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Metrics returns all the metrics exported by the helper.
+func (m *ConnectionMetrics) Metrics() []Metric {
+	return []Metric{m.connected, m.connections, m.in, m.out}
+}
+
+// Register registers all metrics of the helper with the passed client.
+func (m *ConnectionMetrics) Register(c Client) error {
+	for _, metric := range m.Metrics() {
+		if err := c.Register(metric); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// instance returns the instance an endpoint is counted under
+func (m *ConnectionMetrics) instance(endpoint string) string {
+	if m.endpoints[endpoint] {
+		return endpoint
+	}
+
+	return OtherEndpoint
+}
+
+// OnConnect records a client connecting to an endpoint.
+func (m *ConnectionMetrics) OnConnect(endpoint string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := m.instance(endpoint)
+	if err := m.connections.Inc(1, i); err != nil {
+		return err
+	}
+
+	return m.connected.Inc(1, i)
+}
+
+// OnDisconnect records a client disconnecting from an endpoint.
+func (m *ConnectionMetrics) OnDisconnect(endpoint string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := m.instance(endpoint)
+	if v, _ := m.connected.Val(i); v <= 0 {
+		return errors.Errorf("no clients connected to %v", endpoint)
+	}
+
+	return m.connected.Dec(1, i)
+}
+
+// OnMessage records a message received or sent on a connection to an endpoint.
+func (m *ConnectionMetrics) OnMessage(endpoint string, dir MessageDirection) error {
+	i := m.instance(endpoint)
+
+	switch dir {
+	case Inbound:
+		return m.in.Inc(1, i)
+	case Outbound:
+		return m.out.Inc(1, i)
+	}
+
+	return errors.Errorf("invalid message direction %v", dir)
+}
@@ -0,0 +1,72 @@
+package speed
+
+import "testing"
+
+func TestConnectionMetrics(t *testing.T) {
+	m, err := NewConnectionMetrics("test.ws", "chat", "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	for _, e := range []string{"chat", "chat", "feed", "unknown"} {
+		if err = m.OnConnect(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = m.OnDisconnect("chat"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.OnDisconnect("feed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.OnDisconnect("feed"); err == nil {
+		t.Error("expected an error disconnecting from an endpoint without clients")
+	}
+
+	for _, dir := range []MessageDirection{Inbound, Outbound, Outbound} {
+		if err = m.OnMessage("chat", dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v, _ := m.connected.Val("chat"); v != 1 {
+		t.Errorf("expected 1 client connected to chat, got %v", v)
+	}
+
+	if v, _ := m.connected.Val(OtherEndpoint); v != 1 {
+		t.Errorf("expected 1 client connected to other endpoints, got %v", v)
+	}
+
+	if v := m.connected.Rollup(SumRollup).Val(); v != float64(2) {
+		t.Errorf("expected 2 connected clients in total, got %v", v)
+	}
+
+	if v, _ := m.connections.Val("chat"); v != 2 {
+		t.Errorf("expected 2 connections to chat, got %v", v)
+	}
+
+	in, _ := m.in.Val("chat")
+	out, _ := m.out.Val("chat")
+	if in != 1 || out != 2 {
+		t.Errorf("expected 1 message in and 2 out, got %v and %v", in, out)
+	}
+
+	if err = m.OnMessage("chat", MessageDirection(5)); err == nil {
+		t.Error("expected an error for an invalid direction")
+	}
+}
@@ -0,0 +1,96 @@
+package speed
+
+import (
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+// TestConcurrentReader reads the MMV file like a monitor, in a separate copy made by
+// the kernel, while values are updated, and checks it never sees a partial write.
+func TestConcurrentReader(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both halves of the value are always the same
+	wide, err := NewPCPSingletonMetric(uint64(0), "test.wide", Uint64Type, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MustRegister(wide)
+
+	// all characters of the value are always the same
+	str, err := NewPCPSingletonMetric("a", "test.str", StringType, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MustRegister(str)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	// the wide value is updated continuously until all reads are done, the string
+	// once per read, while the file is read, as readers are only guaranteed to see
+	// whole strings if they copy one faster than it is updated twice
+	done, next := make(chan struct{}), make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	defer func() {
+		close(done)
+		close(next)
+		wg.Wait()
+	}()
+
+	go func() {
+		defer wg.Done()
+		for x := uint64(1); ; x++ {
+			select {
+			case <-done:
+				return
+			default:
+				wide.MustSet(x<<32 | x&0xffffffff)
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := range next {
+			str.MustSet(strings.Repeat(string(rune('a'+i%26)), 1+i%200))
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		next <- i
+
+		data, err := ioutil.ReadFile(c.loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h, _, _, values, _, _, strs, err := mmvdump.Dump(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.G1 != h.G2 {
+			t.Fatalf("expected a complete mapping, got generations %v and %v", h.G1, h.G2)
+		}
+
+		if v := values[uint64(wide.offset)].Val; v>>32 != v&0xffffffff {
+			t.Fatalf("read a partially written value %#x", v)
+		}
+
+		s := mmvString(strs, uint64(values[uint64(str.offset)].Extra))
+		if s == "" || strings.Trim(s, s[:1]) != "" {
+			t.Fatalf("read a partially written string %q", s)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package speed
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// PCPConstMetric defines a singleton metric holding a value that never changes
+// once registered, like the number of cpus or a configured limit.
+//
+// A const metric has no setters, the client writes its value once on Start and
+// keeps no update closure for it, so it is skipped by the write policy and the
+// overhead budget, and never competes with mutable metrics for writes.
+type PCPConstMetric struct {
+	*pcpMetricDesc
+	val    interface{}
+	offset int // offset of the value in the MMV file, once written
+}
+
+// NewConstMetric creates a new instance of PCPConstMetric, with discrete semantics
+// it takes 2 extra optional strings as short and long description parameters,
+// which on not being present are set to blank strings.
+func NewConstMetric(name string, val interface{}, t MetricType, u MetricUnit, desc ...string) (*PCPConstMetric, error) {
+	d, err := newpcpMetricDesc(name, t, DiscreteSemantics, u, desc...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.IsCompatible(val) {
+		return nil, errors.Errorf("type %v is not compatible with value %v(%T)", t, val, val)
+	}
+
+	return &PCPConstMetric{d, t.resolve(val), 0}, nil
+}
+
+// Val returns the value of the metric.
+func (m *PCPConstMetric) Val() interface{} { return m.val }
+
+// Indom returns the instance domain for the metric, which is always nil.
+func (m *PCPConstMetric) Indom() *PCPInstanceDomain { return nil }
+
+func (m *PCPConstMetric) String() string { return fmt.Sprint(m) }
@@ -0,0 +1,68 @@
+package speed
+
+import (
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestConstMetric(t *testing.T) {
+	if _, err := NewConstMetric("test.const", "8", Int32Type, OneUnit); err == nil {
+		t.Error("expected an error creating a const metric with an incompatible value")
+	}
+
+	cpus, err := NewConstMetric("test.cpus", 8, Uint32Type, OneUnit, "number of cpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cpus.Semantics() != DiscreteSemantics {
+		t.Errorf("expected const metrics to have discrete semantics, got %v", cpus.Semantics())
+	}
+
+	version, err := NewConstMetric("test.version", "1.2.3", StringType, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(cpus)
+	c.MustRegister(version)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	_, _, m, v, _, _, s, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot create dump, error: %v", err)
+	}
+
+	off, mc := findMetric(cpus, m)
+	if mc == nil {
+		t.Fatal("expected the cpus metric to be written")
+	}
+
+	if mc.Sem() != mmvdump.Semantics(DiscreteSemantics) {
+		t.Errorf("expected discrete semantics to be written, got %v", mc.Sem())
+	}
+
+	if _, val := findSingletonValue(off, v); val == nil || val.Val != 8 {
+		t.Errorf("expected the written value to be 8, got %v", val)
+	}
+
+	off, _ = findMetric(version, m)
+	_, val := findSingletonValue(off, v)
+	if val == nil {
+		t.Fatal("expected the version value to be written")
+	}
+
+	if str, ok := s[uint64(val.Extra)]; !ok {
+		t.Errorf("expected a string at address %v", val.Extra)
+	} else if v := string(str.Payload[:5]); v != "1.2.3" {
+		t.Errorf("expected the written value to be 1.2.3, got %v", v)
+	}
+}
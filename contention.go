@@ -0,0 +1,194 @@
+package speed
+
+import (
+	"bufio"
+	"bytes"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// profiles summarized by the ContentionCollector, which are also the instances of its metrics
+var contentionProfiles = []string{"block", "mutex"}
+
+// ContentionCollector is a Collector summarizing the runtime's block and mutex profiles
+// into counters of the number of contention events and the total time spent contended,
+// with the instances "block" and "mutex", which shows lock contention trends in PCP
+// without having to pull and compare full pprof profiles.
+//
+// The profiles are only recorded while enabled, see Enable. They sample events,
+// so the counters are estimates, which are more precise at higher rates, at a cost.
+type ContentionCollector struct {
+	prefix string
+
+	mutex                sync.Mutex
+	blockRate, mutexRate int
+	enabled              bool
+	prevMutexRate        int
+	err                  error
+}
+
+// NewContentionCollector creates a new ContentionCollector exporting the metrics
+// "<prefix>.count" and "<prefix>.time", which profiles blocking events at blockRate,
+// sampling an average of one event per blockRate nanoseconds spent blocked, and
+// mutex contention events at mutexFraction, sampling on average 1/mutexFraction
+// events, see runtime.SetBlockProfileRate and runtime.SetMutexProfileFraction.
+// Either profile can be left disabled with a zero rate.
+func NewContentionCollector(prefix string, blockRate, mutexFraction int) (*ContentionCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("contention collector prefix cannot be empty")
+	}
+
+	if blockRate < 0 || mutexFraction < 0 {
+		return nil, errors.New("profile rates cannot be negative")
+	}
+
+	return &ContentionCollector{prefix: prefix, blockRate: blockRate, mutexRate: mutexFraction}, nil
+}
+
+// Describe describes the metrics exported by the collector.
+func (col *ContentionCollector) Describe(ch chan<- Desc) {
+	ch <- Desc{
+		Name: col.prefix + ".count", Type: Uint64Type, Semantics: CounterSemantics, Unit: OneUnit,
+		Instances: contentionProfiles, ShortHelp: "estimated number of contention events",
+	}
+
+	ch <- Desc{
+		Name: col.prefix + ".time", Type: Uint64Type, Semantics: CounterSemantics, Unit: NanosecondUnit,
+		Instances: contentionProfiles, ShortHelp: "estimated total time spent contended",
+	}
+}
+
+// Enable enables the block and mutex profiles at the rates of the collector.
+// The profiles are process wide, so this overrides rates set elsewhere.
+func (col *ContentionCollector) Enable() error {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	if col.enabled {
+		return errors.New("contention profiles are already enabled")
+	}
+
+	runtime.SetBlockProfileRate(col.blockRate)
+	col.prevMutexRate = runtime.SetMutexProfileFraction(col.mutexRate)
+	col.enabled = true
+
+	return nil
+}
+
+// Disable disables the block profile and restores the previous mutex profile fraction.
+func (col *ContentionCollector) Disable() error {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	if !col.enabled {
+		return errors.New("contention profiles are not enabled")
+	}
+
+	runtime.SetBlockProfileRate(0)
+	runtime.SetMutexProfileFraction(col.prevMutexRate)
+	col.enabled = false
+
+	return nil
+}
+
+// Collect summarizes the block and mutex profiles and records them.
+func (col *ContentionCollector) Collect(r Recorder) {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	col.err = col.collect(r)
+}
+
+func (col *ContentionCollector) collect(r Recorder) error {
+	for _, profile := range contentionProfiles {
+		var buf bytes.Buffer
+		if err := pprof.Lookup(profile).WriteTo(&buf, 1); err != nil {
+			return err
+		}
+
+		count, ns, err := summarizeContention(&buf)
+		if err != nil {
+			return errors.Wrapf(err, "cannot summarize the %v profile", profile)
+		}
+
+		if err := r.RecordInstance(col.prefix+".count", profile, count); err != nil {
+			return err
+		}
+
+		if err := r.RecordInstance(col.prefix+".time", profile, ns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Err returns the error encountered during the last collection, if any.
+func (col *ContentionCollector) Err() error {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	return col.err
+}
+
+// summarizeContention returns the total number of events and the total time in
+// nanoseconds of a contention profile in the legacy text format, where every record
+// is a line of the cycles and the count of the events, followed by the stack,
+// after a header with the cycles per second
+func summarizeContention(r *bytes.Buffer) (count, ns uint64, err error) {
+	var cycles, perSecond float64
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "cycles/second=") {
+			if perSecond, err = strconv.ParseFloat(strings.TrimPrefix(line, "cycles/second="), 64); err != nil {
+				return 0, 0, err
+			}
+			continue
+		}
+
+		i := strings.Index(line, " @")
+		if i == -1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line[:i])
+		if len(fields) != 2 {
+			return 0, 0, errors.Errorf("invalid profile record %q", line)
+		}
+
+		c, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		cycles += c
+		count += n
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	if cycles > 0 && perSecond <= 0 {
+		return 0, 0, errors.New("profile has no cycles per second")
+	}
+
+	if cycles > 0 {
+		ns = uint64(cycles / perSecond * 1e9)
+	}
+
+	return count, ns, nil
+}
@@ -0,0 +1,99 @@
+package speed
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSummarizeContention(t *testing.T) {
+	profile := `--- mutex:
+cycles/second=2000000000
+sampling period=1
+4000000000 398 @ 0x4df0f2 0x4df07a 0x483981
+#	0x4df0f1	sync.(*Mutex).Unlock+0x51	/usr/lib/go/src/sync/mutex.go:212
+
+1000000000 2 @ 0x488425 0x4defe5
+`
+
+	count, ns, err := summarizeContention(bytes.NewBufferString(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 400 {
+		t.Errorf("expected 400 events, got %v", count)
+	}
+
+	if ns != uint64(2500*time.Millisecond) {
+		t.Errorf("expected 2.5s of contention, got %v", time.Duration(ns))
+	}
+
+	if _, _, err = summarizeContention(bytes.NewBufferString("10 1 @ 0x1\n")); err == nil {
+		t.Error("expected an error for a profile without cycles per second")
+	}
+}
+
+func TestContentionCollector(t *testing.T) {
+	col, err := NewContentionCollector("test.contention", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = col.Enable(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = col.Enable(); err == nil {
+		t.Error("expected an error enabling the profiles twice")
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mu.Lock()
+				time.Sleep(10 * time.Microsecond)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err = col.Disable(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.RegisterCollector(col, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = col.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := c.r.metrics["test.contention.count"].(*PCPInstanceMetric)
+	total := c.r.metrics["test.contention.time"].(*PCPInstanceMetric)
+
+	for _, i := range []string{"block", "mutex"} {
+		if v, _ := count.ValInstance(i); v.(uint64) == 0 {
+			t.Errorf("expected %v contention events", i)
+		}
+
+		if v, _ := total.ValInstance(i); v.(uint64) == 0 {
+			t.Errorf("expected %v contention time", i)
+		}
+	}
+}
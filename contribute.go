@@ -0,0 +1,92 @@
+package speed
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContributionRoot is the subtree of a client reserved for metrics contributed
+// by libraries, see Contribute. Clients reject registering any other metrics under it.
+const ContributionRoot = "contrib"
+
+var libraryPattern = regexp.MustCompile("\\A" + id + "\\z")
+
+// reserved checks whether a metric name is in the subtree reserved for contributed metrics
+func reserved(name string) bool {
+	return strings.HasPrefix(name, ContributionRoot+".")
+}
+
+// Contribute registers metrics of a third party library with a client of the host
+// application, under the subtree "contrib.<library>", so libraries can export metrics
+// without knowing the names used by the application or by other libraries.
+//
+// For example, a metric named "pool.size" contributed by "libfoo" is registered as
+// "contrib.libfoo.pool.size". The names of the metrics and their companion metrics
+// are prefixed in place, so the metrics must not be registered with any client yet.
+//
+// Either all metrics are registered, or none of them are, if any of the names, or any
+// of their instance domains, collide with ones already registered with the client.
+func Contribute(c Client, library string, metrics ...Metric) error {
+	if !libraryPattern.MatchString(library) {
+		return errors.Errorf("invalid library name %q, it has to be a single component of a metric name", library)
+	}
+
+	prefix := ContributionRoot + "." + library + "."
+	r := c.Registry()
+
+	contributed := make([]*pcpMetricDesc, 0, len(metrics))
+	names := make(map[string]bool, len(metrics))
+	indoms := make(map[string]*PCPInstanceDomain)
+
+	for _, m := range metrics {
+		ds, ok := descs(m)
+		if !ok {
+			return errors.Errorf("metric %v of type %T cannot be contributed", m.Name(), m)
+		}
+
+		contributed = append(contributed, ds...)
+
+		if indom := m.(PCPMetric).Indom(); indom != nil {
+			if other, ok := indoms[indom.Name()]; ok && other != indom {
+				return errors.Errorf("library %v contributes different instance domains named %v", library, indom.Name())
+			}
+			indoms[indom.Name()] = indom
+		}
+	}
+
+	for _, md := range contributed {
+		name := prefix + md.name
+		switch {
+		case len(name) > StringLength:
+			return errors.Errorf("contributed metric name %v is too long", name)
+		case names[name]:
+			return errors.Errorf("library %v contributes metric %v more than once", library, name)
+		case r.HasMetric(name):
+			return errors.Errorf("metric %v is already registered", name)
+		}
+		names[name] = true
+	}
+
+	if pr, ok := r.(*PCPRegistry); ok {
+		for name, indom := range indoms {
+			other := pr.instanceDomain(name)
+			if other != nil && other != indom && (other.ID() != indom.ID() || !other.MatchInstances(indom.Instances())) {
+				return errors.Errorf("a different instance domain named %v is already registered", name)
+			}
+		}
+	}
+
+	for _, md := range contributed {
+		md.rename(prefix + md.name)
+	}
+
+	for _, m := range metrics {
+		if err := r.AddMetric(m); err != nil {
+			return errors.Wrapf(err, "cannot contribute metric %v", m.Name())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package speed
+
+import "testing"
+
+func TestContribute(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := NewPCPGauge(0, "pool.size", "size of the pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := NewPCPCounter(0, "pool.hits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = hits.Apply(WithEpoch()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Contribute(c, "lib.foo", size); err == nil {
+		t.Error("expected an error contributing under an invalid library name")
+	}
+
+	if err = Contribute(c, "libfoo", size, hits); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"contrib.libfoo.pool.size", "contrib.libfoo.pool.hits", "contrib.libfoo.pool.hits.epoch"} {
+		if !c.Registry().HasMetric(name) {
+			t.Errorf("expected %v to be registered", name)
+		}
+	}
+
+	if size.ID() != hash("contrib.libfoo.pool.size", PCPMetricItemBitLength) {
+		t.Error("expected the id of the metric to be derived from its new name")
+	}
+
+	// a second library cannot take the same names, and nothing of it is registered
+	other, err := NewPCPGauge(0, "pool.other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := NewPCPGauge(0, "pool.size")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Contribute(c, "libfoo", other, same); err == nil {
+		t.Error("expected an error contributing a name that is already registered")
+	}
+
+	if c.Registry().HasMetric("contrib.libfoo.pool.other") || other.Name() != "pool.other" {
+		t.Error("expected nothing to be contributed on a collision")
+	}
+
+	if err = Contribute(c, "libbar", other, same); err != nil {
+		t.Errorf("expected a different library to use the same names, got %v", err)
+	}
+
+	if _, err = c.RegisterString("contrib.app", 1, Int32Type, InstantSemantics, OneUnit); err == nil {
+		t.Error("expected an error registering a metric under the reserved subtree")
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	size.MustSet(42)
+	matchSingleDump(float64(42), size, c, t)
+}
@@ -0,0 +1,180 @@
+package speed
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CSVDumper appends a row with the values of the metrics of a client to a CSV file
+// on every dump, as a simple archive for environments without pmlogger or a time
+// series database.
+//
+// The first column holds the time of the dump, followed by a column per singleton
+// metric and per instance of an instance metric, named "metric" and "metric[instance]"
+// respectively. The columns are fixed on the first dump, and the header row is only
+// written to an empty file, so a file can be appended to across restarts.
+type CSVDumper struct {
+	mutex   sync.Mutex
+	c       *PCPClient
+	f       *os.File
+	w       *csv.Writer
+	metrics map[string]bool // metrics to dump, all if empty
+	columns []string        // columns after the timestamp, fixed on the first dump
+	header  bool            // whether to write a header on the first dump
+	started bool            // whether the columns are fixed
+	now     func() time.Time
+
+	stop, done chan struct{}
+}
+
+// NewCSVDumper creates a CSVDumper appending to the file at the passed path, which is
+// created if it does not exist. It dumps the passed metrics, or all metrics of the client
+// if none are passed.
+func NewCSVDumper(path string, c *PCPClient, metrics ...string) (*CSVDumper, error) {
+	set := make(map[string]bool, len(metrics))
+	for _, m := range metrics {
+		if !c.Registry().HasMetric(m) {
+			return nil, errors.Errorf("metric %v is not registered with the client", m)
+		}
+		set[m] = true
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open the CSV file")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "cannot open the CSV file")
+	}
+
+	return &CSVDumper{
+		c:       c,
+		f:       f,
+		w:       csv.NewWriter(f),
+		metrics: set,
+		header:  info.Size() == 0,
+		now:     time.Now,
+	}, nil
+}
+
+func csvColumn(s Sample) string {
+	if s.Instance == "" {
+		return s.Metric
+	}
+
+	return s.Metric + "[" + s.Instance + "]"
+}
+
+// Dump appends a row with the current values of the metrics.
+func (d *CSVDumper) Dump() error {
+	samples, err := d.c.Samples()
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	vals := make(map[string]string, len(samples))
+	for _, s := range samples {
+		if len(d.metrics) > 0 && !d.metrics[s.Metric] {
+			continue
+		}
+
+		col := csvColumn(s)
+		vals[col] = fmt.Sprint(s.Value)
+
+		if !d.started {
+			d.columns = append(d.columns, col)
+		}
+	}
+
+	if !d.started && d.header {
+		if err := d.w.Write(append([]string{"timestamp"}, d.columns...)); err != nil {
+			return err
+		}
+	}
+	d.started = true
+
+	row := make([]string, 0, len(d.columns)+1)
+	row = append(row, d.now().Format(time.RFC3339Nano))
+	for _, col := range d.columns {
+		row = append(row, vals[col])
+	}
+
+	if err := d.w.Write(row); err != nil {
+		return err
+	}
+
+	d.w.Flush()
+	return d.w.Error()
+}
+
+// Start starts dumping on the passed interval.
+func (d *CSVDumper) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("dump interval must be positive")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.stop != nil {
+		return errors.New("CSV dumper is already running")
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	d.stop, d.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				_ = d.Dump()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops dumping periodically.
+func (d *CSVDumper) Stop() error {
+	d.mutex.Lock()
+	stop, done := d.stop, d.done
+	d.stop, d.done = nil, nil
+	d.mutex.Unlock()
+
+	if stop == nil {
+		return errors.New("CSV dumper is not running")
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
+
+// Close stops dumping if running and closes the CSV file.
+func (d *CSVDumper) Close() error {
+	_ = d.Stop()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.f.Close()
+}
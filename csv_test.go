@@ -0,0 +1,98 @@
+package speed
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCSVDumper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPGaugeVector(map[string]float64{"a": 1.5, "b": 2}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegister(vector)
+	c.MustRegisterString("test.ignored", 1, Int32Type, InstantSemantics, OneUnit)
+
+	path := filepath.Join(dir, "metrics.csv")
+	if _, err = NewCSVDumper(path, c, "test.unknown"); err == nil {
+		t.Error("expected an error dumping an unknown metric")
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	dump := func() {
+		d, err := NewCSVDumper(path, c, "test.counter", "test.vector")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+
+		if err = d.Start(0); err == nil {
+			t.Error("expected an error starting with a zero interval")
+		}
+
+		d.now = func() time.Time { return now }
+
+		for i := 0; i < 2; i++ {
+			counter.Up()
+			now = now.Add(time.Second)
+
+			if err := d.Dump(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// the second dumper appends to the same file without another header
+	dump()
+	vector.MustSet(3, "b")
+	dump()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"timestamp", "test.counter", "test.vector[a]", "test.vector[b]"},
+		{"2017-01-01T00:00:01Z", "1", "1.5", "2"},
+		{"2017-01-01T00:00:02Z", "2", "1.5", "2"},
+		{"2017-01-01T00:00:03Z", "3", "1.5", "3"},
+		{"2017-01-01T00:00:04Z", "4", "1.5", "3"},
+	}
+
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected rows %v, got %v", expected, rows)
+	}
+}
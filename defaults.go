@@ -0,0 +1,67 @@
+package speed
+
+// MetricDefaults holds the semantics and unit used for metrics registered with
+// RegisterValue, so registrations do not have to repeat them. Zero fields are not set.
+type MetricDefaults struct {
+	Semantics MetricSemantics
+	Unit      MetricUnit
+}
+
+// merge returns the defaults with the set fields of o replacing them
+func (d MetricDefaults) merge(o MetricDefaults) MetricDefaults {
+	if o.Semantics != NoSemantics {
+		d.Semantics = o.Semantics
+	}
+
+	if o.Unit != nil {
+		d.Unit = o.Unit
+	}
+
+	return d
+}
+
+// initialDefaults are the defaults of a new client
+var initialDefaults = MetricDefaults{Semantics: InstantSemantics, Unit: OneUnit}
+
+// SetDefaults sets the semantics and unit of metrics registered with RegisterValue,
+// fields that are not set keep their current defaults, which are InstantSemantics
+// and OneUnit for a new client.
+func (c *PCPClient) SetDefaults(d MetricDefaults) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.defaults = c.defaults.merge(d)
+}
+
+// Defaults returns the current defaults of metrics registered with RegisterValue.
+func (c *PCPClient) Defaults() MetricDefaults {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.defaults
+}
+
+// RegisterValue is RegisterString using the semantics and unit set with SetDefaults,
+// optionally overridden for the metric by the set fields of an override, for example
+//
+//	c.SetDefaults(MetricDefaults{Semantics: CounterSemantics, Unit: OneUnit})
+//	c.RegisterValue("app.requests", 0, Int64Type)
+//	c.RegisterValue("app.bytes", 0, Int64Type, MetricDefaults{Unit: ByteUnit})
+func (c *PCPClient) RegisterValue(str string, val interface{}, t MetricType, override ...MetricDefaults) (Metric, error) {
+	d := c.Defaults()
+	for _, o := range override {
+		d = d.merge(o)
+	}
+
+	return c.RegisterString(str, val, t, d.Semantics, d.Unit)
+}
+
+// MustRegisterValue is RegisterValue that panics
+func (c *PCPClient) MustRegisterValue(str string, val interface{}, t MetricType, override ...MetricDefaults) Metric {
+	m, err := c.RegisterValue(str, val, t, override...)
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
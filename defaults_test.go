@@ -0,0 +1,35 @@
+package speed
+
+import "testing"
+
+func TestRegisterValue(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterValue("test.instant", int32(1), Int32Type)
+	if m.Semantics() != InstantSemantics || m.Unit() != OneUnit {
+		t.Errorf("expected the initial defaults, got %v and %v", m.Semantics(), m.Unit())
+	}
+
+	c.SetDefaults(MetricDefaults{Semantics: CounterSemantics})
+
+	if d := c.Defaults(); d.Semantics != CounterSemantics || d.Unit != OneUnit {
+		t.Errorf("expected unset defaults to be kept, got %v", d)
+	}
+
+	m = c.MustRegisterValue("test.counter", int64(1), Int64Type)
+	if m.Semantics() != CounterSemantics || m.Unit() != OneUnit {
+		t.Errorf("expected the set defaults, got %v and %v", m.Semantics(), m.Unit())
+	}
+
+	m = c.MustRegisterValue("test.bytes[a,b]", Instances{"a": uint64(1), "b": uint64(2)}, Uint64Type, MetricDefaults{Unit: ByteUnit})
+	if m.Semantics() != CounterSemantics || m.Unit() != ByteUnit {
+		t.Errorf("expected the unit to be overridden, got %v and %v", m.Semantics(), m.Unit())
+	}
+
+	if _, err = c.RegisterValue("test.invalid", "a", Int64Type); err == nil {
+		t.Error("expected an error registering an incompatible value")
+	}
+}
@@ -0,0 +1,54 @@
+package speed
+
+import (
+	"os"
+	"time"
+)
+
+// WithDeterministicOutput makes the MMV files written by the client depend only on
+// its metrics and their values, so golden file tests of the produced binary are
+// stable across runs and machines.
+//
+// The generation in the header starts at 1 instead of the current time, and is
+// bumped by 1 on every restart, the process identifier is written as 0, and all
+// padding is zeroed explicitly, even in a reused buffer.
+//
+// This is meant for tests only, as PCP cannot tell restarted processes apart by
+// generation, and drops mappings of dead processes by process identifier.
+func WithDeterministicOutput() ClientOption {
+	return func(c *PCPClient) error {
+		c.deterministic = true
+		return nil
+	}
+}
+
+// nextGeneration returns the generation of a new mapping, always bumped on restarts
+func (c *PCPClient) nextGeneration() int64 {
+	if c.deterministic {
+		return c.generation + 1
+	}
+
+	gen := time.Now().Unix()
+	if gen <= c.generation {
+		gen = c.generation + 1
+	}
+
+	return gen
+}
+
+// pid returns the process identifier written in the header
+func (c *PCPClient) pid() int32 {
+	if c.deterministic {
+		return 0
+	}
+
+	return int32(os.Getpid())
+}
+
+// zero clears the buffer of the writer before a layout is written
+func (c *PCPClient) zero() {
+	b := c.writer.Bytes()
+	for i := range b {
+		b[i] = 0
+	}
+}
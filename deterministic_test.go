@@ -0,0 +1,94 @@
+package speed
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestDeterministicOutput(t *testing.T) {
+	c, err := NewPCPClient("test", WithoutLocalFile(), WithDeterministicOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(42), Int64Type, CounterSemantics, OneUnit)
+
+	c.MustStart()
+
+	h, _, _, _, _, _, _, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot create dump, error: %v", err)
+	}
+
+	if h.G1 != 1 || h.G2 != 1 {
+		t.Errorf("expected the first generation to be 1, got %v and %v", h.G1, h.G2)
+	}
+
+	if h.Process != 0 {
+		t.Errorf("expected the process identifier to be 0, got %v", h.Process)
+	}
+
+	first := append([]byte(nil), c.writer.Bytes()...)
+
+	c.MustStop()
+	c.MustStart()
+	defer c.MustStop()
+
+	h, _, _, _, _, _, _, err = mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot create dump, error: %v", err)
+	}
+
+	if h.G1 != 2 || h.G2 != 2 {
+		t.Errorf("expected the generation to be bumped to 2 on restart, got %v and %v", h.G1, h.G2)
+	}
+
+	// apart from the generation, a restarted client writes the same file
+	second := append([]byte(nil), c.writer.Bytes()...)
+	copy(second[8:24], first[8:24])
+
+	if !bytes.Equal(first, second) {
+		t.Error("expected a restarted client to write the same file")
+	}
+}
+
+func TestDeterministicOutputZeroesPadding(t *testing.T) {
+	c, err := NewPCPClient("test", WithoutLocalFile(), WithDeterministicOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(42, "test.counter", "a counter", "with help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	expected := append([]byte(nil), c.writer.Bytes()...)
+
+	// write the layout again over garbage
+	b := c.writer.Bytes()
+	for i := range b {
+		b[i] = 0xff
+	}
+
+	sections, err := c.sections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.start(sections)
+
+	data := append([]byte(nil), c.writer.Bytes()...)
+	copy(data[8:24], expected[8:24])
+
+	if !bytes.Equal(expected, data) {
+		t.Error("expected the padding to be zeroed when writing the layout")
+	}
+}
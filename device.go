@@ -0,0 +1,226 @@
+package speed
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// InterfaceStats holds the traffic counters of a single network interface
+type InterfaceStats struct {
+	Name                  string
+	BytesIn, BytesOut     uint64
+	PacketsIn, PacketsOut uint64
+}
+
+// MountStats holds the usage of a single mounted filesystem in bytes
+type MountStats struct {
+	Path                 string
+	Capacity, Used, Free uint64
+}
+
+// DeviceProber defines the interface for a type that can probe the host
+// for per device statistics.
+type DeviceProber interface {
+	// returns the counters for all network interfaces on the host
+	Interfaces() ([]InterfaceStats, error)
+
+	// returns the usage of the filesystems mounted at the passed paths
+	Mounts(paths []string) ([]MountStats, error)
+}
+
+// DeviceCollector exports per network interface traffic and per mount
+// filesystem usage as instance metrics.
+//
+// The set of interfaces is probed once on construction, so interfaces
+// appearing later are not reported.
+type DeviceCollector struct {
+	mutex  sync.Mutex
+	prober DeviceProber
+	mounts []string
+
+	bytesIn, bytesOut     *PCPInstanceMetric
+	packetsIn, packetsOut *PCPInstanceMetric
+
+	capacity, used, free *PCPInstanceMetric
+}
+
+// NewDeviceCollector creates a new DeviceCollector with all metrics under the passed prefix,
+// using the passed prober to discover network interfaces and to collect values.
+// The filesystem usage is reported for the passed list of mount points.
+func NewDeviceCollector(prefix string, prober DeviceProber, mounts ...string) (*DeviceCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("device collector prefix cannot be empty")
+	}
+
+	if prober == nil {
+		return nil, errors.New("device collector needs a prober")
+	}
+
+	ifaces, err := prober.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot probe network interfaces")
+	}
+
+	names := make([]string, len(ifaces))
+	for i, iface := range ifaces {
+		names[i] = iface.Name
+	}
+
+	d := &DeviceCollector{prober: prober, mounts: mounts}
+
+	if len(names) > 0 {
+		indom, err := NewPCPInstanceDomain(prefix+".network.indom", names, "network interfaces")
+		if err != nil {
+			return nil, err
+		}
+
+		newNetworkMetric := func(name string, u MetricUnit, desc string) (*PCPInstanceMetric, error) {
+			return NewPCPInstanceMetric(
+				zeroInstances(names, uint64(0)), prefix+".network."+name,
+				indom, Uint64Type, CounterSemantics, u, desc,
+			)
+		}
+
+		if d.bytesIn, err = newNetworkMetric("in.bytes", ByteUnit, "bytes received"); err != nil {
+			return nil, err
+		}
+
+		if d.bytesOut, err = newNetworkMetric("out.bytes", ByteUnit, "bytes transmitted"); err != nil {
+			return nil, err
+		}
+
+		if d.packetsIn, err = newNetworkMetric("in.packets", OneUnit, "packets received"); err != nil {
+			return nil, err
+		}
+
+		if d.packetsOut, err = newNetworkMetric("out.packets", OneUnit, "packets transmitted"); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(mounts) > 0 {
+		indom, err := NewPCPInstanceDomain(prefix+".filesys.indom", mounts, "mounted filesystems")
+		if err != nil {
+			return nil, err
+		}
+
+		newFilesysMetric := func(name string, desc string) (*PCPInstanceMetric, error) {
+			return NewPCPInstanceMetric(
+				zeroInstances(mounts, uint64(0)), prefix+".filesys."+name,
+				indom, Uint64Type, InstantSemantics, ByteUnit, desc,
+			)
+		}
+
+		if d.capacity, err = newFilesysMetric("capacity", "total size of the filesystem"); err != nil {
+			return nil, err
+		}
+
+		if d.used, err = newFilesysMetric("used", "used space on the filesystem"); err != nil {
+			return nil, err
+		}
+
+		if d.free, err = newFilesysMetric("free", "free space on the filesystem"); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// zeroInstances creates an Instances object with all passed instances set to val
+func zeroInstances(instances []string, val interface{}) Instances {
+	ans := make(Instances)
+	for _, i := range instances {
+		ans[i] = val
+	}
+	return ans
+}
+
+// Metrics returns all the metrics exported by the collector.
+func (d *DeviceCollector) Metrics() []Metric {
+	ans := make([]Metric, 0, 7)
+
+	for _, m := range []*PCPInstanceMetric{
+		d.bytesIn, d.bytesOut, d.packetsIn, d.packetsOut,
+		d.capacity, d.used, d.free,
+	} {
+		if m != nil {
+			ans = append(ans, m)
+		}
+	}
+
+	return ans
+}
+
+// Register registers all metrics of the collector with the passed client.
+func (d *DeviceCollector) Register(c Client) error {
+	for _, m := range d.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Collect probes the host and updates all the metrics.
+func (d *DeviceCollector) Collect() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.bytesIn != nil {
+		ifaces, err := d.prober.Interfaces()
+		if err != nil {
+			return err
+		}
+
+		for _, iface := range ifaces {
+			// ignore interfaces that were not present on construction
+			if !d.bytesIn.Indom().HasInstance(iface.Name) {
+				continue
+			}
+
+			if err := setInstances(iface.Name, []deviceValue{
+				{d.bytesIn, iface.BytesIn}, {d.bytesOut, iface.BytesOut},
+				{d.packetsIn, iface.PacketsIn}, {d.packetsOut, iface.PacketsOut},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if d.capacity != nil {
+		mounts, err := d.prober.Mounts(d.mounts)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range mounts {
+			if err := setInstances(m.Path, []deviceValue{
+				{d.capacity, m.Capacity}, {d.used, m.Used}, {d.free, m.Free},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deviceValue pairs a device metric with a probed value
+type deviceValue struct {
+	m   *PCPInstanceMetric
+	val uint64
+}
+
+// setInstances sets the same instance on a list of device metrics
+func setInstances(instance string, vals []deviceValue) error {
+	for _, v := range vals {
+		if err := v.m.SetInstance(v.val, instance); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package speed
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// procDeviceProber implements a DeviceProber reading from procfs and statfs
+type procDeviceProber struct{}
+
+// NewDeviceProber returns a DeviceProber for the current host.
+func NewDeviceProber() DeviceProber { return procDeviceProber{} }
+
+func (procDeviceProber) Interfaces() ([]InterfaceStats, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseNetDev(f)
+}
+
+// parseNetDev parses the contents of /proc/net/dev
+func parseNetDev(r io.Reader) ([]InterfaceStats, error) {
+	var ans []InterfaceStats
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			// header lines
+			continue
+		}
+
+		fields := strings.Fields(line[i+1:])
+		if len(fields) < 10 {
+			return nil, errors.Errorf("invalid /proc/net/dev line %q", line)
+		}
+
+		vals := make([]uint64, 4)
+		for j, k := range []int{0, 1, 8, 9} {
+			v, err := strconv.ParseUint(fields[k], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			vals[j] = v
+		}
+
+		ans = append(ans, InterfaceStats{
+			Name:       strings.TrimSpace(line[:i]),
+			BytesIn:    vals[0],
+			PacketsIn:  vals[1],
+			BytesOut:   vals[2],
+			PacketsOut: vals[3],
+		})
+	}
+
+	return ans, scanner.Err()
+}
+
+func (procDeviceProber) Mounts(paths []string) ([]MountStats, error) {
+	ans := make([]MountStats, len(paths))
+
+	for i, p := range paths {
+		var s syscall.Statfs_t
+		if err := syscall.Statfs(p, &s); err != nil {
+			return nil, errors.Wrapf(err, "cannot stat filesystem at %v", p)
+		}
+
+		bsize := uint64(s.Bsize)
+		ans[i] = MountStats{
+			Path:     p,
+			Capacity: s.Blocks * bsize,
+			Used:     (s.Blocks - s.Bfree) * bsize,
+			Free:     s.Bavail * bsize,
+		}
+	}
+
+	return ans, nil
+}
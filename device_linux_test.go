@@ -0,0 +1,26 @@
+package speed
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNetDev(t *testing.T) {
+	dev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 3560219     688    0    0    0     0          0         0  3560220     689    0    0    0     0       0          0
+`
+
+	ifaces, err := parseNetDev(strings.NewReader(dev))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ifaces) != 1 {
+		t.Fatalf("expected 1 interface, got %v", len(ifaces))
+	}
+
+	if i := ifaces[0]; i.Name != "lo" || i.BytesIn != 3560219 || i.PacketsIn != 688 || i.BytesOut != 3560220 || i.PacketsOut != 689 {
+		t.Errorf("unexpected interface stats %v", i)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package speed
+
+import "github.com/pkg/errors"
+
+// unsupportedDeviceProber is a DeviceProber for platforms without device probing
+type unsupportedDeviceProber struct{}
+
+// NewDeviceProber returns a DeviceProber for the current host.
+func NewDeviceProber() DeviceProber { return unsupportedDeviceProber{} }
+
+func (unsupportedDeviceProber) Interfaces() ([]InterfaceStats, error) {
+	return nil, errors.New("probing network interfaces is only supported on linux")
+}
+
+func (unsupportedDeviceProber) Mounts([]string) ([]MountStats, error) {
+	return nil, errors.New("probing mounts is only supported on linux")
+}
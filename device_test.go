@@ -0,0 +1,55 @@
+package speed
+
+import "testing"
+
+type testDeviceProber struct {
+	ifaces []InterfaceStats
+}
+
+func (p *testDeviceProber) Interfaces() ([]InterfaceStats, error) { return p.ifaces, nil }
+
+func (p *testDeviceProber) Mounts(paths []string) ([]MountStats, error) {
+	ans := make([]MountStats, len(paths))
+	for i, path := range paths {
+		ans[i] = MountStats{path, 100, 40, 60}
+	}
+	return ans, nil
+}
+
+func TestDeviceCollector(t *testing.T) {
+	p := &testDeviceProber{[]InterfaceStats{{"lo", 0, 0, 0, 0}, {"eth0", 0, 0, 0, 0}}}
+
+	d, err := NewDeviceCollector("test.device", p, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(d.Metrics()); l != 7 {
+		t.Errorf("expected 7 metrics, got %v", l)
+	}
+
+	p.ifaces = []InterfaceStats{{"lo", 10, 20, 1, 2}, {"eth0", 30, 40, 3, 4}, {"eth1", 1, 1, 1, 1}}
+	if err = d.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := d.bytesIn.ValInstance("eth0"); v != uint64(30) {
+		t.Errorf("expected eth0 bytes in to be 30, got %v", v)
+	}
+
+	if v, _ := d.packetsOut.ValInstance("lo"); v != uint64(2) {
+		t.Errorf("expected lo packets out to be 2, got %v", v)
+	}
+
+	if v, _ := d.used.ValInstance("/"); v != uint64(40) {
+		t.Errorf("expected used space to be 40, got %v", v)
+	}
+
+	if _, err = NewDeviceCollector("test.device", p); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = NewDeviceCollector("test.device", nil); err == nil {
+		t.Error("expected an error when creating a collector without a prober")
+	}
+}
@@ -0,0 +1,208 @@
+package speed
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Discovery describes the MMV file of a started client, for agents that cannot
+// look into the MMV directory of a container, like a pmdammv sidecar, or an agent
+// on the host that needs to mount the file.
+type Discovery struct {
+	Name      string            `json:"name"`
+	Path      string            `json:"path,omitempty"` // not set for clients without a local file
+	ClusterID uint32            `json:"cluster_id"`
+	Metrics   int               `json:"metrics"`
+	PID       int               `json:"pid"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// WithDiscovery makes the client write a Discovery of its MMV file as "<name>.json"
+// to the passed directory on Start, and remove it on Stop. The directory is usually
+// a volume shared with the agent, which can watch it using a DiscoveryWatcher.
+func WithDiscovery(dir string) ClientOption {
+	return func(c *PCPClient) error {
+		if dir == "" {
+			return errors.New("discovery directory cannot be empty")
+		}
+
+		c.discoveryDir = dir
+		return nil
+	}
+}
+
+func (c *PCPClient) discoveryPath() string {
+	return filepath.Join(c.discoveryDir, filepath.Base(c.loc)+".json")
+}
+
+func (c *PCPClient) writeDiscovery() error {
+	d := Discovery{
+		Name:      filepath.Base(c.loc),
+		ClusterID: c.clusterID,
+		Metrics:   c.r.MetricCount(),
+		PID:       os.Getpid(),
+		Labels:    c.labels,
+	}
+
+	if !c.noFile {
+		d.Path = c.loc
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode the discovery")
+	}
+
+	return writeFileAtomically(c.discoveryPath(), data)
+}
+
+func (c *PCPClient) removeDiscovery() error {
+	return os.Remove(c.discoveryPath())
+}
+
+// ReadDiscoveries returns all discoveries in the passed directory, sorted by name.
+// Files that are not discoveries are ignored.
+func ReadDiscoveries(dir string) ([]Discovery, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the discovery directory")
+	}
+
+	var ans []Discovery
+	for _, f := range files {
+		// temporary files of atomic writes start with a dot
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			// removed in between
+			continue
+		}
+
+		var d Discovery
+		if err := json.Unmarshal(data, &d); err != nil || d.Name == "" {
+			continue
+		}
+
+		ans = append(ans, d)
+	}
+
+	sort.Slice(ans, func(i, j int) bool { return ans[i].Name < ans[j].Name })
+	return ans, nil
+}
+
+// DiscoveryWatcher watches a discovery directory written to by clients created with
+// WithDiscovery, calling a handler for every discovery that appears or changes, and
+// for every discovery that is removed.
+type DiscoveryWatcher struct {
+	mutex   sync.Mutex
+	dir     string
+	handler func(d Discovery, removed bool)
+	known   map[string]Discovery
+
+	stop, done chan struct{}
+}
+
+// NewDiscoveryWatcher creates a new DiscoveryWatcher for the passed directory.
+func NewDiscoveryWatcher(dir string, handler func(d Discovery, removed bool)) (*DiscoveryWatcher, error) {
+	if handler == nil {
+		return nil, errors.New("discovery watcher needs a handler")
+	}
+
+	return &DiscoveryWatcher{
+		dir:     dir,
+		handler: handler,
+		known:   make(map[string]Discovery),
+	}, nil
+}
+
+// Poll reads the directory once, calling the handler for all changes since the last poll.
+func (w *DiscoveryWatcher) Poll() error {
+	ds, err := ReadDiscoveries(w.dir)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	current := make(map[string]Discovery, len(ds))
+	for _, d := range ds {
+		current[d.Name] = d
+
+		if old, ok := w.known[d.Name]; !ok || !reflect.DeepEqual(old, d) {
+			w.handler(d, false)
+		}
+	}
+
+	for name, d := range w.known {
+		if _, ok := current[name]; !ok {
+			w.handler(d, true)
+		}
+	}
+
+	w.known = current
+	return nil
+}
+
+// Start starts polling the directory on the passed interval.
+func (w *DiscoveryWatcher) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("poll interval must be positive")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.stop != nil {
+		return errors.New("discovery watcher is already running")
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	w.stop, w.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				_ = w.Poll()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops polling the directory.
+func (w *DiscoveryWatcher) Stop() error {
+	w.mutex.Lock()
+	stop, done := w.stop, w.done
+	w.stop, w.done = nil, nil
+	w.mutex.Unlock()
+
+	if stop == nil {
+		return errors.New("discovery watcher is not running")
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
@@ -0,0 +1,91 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// foreign files are ignored
+	if err = ioutil.WriteFile(filepath.Join(dir, "README"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type event struct {
+		d       Discovery
+		removed bool
+	}
+
+	var events []event
+	w, err := NewDiscoveryWatcher(dir, func(d Discovery, removed bool) {
+		events = append(events, event{d, removed})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Start(0); err == nil {
+		t.Error("expected an error starting with a zero interval")
+	}
+
+	c, err := NewPCPClient("discovered", WithDiscovery(dir), WithLabels(map[string]string{"pod": "web-1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit)
+	c.MustStart()
+
+	if err = w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].removed {
+		t.Fatalf("expected the client to be discovered, got %v", events)
+	}
+
+	d := events[0].d
+	if d.Name != "discovered" || d.Path != c.loc || d.ClusterID != c.clusterID || d.Metrics != 1 || d.PID != os.Getpid() || d.Labels["pod"] != "web-1" {
+		t.Errorf("unexpected discovery %+v", d)
+	}
+
+	// nothing changed
+	if err = w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStop()
+
+	if err = w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 || !events[1].removed || events[1].d.Name != "discovered" {
+		t.Errorf("expected the client to be removed, got %v", events)
+	}
+}
+
+func TestDiscoveryWriteFailure(t *testing.T) {
+	c, err := NewPCPClient("test", WithDiscovery(filepath.Join(os.TempDir(), "speed-does-not-exist")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit)
+
+	if err = c.Start(); err == nil {
+		t.Fatal("expected an error writing the discovery to a missing directory")
+	}
+
+	if c.writer != nil || c.r.mapped {
+		t.Error("expected the client to be unmapped after failing to start")
+	}
+}
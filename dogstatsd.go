@@ -0,0 +1,248 @@
+package speed
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dogStatsDPayload is the maximum size of a datagram sent by a DogStatsDExporter,
+// as recommended by Datadog for sending over a network
+const dogStatsDPayload = 1432
+
+// DogStatsDExporter sends the values of the metrics of a client to a DogStatsD agent.
+//
+// Metrics with counter semantics are sent as counts of the increments since the
+// previous export, starting from the second one, and all other numeric metrics as
+// gauges. The instances of instance metrics are sent as an "instance" tag, or as
+// the tag set with SetInstanceTag, along with the constant tags of the exporter
+// and the labels of the client. The tags of instances made with TaggedInstance are
+// sent as tags too.
+// String metrics and values that cannot be represented, like NaN, are skipped.
+type DogStatsDExporter struct {
+	mutex        sync.Mutex
+	c            *PCPClient
+	conn         net.Conn
+	namespace    string
+	tags         []string
+	instanceTags map[string]string  // tag names for the instances of metrics
+	counters     map[string]float64 // last exported values of counters
+
+	stop, done chan struct{}
+}
+
+var dogStatsDEscaper = strings.NewReplacer("|", "_", ",", "_", "#", "_", " ", "_", "\n", "_")
+
+// NewDogStatsDExporter creates a DogStatsDExporter sending to the passed UDP address,
+// like "localhost:8125". The passed namespace is prefixed to all metric names, and the
+// passed tags, like "env:prod", are sent with all metrics.
+func NewDogStatsDExporter(addr string, c *PCPClient, namespace string, tags ...string) (*DogStatsDExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to dogstatsd")
+	}
+
+	if namespace != "" && !strings.HasSuffix(namespace, ".") {
+		namespace += "."
+	}
+
+	escaped := make([]string, 0, len(tags))
+	for _, t := range tags {
+		escaped = append(escaped, dogStatsDEscaper.Replace(t))
+	}
+
+	labels := c.Labels()
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		escaped = append(escaped, dogStatsDEscaper.Replace(k+":"+labels[k]))
+	}
+
+	return &DogStatsDExporter{
+		c:            c,
+		conn:         conn,
+		namespace:    namespace,
+		tags:         escaped,
+		instanceTags: make(map[string]string),
+		counters:     make(map[string]float64),
+	}, nil
+}
+
+// SetInstanceTag sets the name of the tag the instances of the passed metric are sent as,
+// for example "method" to send the instances of a request counter as "method:GET".
+func (e *DogStatsDExporter) SetInstanceTag(metric, tag string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.instanceTags[metric] = dogStatsDEscaper.Replace(tag)
+}
+
+// sampleFloat returns the value of a numeric sample as a float64
+func sampleFloat(val interface{}) (float64, bool) {
+	var f float64
+
+	switch v := val.(type) {
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint32:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	case float32:
+		f = float64(v)
+	case float64:
+		f = v
+	default:
+		return 0, false
+	}
+
+	return f, !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// lines formats the passed samples as DogStatsD lines, updating the last counter values
+func (e *DogStatsDExporter) lines(samples []Sample, semantics map[string]MetricSemantics) []byte {
+	var buf bytes.Buffer
+
+	for _, s := range samples {
+		val, ok := sampleFloat(s.Value)
+		if !ok {
+			continue
+		}
+
+		kind := "g"
+		if semantics[s.Metric] == CounterSemantics {
+			key := s.Metric + "\x00" + s.Instance
+			last, seen := e.counters[key]
+			e.counters[key] = val
+
+			if !seen {
+				continue
+			}
+
+			kind = "c"
+			if val >= last {
+				val -= last
+			}
+		}
+
+		tags := e.tags
+		if s.Instance != "" {
+			tag, ok := e.instanceTags[s.Metric]
+			if !ok {
+				tag = "instance"
+			}
+
+			tags = append(tags[:len(tags):len(tags)], tag+":"+dogStatsDEscaper.Replace(s.Instance))
+
+			if it := instanceTags(s.Instance); it != nil {
+				keys := make([]string, 0, len(it))
+				for k := range it {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+
+				for _, k := range keys {
+					tags = append(tags, dogStatsDEscaper.Replace(k+":"+it[k]))
+				}
+			}
+		}
+
+		fmt.Fprintf(&buf, "%v%v:%v|%v", e.namespace, s.Metric, strconv.FormatFloat(val, 'f', -1, 64), kind)
+		if len(tags) > 0 {
+			buf.WriteString("|#" + strings.Join(tags, ","))
+		}
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// Export sends the current values of all metrics of the client.
+func (e *DogStatsDExporter) Export() error {
+	samples, err := e.c.Samples()
+	if err != nil {
+		return err
+	}
+
+	semantics := make(map[string]MetricSemantics)
+	for _, entry := range e.c.Registry().Catalog() {
+		semantics[entry.Name] = entry.Semantics
+	}
+
+	e.mutex.Lock()
+	data := e.lines(samples, semantics)
+	e.mutex.Unlock()
+
+	return sendDatagrams(e.conn, data, dogStatsDPayload)
+}
+
+// Start starts exporting on the passed flush interval.
+func (e *DogStatsDExporter) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("flush interval must be positive")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.stop != nil {
+		return errors.New("dogstatsd exporter is already running")
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	e.stop, e.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				_ = e.Export()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops exporting periodically.
+func (e *DogStatsDExporter) Stop() error {
+	e.mutex.Lock()
+	stop, done := e.stop, e.done
+	e.stop, e.done = nil, nil
+	e.mutex.Unlock()
+
+	if stop == nil {
+		return errors.New("dogstatsd exporter is not running")
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
+
+// Close stops exporting if running, and closes the connection.
+func (e *DogStatsDExporter) Close() error {
+	_ = e.Stop()
+	return e.conn.Close()
+}
@@ -0,0 +1,87 @@
+package speed
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDogStatsDExporter(t *testing.T) {
+	c, err := NewPCPClient("test", WithLabels(map[string]string{"pod": "web-1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests, err := NewPCPCounterVector(map[string]int64{"GET": 1, "POST": 0}, "http.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	load, err := NewPCPGauge(0.5, "load")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(requests)
+	c.MustRegister(load)
+	c.MustRegisterString("version", "1.0", StringType, DiscreteSemantics, OneUnit)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := NewDogStatsDExporter(conn.LocalAddr().String(), c, "app", "env:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if err = e.Start(0); err == nil {
+		t.Error("expected an error starting with a zero interval")
+	}
+
+	e.SetInstanceTag("http.requests", "method")
+
+	read := func() string {
+		buf := make([]byte, dogStatsDPayload)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	// counters are only sent from the second export on
+	if err = e.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := read(); lines != "app.load:0.5|g|#env:test,pod:web-1\n" {
+		t.Errorf("expected only the gauge to be sent on the first export, got %q", lines)
+	}
+
+	requests.MustInc(3, "GET")
+	requests.MustInc(1, "POST")
+	load.MustSet(1.25)
+
+	if err = e.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"app.http.requests:3|c|#env:test,pod:web-1,method:GET",
+		"app.http.requests:1|c|#env:test,pod:web-1,method:POST",
+		"app.load:1.25|g|#env:test,pod:web-1",
+	}
+
+	if lines := read(); lines != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("expected lines %q, got %q", expected, lines)
+	}
+}
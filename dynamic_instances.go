@@ -0,0 +1,252 @@
+package speed
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OverflowInstance is the instance aggregating the keys beyond the limit of a
+// DynamicInstances created with WithMaxInstances.
+const OverflowInstance = "_other"
+
+// DynamicInstances creates the instances of an instance domain registered with a
+// client as they are first used, like one per client address or per URL, and retires
+// the ones that were not used for a while, so the instance domain of a long running
+// server follows its active keys instead of growing without bound.
+//
+// Values of the metrics using the instance domain are updated through Instance, which
+// adds the instance for a key on its first use:
+//
+//	instance, err := d.Instance(addr)
+//	if err == nil {
+//		err = requests.Inc(1, instance)
+//	}
+//
+// The instance domain should not be changed otherwise, like by an InstanceSync.
+// Like for InstanceSync, every change remaps the started client, which readers see as
+// a new generation of the file, added instances start with zero values, and only
+// instance metrics, counter vectors and gauge vectors can use the instance domain,
+// without weighted averages or a TTL. Updates of retired instances fail like updates of
+// any other instance that is not in the instance domain, until it is used again.
+type DynamicInstances struct {
+	client *PCPClient
+	indom  *PCPInstanceDomain
+	idle   time.Duration
+
+	mutex    sync.Mutex
+	used     map[string]time.Time // the last use of every instance
+	max      int                  // the limit of instances besides OverflowInstance, 0 for none
+	overflow *PCPCounter          // the uses of keys aggregated into OverflowInstance
+	runner   *collectorRunner
+	now      func() time.Time
+
+	// OnError, if set, is called with the failures of periodic expiries.
+	OnError func(error)
+}
+
+// DynamicInstancesOption configures a DynamicInstances.
+type DynamicInstancesOption func(*DynamicInstances) error
+
+// WithMaxInstances limits the number of instances, so a flood of keys, like from a
+// scan of many URLs, cannot blow up the MMV file and pmcd. Once the limit is reached,
+// Instance returns OverflowInstance for new keys, aggregating their values until idle
+// instances are retired, and every such use is counted by a counter with the passed
+// name.
+//
+// The counter is registered with the client, so the option has to be applied
+// before the client is started.
+func WithMaxInstances(n int, overflow string) DynamicInstancesOption {
+	return func(d *DynamicInstances) error {
+		if n <= 0 {
+			return errors.New("max instances must be positive")
+		}
+
+		if len(d.used) > n {
+			return errors.Errorf("instance domain %v has %v instances already, more than %v", d.indom.Name(), len(d.used), n)
+		}
+
+		counter, err := NewPCPCounter(0, overflow,
+			"number of uses of keys of "+d.indom.Name()+" aggregated into "+OverflowInstance)
+		if err != nil {
+			return err
+		}
+
+		if err = d.client.Register(counter); err != nil {
+			return err
+		}
+
+		d.max, d.overflow = n, counter
+		return nil
+	}
+}
+
+// NewDynamicInstances creates a new DynamicInstances for the passed instance domain,
+// which has to be registered with the passed client, retiring instances not used
+// within idle. The instances the domain has already count as used now.
+func NewDynamicInstances(c *PCPClient, indom *PCPInstanceDomain, idle time.Duration, opts ...DynamicInstancesOption) (*DynamicInstances, error) {
+	if idle <= 0 {
+		return nil, errors.New("idle time must be positive")
+	}
+
+	if c.r.instanceDomain(indom.Name()) != indom {
+		return nil, errors.Errorf("instance domain %v is not registered with the client", indom.Name())
+	}
+
+	d := &DynamicInstances{
+		client: c,
+		indom:  indom,
+		idle:   idle,
+		used:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+
+	now := d.now()
+	for _, name := range indom.Instances() {
+		d.used[name] = now
+	}
+
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Instance returns the instance for the passed key, adding it to the instance domain
+// if it is not in it yet, and marks it as used. With WithMaxInstances, it returns
+// OverflowInstance for new keys once the limit is reached.
+func (d *DynamicInstances) Instance(key string) (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.used[key]; !ok && d.full() {
+		key = OverflowInstance
+		_ = d.overflow.Inc(1)
+	}
+
+	if _, ok := d.used[key]; !ok {
+		if err := d.client.setInstances(d.indom, append(d.names(), key)); err != nil {
+			return "", err
+		}
+	}
+
+	d.used[key] = d.now()
+	return key, nil
+}
+
+// Expire retires all instances that were not used within the idle time, remapping the
+// client once for all of them. An instance domain cannot have no instances, so the
+// most recently used instance is kept even if it is idle.
+func (d *DynamicInstances) Expire() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
+
+	var (
+		idle   []string
+		latest string
+	)
+
+	for name, t := range d.used {
+		if now.Sub(t) >= d.idle {
+			idle = append(idle, name)
+		}
+
+		if latest == "" || t.After(d.used[latest]) || (t.Equal(d.used[latest]) && name < latest) {
+			latest = name
+		}
+	}
+
+	if len(idle) == len(d.used) {
+		for i, name := range idle {
+			if name == latest {
+				idle = append(idle[:i], idle[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if len(idle) == 0 {
+		return nil
+	}
+
+	for _, name := range idle {
+		delete(d.used, name)
+	}
+
+	if err := d.client.setInstances(d.indom, d.names()); err != nil {
+		// still in the instance domain
+		for _, name := range idle {
+			d.used[name] = now
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// full reports whether the limit of instances is reached
+func (d *DynamicInstances) full() bool {
+	if d.max == 0 {
+		return false
+	}
+
+	n := len(d.used)
+	if _, ok := d.used[OverflowInstance]; ok {
+		n--
+	}
+
+	return n >= d.max
+}
+
+// names returns the instances in use, sorted
+func (d *DynamicInstances) names() []string {
+	ans := make([]string, 0, len(d.used))
+	for name := range d.used {
+		ans = append(ans, name)
+	}
+
+	sort.Strings(ans)
+	return ans
+}
+
+// Describe sends nothing, the metrics using the instance domain are registered already
+func (d *DynamicInstances) Describe(chan<- Desc) {}
+
+// Collect retires the idle instances, reporting failures to OnError
+func (d *DynamicInstances) Collect(Recorder) {
+	if err := d.Expire(); err != nil && d.OnError != nil {
+		d.OnError(err)
+	}
+}
+
+// Start retires the idle instances every interval, until Stop is called.
+func (d *DynamicInstances) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("expiry interval must be positive")
+	}
+
+	if d.runner != nil {
+		return errors.New("instance expiry is already started")
+	}
+
+	// not a collector of the client, as the client collects holding its lock on Start, which expiring takes
+	d.runner = &collectorRunner{collector: d, interval: interval}
+	d.runner.start()
+	return nil
+}
+
+// Stop stops retiring idle instances periodically.
+func (d *DynamicInstances) Stop() {
+	if d.runner != nil {
+		d.runner.stop()
+		d.runner = nil
+	}
+}
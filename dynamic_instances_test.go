@@ -0,0 +1,201 @@
+package speed
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestDynamicInstances(t *testing.T) {
+	c, err := NewPCPClient("dynamic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0}, "test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(vector)
+	c.MustStart()
+	defer c.MustStop()
+
+	if _, err = NewDynamicInstances(c, vector.Indom(), 0); err == nil {
+		t.Error("expected an error creating dynamic instances without an idle time")
+	}
+
+	d, err := NewDynamicInstances(c, vector.Indom(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 0)
+	d.now = func() time.Time { return now }
+	d.used["a"] = now
+
+	inc := func(key string) {
+		instance, err := d.Instance(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vector.MustInc(1, instance)
+	}
+
+	inc("a")
+	inc("10.0.0.1")
+	inc("10.0.0.1")
+
+	if v, err := vector.Val("10.0.0.1"); err != nil || v != 2 {
+		t.Errorf("expected the added instance to be 2, got %v, %v", v, err)
+	}
+
+	now = now.Add(30 * time.Second)
+	inc("10.0.0.1")
+
+	// a is idle, 10.0.0.1 was used since
+	now = now.Add(30 * time.Second)
+	if err = d.Expire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if instances := vector.Indom().Instances(); !reflect.DeepEqual(instances, []string{"10.0.0.1"}) {
+		t.Errorf("expected only 10.0.0.1 to be left, got %v", instances)
+	}
+
+	if err = vector.Inc(1, "a"); err == nil {
+		t.Error("expected an error updating a retired instance")
+	}
+
+	// a retired instance comes back from zero
+	inc("a")
+
+	if v, err := vector.Val("a"); err != nil || v != 1 {
+		t.Errorf("expected a to start over, got %v, %v", v, err)
+	}
+
+	if v, err := vector.Val("10.0.0.1"); err != nil || v != 3 {
+		t.Errorf("expected 10.0.0.1 to keep its value, got %v, %v", v, err)
+	}
+
+	_, _, metrics, values, instances, _, strs, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, instances, strs, c, t)
+
+	// the most recently used instance is kept when all are idle
+	now = now.Add(2 * time.Minute)
+	if err = d.Expire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if instances := vector.Indom().Instances(); !reflect.DeepEqual(instances, []string{"a"}) {
+		t.Errorf("expected only a to be left, got %v", instances)
+	}
+
+	if err = d.Start(0); err == nil {
+		t.Error("expected an error starting with a zero interval")
+	}
+
+	if err = d.Start(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = d.Start(time.Hour); err == nil {
+		t.Error("expected an error starting twice")
+	}
+
+	d.Stop()
+}
+
+func TestDynamicInstancesLimit(t *testing.T) {
+	c, err := NewPCPClient("dynamic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0}, "test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(vector)
+
+	if _, err = NewDynamicInstances(c, vector.Indom(), time.Minute, WithMaxInstances(0, "test.requests.overflow")); err == nil {
+		t.Error("expected an error limiting the instances to 0")
+	}
+
+	d, err := NewDynamicInstances(c, vector.Indom(), time.Minute, WithMaxInstances(2, "test.requests.overflow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	now := time.Unix(0, 0)
+	d.now = func() time.Time { return now }
+	d.used["a"] = now
+
+	inc := func(key string) string {
+		instance, err := d.Instance(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vector.MustInc(1, instance)
+		return instance
+	}
+
+	inc("a")
+	now = now.Add(time.Minute)
+
+	if instance := inc("b"); instance != "b" {
+		t.Errorf("expected b to get its own instance, got %v", instance)
+	}
+
+	// keys beyond the limit are aggregated
+	for _, key := range []string{"c", "d", "c"} {
+		if instance := inc(key); instance != OverflowInstance {
+			t.Errorf("expected %v to be aggregated into %v, got %v", key, OverflowInstance, instance)
+		}
+	}
+
+	if instances := vector.Indom().Instances(); !reflect.DeepEqual(instances, []string{OverflowInstance, "a", "b"}) {
+		t.Errorf("expected a, b and %v, got %v", OverflowInstance, instances)
+	}
+
+	if v, err := vector.Val(OverflowInstance); err != nil || v != 3 {
+		t.Errorf("expected %v to be 3, got %v, %v", OverflowInstance, v, err)
+	}
+
+	if v := c.r.metrics["test.requests.overflow"].(*PCPCounter).Val(); v != 3 {
+		t.Errorf("expected 3 overflows, got %v", v)
+	}
+
+	// retiring an idle instance makes room for a new key
+	if err = d.Expire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if instance := inc("e"); instance != "e" {
+		t.Errorf("expected e to get its own instance, got %v", instance)
+	}
+
+	_, _, metrics, values, instances, _, strs, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, instances, strs, c, t)
+
+	// the counter cannot be registered with a started client
+	if _, err = NewDynamicInstances(c, vector.Indom(), time.Minute, WithMaxInstances(10, "test.other.overflow")); err == nil {
+		t.Error("expected an error limiting the instances of a started client")
+	}
+}
@@ -0,0 +1,213 @@
+package speed
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PCPEnum implements a metric storing an int32 value out of a fixed set of
+// values that each carry a label, for example a service state with
+// 0=stopped, 1=starting and 2=running.
+//
+// The mapping is appended to the long description of the metric, so it is
+// available to monitors reading the help text, and it is part of the
+// registry's Catalog.
+type PCPEnum struct {
+	*pcpSingletonMetric
+	mutex  sync.RWMutex
+	labels map[int32]string
+	values map[string]int32
+}
+
+// NewPCPEnum creates a new PCPEnum instance with an initial value and the mapping of
+// values to labels. Labels must be unique and the initial value must be mapped.
+// Optionally it can also take a couple of description strings that are used as
+// short and long descriptions respectively.
+// Internally it creates a PCP SingletonMetric with Int32Type, DiscreteSemantics
+// and OneUnit.
+func NewPCPEnum(val int32, name string, labels map[int32]string, desc ...string) (*PCPEnum, error) {
+	if len(labels) == 0 {
+		return nil, errors.New("an enum needs at least one value")
+	}
+
+	values := make(map[string]int32, len(labels))
+	for v, l := range labels {
+		if l == "" {
+			return nil, errors.Errorf("the label for value %v cannot be empty", v)
+		}
+
+		if other, present := values[l]; present {
+			return nil, errors.Errorf("values %v and %v have the same label %v", v, other, l)
+		}
+
+		values[l] = v
+	}
+
+	if _, present := labels[val]; !present {
+		return nil, errors.Errorf("initial value %v is not mapped to a label", val)
+	}
+
+	d, err := newpcpMetricDesc(name, Int32Type, DiscreteSemantics, OneUnit, desc...)
+	if err != nil {
+		return nil, err
+	}
+
+	d.longDescription = enumHelp(d.longDescription, labels)
+	if len(d.longDescription) >= StringLength {
+		return nil, errors.Errorf("the long description with the enum values is longer than %v", StringLength-1)
+	}
+
+	sm, err := newpcpSingletonMetric(val, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PCPEnum{pcpSingletonMetric: sm, labels: copyLabels(labels), values: values}, nil
+}
+
+// enumHelp appends the mapping of values to labels to a long description,
+// as "values: 0=stopped, 1=starting, 2=running".
+func enumHelp(help string, labels map[int32]string) string {
+	m := make(map[int]string, len(labels))
+	for v, l := range labels {
+		m[int(v)] = l
+	}
+
+	return mappingHelp(help, "values", m)
+}
+
+// mappingHelp appends a titled mapping of numbers to labels to a long description,
+// sorted by number.
+func mappingHelp(help, title string, labels map[int]string) string {
+	keys := make([]int, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%v=%v", k, labels[k])
+	}
+
+	mapping := title + ": " + strings.Join(pairs, ", ")
+	if help == "" {
+		return mapping
+	}
+
+	return help + "\n" + mapping
+}
+
+// parseEnumHelp reads the mapping of values to labels back from a long description
+// written by enumHelp, returning nil if there is none.
+func parseEnumHelp(help string) map[int32]string {
+	values := help[strings.LastIndex(help, "\n")+1:]
+	if !strings.HasPrefix(values, "values: ") {
+		return nil
+	}
+
+	ans := make(map[int32]string)
+	for _, pair := range strings.Split(strings.TrimPrefix(values, "values: "), ", ") {
+		i := strings.Index(pair, "=")
+		if i == -1 {
+			return nil
+		}
+
+		v, err := strconv.ParseInt(pair[:i], 10, 32)
+		if err != nil {
+			return nil
+		}
+
+		ans[int32(v)] = pair[i+1:]
+	}
+
+	return ans
+}
+
+func copyLabels(labels map[int32]string) map[int32]string {
+	ans := make(map[int32]string, len(labels))
+	for v, l := range labels {
+		ans[v] = l
+	}
+	return ans
+}
+
+// Labels returns the mapping of values to labels.
+func (e *PCPEnum) Labels() map[int32]string { return copyLabels(e.labels) }
+
+// Val returns the current value of the enum.
+func (e *PCPEnum) Val() int32 {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return e.val.(int32)
+}
+
+// Label returns the label of the current value of the enum.
+func (e *PCPEnum) Label() string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return e.labels[e.val.(int32)]
+}
+
+// Set sets the value of the enum, the value must be mapped to a label.
+func (e *PCPEnum) Set(val int32) error {
+	if err := e.prepare(); err != nil {
+		return err
+	}
+
+	if _, present := e.labels[val]; !present {
+		return errors.Errorf("value %v is not mapped to a label", val)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.set(val)
+}
+
+// MustSet is a Set that panics on failure.
+func (e *PCPEnum) MustSet(val int32) {
+	if err := e.Set(val); err != nil {
+		e.fail(err)
+	}
+}
+
+// SetLabel sets the enum to the value mapped to the passed label.
+func (e *PCPEnum) SetLabel(label string) error {
+	if err := e.prepare(); err != nil {
+		return err
+	}
+
+	val, present := e.values[label]
+	if !present {
+		return errors.Errorf("unknown label %v", label)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.set(val)
+}
+
+// MustSetLabel is a SetLabel that panics on failure.
+func (e *PCPEnum) MustSetLabel(label string) {
+	if err := e.SetLabel(label); err != nil {
+		e.fail(err)
+	}
+}
+
+// Format implements fmt.Formatter, writing the label along with the value.
+func (e *PCPEnum) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, e.name, func(plus bool) string {
+		return e.formatWith(fmt.Sprintf("%v (%v)", e.Val(), e.Label()), plus)
+	})
+}
+
+func (e *PCPEnum) String() string { return fmt.Sprint(e) }
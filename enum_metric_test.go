@@ -0,0 +1,84 @@
+package speed
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+var serviceStates = map[int32]string{0: "stopped", 1: "starting", 2: "running"}
+
+func TestEnumValidation(t *testing.T) {
+	cases := []struct {
+		val    int32
+		labels map[int32]string
+	}{
+		{0, nil},
+		{3, serviceStates},
+		{0, map[int32]string{0: "stopped", 1: ""}},
+		{0, map[int32]string{0: "stopped", 1: "stopped"}},
+	}
+
+	for _, c := range cases {
+		if _, err := NewPCPEnum(c.val, "test.state", c.labels); err == nil {
+			t.Errorf("expected an error creating an enum with value %v and labels %v", c.val, c.labels)
+		}
+	}
+}
+
+func TestEnum(t *testing.T) {
+	e, err := NewPCPEnum(0, "test.state", serviceStates, "service state", "state of the service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if help := "state of the service\nvalues: 0=stopped, 1=starting, 2=running"; e.LongDescription() != help {
+		t.Errorf("expected the long description to be %q, got %q", help, e.LongDescription())
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(e)
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = e.Set(3); err == nil {
+		t.Error("expected an error setting an unmapped value")
+	}
+
+	if err = e.SetLabel("crashed"); err == nil {
+		t.Error("expected an error setting an unknown label")
+	}
+
+	e.MustSetLabel("running")
+	if e.Val() != 2 || e.Label() != "running" {
+		t.Errorf("expected the enum to be 2 (running), got %v (%v)", e.Val(), e.Label())
+	}
+
+	_, _, m, v, _, _, _, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot create dump, error: %v", err)
+	}
+
+	off, _ := findMetric(e, m)
+	if _, val := findSingletonValue(off, v); val == nil || val.Val != 2 {
+		t.Errorf("expected the written value to be 2, got %v", val)
+	}
+
+	catalog, err := ReadCatalog(c.writer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(catalog[0].Values, serviceStates) {
+		t.Errorf("expected the catalog to have the values %v, got %v", serviceStates, catalog[0].Values)
+	}
+
+	if !reflect.DeepEqual(c.Registry().Catalog(), catalog) {
+		t.Errorf("expected the registry catalog to match the one read from the MMV file")
+	}
+}
@@ -0,0 +1,213 @@
+package speed
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var metricTypes = []MetricType{Int32Type, Uint32Type, Int64Type, Uint64Type, FloatType, DoubleType, StringType}
+
+var metricSemantics = []MetricSemantics{NoSemantics, CounterSemantics, InstantSemantics, DiscreteSemantics}
+
+var spaceUnits = []SpaceUnit{ByteUnit, KilobyteUnit, MegabyteUnit, GigabyteUnit, TerabyteUnit, PetabyteUnit, ExabyteUnit}
+
+var timeUnits = []TimeUnit{NanosecondUnit, MicrosecondUnit, MillisecondUnit, SecondUnit, MinuteUnit, HourUnit}
+
+// matchEnumName reports if s names the constant with the passed generated name,
+// either as the full name, like "Int32Type", or without the suffix, like "int32",
+// case insensitive
+func matchEnumName(s, name, suffix string) bool {
+	s = strings.TrimSpace(s)
+	return strings.EqualFold(s, name) || strings.EqualFold(s, strings.TrimSuffix(name, suffix))
+}
+
+// unmarshalName decodes a JSON string
+func unmarshalName(data []byte) (string, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return "", errors.Wrap(err, "expected a JSON string")
+	}
+	return s, nil
+}
+
+// ParseMetricType parses a MetricType from its name, like "Int32Type" or "int32".
+func ParseMetricType(s string) (MetricType, error) {
+	for _, t := range metricTypes {
+		if matchEnumName(s, t.String(), "Type") {
+			return t, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown metric type %q", s)
+}
+
+func (m MetricType) isValid() bool { return m >= Int32Type && m <= StringType }
+
+// MarshalJSON encodes a MetricType as its name.
+func (m MetricType) MarshalJSON() ([]byte, error) {
+	if !m.isValid() {
+		return nil, errors.Errorf("invalid metric type %d", m)
+	}
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON decodes a MetricType from its name.
+func (m *MetricType) UnmarshalJSON(data []byte) error {
+	s, err := unmarshalName(data)
+	if err != nil {
+		return err
+	}
+
+	*m, err = ParseMetricType(s)
+	return err
+}
+
+// ParseMetricSemantics parses a MetricSemantics from its name,
+// like "CounterSemantics", or any string accepted by ParseSemantics.
+func ParseMetricSemantics(s string) (MetricSemantics, error) {
+	for _, sem := range metricSemantics {
+		if strings.EqualFold(strings.TrimSpace(s), sem.String()) {
+			return sem, nil
+		}
+	}
+
+	return ParseSemantics(s)
+}
+
+// MarshalJSON encodes a MetricSemantics as its name.
+func (s MetricSemantics) MarshalJSON() ([]byte, error) {
+	for _, sem := range metricSemantics {
+		if s == sem {
+			return json.Marshal(s.String())
+		}
+	}
+
+	return nil, errors.Errorf("invalid metric semantics %d", s)
+}
+
+// UnmarshalJSON decodes a MetricSemantics from its name.
+func (s *MetricSemantics) UnmarshalJSON(data []byte) error {
+	name, err := unmarshalName(data)
+	if err != nil {
+		return err
+	}
+
+	*s, err = ParseMetricSemantics(name)
+	return err
+}
+
+// ParseSpaceUnit parses a SpaceUnit from its name, like "KilobyteUnit",
+// or a PCP unit name like "Kbyte".
+func ParseSpaceUnit(s string) (SpaceUnit, error) {
+	for _, u := range spaceUnits {
+		if matchEnumName(s, u.String(), "Unit") {
+			return u, nil
+		}
+	}
+
+	if u, err := ParseUnit(s); err == nil {
+		if su, ok := u.(SpaceUnit); ok {
+			return su, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown space unit %q", s)
+}
+
+// MarshalJSON encodes a SpaceUnit as its name.
+func (s SpaceUnit) MarshalJSON() ([]byte, error) {
+	for _, u := range spaceUnits {
+		if s == u {
+			return json.Marshal(s.String())
+		}
+	}
+
+	return nil, errors.Errorf("invalid space unit %d", s)
+}
+
+// UnmarshalJSON decodes a SpaceUnit from its name.
+func (s *SpaceUnit) UnmarshalJSON(data []byte) error {
+	name, err := unmarshalName(data)
+	if err != nil {
+		return err
+	}
+
+	*s, err = ParseSpaceUnit(name)
+	return err
+}
+
+// ParseTimeUnit parses a TimeUnit from its name, like "MillisecondUnit",
+// or a PCP unit name like "millisec".
+func ParseTimeUnit(s string) (TimeUnit, error) {
+	for _, u := range timeUnits {
+		if matchEnumName(s, u.String(), "Unit") {
+			return u, nil
+		}
+	}
+
+	if u, err := ParseUnit(s); err == nil {
+		if tu, ok := u.(TimeUnit); ok {
+			return tu, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown time unit %q", s)
+}
+
+// MarshalJSON encodes a TimeUnit as its name.
+func (t TimeUnit) MarshalJSON() ([]byte, error) {
+	for _, u := range timeUnits {
+		if t == u {
+			return json.Marshal(t.String())
+		}
+	}
+
+	return nil, errors.Errorf("invalid time unit %d", t)
+}
+
+// UnmarshalJSON decodes a TimeUnit from its name.
+func (t *TimeUnit) UnmarshalJSON(data []byte) error {
+	name, err := unmarshalName(data)
+	if err != nil {
+		return err
+	}
+
+	*t, err = ParseTimeUnit(name)
+	return err
+}
+
+// ParseCountUnit parses a CountUnit from its name, "OneUnit",
+// or a PCP unit name like "count".
+func ParseCountUnit(s string) (CountUnit, error) {
+	if matchEnumName(s, OneUnit.String(), "Unit") {
+		return OneUnit, nil
+	}
+
+	if u, err := ParseUnit(s); err == nil && u == MetricUnit(OneUnit) {
+		return OneUnit, nil
+	}
+
+	return 0, errors.Errorf("unknown count unit %q", s)
+}
+
+// MarshalJSON encodes a CountUnit as its name.
+func (c CountUnit) MarshalJSON() ([]byte, error) {
+	if c != OneUnit {
+		return nil, errors.Errorf("invalid count unit %d", c)
+	}
+
+	return json.Marshal(c.String())
+}
+
+// UnmarshalJSON decodes a CountUnit from its name.
+func (c *CountUnit) UnmarshalJSON(data []byte) error {
+	name, err := unmarshalName(data)
+	if err != nil {
+		return err
+	}
+
+	*c, err = ParseCountUnit(name)
+	return err
+}
@@ -0,0 +1,77 @@
+package speed
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEnumJSONRoundTrip(t *testing.T) {
+	type payload struct {
+		Type      MetricType      `json:"type"`
+		Semantics MetricSemantics `json:"semantics"`
+		Space     SpaceUnit       `json:"space"`
+		Time      TimeUnit        `json:"time"`
+		Count     CountUnit       `json:"count"`
+	}
+
+	for _, typ := range metricTypes {
+		for _, sem := range metricSemantics {
+			p := payload{typ, sem, MegabyteUnit, MillisecondUnit, OneUnit}
+
+			b, err := json.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var q payload
+			if err = json.Unmarshal(b, &q); err != nil {
+				t.Fatalf("cannot unmarshal %s, error: %v", b, err)
+			}
+
+			if p != q {
+				t.Errorf("expected %v to round trip, got %v", p, q)
+			}
+		}
+	}
+
+	b, _ := json.Marshal(payload{Int64Type, CounterSemantics, ByteUnit, SecondUnit, OneUnit})
+	expected := `{"type":"Int64Type","semantics":"CounterSemantics","space":"ByteUnit","time":"SecondUnit","count":"OneUnit"}`
+	if string(b) != expected {
+		t.Errorf("expected %v, got %s", expected, b)
+	}
+
+	if _, err := json.Marshal(MetricType(42)); err == nil {
+		t.Error("expected an error marshaling an invalid MetricType")
+	}
+
+	var typ MetricType
+	if err := json.Unmarshal([]byte(`"Int128Type"`), &typ); err == nil {
+		t.Error("expected an error unmarshaling an unknown MetricType")
+	}
+}
+
+func TestParseEnums(t *testing.T) {
+	if v, err := ParseMetricType("uint64"); err != nil || v != Uint64Type {
+		t.Errorf("expected uint64 to be Uint64Type, got %v, error: %v", v, err)
+	}
+
+	if v, err := ParseMetricSemantics("instant"); err != nil || v != InstantSemantics {
+		t.Errorf("expected instant to be InstantSemantics, got %v, error: %v", v, err)
+	}
+
+	if v, err := ParseSpaceUnit("Gbyte"); err != nil || v != GigabyteUnit {
+		t.Errorf("expected Gbyte to be GigabyteUnit, got %v, error: %v", v, err)
+	}
+
+	if v, err := ParseTimeUnit("microsecond"); err != nil || v != MicrosecondUnit {
+		t.Errorf("expected microsecond to be MicrosecondUnit, got %v, error: %v", v, err)
+	}
+
+	if v, err := ParseCountUnit("count"); err != nil || v != OneUnit {
+		t.Errorf("expected count to be OneUnit, got %v, error: %v", v, err)
+	}
+
+	if _, err := ParseTimeUnit("byte"); err == nil {
+		t.Error("expected an error parsing a space unit as a time unit")
+	}
+}
@@ -0,0 +1,109 @@
+package speed
+
+import "github.com/pkg/errors"
+
+// Resetter defines a metric whose values can be intentionally reset to zero.
+type Resetter interface {
+	Metric
+
+	Reset() error
+}
+
+// WithEpoch creates a companion discrete metric named "<name>.epoch" that is
+// incremented every time the metric is reset, so that rate computations
+// downstream can tell an intentional reset apart from a process restart.
+//
+// The companion is registered along with the metric, so the option has to be
+// applied before registering the metric with a client.
+func WithEpoch() MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if md.epoch != nil {
+			return errors.Errorf("metric %v already has an epoch", md.name)
+		}
+
+		e, err := NewPCPSingletonMetric(
+			uint32(0), md.name+".epoch", Uint32Type, DiscreteSemantics, OneUnit,
+			"number of times "+md.name+" was reset",
+		)
+		if err != nil {
+			return err
+		}
+
+		md.epoch = e
+		md.companions = append(md.companions, e)
+		return nil
+	}
+}
+
+// bumpEpoch increments the epoch of the metric, if it has one
+func (md *pcpMetricDesc) bumpEpoch() error {
+	if md.epoch == nil {
+		return nil
+	}
+
+	md.epoch.mutex.Lock()
+	defer md.epoch.mutex.Unlock()
+
+	return md.epoch.set(md.epoch.val.(uint32) + 1)
+}
+
+// Epoch returns the number of times the metric was reset,
+// which is always 0 for metrics without WithEpoch.
+func (md *pcpMetricDesc) Epoch() uint32 {
+	if md.epoch == nil {
+		return 0
+	}
+
+	return md.epoch.Val().(uint32)
+}
+
+// Reset sets the counter back to 0, bypassing the monotonicity check of Set.
+func (c *PCPCounter) Reset() error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.set(int64(0)); err != nil {
+		return err
+	}
+
+	return c.bumpEpoch()
+}
+
+// Reset sets all instances of the counter vector back to 0.
+func (c *PCPCounterVector) Reset() error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, ins := range c.indom.Instances() {
+		if err := c.setInstance(int64(0), ins); err != nil {
+			return err
+		}
+	}
+
+	return c.bumpEpoch()
+}
+
+// Reset discards all recorded values.
+func (h *PCPHistogram) Reset() error {
+	if err := h.prepare(); err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.h.Reset()
+	if err := h.update(); err != nil {
+		return err
+	}
+
+	return h.bumpEpoch()
+}
@@ -0,0 +1,82 @@
+package speed
+
+import "testing"
+
+func TestCounterReset(t *testing.T) {
+	c, err := NewPCPCounter(0, "test.reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Apply(WithEpoch()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Apply(WithEpoch()); err == nil {
+		t.Error("expected an error applying WithEpoch twice")
+	}
+
+	client, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.MustRegister(c)
+	if !client.Registry().HasMetric("test.reset.epoch") {
+		t.Error("expected the epoch metric to be registered with the counter")
+	}
+
+	client.MustStart()
+	defer client.MustStop()
+
+	c.MustInc(10)
+	if err = c.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Val() != 0 {
+		t.Errorf("expected counter to be reset to 0, got %v", c.Val())
+	}
+
+	if c.Epoch() != 1 {
+		t.Errorf("expected epoch to be 1, got %v", c.Epoch())
+	}
+
+	matchSingleDump(uint32(1), c.epoch, client, t)
+}
+
+func TestResetters(t *testing.T) {
+	cv, err := NewPCPCounterVector(map[string]int64{"a": 1, "b": 2}, "test.reset.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewPCPHistogram("test.reset.histogram", 0, 100, 3, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.MustRecord(50)
+
+	timer, err := NewPCPTimer("test.reset.timer", NanosecondUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []Resetter{cv, h, timer} {
+		if err = r.Reset(); err != nil {
+			t.Errorf("cannot reset %v, error: %v", r.Name(), err)
+		}
+	}
+
+	if v, _ := cv.Val("b"); v != 0 {
+		t.Errorf("expected vector instance to be reset, got %v", v)
+	}
+
+	if h.Max() != 0 || h.Mean() != 0 {
+		t.Errorf("expected histogram to be reset, got max %v, mean %v", h.Max(), h.Mean())
+	}
+
+	if h.Epoch() != 0 {
+		t.Error("expected no epoch for a histogram without WithEpoch")
+	}
+}
@@ -0,0 +1,120 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OtherErrorCategory is the category errors of undeclared categories are counted under
+const OtherErrorCategory = "other"
+
+// ErrorTracker counts errors by category and keeps the most recent error, exporting
+//
+// - <prefix>.count: the number of errors, with an instance per category
+//
+// - <prefix>.last.message: the message of the most recent error
+//
+// - <prefix>.last.time: the unix time of the most recent error
+//
+// Messages longer than a string metric can hold are truncated.
+type ErrorTracker struct {
+	mutex   sync.Mutex
+	count   *PCPCounterVector
+	message *PCPSingletonMetric
+	time    *PCPSingletonMetric
+	now     func() time.Time
+}
+
+// NewErrorTracker creates a new ErrorTracker with the passed categories,
+// along with the "other" category.
+func NewErrorTracker(prefix string, categories ...string) (*ErrorTracker, error) {
+	if prefix == "" {
+		return nil, errors.New("error tracker prefix cannot be empty")
+	}
+
+	counts := map[string]int64{OtherErrorCategory: 0}
+	for _, c := range categories {
+		if _, present := counts[c]; present {
+			return nil, errors.Errorf("error category %v declared twice", c)
+		}
+		counts[c] = 0
+	}
+
+	count, err := NewPCPCounterVector(counts, prefix+".count", "number of errors by category")
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := NewPCPSingletonMetric(
+		"", prefix+".last.message", StringType, DiscreteSemantics, OneUnit,
+		"message of the most recent error",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewPCPSingletonMetric(
+		int64(0), prefix+".last.time", Int64Type, DiscreteSemantics, SecondUnit,
+		"unix time of the most recent error",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ErrorTracker{count: count, message: message, time: t, now: time.Now}, nil
+}
+
+// Metrics returns all the metrics exported by the tracker.
+func (e *ErrorTracker) Metrics() []Metric {
+	return []Metric{e.count, e.message, e.time}
+}
+
+// Register registers all metrics of the tracker with the passed client.
+func (e *ErrorTracker) Register(c Client) error {
+	for _, m := range e.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Track records an error of the passed category, counting it under "other"
+// if the category was not declared. Tracking a nil error does nothing.
+func (e *ErrorTracker) Track(category string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.count.Indom().HasInstance(category) {
+		category = OtherErrorCategory
+	}
+
+	if cerr := e.count.Inc(1, category); cerr != nil {
+		return cerr
+	}
+
+	msg := err.Error()
+	if len(msg) > StringLength-1 {
+		msg = msg[:StringLength-1]
+	}
+
+	if cerr := e.message.Set(msg); cerr != nil {
+		return cerr
+	}
+
+	return e.time.Set(e.now().Unix())
+}
+
+// MustTrack is Track that panics on failure.
+func (e *ErrorTracker) MustTrack(category string, err error) {
+	if terr := e.Track(category, err); terr != nil {
+		e.count.fail(terr)
+	}
+}
@@ -0,0 +1,77 @@
+package speed
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorTracker(t *testing.T) {
+	e, err := NewErrorTracker("test.errors", "db", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.now = func() time.Time { return time.Unix(1500000000, 0) }
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = e.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	e.MustTrack("db", errors.New("connection refused"))
+	e.MustTrack("db", nil)
+	e.MustTrack("disk", errors.New(strings.Repeat("x", 2*StringLength)))
+
+	if v, _ := e.count.Val("db"); v != 1 {
+		t.Errorf("expected 1 db error, got %v", v)
+	}
+
+	if v, _ := e.count.Val(OtherErrorCategory); v != 1 {
+		t.Errorf("expected 1 other error, got %v", v)
+	}
+
+	if msg := e.message.Val().(string); len(msg) != StringLength-1 {
+		t.Errorf("expected the last message to be truncated to %v bytes, got %v", StringLength-1, len(msg))
+	}
+
+	if v := e.time.Val(); v != int64(1500000000) {
+		t.Errorf("expected the last error time to be 1500000000, got %v", v)
+	}
+
+	if _, err = NewErrorTracker("test.errors", "db", "db"); err == nil {
+		t.Error("expected an error declaring a category twice")
+	}
+}
+
+func TestErrorTrackerMustTrackPanicHandler(t *testing.T) {
+	var handled []error
+	c, err := NewPCPClient("test", WithPanicHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewErrorTracker("test.errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = e.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// tracking from a callback of an update of the count fails
+	e.count.callback(func() { e.MustTrack("db", errors.New("failed")) })
+
+	if len(handled) != 1 {
+		t.Errorf("expected the failure to be handled by the panic handler, got %v", handled)
+	}
+}
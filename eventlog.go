@@ -0,0 +1,159 @@
+package speed
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// EventLog counts events and keeps the descriptions of the most recent ones,
+// exporting the number of events as "<name>.count" and the descriptions of up to
+// the last n events, newest first and one per line, as the string metric
+// "<name>.recent", so for example the most recent errors show up in pminfo.
+//
+// A string metric holds at most StringLength-1 bytes, so the oldest of the
+// kept events are left out of "<name>.recent" when they do not fit, and the
+// newest event is truncated if it does not fit on its own.
+type EventLog struct {
+	mutex  sync.Mutex
+	events []string // ring of the last n events
+	next   int      // position of the next event in the ring
+	full   bool
+
+	count  *PCPCounter
+	recent *PCPSingletonMetric
+}
+
+// NewEventLog creates a new EventLog keeping the last n events.
+// It can optionally take a description of the events, used in the descriptions of both metrics.
+func NewEventLog(name string, n int, desc ...string) (*EventLog, error) {
+	if name == "" {
+		return nil, errors.New("event log name cannot be empty")
+	}
+
+	if n < 1 {
+		return nil, errors.New("event log must keep at least one event")
+	}
+
+	if len(desc) > 1 {
+		return nil, errors.New("only an optional description of the events is allowed")
+	}
+
+	events := name
+	if len(desc) > 0 {
+		events = desc[0]
+	}
+
+	count, err := NewPCPCounter(0, name+".count", "number of "+events)
+	if err != nil {
+		return nil, err
+	}
+
+	recent, err := NewPCPSingletonMetric(
+		"", name+".recent", StringType, DiscreteSemantics, OneUnit,
+		"most recent "+events+", newest first",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventLog{events: make([]string, n), count: count, recent: recent}, nil
+}
+
+// Metrics returns both metrics of the log.
+func (l *EventLog) Metrics() []Metric {
+	return []Metric{l.count, l.recent}
+}
+
+// Register registers both metrics of the log with the passed client.
+func (l *EventLog) Register(c Client) error {
+	for _, m := range l.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Record counts an event and adds its description to the recent events.
+func (l *EventLog) Record(event string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.count.Inc(1); err != nil {
+		return err
+	}
+
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	l.full = l.full || l.next == 0
+
+	return l.recent.Set(joinEvents(l.recentEvents(), StringLength-1))
+}
+
+// MustRecord is Record that panics on failure.
+func (l *EventLog) MustRecord(event string) {
+	if err := l.Record(event); err != nil {
+		l.count.fail(err)
+	}
+}
+
+// Recent returns the descriptions of the kept events, newest first.
+func (l *EventLog) Recent() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.recentEvents()
+}
+
+// recentEvents returns the kept events, newest first
+func (l *EventLog) recentEvents() []string {
+	n := l.next
+	if l.full {
+		n = len(l.events)
+	}
+
+	ans := make([]string, n)
+	for i := range ans {
+		ans[i] = l.events[(l.next-1-i+len(l.events))%len(l.events)]
+	}
+
+	return ans
+}
+
+// Count returns the number of recorded events.
+func (l *EventLog) Count() int64 { return l.count.Val() }
+
+// joinEvents joins as many events as fit in max bytes, one per line,
+// truncating the first event on a character boundary if it does not fit
+func joinEvents(events []string, max int) string {
+	if len(events) == 0 {
+		return ""
+	}
+
+	first := events[0]
+	if len(first) > max {
+		n := max
+		for n > 0 && !utf8.RuneStart(first[n]) {
+			n--
+		}
+		return first[:n]
+	}
+
+	var b strings.Builder
+	b.WriteString(first)
+
+	for _, e := range events[1:] {
+		if b.Len()+1+len(e) > max {
+			break
+		}
+
+		b.WriteByte('\n')
+		b.WriteString(e)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package speed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEventLog(t *testing.T) {
+	l, err := NewEventLog("test.errors", 3, "errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewEventLog("test.errors", 0); err == nil {
+		t.Error("expected an error keeping no events")
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = l.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if len(l.Recent()) != 0 {
+		t.Errorf("expected no recent events, got %v", l.Recent())
+	}
+
+	for _, e := range []string{"a", "b", "c", "d"} {
+		l.MustRecord(e)
+	}
+
+	if l.Count() != 4 {
+		t.Errorf("expected 4 events, got %v", l.Count())
+	}
+
+	if r := l.Recent(); !reflect.DeepEqual(r, []string{"d", "c", "b"}) {
+		t.Errorf("expected the last 3 events newest first, got %v", r)
+	}
+
+	if v := l.recent.Val().(string); v != "d\nc\nb" {
+		t.Errorf("expected %q, got %q", "d\nc\nb", v)
+	}
+
+	long := strings.Repeat("x", 200)
+	l.MustRecord(long)
+	if v := l.recent.Val().(string); v != long+"\nd\nc" {
+		t.Errorf("unexpected recent events %q", v)
+	}
+
+	l.MustRecord(long)
+	if v := l.recent.Val().(string); v != long {
+		t.Errorf("expected only the newest event to fit, got %q", v)
+	}
+}
+
+func TestJoinEvents(t *testing.T) {
+	if s := joinEvents([]string{"héllo", "b"}, 2); s != "h" {
+		t.Errorf("expected the first event to be truncated on a character boundary, got %q", s)
+	}
+
+	if s := joinEvents([]string{"ab", "cd", "ef"}, 6); s != "ab\ncd" {
+		t.Errorf("expected the events that fit, got %q", s)
+	}
+}
+
+func TestEventLogMustRecordPanicHandler(t *testing.T) {
+	var handled []error
+	c, err := NewPCPClient("test", WithPanicHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewEventLog("test.events", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = l.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// recording from a callback of an update of the count fails
+	l.count.callback(func() { l.MustRecord("event") })
+
+	if len(handled) != 1 {
+		t.Errorf("expected the failure to be handled by the panic handler, got %v", handled)
+	}
+}
@@ -0,0 +1,301 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ExistingFilePolicy defines what a client does on Start when its MMV file
+// already exists, for example, when it was left behind by a previous run that
+// crashed before stopping the client.
+type ExistingFilePolicy int
+
+// Possible values for an ExistingFilePolicy
+const (
+	// RecreateExistingFile removes the existing file and writes a new one.
+	// This is the behaviour of clients without WithExistingFilePolicy.
+	RecreateExistingFile ExistingFilePolicy = iota
+
+	// FailOnExistingFile makes Start fail, leaving the existing file in place,
+	// for example, to avoid replacing the file of another running process.
+	FailOnExistingFile
+
+	// ReuseCompatibleFile restores the values in the existing file into the metrics
+	// of the client, if the file describes exactly the same metrics, with the same
+	// types, semantics, units and instances, so counters continue from where the
+	// previous run left off. Otherwise, the file is recreated.
+	//
+	// Only the values are restored, so metrics deriving their values from internal
+	// state, like histograms, overwrite the restored values on their next update.
+	ReuseCompatibleFile
+
+	// RebindExistingFile restores the values in the existing file into the metrics
+	// of the client with the same name, type, semantics and unit, finding them
+	// through the layout persisted by the previous run with WithPersistedLayout,
+	// so counters continue from where the previous run left off, even when metrics
+	// were added or removed in between. Without a layout matching the file, the
+	// file is recreated. A layout file that cannot be read, or values that cannot be
+	// read at the offsets of a matching layout, fail Start.
+	RebindExistingFile
+)
+
+// WithExistingFilePolicy sets what the client does on Start when its MMV file already exists.
+func WithExistingFilePolicy(p ExistingFilePolicy) ClientOption {
+	return func(c *PCPClient) error {
+		if p < RecreateExistingFile || p > RebindExistingFile {
+			return errors.Errorf("invalid existing file policy %d", p)
+		}
+
+		c.existingFile = p
+		return nil
+	}
+}
+
+// handleExistingFile applies the existing file policy, before the file is recreated
+func (c *PCPClient) handleExistingFile() error {
+	if c.existingFile == RecreateExistingFile {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.loc)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if c.existingFile == FailOnExistingFile {
+		return errors.Errorf("MMV file %v already exists", c.loc)
+	}
+
+	if err == nil && c.existingFile == RebindExistingFile {
+		return c.rebind(data)
+	}
+
+	// an unreadable or incompatible file is simply recreated
+	if err != nil || !c.compatible(data) {
+		return nil
+	}
+
+	samples, err := ReadSamples(data)
+	if err != nil {
+		return nil
+	}
+
+	c.restore(samples)
+	return nil
+}
+
+// compatible checks whether the passed MMV file describes the same metrics as the registry
+func (c *PCPClient) compatible(data []byte) bool {
+	existing, err := ReadCatalog(data)
+	if err != nil {
+		return false
+	}
+
+	current := c.r.Catalog()
+	if len(existing) != len(current) {
+		return false
+	}
+
+	for i, e := range existing {
+		m := current[i]
+		if e.Name != m.Name || e.Type != m.Type || e.Semantics != m.Semantics || e.Unit != m.Unit {
+			return false
+		}
+
+		if (e.Indom == nil) != (m.Indom == nil) {
+			return false
+		}
+
+		if e.Indom != nil && (e.Indom.ID != m.Indom.ID || !stringsEqual(e.Indom.Instances, m.Indom.Instances)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// restore sets the values of the metrics in the registry to the passed samples
+func (c *PCPClient) restore(samples []Sample) {
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	for _, s := range samples {
+		m := c.r.metrics[s.Metric]
+		if l, ok := m.(valueLocker); ok {
+			unlock := l.lockValues()
+			restoreSample(m, s)
+			unlock()
+		}
+	}
+}
+
+// restoreSample writes the value of a sample to a metric, which is locked
+func restoreSample(m PCPMetric, s Sample) {
+	switch m := m.(type) {
+	case singletonMetric:
+		sm := m.singleton()
+		sm.val = sm.t.resolve(s.Value)
+		sm.assigned = true
+	case instanceMetric:
+		im := m.instances()
+		if v, ok := im.vals[s.Instance]; ok {
+			v.val = im.t.resolve(s.Value)
+			v.assigned = true
+
+			if im.weighted != nil {
+				im.weighted.setValue(s.Instance, v.val)
+			}
+
+			for _, a := range im.weighting {
+				a.setWeight(s.Instance, v.val)
+			}
+		}
+
+		if im.rollup != nil {
+			im.rollup.refresh()
+		}
+	}
+}
+
+// SeedFrom initializes the metrics of a client that is not started yet with the
+// values in the MMV file at the passed path, usually left behind by a previous run.
+// Only metrics with the same name and type are seeded, others keep their values.
+//
+// Unlike RebindExistingFile or WithPersistence, it needs no support from the previous
+// run, but only restores what the file had when that run stopped updating it.
+func (c *PCPClient) SeedFrom(path string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.r.mapped {
+		return errors.New("cannot seed the values of a started client")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "cannot read the MMV file to seed from")
+	}
+
+	samples, err := ReadSamples(data)
+	if err != nil {
+		return err
+	}
+
+	c.r.metricslock.RLock()
+	matching := samples[:0]
+	for _, s := range samples {
+		if m, ok := c.r.metrics[s.Metric]; ok && m.Type().IsCompatible(s.Value) {
+			matching = append(matching, s)
+		}
+	}
+	c.r.metricslock.RUnlock()
+
+	c.restore(matching)
+	return nil
+}
+
+// valueLocker is implemented by the metrics whose values can be restored,
+// locking them like their updates do, returning a function unlocking them
+type valueLocker interface {
+	lockValues() func()
+}
+
+func (m *PCPSingletonMetric) lockValues() func() {
+	m.mutex.Lock()
+	return m.mutex.Unlock
+}
+
+func (c *PCPCounter) lockValues() func() {
+	c.mutex.Lock()
+	return c.mutex.Unlock
+}
+
+func (g *PCPGauge) lockValues() func() {
+	g.mutex.Lock()
+	return g.mutex.Unlock
+}
+
+func (t *PCPTimer) lockValues() func() {
+	t.mutex.Lock()
+	return t.mutex.Unlock
+}
+
+func (p *PCPPercentage) lockValues() func() {
+	p.mutex.Lock()
+	return p.mutex.Unlock
+}
+
+func (e *PCPEnum) lockValues() func() {
+	e.mutex.Lock()
+	return e.mutex.Unlock
+}
+
+func (b *PCPBitField) lockValues() func() {
+	b.mutex.Lock()
+	return b.mutex.Unlock
+}
+
+func (m *PCPInstanceMetric) lockValues() func() {
+	m.mutex.Lock()
+	return m.mutex.Unlock
+}
+
+func (c *PCPCounterVector) lockValues() func() {
+	c.mutex.Lock()
+	return c.mutex.Unlock
+}
+
+func (g *PCPGaugeVector) lockValues() func() {
+	g.mutex.Lock()
+	return g.mutex.Unlock
+}
+
+func (h *PCPHistogram) lockValues() func() {
+	h.mutex.Lock()
+	return h.mutex.Unlock
+}
+
+func (s *PCPSLO) lockValues() func() {
+	s.mutex.Lock()
+	return s.mutex.Unlock
+}
+
+func (m *MultiDimMetric) lockValues() func() {
+	m.mutex.Lock()
+	return m.mutex.Unlock
+}
+
+// lockMetric locks the values of a metric while the mapping of its client changes,
+// unless the calling goroutine holds the lock already, running a callback of one of
+// its updates, see pcpMetricDesc.callback. It returns a function unlocking it.
+func lockMetric(m PCPMetric) func() {
+	l, ok := m.(valueLocker)
+	if !ok {
+		return func() {}
+	}
+
+	if dm, ok := m.(describedMetric); ok {
+		if g := atomic.LoadInt64(&dm.desc().callbackGoroutine); g != 0 && g == goroutineID() {
+			return func() {}
+		}
+	}
+
+	return l.lockValues()
+}
@@ -0,0 +1,140 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// leaveBehind writes the MMV file of a client with the passed counter value,
+// as if the process crashed without stopping the client
+func leaveBehind(t *testing.T, val int64) string {
+	c, err := NewPCPClient("existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegisterString("test.vector[a,b]", Instances{"a": 1.5, "b": 2.5}, DoubleType, InstantSemantics, OneUnit)
+	c.MustStart()
+
+	counter.MustInc(val)
+	data := append([]byte(nil), c.writer.Bytes()...)
+	c.MustStop()
+
+	if err = ioutil.WriteFile(c.loc, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return c.loc
+}
+
+func TestExistingFilePolicy(t *testing.T) {
+	if _, err := NewPCPClient("existing", WithExistingFilePolicy(ExistingFilePolicy(42))); err == nil {
+		t.Error("expected an error creating a client with an invalid policy")
+	}
+
+	newClient := func(p ExistingFilePolicy, typ MetricType) (*PCPClient, *PCPSingletonMetric) {
+		c, err := NewPCPClient("existing", WithExistingFilePolicy(p))
+		if err != nil {
+			panic(err)
+		}
+
+		var val interface{} = int64(0)
+		if typ == Uint64Type {
+			val = uint64(0)
+		}
+
+		m := c.MustRegisterString("test.counter", val, typ, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+		c.MustRegisterString("test.vector[a,b]", Instances{"a": 0.0, "b": 0.0}, DoubleType, InstantSemantics, OneUnit)
+		return c, m
+	}
+
+	loc := leaveBehind(t, 5)
+	defer os.Remove(loc)
+
+	c, _ := newClient(FailOnExistingFile, Int64Type)
+	if err := c.Start(); err == nil {
+		t.Error("expected an error starting a client with an existing file")
+		c.MustStop()
+	}
+
+	if _, err := os.Stat(loc); err != nil {
+		t.Errorf("expected the existing file to be left in place, got %v", err)
+	}
+
+	c, m := newClient(ReuseCompatibleFile, Int64Type)
+	c.MustStart()
+
+	if m.Val() != int64(5) {
+		t.Errorf("expected the counter to be restored to 5, got %v", m.Val())
+	}
+
+	matchSingleDump(int64(5), m, c, t)
+
+	v := c.r.metrics["test.vector"].(*PCPInstanceMetric)
+	if b, err := v.ValInstance("b"); err != nil || b != 2.5 {
+		t.Errorf("expected the instance b to be restored to 2.5, got %v", b)
+	}
+
+	c.MustStop()
+
+	// an incompatible file is recreated
+	loc = leaveBehind(t, 5)
+
+	c, m = newClient(ReuseCompatibleFile, Uint64Type)
+	c.MustStart()
+	defer c.MustStop()
+
+	if m.Val() != uint64(0) {
+		t.Errorf("expected the counter not to be restored from an incompatible file, got %v", m.Val())
+	}
+}
+
+func TestSeedFrom(t *testing.T) {
+	loc := leaveBehind(t, 5)
+	defer os.Remove(loc)
+
+	c, err := NewPCPClient("seeded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	changed := c.MustRegisterString("test.vector[a,b]", Instances{"a": int32(0), "b": int32(0)}, Int32Type, InstantSemantics, OneUnit).(*PCPInstanceMetric)
+	added := c.MustRegisterString("test.added", int64(1), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+
+	if err = c.SeedFrom(loc); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Val() != int64(5) {
+		t.Errorf("expected the counter to be seeded with 5, got %v", m.Val())
+	}
+
+	if b, err := changed.ValInstance("b"); err != nil || b != int32(0) {
+		t.Errorf("expected a metric with a different type not to be seeded, got %v", b)
+	}
+
+	if added.Val() != int64(1) {
+		t.Errorf("expected a metric missing from the file to keep its value, got %v", added.Val())
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	matchSingleDump(int64(5), m, c, t)
+
+	if err = c.SeedFrom(loc); err == nil {
+		t.Error("expected an error seeding a started client")
+	}
+
+	if err = (&PCPClient{r: NewPCPRegistry()}).SeedFrom(loc + ".missing"); err == nil {
+		t.Error("expected an error seeding from a missing file")
+	}
+}
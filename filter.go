@@ -0,0 +1,69 @@
+package speed
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// MetricFilter decides whether the values of the metric with the passed name
+// are written to the MMV file and exported.
+type MetricFilter func(name string) bool
+
+// SetFilter sets the filter deciding which metrics of the client have their values
+// written and exported, so verbose debug metrics can be registered everywhere but
+// only enabled where needed. Unlike most settings, it can be changed at any time,
+// a nil filter enables all metrics, which is the default.
+//
+// Disabled metrics stay in the MMV file, since its layout is fixed once started,
+// with the value they had when they were disabled, while updates only change their
+// value in memory, until their first update after being enabled again.
+func (c *PCPClient) SetFilter(f MetricFilter) {
+	c.filter.Store(f)
+}
+
+// enabled returns whether the level and the filter of the client enable the passed metric
+func (c *PCPClient) enabled(name string, level MetricLevel) bool {
+	if level > c.Level() {
+		return false
+	}
+
+	f, _ := c.filter.Load().(MetricFilter)
+	return f == nil || f(name)
+}
+
+// filtering makes an update closure skip writes while the metric is disabled
+func (c *PCPClient) filtering(name string, level MetricLevel, update updateClosure) updateClosure {
+	return func(val interface{}) error {
+		if !c.enabled(name, level) {
+			return nil
+		}
+
+		return update(val)
+	}
+}
+
+// GlobFilter creates a MetricFilter enabling the metrics matching any of the allow
+// patterns, or all metrics if there are none, except for the ones matching any of
+// the deny patterns. The patterns use the syntax of path.Match, so "*" matches any
+// sequence of characters, including dots.
+func GlobFilter(allow, deny []string) (MetricFilter, error) {
+	for _, p := range append(append([]string(nil), allow...), deny...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.Errorf("invalid metric pattern %q", p)
+		}
+	}
+
+	matches := func(patterns []string, name string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(name string) bool {
+		return (len(allow) == 0 || matches(allow, name)) && !matches(deny, name)
+	}, nil
+}
@@ -0,0 +1,87 @@
+package speed
+
+import "testing"
+
+func TestSetFilter(t *testing.T) {
+	c, err := NewPCPClient("filter", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := c.MustRegisterString("app.requests", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	debug := c.MustRegisterString("app.debug.queue", int64(0), Int64Type, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+	defer c.MustStop()
+
+	f, err := GlobFilter(nil, []string{"app.debug.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetFilter(f)
+
+	requests.MustSet(int64(3))
+	debug.MustSet(int64(9))
+
+	written := func() map[string]interface{} {
+		samples, err := c.allSamples()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ans := make(map[string]interface{})
+		for _, s := range samples {
+			ans[s.Metric] = s.Value
+		}
+		return ans
+	}
+
+	if w := written(); w["app.requests"] != int64(3) || w["app.debug.queue"] != int64(0) {
+		t.Errorf("expected only the enabled metric to be written, got %v", w)
+	}
+
+	if debug.Val() != int64(9) {
+		t.Errorf("expected the disabled metric to be updated in memory, got %v", debug.Val())
+	}
+
+	samples, err := c.Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 1 || samples[0].Metric != "app.requests" {
+		t.Errorf("expected the disabled metric not to be exported, got %v", samples)
+	}
+
+	// enabled again at runtime, written on the next update
+	c.SetFilter(nil)
+	debug.MustSet(int64(10))
+
+	if w := written(); w["app.debug.queue"] != int64(10) {
+		t.Errorf("expected the enabled metric to be written, got %v", w)
+	}
+}
+
+func TestGlobFilter(t *testing.T) {
+	f, err := GlobFilter([]string{"app.*", "runtime.gc.*"}, []string{"app.debug.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"app.requests":    true,
+		"app.http.errors": true,
+		"app.debug.queue": false,
+		"runtime.gc.runs": true,
+		"runtime.memory":  false,
+	}
+
+	for name, expected := range cases {
+		if f(name) != expected {
+			t.Errorf("expected %v to be enabled: %v", name, expected)
+		}
+	}
+
+	if _, err := GlobFilter([]string{"app.["}, nil); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
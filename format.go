@@ -0,0 +1,197 @@
+package speed
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Clients, metrics and instance domains are formatted as structured multi-line
+// text by String and the %v and %s verbs, listing their descriptions and values.
+//
+// The %+v verb also includes the ids and, while mapped, the offsets everything
+// was written at in the MMV file, for debugging layout problems.
+
+// indent prefixes all lines of s with two spaces
+func indent(s string) string {
+	return "  " + strings.Replace(s, "\n", "\n  ", -1)
+}
+
+// formatVerb writes the output of format for the %v and %s verbs,
+// and an error marker like the fmt package for all others
+func formatVerb(f fmt.State, verb rune, name string, format func(plus bool) string) {
+	switch verb {
+	case 'v', 's':
+		_, _ = io.WriteString(f, format(verb == 'v' && f.Flag('+')))
+	default:
+		_, _ = fmt.Fprintf(f, "%%!%c(%v)", verb, name)
+	}
+}
+
+// formatNested formats a metric or an instance domain listed by a client
+func formatNested(v interface{}, plus bool) string {
+	if plus {
+		return fmt.Sprintf("%+v", v)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// format describes the metric, followed by the passed lines describing its values
+func (md *pcpMetricDesc) format(plus bool, values ...string) string {
+	var b strings.Builder
+
+	b.WriteString(md.name)
+	if plus {
+		fmt.Fprintf(&b, " (id %v", md.id)
+		if md.offset != 0 {
+			fmt.Fprintf(&b, ", offset %v", md.offset)
+		}
+		b.WriteString(")")
+	}
+
+	fmt.Fprintf(&b, "\n  type: %v, semantics: %v, unit: %v", md.t, md.sem, pmUnitsString(md.u))
+
+	if md.shortDescription != "" {
+		fmt.Fprintf(&b, "\n  help: %v", md.shortDescription)
+	}
+
+	if md.longDescription != "" {
+		fmt.Fprintf(&b, "\n  long help: %v", md.longDescription)
+	}
+
+	for _, v := range values {
+		b.WriteString("\n" + indent(v))
+	}
+
+	return b.String()
+}
+
+// formatValue describes a single value, with its offset if it is mapped
+func formatValue(val string, md *pcpMetricDesc, offset int, plus bool) string {
+	if plus && md.offset != 0 {
+		return fmt.Sprintf("%v (offset %v)", val, offset)
+	}
+
+	return val
+}
+
+func (m *pcpSingletonMetric) formatWith(val string, plus bool) string {
+	return m.format(plus, "value: "+formatValue(val, m.pcpMetricDesc, m.offset, plus))
+}
+
+// Format implements fmt.Formatter.
+func (m *pcpSingletonMetric) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, m.name, func(plus bool) string {
+		return m.formatWith(fmt.Sprint(m.val), plus)
+	})
+}
+
+func (m *pcpSingletonMetric) String() string { return fmt.Sprint(m) }
+
+// Format implements fmt.Formatter.
+func (m *pcpInstanceMetric) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, m.name, func(plus bool) string {
+		values := []string{"indom: " + m.indom.name, "instances:"}
+
+		for _, name := range m.indom.Instances() {
+			v := m.vals[name]
+			values = append(values, "  "+name+": "+formatValue(fmt.Sprint(v.val), m.pcpMetricDesc, v.offset, plus))
+		}
+
+		return m.format(plus, values...)
+	})
+}
+
+func (m *pcpInstanceMetric) String() string { return fmt.Sprint(m) }
+
+// Format implements fmt.Formatter.
+func (m *PCPConstMetric) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, m.name, func(plus bool) string {
+		return m.format(plus, "value: "+formatValue(fmt.Sprint(m.val), m.pcpMetricDesc, m.offset, plus))
+	})
+}
+
+// Format implements fmt.Formatter.
+func (indom *PCPInstanceDomain) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, indom.name, func(plus bool) string {
+		var b strings.Builder
+
+		b.WriteString(indom.name)
+		if plus {
+			fmt.Fprintf(&b, " (id %v)", indom.id)
+		}
+
+		if indom.shortDescription != "" {
+			fmt.Fprintf(&b, "\n  help: %v", indom.shortDescription)
+		}
+
+		if indom.longDescription != "" {
+			fmt.Fprintf(&b, "\n  long help: %v", indom.longDescription)
+		}
+
+		if !plus {
+			fmt.Fprintf(&b, "\n  instances: %v", strings.Join(indom.Instances(), ", "))
+			return b.String()
+		}
+
+		b.WriteString("\n  instances:")
+		for _, i := range indom.sortedInstances() {
+			fmt.Fprintf(&b, "\n    %v (id %v", i.name, i.id)
+			if i.offset != 0 {
+				fmt.Fprintf(&b, ", offset %v", i.offset)
+			}
+			b.WriteString(")")
+		}
+
+		return b.String()
+	})
+}
+
+// Format implements fmt.Formatter.
+func (c *PCPClient) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, c.loc, func(plus bool) string {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		var b strings.Builder
+
+		fmt.Fprintf(&b, "%v (cluster %v)", c.loc, c.clusterID)
+
+		switch {
+		case c.r.mapped:
+			fmt.Fprintf(&b, "\n  mapped, generation %v, %v bytes", c.generation, c.Length())
+		case c.deferred:
+			b.WriteString("\n  started, not mapped until the first write")
+		default:
+			b.WriteString("\n  not mapped")
+		}
+
+		if plus && c.r.mapped {
+			fmt.Fprintf(
+				&b, "\n  sections: indoms at %v, instances at %v, metrics at %v, values at %v, strings at %v",
+				c.r.indomoffset, c.r.instanceoffset, c.r.metricsoffset, c.r.valuesoffset, c.r.stringsoffset,
+			)
+		}
+
+		metrics := c.r.sortedMetrics()
+		if len(metrics) > 0 {
+			b.WriteString("\n  metrics:")
+			for _, m := range metrics {
+				b.WriteString("\n" + indent(indent(formatNested(m, plus))))
+			}
+		}
+
+		indoms := c.r.sortedInstanceDomains()
+		if len(indoms) > 0 {
+			b.WriteString("\n  instance domains:")
+			for _, indom := range indoms {
+				b.WriteString("\n" + indent(indent(formatNested(indom, plus))))
+			}
+		}
+
+		return b.String()
+	})
+}
+
+func (c *PCPClient) String() string { return fmt.Sprint(c) }
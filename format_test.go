@@ -0,0 +1,138 @@
+package speed
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormatMetrics(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(42, "test.counter", "number of requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPGaugeVector(map[string]float64{"b": 2, "a": 1.5}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enum, err := NewPCPEnum(1, "test.state", map[int32]string{0: "stopped", 1: "running"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegister(vector)
+	c.MustRegister(enum)
+
+	expected := "test.counter\n" +
+		"  type: Int64Type, semantics: CounterSemantics, unit: count\n" +
+		"  help: number of requests\n" +
+		"  value: 42"
+	if s := counter.String(); s != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, s)
+	}
+
+	if s := fmt.Sprintf("%v", counter); s != expected {
+		t.Errorf("expected %%v to be the same as String, got\n%v", s)
+	}
+
+	expected = "test.vector\n" +
+		"  type: DoubleType, semantics: InstantSemantics, unit: count\n" +
+		"  indom: test.vector.indom\n" +
+		"  instances:\n" +
+		"    a: 1.5\n" +
+		"    b: 2"
+	if s := vector.String(); s != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, s)
+	}
+
+	if s := enum.String(); !strings.HasSuffix(s, "value: 1 (running)") {
+		t.Errorf("expected the enum to be formatted with its label, got\n%v", s)
+	}
+
+	if s := fmt.Sprintf("%d", counter); s != "%!d(test.counter)" {
+		t.Errorf("expected an error marker for %%d, got %v", s)
+	}
+
+	if s := fmt.Sprintf("%+v", counter); strings.Contains(s, "offset") {
+		t.Errorf("expected no offsets for an unmapped metric, got\n%v", s)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	s := fmt.Sprintf("%+v", counter)
+	if !strings.HasPrefix(s, fmt.Sprintf("test.counter (id %v, offset %v)", counter.id, counter.pcpMetricDesc.offset)) {
+		t.Errorf("expected the id and offset of the metric, got\n%v", s)
+	}
+
+	if !strings.HasSuffix(s, fmt.Sprintf("value: 42 (offset %v)", counter.pcpSingletonMetric.offset)) {
+		t.Errorf("expected the offset of the value, got\n%v", s)
+	}
+
+	if counter.pcpMetricDesc.offset == 0 || counter.pcpSingletonMetric.offset == 0 {
+		t.Error("expected the offsets to be set while mapped")
+	}
+}
+
+func TestFormatInstanceDomain(t *testing.T) {
+	indom, err := NewPCPInstanceDomain("test.indom", []string{"b", "a"}, "things")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "test.indom\n  help: things\n  instances: a, b"
+	if s := indom.String(); s != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, s)
+	}
+
+	expected = fmt.Sprintf(
+		"test.indom (id %v)\n  help: things\n  instances:\n    a (id %v)\n    b (id %v)",
+		indom.id, indom.instances["a"].id, indom.instances["b"].id,
+	)
+	if s := fmt.Sprintf("%+v", indom); s != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, s)
+	}
+}
+
+func TestFormatClient(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.a[x,y]", Instances{"x": 1, "y": 2}, Int32Type, InstantSemantics, OneUnit)
+	c.MustRegisterString("test.b", 3, Int32Type, InstantSemantics, OneUnit)
+
+	s := c.String()
+	if !strings.Contains(s, "\n  not mapped\n  metrics:\n    test.a\n") {
+		t.Errorf("expected an unmapped client listing its metrics, got\n%v", s)
+	}
+
+	if !strings.Contains(s, "\n  instance domains:\n    test.a\n      instances: x, y") {
+		t.Errorf("expected the client to list its instance domains, got\n%v", s)
+	}
+
+	if strings.Index(s, "test.a\n") > strings.Index(s, "test.b\n") {
+		t.Errorf("expected the metrics to be sorted by name, got\n%v", s)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	s = fmt.Sprintf("%+v", c)
+	if !strings.Contains(s, fmt.Sprintf("mapped, generation %v, %v bytes", c.generation, c.Length())) {
+		t.Errorf("expected a mapped client, got\n%v", s)
+	}
+
+	if !strings.Contains(s, fmt.Sprintf("sections: indoms at %v,", c.r.indomoffset)) {
+		t.Errorf("expected the offsets of the sections, got\n%v", s)
+	}
+}
@@ -0,0 +1,212 @@
+//go:build go1.21
+// +build go1.21
+
+package speed
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// runtime metrics read by the GCCollector, in the order of the samples
+var gcRuntimeMetrics = []string{
+	"/gc/gogc:percent",
+	"/gc/gomemlimit:bytes",
+	"/gc/cycles/total:gc-cycles",
+	"/gc/cycles/forced:gc-cycles",
+	"/gc/heap/goal:bytes",
+	"/gc/heap/live:bytes",
+}
+
+// GCCollector is a Collector exporting the garbage collector's tuning knobs, GOGC
+// and GOMEMLIMIT, along with the number of completed and forced GC cycles, and the
+// heap goal against the live heap as the instances "goal" and "live" of
+// "<prefix>.heap", as reported by the runtime/metrics package. A disabled GOGC and
+// an unset memory limit are exported as -1.
+//
+// The metrics are updated on every collection, see RegisterCollector, and on every
+// change made through SetGCPercent and SetMemoryLimit. Calling WatchCycles also
+// updates them at the end of every GC cycle, so charts show the heap goal and the
+// live heap of every cycle rather than of the collection interval.
+type GCCollector struct {
+	prefix string
+
+	mutex    sync.Mutex
+	sample   []metrics.Sample
+	recorder Recorder // of the last collection, for collecting on changes and GC cycles
+	err      error
+
+	watching int32 // 1 while GC cycles are watched
+}
+
+// NewGCCollector creates a new GCCollector with all metrics created under the passed
+// prefix, for example, passing "app.gc" creates "app.gc.gogc", "app.gc.memory_limit",
+// "app.gc.cycles", "app.gc.forced" and "app.gc.heap".
+func NewGCCollector(prefix string) (*GCCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("gc collector prefix cannot be empty")
+	}
+
+	col := &GCCollector{prefix: prefix, sample: make([]metrics.Sample, len(gcRuntimeMetrics))}
+	for i, name := range gcRuntimeMetrics {
+		col.sample[i].Name = name
+	}
+
+	return col, nil
+}
+
+// Describe describes the metrics exported by the collector.
+func (col *GCCollector) Describe(ch chan<- Desc) {
+	ch <- Desc{
+		Name: col.prefix + ".gogc", Type: Int64Type, Semantics: DiscreteSemantics, Unit: OneUnit,
+		ShortHelp: "GOGC, the heap growth percentage triggering a GC cycle",
+	}
+
+	ch <- Desc{
+		Name: col.prefix + ".memory_limit", Type: Int64Type, Semantics: DiscreteSemantics, Unit: ByteUnit,
+		ShortHelp: "GOMEMLIMIT, the soft memory limit of the runtime",
+	}
+
+	ch <- Desc{
+		Name: col.prefix + ".cycles", Type: Uint64Type, Semantics: CounterSemantics, Unit: OneUnit,
+		ShortHelp: "number of completed GC cycles",
+	}
+
+	ch <- Desc{
+		Name: col.prefix + ".forced", Type: Uint64Type, Semantics: CounterSemantics, Unit: OneUnit,
+		ShortHelp: "number of GC cycles forced by the application",
+	}
+
+	ch <- Desc{
+		Name: col.prefix + ".heap", Type: Uint64Type, Semantics: InstantSemantics, Unit: ByteUnit,
+		Instances: []string{"goal", "live"},
+		ShortHelp: "heap size the GC aims to stay under against the heap marked live by the last GC cycle",
+	}
+}
+
+// Collect records the current state of the garbage collector.
+func (col *GCCollector) Collect(r Recorder) {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	col.recorder = r
+	col.err = col.collect(r)
+}
+
+// collect reads the current state of the garbage collector, holding the lock
+func (col *GCCollector) collect(r Recorder) error {
+	metrics.Read(col.sample)
+
+	vals := make([]uint64, len(col.sample))
+	for i, s := range col.sample {
+		if s.Value.Kind() != metrics.KindUint64 {
+			return errors.Errorf("%v is not supported by the runtime", s.Name)
+		}
+
+		vals[i] = s.Value.Uint64()
+	}
+
+	// a disabled GOGC is reported as -1 converted to uint64
+	gogc := int64(vals[0])
+
+	limit := int64(vals[1])
+	if vals[1] >= math.MaxInt64 {
+		limit = -1
+	}
+
+	for _, v := range []struct {
+		name string
+		val  interface{}
+	}{
+		{".gogc", gogc}, {".memory_limit", limit}, {".cycles", vals[2]}, {".forced", vals[3]},
+	} {
+		if err := r.Record(col.prefix+v.name, v.val); err != nil {
+			return err
+		}
+	}
+
+	if err := r.RecordInstance(col.prefix+".heap", "goal", vals[4]); err != nil {
+		return err
+	}
+
+	return r.RecordInstance(col.prefix+".heap", "live", vals[5])
+}
+
+// recollect collects again into the recorder of the last collection, if there was one
+func (col *GCCollector) recollect() {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	if col.recorder != nil {
+		col.err = col.collect(col.recorder)
+	}
+}
+
+// Err returns the error encountered during the last collection, if any.
+func (col *GCCollector) Err() error {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	return col.err
+}
+
+// SetGCPercent sets GOGC like debug.SetGCPercent, returning the previous value,
+// and updates the metrics.
+func (col *GCCollector) SetGCPercent(percent int) int {
+	prev := debug.SetGCPercent(percent)
+	col.recollect()
+	return prev
+}
+
+// SetMemoryLimit sets GOMEMLIMIT like debug.SetMemoryLimit, returning the previous
+// value, and updates the metrics.
+func (col *GCCollector) SetMemoryLimit(limit int64) int64 {
+	prev := debug.SetMemoryLimit(limit)
+	col.recollect()
+	return prev
+}
+
+// gcSentinel is garbage that is finalized at the end of a GC cycle
+type gcSentinel struct {
+	col *GCCollector
+	_   int64 // finalizers are not guaranteed to run for zero sized objects
+}
+
+func watchCycle(s *gcSentinel) {
+	if atomic.LoadInt32(&s.col.watching) == 0 {
+		return
+	}
+
+	s.col.recollect()
+	s.col.arm()
+}
+
+// arm makes the collector collect at the end of the next GC cycle
+func (col *GCCollector) arm() {
+	runtime.SetFinalizer(&gcSentinel{col: col}, watchCycle)
+}
+
+// WatchCycles makes the collector also collect at the end of every GC cycle.
+func (col *GCCollector) WatchCycles() error {
+	if !atomic.CompareAndSwapInt32(&col.watching, 0, 1) {
+		return errors.New("gc cycles are already watched")
+	}
+
+	col.arm()
+	return nil
+}
+
+// StopWatchingCycles stops collecting at the end of every GC cycle.
+func (col *GCCollector) StopWatchingCycles() error {
+	if !atomic.CompareAndSwapInt32(&col.watching, 1, 0) {
+		return errors.New("gc cycles are not watched")
+	}
+
+	return nil
+}
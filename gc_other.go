@@ -0,0 +1,46 @@
+//go:build !go1.21
+// +build !go1.21
+
+package speed
+
+import (
+	"math"
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+)
+
+// GCCollector exports the state of the garbage collector on go1.21 and later,
+// which added the runtime metrics it reads.
+type GCCollector struct{}
+
+// NewGCCollector fails before go1.21.
+func NewGCCollector(prefix string) (*GCCollector, error) {
+	return nil, errors.New("the gc collector needs go1.21 or later")
+}
+
+// Describe describes no metrics before go1.21.
+func (col *GCCollector) Describe(ch chan<- Desc) {}
+
+// Collect records nothing before go1.21.
+func (col *GCCollector) Collect(r Recorder) {}
+
+// Err returns nil before go1.21.
+func (col *GCCollector) Err() error { return nil }
+
+// SetGCPercent sets GOGC like debug.SetGCPercent, returning the previous value.
+func (col *GCCollector) SetGCPercent(percent int) int { return debug.SetGCPercent(percent) }
+
+// SetMemoryLimit does nothing before go1.21, where there is no memory limit,
+// returning math.MaxInt64.
+func (col *GCCollector) SetMemoryLimit(limit int64) int64 { return math.MaxInt64 }
+
+// WatchCycles fails before go1.21.
+func (col *GCCollector) WatchCycles() error {
+	return errors.New("watching gc cycles needs go1.21 or later")
+}
+
+// StopWatchingCycles fails before go1.21.
+func (col *GCCollector) StopWatchingCycles() error {
+	return errors.New("gc cycles are not watched")
+}
@@ -0,0 +1,96 @@
+//go:build go1.21
+// +build go1.21
+
+package speed
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGCCollector(t *testing.T) {
+	col, err := NewGCCollector("test.gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.RegisterCollector(col, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = col.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	gogc := c.r.metrics["test.gc.gogc"].(*PCPSingletonMetric)
+	memoryLimit := c.r.metrics["test.gc.memory_limit"].(*PCPSingletonMetric)
+	forced := c.r.metrics["test.gc.forced"].(*PCPSingletonMetric)
+	heap := c.r.metrics["test.gc.heap"].(*PCPInstanceMetric)
+
+	prev := col.SetGCPercent(-1)
+	defer col.SetGCPercent(prev)
+
+	if v := gogc.Val().(int64); v != -1 {
+		t.Errorf("expected a disabled GOGC to be -1, got %v", v)
+	}
+
+	col.SetGCPercent(150)
+	if v := gogc.Val().(int64); v != 150 {
+		t.Errorf("expected GOGC to be 150, got %v", v)
+	}
+
+	prevLimit := col.SetMemoryLimit(1 << 40)
+	if v := memoryLimit.Val().(int64); v != 1<<40 {
+		t.Errorf("expected a memory limit of 1TiB, got %v", v)
+	}
+
+	col.SetMemoryLimit(math.MaxInt64)
+	defer col.SetMemoryLimit(prevLimit)
+
+	if v := memoryLimit.Val().(int64); v != -1 {
+		t.Errorf("expected no memory limit to be -1, got %v", v)
+	}
+
+	before := forced.Val().(uint64)
+
+	if err = col.WatchCycles(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = col.WatchCycles(); err == nil {
+		t.Error("expected an error watching cycles twice")
+	}
+
+	runtime.GC()
+
+	// the finalizer runs asynchronously after the cycle
+	if !waitFor(func() bool { return forced.Val().(uint64) > before }) {
+		t.Error("expected the forced cycle to be collected at the end of the cycle")
+	}
+
+	if v, _ := heap.ValInstance("goal"); v.(uint64) == 0 {
+		t.Error("expected a heap goal")
+	}
+
+	if err = col.StopWatchingCycles(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = col.StopWatchingCycles(); err == nil {
+		t.Error("expected an error stopping watching cycles twice")
+	}
+
+	if err = col.Err(); err != nil {
+		t.Error(err)
+	}
+}
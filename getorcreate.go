@@ -0,0 +1,98 @@
+package speed
+
+import "github.com/pkg/errors"
+
+// getOrCreate returns the metric registered with the client under the passed name,
+// or registers the one returned by create. Existing metrics are looked up without
+// locking the client, which is only locked to create a metric, so concurrent calls
+// for the same name always get the same metric.
+func (c *PCPClient) getOrCreate(name string, create func() (Metric, error)) (Metric, error) {
+	if m, ok := c.lookup(name); ok {
+		return m, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// another call may have created it while waiting for the lock
+	if m, ok := c.lookup(name); ok {
+		return m, nil
+	}
+
+	nm, err := create()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.Register(nm); err != nil {
+		return nil, err
+	}
+
+	return nm, nil
+}
+
+// lookup returns the metric registered with the client under the passed name
+func (c *PCPClient) lookup(name string) (Metric, bool) {
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	m, ok := c.r.metrics[c.prefix+name]
+	return m, ok
+}
+
+// GetOrCreateCounter returns the PCPCounter registered with the client under the
+// passed name, or creates and registers one with an initial value of 0, so code on
+// the request path can use metrics without having to set them up in order first.
+// It is safe to call concurrently.
+//
+// As metrics cannot be added to a started client, new metrics can only be created
+// before Start, while existing ones can always be retrieved. The name is the name
+// passed on registration, without the prefix of WithPrefix.
+func (c *PCPClient) GetOrCreateCounter(name string, desc ...string) (*PCPCounter, error) {
+	m, err := c.getOrCreate(name, func() (Metric, error) { return NewPCPCounter(0, name, desc...) })
+	if err != nil {
+		return nil, err
+	}
+
+	counter, ok := m.(*PCPCounter)
+	if !ok {
+		return nil, errors.Errorf("metric %v is a %T, not a counter", name, m)
+	}
+
+	return counter, nil
+}
+
+// GetOrCreateGauge is GetOrCreateCounter for a PCPGauge.
+func (c *PCPClient) GetOrCreateGauge(name string, desc ...string) (*PCPGauge, error) {
+	m, err := c.getOrCreate(name, func() (Metric, error) { return NewPCPGauge(0, name, desc...) })
+	if err != nil {
+		return nil, err
+	}
+
+	gauge, ok := m.(*PCPGauge)
+	if !ok {
+		return nil, errors.Errorf("metric %v is a %T, not a gauge", name, m)
+	}
+
+	return gauge, nil
+}
+
+// GetOrCreateTimer is GetOrCreateCounter for a PCPTimer of the passed unit.
+// An existing timer is only returned if it has the same unit.
+func (c *PCPClient) GetOrCreateTimer(name string, unit TimeUnit, desc ...string) (*PCPTimer, error) {
+	m, err := c.getOrCreate(name, func() (Metric, error) { return NewPCPTimer(name, unit, desc...) })
+	if err != nil {
+		return nil, err
+	}
+
+	timer, ok := m.(*PCPTimer)
+	if !ok {
+		return nil, errors.Errorf("metric %v is a %T, not a timer", name, m)
+	}
+
+	if timer.Unit().String() != unit.String() {
+		return nil, errors.Errorf("timer %v has unit %v, not %v", name, timer.Unit(), unit)
+	}
+
+	return timer, nil
+}
@@ -0,0 +1,97 @@
+package speed
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetOrCreateCounter(t *testing.T) {
+	c, err := NewPCPClient("test", WithPrefix("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	counters := make([]*PCPCounter, 10)
+
+	for i := range counters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var err error
+			if counters[i], err = c.GetOrCreateCounter("requests"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, counter := range counters[1:] {
+		if counter != counters[0] {
+			t.Fatal("expected all calls to return the same counter")
+		}
+	}
+
+	if counters[0].Name() != "app.requests" {
+		t.Errorf("expected the counter to be prefixed, got %v", counters[0].Name())
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	// existing metrics can be retrieved once started
+	counter, err := c.GetOrCreateCounter("requests")
+	if err != nil || counter != counters[0] {
+		t.Errorf("expected the existing counter once started, got %v, %v", counter, err)
+	}
+
+	// looking up existing metrics does not wait for the client lock
+	c.mutex.Lock()
+	looked := make(chan *PCPCounter)
+	go func() {
+		counter, _ := c.GetOrCreateCounter("requests")
+		looked <- counter
+	}()
+
+	select {
+	case counter = <-looked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected looking up an existing counter not to lock the client")
+	}
+	c.mutex.Unlock()
+
+	if counter != counters[0] {
+		t.Errorf("expected the existing counter without locking the client, got %v", counter)
+	}
+
+	if _, err = c.GetOrCreateGauge("requests"); err == nil {
+		t.Error("expected an error getting a counter as a gauge")
+	}
+
+	if _, err = c.GetOrCreateGauge("new"); err == nil {
+		t.Error("expected an error creating a metric once started")
+	}
+}
+
+func TestGetOrCreateTimer(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timer, err := c.GetOrCreateTimer("test.timer", MillisecondUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other, err := c.GetOrCreateTimer("test.timer", MillisecondUnit); err != nil || other != timer {
+		t.Errorf("expected the same timer, got %v, %v", other, err)
+	}
+
+	if _, err = c.GetOrCreateTimer("test.timer", SecondUnit); err == nil {
+		t.Error("expected an error getting a timer with a different unit")
+	}
+}
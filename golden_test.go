@@ -0,0 +1,123 @@
+package speed
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden MMV files in testdata")
+
+// goldenFixtures are the clients whose MMV files are checked into testdata,
+// covering the layouts of both MMV versions.
+var goldenFixtures = []struct {
+	name    string
+	metrics func() ([]Metric, error)
+}{
+	{"singletons", func() ([]Metric, error) {
+		counter, err := NewPCPCounter(42, "golden.counter", "a counter", "a counter with help text")
+		if err != nil {
+			return nil, err
+		}
+
+		gauge, err := NewPCPGauge(3.5, "golden.gauge")
+		if err != nil {
+			return nil, err
+		}
+
+		str, err := NewPCPSingletonMetric("hello", "golden.string", StringType, DiscreteSemantics, OneUnit)
+		if err != nil {
+			return nil, err
+		}
+
+		return []Metric{counter, gauge, str}, nil
+	}},
+	{"instances", func() ([]Metric, error) {
+		indom, err := NewPCPInstanceDomain("golden.indom", []string{"x", "y", "z"}, "an instance domain")
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := NewPCPInstanceMetric(
+			Instances{"x": uint32(1), "y": uint32(2), "z": uint32(3)},
+			"golden.instances", indom, Uint32Type, InstantSemantics, ByteUnit,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		vector, err := NewPCPCounterVector(map[string]int64{"a": 4, "b": 5}, "golden.vector")
+		if err != nil {
+			return nil, err
+		}
+
+		return []Metric{m, vector}, nil
+	}},
+	{"mmv2", func() ([]Metric, error) {
+		name := "golden." + strings.Repeat("long", 20)
+		indom, err := NewPCPInstanceDomain("golden.mmv2.indom", []string{"an instance with a name longer than the v1 limit of sixty three bytes"})
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := NewPCPSingletonMetric(int64(-7), name, Int64Type, InstantSemantics, OneUnit)
+		if err != nil {
+			return nil, err
+		}
+
+		im, err := NewPCPInstanceMetric(Instances{indom.Instances()[0]: 2.5}, "golden.mmv2", indom, DoubleType, InstantSemantics, SecondUnit)
+		if err != nil {
+			return nil, err
+		}
+
+		return []Metric{m, im}, nil
+	}},
+}
+
+// goldenFile writes the MMV file of a golden fixture
+func goldenFile(t *testing.T, metrics func() ([]Metric, error)) []byte {
+	c, err := NewPCPClient("golden", WithoutLocalFile(), WithDeterministicOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := metrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range ms {
+		c.MustRegister(m)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	return append([]byte(nil), c.writer.Bytes()...)
+}
+
+func TestGoldenFiles(t *testing.T) {
+	for _, f := range goldenFixtures {
+		data := goldenFile(t, f.metrics)
+		loc := filepath.Join("testdata", f.name+".mmv")
+
+		if *updateGolden {
+			if err := ioutil.WriteFile(loc, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := ioutil.ReadFile(loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(expected, data) {
+			t.Errorf("%v differs from the written file, run the tests with -update if the change is intended", loc)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Package health implements named health checks for an application,
+// exporting their results as speed instance metrics.
+//
+// Checks are added before registering with a client, as instances cannot be
+// changed once a mapping is active. The results of every check are exported
+// under `<app>.health.*` with one instance per check.
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/performancecopilot/speed"
+)
+
+// Status is the result of a health check
+type Status int32
+
+// Possible values for a Status.
+const (
+	Unknown Status = iota // the check has not run yet
+	Healthy
+	Unhealthy
+)
+
+// Check is a single health check, returning a non nil error on failure
+type Check func() error
+
+type check struct {
+	name        string
+	fn          Check
+	status      Status
+	lastSuccess time.Time
+	failures    int64
+	lastErr     error
+}
+
+// Checker maintains a set of named health checks and exports their results.
+type Checker struct {
+	mutex  sync.Mutex
+	app    string
+	checks map[string]*check
+	order  []string
+
+	status, lastSuccess, failures *speed.PCPInstanceMetric
+	updateErr                     error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a new Checker for the passed application name.
+func New(app string) *Checker {
+	return &Checker{
+		app:    app,
+		checks: make(map[string]*check),
+	}
+}
+
+// Add adds a new named check, it fails if the checker has already been registered.
+func (c *Checker) Add(name string, fn Check) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.status != nil {
+		return errors.New("cannot add a check after registering the checker")
+	}
+
+	if fn == nil {
+		return errors.New("check cannot be nil")
+	}
+
+	if _, present := c.checks[name]; present {
+		return errors.Errorf("a check named %v already exists", name)
+	}
+
+	c.checks[name] = &check{name: name, fn: fn}
+	c.order = append(c.order, name)
+	return nil
+}
+
+// Register creates the health metrics and registers them with the passed client.
+// Metrics cannot be removed from a client, so all of them are validated before
+// registering any, and a failing Register leaves the client as it was.
+func (c *Checker) Register(client speed.Client) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.status != nil {
+		return errors.New("checker is already registered")
+	}
+
+	if len(c.checks) == 0 {
+		return errors.New("cannot register a checker without checks")
+	}
+
+	prefix := c.app + ".health"
+
+	indom, err := speed.NewPCPInstanceDomain(prefix+".indom", c.order, "health checks")
+	if err != nil {
+		return err
+	}
+
+	newMetric := func(name string, val interface{}, t speed.MetricType, u speed.MetricUnit, desc string) (*speed.PCPInstanceMetric, error) {
+		vals := make(speed.Instances)
+		for _, n := range c.order {
+			vals[n] = val
+		}
+
+		return speed.NewPCPInstanceMetric(vals, prefix+"."+name, indom, t, speed.InstantSemantics, u, desc)
+	}
+
+	status, err := newMetric("status", int32(Unknown), speed.Int32Type, speed.OneUnit,
+		"health check status, 0 unknown, 1 healthy, 2 unhealthy")
+	if err != nil {
+		return err
+	}
+
+	lastSuccess, err := newMetric("last_success", int64(0), speed.Int64Type, speed.SecondUnit,
+		"unix time of the last successful check")
+	if err != nil {
+		return err
+	}
+
+	failures, err := newMetric("consecutive_failures", int64(0), speed.Int64Type, speed.OneUnit,
+		"number of consecutive failed checks")
+	if err != nil {
+		return err
+	}
+
+	ms := []speed.Metric{status, lastSuccess, failures}
+	if err = validate(client, ms, len(c.order)); err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		if err = client.Register(m); err != nil {
+			return err
+		}
+	}
+
+	c.status, c.lastSuccess, c.failures = status, lastSuccess, failures
+	return nil
+}
+
+// validate checks that all metrics, with the passed number of instances each,
+// can be registered together with the client
+func validate(client speed.Client, ms []speed.Metric, instances int) error {
+	if v, ok := client.(interface{ ValidateRegistration(speed.Metric) error }); ok {
+		for _, m := range ms {
+			if err := v.ValidateRegistration(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	r := client.Registry()
+	if r.MetricCount()+len(ms) > speed.MaxMetrics {
+		return errors.Errorf("cannot register %v more metrics, the limit is %v", len(ms), speed.MaxMetrics)
+	}
+
+	if r.ValuesCount()+len(ms)*instances > speed.MaxValues {
+		return errors.Errorf("cannot register %v more values, the limit is %v", len(ms)*instances, speed.MaxValues)
+	}
+
+	return nil
+}
+
+// Check runs all checks once and updates the metrics,
+// returning the status of every check. Checks run without locking
+// the checker, so they can be slow, or use the checker themselves.
+func (c *Checker) Check() map[string]Status {
+	c.mutex.Lock()
+	checks := make([]*check, len(c.order))
+	for i, name := range c.order {
+		checks[i] = c.checks[name]
+	}
+	c.mutex.Unlock()
+
+	errs := make([]error, len(checks))
+	for i, ch := range checks {
+		errs[i] = ch.fn()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.updateErr = nil
+
+	ans := make(map[string]Status, len(checks))
+	for i, ch := range checks {
+		if err := c.record(ch, errs[i]); err != nil && c.updateErr == nil {
+			c.updateErr = errors.Wrapf(err, "cannot update the health metrics of %v", ch.name)
+		}
+
+		ans[ch.name] = ch.status
+	}
+
+	return ans
+}
+
+// record records the result of a run of a check, holding the lock
+func (c *Checker) record(ch *check, err error) error {
+	ch.lastErr = err
+	if err == nil {
+		ch.status = Healthy
+		ch.lastSuccess = time.Now()
+		ch.failures = 0
+	} else {
+		ch.status = Unhealthy
+		ch.failures++
+	}
+
+	// metrics only exist once registered
+	if c.status == nil {
+		return nil
+	}
+
+	if err := c.status.SetInstance(int32(ch.status), ch.name); err != nil {
+		return err
+	}
+
+	if err := c.failures.SetInstance(ch.failures, ch.name); err != nil {
+		return err
+	}
+
+	if ch.status == Healthy {
+		return c.lastSuccess.SetInstance(ch.lastSuccess.Unix(), ch.name)
+	}
+
+	return nil
+}
+
+// UpdateErr returns the error updating the health metrics during the last Check, if any.
+func (c *Checker) UpdateErr() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.updateErr
+}
+
+// Err returns the error returned by the last run of the named check.
+func (c *Checker) Err(name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ch, present := c.checks[name]
+	if !present {
+		return errors.Errorf("no check named %v", name)
+	}
+
+	return ch.lastErr
+}
+
+// Start runs all checks at the passed interval until Stop is called.
+func (c *Checker) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("check interval must be positive")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stop != nil {
+		return errors.New("checker is already running")
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	c.stop, c.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				c.Check()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops running checks on a schedule.
+func (c *Checker) Stop() error {
+	c.mutex.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mutex.Unlock()
+
+	if stop == nil {
+		return errors.New("checker is not running")
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
@@ -0,0 +1,147 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed"
+)
+
+func TestChecker(t *testing.T) {
+	c := New("test")
+
+	fail := true
+	if err := c.Add("db", func() error {
+		if fail {
+			return errors.New("db is down")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Add("cache", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Add("cache", func() error { return nil }); err == nil {
+		t.Error("expected an error adding a check twice")
+	}
+
+	client, err := speed.NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Register(client); err != nil {
+		t.Fatal(err)
+	}
+
+	if !client.Registry().HasMetric("test.health.status") {
+		t.Error("expected test.health.status to be registered")
+	}
+
+	c.Check()
+	s := c.Check()
+
+	if s["db"] != Unhealthy || s["cache"] != Healthy {
+		t.Errorf("unexpected statuses %v", s)
+	}
+
+	if v, _ := c.failures.ValInstance("db"); v != int64(2) {
+		t.Errorf("expected 2 consecutive failures, got %v", v)
+	}
+
+	if c.Err("db") == nil {
+		t.Error("expected the last db error to be recorded")
+	}
+
+	fail = false
+	c.Check()
+
+	if v, _ := c.failures.ValInstance("db"); v != int64(0) {
+		t.Errorf("expected failures to reset, got %v", v)
+	}
+
+	if v, _ := c.lastSuccess.ValInstance("db"); v.(int64) == 0 {
+		t.Error("expected a last success timestamp")
+	}
+
+	if err = c.Start(0); err == nil {
+		t.Error("expected an error starting with a zero interval")
+	}
+
+	if err = c.Start(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Stop(); err == nil {
+		t.Error("expected an error stopping a stopped checker")
+	}
+}
+
+func TestCheckerRunsChecksUnlocked(t *testing.T) {
+	c := New("test")
+
+	// a check using the checker would deadlock if checks ran holding its lock
+	if err := c.Add("self", func() error { return c.Err("other") }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Add("other", func() error { return errors.New("failed") }); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan map[string]Status)
+	go func() { done <- c.Check() }()
+
+	select {
+	case s := <-done:
+		if s["self"] != Healthy || s["other"] != Unhealthy {
+			t.Errorf("unexpected statuses %v", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a check using the checker not to deadlock")
+	}
+
+	if err := c.UpdateErr(); err != nil {
+		t.Errorf("expected no error updating the metrics, got %v", err)
+	}
+}
+
+func TestCheckerRegisterFailure(t *testing.T) {
+	c := New("test")
+	if err := c.Add("db", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := speed.NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.MustRegisterString("test.health.consecutive_failures", int64(0), speed.Int64Type, speed.InstantSemantics, speed.OneUnit)
+
+	if err = c.Register(client); err == nil {
+		t.Fatal("expected an error registering a metric twice")
+	}
+
+	if client.Registry().HasMetric("test.health.status") {
+		t.Error("expected no metric to be registered after a failed Register")
+	}
+
+	// the checker can still be registered elsewhere
+	other, err := speed.NewPCPClient("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Register(other); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HistoryEntry is a single value recorded in a metric's history.
+type HistoryEntry struct {
+	Instance string      `json:"instance,omitempty"` // empty for singleton metrics
+	Val      interface{} `json:"value"`
+	Time     time.Time   `json:"time"`
+}
+
+// historyRing retains the last n values set on a metric
+type historyRing struct {
+	mutex   sync.Mutex
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+func newhistoryRing(n int) *historyRing {
+	return &historyRing{entries: make([]HistoryEntry, n)}
+}
+
+func (h *historyRing) record(instance string, val interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.entries[h.next] = HistoryEntry{instance, val, time.Now()}
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot returns the recorded entries, oldest first
+func (h *historyRing) snapshot() []HistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.full {
+		return append([]HistoryEntry(nil), h.entries[:h.next]...)
+	}
+
+	ans := make([]HistoryEntry, 0, len(h.entries))
+	ans = append(ans, h.entries[h.next:]...)
+	return append(ans, h.entries[:h.next]...)
+}
+
+// WithHistory makes a metric retain the last n values set on it along with
+// the time they were set, accessible through History.
+// For instance metrics, a single history is kept across all instances.
+func WithHistory(n int) MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if n <= 0 {
+			return errors.New("history size must be positive")
+		}
+
+		md.history = newhistoryRing(n)
+		return nil
+	}
+}
+
+// recordHistory records a value set on the metric, if history is enabled
+func (md *pcpMetricDesc) recordHistory(instance string, val interface{}) {
+	if md.history != nil {
+		md.history.record(instance, val)
+	}
+}
+
+// History returns the values retained for the metric, oldest first,
+// or nil if WithHistory was not applied to it.
+func (md *pcpMetricDesc) History() []HistoryEntry {
+	if md.history == nil {
+		return nil
+	}
+
+	return md.history.snapshot()
+}
@@ -0,0 +1,64 @@
+package speed
+
+import "testing"
+
+func TestHistory(t *testing.T) {
+	c, err := NewPCPCounter(0, "test.history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.History() != nil {
+		t.Error("expected no history without WithHistory")
+	}
+
+	if err = c.Apply(WithHistory(0)); err == nil {
+		t.Error("expected an error for an empty history")
+	}
+
+	if err = c.Apply(WithHistory(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Up()
+	c.Up()
+	if h := c.History(); len(h) != 2 || h[0].Val != int64(1) || h[1].Val != int64(2) {
+		t.Errorf("unexpected history %v", h)
+	}
+
+	c.Up()
+	c.Up()
+	h := c.History()
+	if len(h) != 3 {
+		t.Fatalf("expected history to retain 3 values, got %v", len(h))
+	}
+
+	for i, v := range []int64{2, 3, 4} {
+		if h[i].Val != v {
+			t.Errorf("expected history value %v to be %v, got %v", i, v, h[i].Val)
+		}
+	}
+
+	if h[0].Time.After(h[2].Time) {
+		t.Error("expected history to be ordered oldest first")
+	}
+}
+
+func TestInstanceHistory(t *testing.T) {
+	g, err := NewPCPGaugeVector(map[string]float64{"a": 0, "b": 0}, "test.history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.Apply(WithHistory(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	g.MustSet(1, "a")
+	g.MustSet(2, "b")
+
+	h := g.History()
+	if len(h) != 2 || h[0].Instance != "a" || h[1].Instance != "b" {
+		t.Errorf("unexpected history %v", h)
+	}
+}
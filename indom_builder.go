@@ -0,0 +1,100 @@
+package speed
+
+import "github.com/pkg/errors"
+
+// IndomBuilder declares an instance domain step by step, for example
+//
+//	indom, err := speed.NewIndomBuilder("disk").
+//		Instances("sda", "sdb").
+//		ShortHelp("disks on the host").
+//		Build(client)
+//
+// Nothing is created until Build is called, which validates the complete
+// declaration before creating and registering the instance domain.
+type IndomBuilder struct {
+	name       string
+	instances  []string
+	short      string
+	long       string
+	id         uint32
+	explicitID bool
+}
+
+// NewIndomBuilder starts declaring an instance domain of the passed name.
+func NewIndomBuilder(name string) *IndomBuilder {
+	return &IndomBuilder{name: name}
+}
+
+// Instances adds instances to the instance domain.
+func (b *IndomBuilder) Instances(instances ...string) *IndomBuilder {
+	b.instances = append(b.instances, instances...)
+	return b
+}
+
+// ShortHelp sets the short description of the instance domain.
+func (b *IndomBuilder) ShortHelp(help string) *IndomBuilder {
+	b.short = help
+	return b
+}
+
+// LongHelp sets the long description of the instance domain.
+func (b *IndomBuilder) LongHelp(help string) *IndomBuilder {
+	b.long = help
+	return b
+}
+
+// ID assigns an explicit id to the instance domain,
+// see NewPCPInstanceDomainWithID.
+func (b *IndomBuilder) ID(id uint32) *IndomBuilder {
+	b.id, b.explicitID = id, true
+	return b
+}
+
+// Build creates the instance domain and registers it with the passed client.
+// If the client is nil, the instance domain is only created.
+func (b *IndomBuilder) Build(c Client) (*PCPInstanceDomain, error) {
+	if len(b.instances) == 0 {
+		return nil, errors.Errorf("instance domain %v has no instances", b.name)
+	}
+
+	if c != nil && c.Registry().HasInstanceDomain(b.name) {
+		return nil, errors.Errorf("instance domain %v is already registered", b.name)
+	}
+
+	desc := []string{b.short}
+	if b.long != "" {
+		desc = append(desc, b.long)
+	}
+
+	var (
+		indom *PCPInstanceDomain
+		err   error
+	)
+
+	if b.explicitID {
+		indom, err = NewPCPInstanceDomainWithID(b.id, b.name, b.instances, desc...)
+	} else {
+		indom, err = NewPCPInstanceDomain(b.name, b.instances, desc...)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		if err = c.Registry().AddInstanceDomain(indom); err != nil {
+			return nil, err
+		}
+	}
+
+	return indom, nil
+}
+
+// MustBuild is Build that panics on failure.
+func (b *IndomBuilder) MustBuild(c Client) *PCPInstanceDomain {
+	indom, err := b.Build(c)
+	if err != nil {
+		panic(err)
+	}
+	return indom
+}
@@ -0,0 +1,54 @@
+package speed
+
+import "testing"
+
+func TestIndomBuilder(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indom, err := NewIndomBuilder("test.disk").
+		Instances("sda", "sdb").
+		Instances("sdc").
+		ShortHelp("disks").
+		LongHelp("disks on the host").
+		Build(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !indom.MatchInstances([]string{"sda", "sdb", "sdc"}) {
+		t.Errorf("expected instances sda, sdb and sdc, got %v", indom.Instances())
+	}
+
+	if indom.Description() != "disks\ndisks on the host" {
+		t.Errorf("unexpected description %q", indom.Description())
+	}
+
+	if !c.Registry().HasInstanceDomain("test.disk") {
+		t.Error("expected the indom to be registered")
+	}
+
+	if _, err = NewIndomBuilder("test.disk").Instances("sdd").Build(c); err == nil {
+		t.Error("expected an error building an indom that is already registered")
+	}
+
+	// an invalid instance leaves nothing behind
+	if _, err = NewIndomBuilder("test.net").Instances("eth0", "eth0").Build(c); err == nil {
+		t.Error("expected an error building an indom with duplicate instances")
+	}
+
+	if c.Registry().HasInstanceDomain("test.net") {
+		t.Error("expected an invalid indom not to be registered")
+	}
+
+	if _, err = NewIndomBuilder("test.empty").Build(nil); err == nil {
+		t.Error("expected an error building an indom without instances")
+	}
+
+	indom = NewIndomBuilder("test.id").Instances("a").ID(42).MustBuild(nil)
+	if indom.ID() != 42 {
+		t.Errorf("expected the id to be 42, got %v", indom.ID())
+	}
+}
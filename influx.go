@@ -0,0 +1,280 @@
+package speed
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// influxUDPPayload is the maximum size of a datagram sent by an InfluxExporter,
+// that keeps datagrams within the usual MTU, as recommended for the UDP listeners
+// of InfluxDB and Telegraf
+const influxUDPPayload = 1400
+
+// InfluxExporter pushes the values of the metrics of a client to InfluxDB, or
+// anything else accepting the InfluxDB line protocol like Telegraf.
+//
+// Every metric is a measurement with a single "value" field, and the instances
+// of instance metrics are written as an "instance" tag, along with the labels
+// of the client, for example
+//
+//	app.requests,instance=GET value=42i 1483228800000000000
+//
+// The tags of instances made with TaggedInstance are written as tags too, taking
+// precedence over the labels of the client.
+//
+// Values that cannot be represented, like NaN, are skipped.
+type InfluxExporter struct {
+	mutex sync.Mutex
+	c     *PCPClient
+	send  func([]byte) error
+	conn  net.Conn // for UDP exporters
+	now   func() time.Time
+
+	stop, done chan struct{}
+}
+
+// NewInfluxHTTPExporter creates an InfluxExporter that posts the values to the passed
+// write endpoint, for example "http://localhost:8086/write?db=app".
+func NewInfluxHTTPExporter(url string, c *PCPClient) (*InfluxExporter, error) {
+	if url == "" {
+		return nil, errors.New("influx exporter needs a URL")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return &InfluxExporter{
+		c:   c,
+		now: time.Now,
+		send: func(data []byte) error {
+			res, err := client.Post(url, "text/plain; charset=utf-8", bytes.NewReader(data))
+			if err != nil {
+				return errors.Wrap(err, "cannot post to influx")
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode/100 != 2 {
+				msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+				return errors.Errorf("influx responded with %v: %s", res.Status, bytes.TrimSpace(msg))
+			}
+
+			return nil
+		},
+	}, nil
+}
+
+// sendDatagrams writes newline separated lines to a connection, in datagrams
+// of at most max bytes that only contain complete lines.
+func sendDatagrams(conn net.Conn, data []byte, max int) error {
+	for len(data) > 0 {
+		n := len(data)
+		if n > max {
+			// split after the last complete line that fits
+			n = bytes.LastIndexByte(data[:max], '\n') + 1
+			if n == 0 {
+				return errors.Errorf("line is longer than %v bytes", max)
+			}
+		}
+
+		if _, err := conn.Write(data[:n]); err != nil {
+			return errors.Wrap(err, "cannot send datagram")
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
+
+// NewInfluxUDPExporter creates an InfluxExporter that sends the values to the passed
+// UDP address, like "localhost:8089", splitting them in datagrams of at most 1400 bytes.
+func NewInfluxUDPExporter(addr string, c *PCPClient) (*InfluxExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to influx")
+	}
+
+	return &InfluxExporter{
+		c:    c,
+		conn: conn,
+		now:  time.Now,
+		send: func(data []byte) error {
+			return sendDatagrams(conn, data, influxUDPPayload)
+		},
+	}, nil
+}
+
+var (
+	influxNameEscaper  = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxFieldEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxValue formats a value as a line protocol field value,
+// returning false for values that cannot be represented
+func influxValue(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case int32:
+		return strconv.FormatInt(int64(v), 10) + "i", true
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10) + "i", true
+	case uint64:
+		if v > math.MaxInt64 {
+			return strconv.FormatFloat(float64(v), 'g', -1, 64), true
+		}
+		return strconv.FormatUint(v, 10) + "i", true
+	case float32:
+		return influxFloat(float64(v))
+	case float64:
+		return influxFloat(v)
+	case string:
+		return `"` + influxFieldEscaper.Replace(v) + `"`, true
+	}
+
+	return "", false
+}
+
+func influxFloat(f float64) (string, bool) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", false
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64), true
+}
+
+// writeInfluxLines writes the passed samples in the line protocol with the passed labels
+// as tags and the passed timestamp.
+func writeInfluxLines(w io.Writer, samples []Sample, labels map[string]string, t time.Time) error {
+	for _, s := range samples {
+		val, ok := influxValue(s.Value)
+		if !ok {
+			continue
+		}
+
+		tags := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			tags[k] = v
+		}
+
+		if s.Instance != "" {
+			for k, v := range instanceTags(s.Instance) {
+				tags[k] = v
+			}
+
+			tags["instance"] = s.Instance
+		}
+
+		// tags are sorted by key, as recommended for performance
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var b strings.Builder
+		b.WriteString(influxNameEscaper.Replace(s.Metric))
+		for _, k := range keys {
+			b.WriteString("," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(tags[k]))
+		}
+
+		if _, err := fmt.Fprintf(w, "%v value=%v %v\n", b.String(), val, t.UnixNano()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Export sends the current values of all metrics of the client.
+func (e *InfluxExporter) Export() error {
+	samples, err := e.c.Samples()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := writeInfluxLines(&buf, samples, e.c.Labels(), e.now()); err != nil {
+		return err
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	return e.send(buf.Bytes())
+}
+
+// Start starts exporting on the passed interval.
+func (e *InfluxExporter) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("export interval must be positive")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.stop != nil {
+		return errors.New("influx exporter is already running")
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	e.stop, e.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				_ = e.Export()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops exporting periodically.
+func (e *InfluxExporter) Stop() error {
+	e.mutex.Lock()
+	stop, done := e.stop, e.done
+	e.stop, e.done = nil, nil
+	e.mutex.Unlock()
+
+	if stop == nil {
+		return errors.New("influx exporter is not running")
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
+
+// Close stops exporting if running, and closes the connection of UDP exporters.
+func (e *InfluxExporter) Close() error {
+	_ = e.Stop()
+
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+
+	return nil
+}
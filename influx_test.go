@@ -0,0 +1,134 @@
+package speed
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteInfluxLines(t *testing.T) {
+	samples := []Sample{
+		{"app.requests", "GET /a b", int64(42)},
+		{"app.size", "", uint64(math.MaxUint64)},
+		{"app.load", "", 0.5},
+		{"app.nan", "", math.NaN()},
+		{"app my,name", "", `say "hi"\`},
+		{"app.latency", "method=GET,pod=web-2", int64(3)},
+	}
+
+	var buf bytes.Buffer
+	if err := writeInfluxLines(&buf, samples, map[string]string{"pod": "web-1", "a": "x y"}, time.Unix(1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `app.requests,a=x\ y,instance=GET\ /a\ b,pod=web-1 value=42i 1000000000
+app.size,a=x\ y,pod=web-1 value=1.8446744073709552e+19 1000000000
+app.load,a=x\ y,pod=web-1 value=0.5 1000000000
+app\ my\,name,a=x\ y,pod=web-1 value="say \"hi\"\\" 1000000000
+app.latency,a=x\ y,instance=method\=GET\,pod\=web-2,method=GET,pod=web-2 value=3i 1000000000
+`
+
+	if buf.String() != expected {
+		t.Errorf("expected lines\n%v\ngot\n%v", expected, buf.String())
+	}
+}
+
+func newInfluxTestClient(t *testing.T) *PCPClient {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(3), Int64Type, CounterSemantics, OneUnit)
+	c.MustRegisterString("test.vector[a,b]", Instances{"a": 1.5, "b": 2.5}, DoubleType, InstantSemantics, OneUnit)
+	c.MustStart()
+
+	return c
+}
+
+func TestInfluxHTTPExporter(t *testing.T) {
+	c := newInfluxTestClient(t)
+	defer c.MustStop()
+
+	bodies := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	e, err := NewInfluxHTTPExporter(s.URL+"/write?db=test", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.now = func() time.Time { return time.Unix(1, 0) }
+
+	if err = e.Start(0); err == nil {
+		t.Error("expected an error starting with a zero interval")
+	}
+
+	if err = e.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "test.counter value=3i 1000000000\n" +
+		"test.vector,instance=a value=1.5 1000000000\n" +
+		"test.vector,instance=b value=2.5 1000000000\n"
+
+	if body := <-bodies; body != expected {
+		t.Errorf("expected body\n%v\ngot\n%v", expected, body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+
+	e, err = NewInfluxHTTPExporter(failing.URL, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = e.Export(); err == nil || !strings.Contains(err.Error(), "database not found") {
+		t.Errorf("expected the error of the server to be returned, got %v", err)
+	}
+}
+
+func TestInfluxUDPExporter(t *testing.T) {
+	c := newInfluxTestClient(t)
+	defer c.MustStop()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := NewInfluxUDPExporter(conn.LocalAddr().String(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if err = e.Export(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, influxUDPPayload)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(buf[:n]), "\n"); lines != 3 {
+		t.Errorf("expected 3 lines in the datagram, got %v", lines)
+	}
+}
@@ -1,14 +1,17 @@
 package speed
 
+import "sort"
+
 // Instances defines a valid collection of instance name and values
 type Instances map[string]interface{}
 
-// Keys collects and returns all the keys in all instance values
+// Keys collects and returns all the keys in all instance values, sorted
 func (i Instances) Keys() []string {
 	s := make([]string, 0, len(i))
 	for k := range i {
 		s = append(s, k)
 	}
+	sort.Strings(s)
 	return s
 }
 
@@ -29,3 +32,29 @@ func newpcpInstance(name string) *pcpInstance {
 		name, hash(name, 0), 0,
 	}
 }
+
+// newpcpInstances creates the instances for the passed names, keyed by their names.
+//
+// Instance ids are 32 bit hashes of the names, which are only used in the MMV file,
+// so two different names can end up with the same id. On a collision, the id of the
+// later name in lexicographic order is incremented until it is unique, so the ids
+// do not depend on the order the names are passed in.
+func newpcpInstances(names []string) map[string]*pcpInstance {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	ans := make(map[string]*pcpInstance, len(names))
+	ids := make(map[uint32]bool, len(names))
+
+	for _, name := range sorted {
+		i := newpcpInstance(name)
+		for ids[i.id] {
+			i.id++
+		}
+
+		ids[i.id] = true
+		ans[name] = i
+	}
+
+	return ans
+}
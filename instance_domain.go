@@ -2,6 +2,10 @@ package speed
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/pkg/errors"
 )
@@ -25,15 +29,35 @@ const PCPInstanceDomainBitLength = 22
 type PCPInstanceDomain struct {
 	id                                uint32
 	name                              string
+	mutex                             sync.RWMutex // guards instances, which an InstanceSync can replace
 	instances                         map[string]*pcpInstance
 	shortDescription, longDescription string
+	offset                            int // offset of the instance domain in the MMV file, once written
 }
 
 // NewPCPInstanceDomain creates a new instance domain or returns an already created one for the passed name
 // NOTE: this is different from parfait's idea of generating ids for InstanceDomains
 // We simply generate a unique 32 bit hash for an instance domain name, and if it has not
 // already been created, we create it, otherwise we return the already created version
+//
+// As the id is a hash of the name, two different names can end up with the same id,
+// which is reported when registering the second one. NewPCPInstanceDomainWithID can be
+// used to assign an explicit id to one of them.
 func NewPCPInstanceDomain(name string, instances []string, desc ...string) (*PCPInstanceDomain, error) {
+	return newPCPInstanceDomain(hash(name, PCPInstanceDomainBitLength), name, instances, desc...)
+}
+
+// NewPCPInstanceDomainWithID creates a new instance domain with an explicit id instead of
+// one generated from its name. The id has to fit in PCPInstanceDomainBitLength bits.
+func NewPCPInstanceDomainWithID(id uint32, name string, instances []string, desc ...string) (*PCPInstanceDomain, error) {
+	if id >= 1<<PCPInstanceDomainBitLength {
+		return nil, errors.Errorf("Instance Domain id %v does not fit in %v bits", id, PCPInstanceDomainBitLength)
+	}
+
+	return newPCPInstanceDomain(id, name, instances, desc...)
+}
+
+func newPCPInstanceDomain(id uint32, name string, instances []string, desc ...string) (*PCPInstanceDomain, error) {
 	if name == "" {
 		return nil, errors.New("Instance Domain name cannot be empty")
 	}
@@ -52,27 +76,74 @@ func NewPCPInstanceDomain(name string, instances []string, desc ...string) (*PCP
 		longDescription = desc[1]
 	}
 
-	imap := make(map[string]*pcpInstance)
-
-	for _, instance := range instances {
-		if len(instance) > StringLength {
-			return nil, errors.Errorf("instance name %v is too long", instance)
-		}
-
-		imap[instance] = newpcpInstance(instance)
+	if err := validateInstanceNames(instances); err != nil {
+		return nil, err
 	}
 
 	return &PCPInstanceDomain{
-		id:               hash(name, PCPInstanceDomainBitLength),
+		id:               id,
 		name:             name,
-		instances:        imap,
+		instances:        newpcpInstances(instances),
 		shortDescription: shortDescription,
 		longDescription:  longDescription,
 	}, nil
 }
 
+// InstanceNameError is returned when an instance name cannot be used
+// in an instance domain.
+type InstanceNameError struct {
+	Instance string // the offending instance name
+	Reason   string // why the name was rejected
+}
+
+func (e *InstanceNameError) Error() string {
+	return fmt.Sprintf("invalid instance name %q: %v", e.Instance, e.Reason)
+}
+
+// validateInstanceNames checks a set of instance names against the MMV limits and the PCP
+// conventions for external instance names. PCP clients like pminfo identify an instance
+// by its name up to the first space, so those prefixes have to be unique.
+//
+// see: http://man7.org/linux/man-pages/man3/pmdainstance.3.html
+func validateInstanceNames(instances []string) error {
+	prefixes := make(map[string]string, len(instances))
+
+	for _, instance := range instances {
+		switch {
+		case instance == "":
+			return &InstanceNameError{instance, "name cannot be empty"}
+		case len(instance) > StringLength:
+			return &InstanceNameError{instance, fmt.Sprintf("name is longer than %v bytes", StringLength)}
+		case unicode.IsSpace(rune(instance[0])):
+			return &InstanceNameError{instance, "name cannot start with whitespace"}
+		case strings.IndexFunc(instance, func(r rune) bool { return unicode.IsSpace(r) && r != ' ' }) != -1:
+			return &InstanceNameError{instance, "name can only contain spaces as whitespace"}
+		}
+
+		prefix := instance
+		if i := strings.IndexByte(instance, ' '); i != -1 {
+			prefix = instance[:i]
+		}
+
+		if other, present := prefixes[prefix]; present {
+			if other == instance {
+				return &InstanceNameError{instance, "name is duplicated"}
+			}
+
+			return &InstanceNameError{instance, fmt.Sprintf("name is not unique up to the first space, conflicts with %q", other)}
+		}
+
+		prefixes[prefix] = instance
+	}
+
+	return nil
+}
+
 // HasInstance returns true if an instance of the specified name is in the Indom
 func (indom *PCPInstanceDomain) HasInstance(name string) bool {
+	indom.mutex.RLock()
+	defer indom.mutex.RUnlock()
+
 	_, present := indom.instances[name]
 	return present
 }
@@ -85,22 +156,49 @@ func (indom *PCPInstanceDomain) Name() string { return indom.name }
 
 // InstanceCount returns the number of instances in the current instance domain
 func (indom *PCPInstanceDomain) InstanceCount() int {
+	indom.mutex.RLock()
+	defer indom.mutex.RUnlock()
+
 	return len(indom.instances)
 }
 
-// Instances returns a slice of defined instances for the instance domain
+// Instances returns a slice of defined instances for the instance domain, sorted by name
 func (indom *PCPInstanceDomain) Instances() []string {
+	indom.mutex.RLock()
+	defer indom.mutex.RUnlock()
+
+	return indom.instanceNames()
+}
+
+// instanceNames returns the sorted names of the instances, holding the lock
+func (indom *PCPInstanceDomain) instanceNames() []string {
 	ans, i := make([]string, len(indom.instances)), 0
 	for k := range indom.instances {
 		ans[i] = k
 		i++
 	}
+	sort.Strings(ans)
+	return ans
+}
+
+// sortedInstances returns the instances of the instance domain sorted by name
+func (indom *PCPInstanceDomain) sortedInstances() []*pcpInstance {
+	indom.mutex.RLock()
+	defer indom.mutex.RUnlock()
+
+	ans := make([]*pcpInstance, 0, len(indom.instances))
+	for _, name := range indom.instanceNames() {
+		ans = append(ans, indom.instances[name])
+	}
 	return ans
 }
 
 // MatchInstances returns true if the passed InstanceDomain
 // has exactly the same instances as the passed array
 func (indom *PCPInstanceDomain) MatchInstances(ins []string) bool {
+	indom.mutex.RLock()
+	defer indom.mutex.RUnlock()
+
 	if len(ins) != len(indom.instances) {
 		return false
 	}
@@ -119,6 +217,4 @@ func (indom *PCPInstanceDomain) Description() string {
 	return indom.shortDescription + "\n" + indom.longDescription
 }
 
-func (indom *PCPInstanceDomain) String() string {
-	return fmt.Sprintf("%s%v", indom.name, indom.Instances())
-}
+func (indom *PCPInstanceDomain) String() string { return fmt.Sprint(indom) }
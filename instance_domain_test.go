@@ -0,0 +1,122 @@
+package speed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestInstanceNameValidation(t *testing.T) {
+	cases := []struct {
+		instances []string
+		valid     bool
+	}{
+		{[]string{"sda", "sdb"}, true},
+		{[]string{"1 minute", "5 minute"}, true},
+		{[]string{""}, false},
+		{[]string{strings.Repeat("a", StringLength+1)}, false},
+		{[]string{" sda"}, false},
+		{[]string{"sda\tfast"}, false},
+		{[]string{"sda", "sda"}, false},
+		{[]string{"disk one", "disk two"}, false},
+		{[]string{"disk", "disk two"}, false},
+	}
+
+	for _, c := range cases {
+		_, err := NewPCPInstanceDomain("test.indom", c.instances)
+		if c.valid && err != nil {
+			t.Errorf("expected %q to be valid, got %v", c.instances, err)
+		}
+
+		if !c.valid {
+			if _, ok := err.(*InstanceNameError); !ok {
+				t.Errorf("expected an InstanceNameError for %q, got %v", c.instances, err)
+			}
+		}
+	}
+}
+
+func TestInstanceDomainIDCollision(t *testing.T) {
+	r := NewPCPRegistry()
+
+	a, err := NewPCPInstanceDomain("test.a", []string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a hash collision by assigning the id of the first indom
+	b, err := NewPCPInstanceDomainWithID(a.ID(), "test.b", []string{"y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.AddInstanceDomain(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.AddInstanceDomain(b); err == nil {
+		t.Error("expected an error adding an indom with a colliding id")
+	}
+
+	b, err = NewPCPInstanceDomainWithID(a.ID()+1, "test.b", []string{"y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.AddInstanceDomain(b); err != nil {
+		t.Errorf("expected an indom with an explicit id to be added, got %v", err)
+	}
+
+	if _, err = NewPCPInstanceDomainWithID(1<<PCPInstanceDomainBitLength, "test.c", nil); err == nil {
+		t.Error("expected an error creating an indom with an id that is too large")
+	}
+}
+
+func TestInstanceIDCollision(t *testing.T) {
+	// "costarring" and "liquid" have the same 32 bit FNV-1a hash
+	for _, names := range [][]string{{"costarring", "liquid"}, {"liquid", "costarring"}} {
+		indom, err := NewPCPInstanceDomain("test.collision", names)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, b := indom.instances["costarring"], indom.instances["liquid"]
+		if a.id != hash("costarring", 0) {
+			t.Errorf("expected costarring to keep its hashed id, got %v", a.id)
+		}
+
+		if b.id != a.id+1 {
+			t.Errorf("expected the colliding id of liquid to be %v, got %v", a.id+1, b.id)
+		}
+
+		if clone := indom.Clone(); clone.instances["liquid"].id != b.id {
+			t.Error("expected a clone to keep the instance ids")
+		}
+	}
+}
+
+func TestInstanceIDCollisionWritten(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.collision[costarring,liquid]", Instances{"costarring": 1, "liquid": 2}, Int32Type, InstantSemantics, OneUnit)
+	c.MustStart()
+	defer c.MustStop()
+
+	_, _, _, _, instances, _, _, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[int32]bool)
+	for _, i := range instances {
+		ids[i.Internal()] = true
+	}
+
+	if len(ids) != 2 {
+		t.Errorf("expected 2 distinct instance ids in the MMV file, got %v", len(ids))
+	}
+}
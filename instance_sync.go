@@ -0,0 +1,338 @@
+package speed
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InstanceSource returns the current instances of an instance domain, for example,
+// the backends of a service from service discovery.
+type InstanceSource func() ([]string, error)
+
+// FileInstances returns an InstanceSource reading instances from a file with one
+// instance per line, ignoring blank lines and lines starting with '#'.
+func FileInstances(path string) InstanceSource {
+	return func() ([]string, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read the instances")
+		}
+
+		var ans []string
+
+		s := bufio.NewScanner(bytes.NewReader(data))
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				ans = append(ans, line)
+			}
+		}
+
+		return ans, s.Err()
+	}
+}
+
+// DNSInstances returns an InstanceSource resolving the addresses of a host,
+// for example, the backends behind a headless service.
+func DNSInstances(host string) InstanceSource {
+	return func() ([]string, error) {
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot resolve %v", host)
+		}
+
+		return addrs, nil
+	}
+}
+
+// InstanceSync keeps the instances of an instance domain registered with a client in
+// sync with an InstanceSource, adding instances as they appear and retiring them as
+// they disappear, so metrics per backend follow a changing pool of backends.
+//
+// As the layout of an MMV file is fixed, every change remaps the started client,
+// which readers see as a new generation of the file, without stopping it like Remap,
+// so its collectors, pushes and checkpoints carry on. Added instances start with zero
+// values, retained ones keep their values and ids.
+//
+// Only instance metrics, counter vectors and gauge vectors can use the instance domain,
+// without weighted averages or a TTL. Updates of retired instances fail like updates of
+// any other instance that is not in the instance domain. A source returning no
+// instances fails the sync, leaving the instances as they are.
+type InstanceSync struct {
+	client *PCPClient
+	indom  *PCPInstanceDomain
+	source InstanceSource
+	runner *collectorRunner
+
+	// OnChange, if set, is called with the instances added and retired by every change.
+	OnChange func(added, retired []string)
+
+	// OnError, if set, is called with the failures of periodic syncs.
+	OnError func(error)
+}
+
+// NewInstanceSync creates a new InstanceSync for the passed instance domain, which has
+// to be registered with the passed client.
+func NewInstanceSync(c *PCPClient, indom *PCPInstanceDomain, source InstanceSource) (*InstanceSync, error) {
+	if source == nil {
+		return nil, errors.New("instance source cannot be nil")
+	}
+
+	if c.r.instanceDomain(indom.Name()) != indom {
+		return nil, errors.Errorf("instance domain %v is not registered with the client", indom.Name())
+	}
+
+	return &InstanceSync{client: c, indom: indom, source: source}, nil
+}
+
+// Sync reads the instances from the source once, and applies any change to the
+// instance domain and all metrics using it.
+func (s *InstanceSync) Sync() error {
+	instances, err := s.source()
+	if err != nil {
+		return err
+	}
+
+	added, retired := diffInstances(s.indom.Instances(), instances)
+	if len(added) == 0 && len(retired) == 0 {
+		return nil
+	}
+
+	if err = s.client.setInstances(s.indom, instances); err != nil {
+		return err
+	}
+
+	if s.OnChange != nil {
+		s.OnChange(added, retired)
+	}
+
+	return nil
+}
+
+// Describe sends nothing, the metrics using the instance domain are registered already
+func (s *InstanceSync) Describe(chan<- Desc) {}
+
+// Collect syncs the instances, reporting failures to OnError
+func (s *InstanceSync) Collect(Recorder) {
+	if err := s.Sync(); err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// Start syncs the instances every interval, until Stop is called.
+func (s *InstanceSync) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("sync interval must be positive")
+	}
+
+	if s.runner != nil {
+		return errors.New("instance sync is already started")
+	}
+
+	// not a collector of the client, as the client collects holding its lock on Start, which syncing takes
+	s.runner = &collectorRunner{collector: s, interval: interval}
+	s.runner.start()
+	return nil
+}
+
+// Stop stops syncing the instances periodically.
+func (s *InstanceSync) Stop() {
+	if s.runner != nil {
+		s.runner.stop()
+		s.runner = nil
+	}
+}
+
+// diffInstances returns the instances only in next, and the ones only in current, sorted
+func diffInstances(current, next []string) (added, retired []string) {
+	in := func(s []string) map[string]bool {
+		ans := make(map[string]bool, len(s))
+		for _, v := range s {
+			ans[v] = true
+		}
+		return ans
+	}
+
+	c, n := in(current), in(next)
+
+	for v := range n {
+		if !c[v] {
+			added = append(added, v)
+		}
+	}
+
+	for v := range c {
+		if !n[v] {
+			retired = append(retired, v)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(retired)
+	return added, retired
+}
+
+// instanceSetter is implemented by the instance metrics whose instances can change
+type instanceSetter interface {
+	instanceMetric
+	lockInstances() func()
+}
+
+func (m *PCPInstanceMetric) lockInstances() func() {
+	m.mutex.Lock()
+	return m.mutex.Unlock
+}
+
+func (c *PCPCounterVector) lockInstances() func() {
+	c.mutex.Lock()
+	return c.mutex.Unlock
+}
+
+func (g *PCPGaugeVector) lockInstances() func() {
+	g.mutex.Lock()
+	return g.mutex.Unlock
+}
+
+// setInstances replaces the instances of a registered instance domain, remapping the
+// client if it is started, without stopping it, so its collectors, pushes and
+// checkpoints carry on undisturbed
+func (c *PCPClient) setInstances(indom *PCPInstanceDomain, instances []string) error {
+	// the instance domain and its instances are laid out together, see tocCount
+	if len(instances) == 0 {
+		return errors.Errorf("instance domain %v cannot change to no instances", indom.Name())
+	}
+
+	if err := validateInstanceNames(instances); err != nil {
+		return err
+	}
+
+	var users []instanceSetter
+
+	c.r.metricslock.RLock()
+	for _, m := range c.r.metrics {
+		if m.Indom() != indom {
+			continue
+		}
+
+		im, ok := m.(instanceSetter)
+		if !ok || im.instances().weighted != nil || len(im.instances().weighting) > 0 || im.instances().ttl != nil {
+			c.r.metricslock.RUnlock()
+			return errors.Errorf("the instances of metric %v of type %T cannot change", m.Name(), m)
+		}
+
+		users = append(users, im)
+	}
+	c.r.metricslock.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// a lazily started client is not mapped yet, so its layout can still change
+	if !c.r.mapped || c.deferred {
+		return c.r.setInstances(indom, instances, users)
+	}
+
+	return c.remap(func() error { return c.r.setInstances(indom, instances, users) })
+}
+
+// setInstances replaces the instances of an instance domain and its metrics,
+// keeping the values of the retained instances
+func (r *PCPRegistry) setInstances(indom *PCPInstanceDomain, instances []string, users []instanceSetter) error {
+	r.indomlock.Lock()
+	defer r.indomlock.Unlock()
+
+	delta := len(instances) - indom.InstanceCount()
+	if err := checkLimit("instances", r.instanceCount, delta, MaxInstances); err != nil {
+		return err
+	}
+
+	if err := checkLimit("values", r.valueCount, delta*len(users), MaxValues); err != nil {
+		return err
+	}
+
+	next := nextInstances(indom.instances, instances)
+
+	// all metrics using the instance domain stay locked until it changes too
+	for _, u := range users {
+		defer u.lockInstances()()
+	}
+
+	for _, u := range users {
+		im := u.instances()
+
+		// changed in place, rollups refer to the map
+		for name := range im.vals {
+			if _, ok := next[name]; !ok {
+				delete(im.vals, name)
+			}
+		}
+
+		for name := range next {
+			if _, ok := im.vals[name]; !ok {
+				im.vals[name] = newinstanceValue(im.t.zero())
+			}
+		}
+
+		if im.t == StringType {
+			r.stringcount += stringBlocks * delta
+		}
+
+		if im.rollup != nil {
+			im.rollup.refresh()
+		}
+	}
+
+	indom.mutex.Lock()
+	indom.instances = next
+	indom.mutex.Unlock()
+
+	r.instanceCount += delta
+	r.valueCount += delta * len(users)
+
+	for _, name := range instances {
+		if len(name) > MaxV1NameLength {
+			r.version2 = true
+		}
+	}
+
+	return nil
+}
+
+// nextInstances returns the instances for the passed names, keeping the ids of the
+// current instances that are retained, so readers matching instances by id across
+// generations see the same ones. Added instances get ids like newpcpInstances, skipping
+// the ids of the retained ones.
+func nextInstances(current map[string]*pcpInstance, names []string) map[string]*pcpInstance {
+	ans := make(map[string]*pcpInstance, len(names))
+	ids := make(map[uint32]bool, len(names))
+
+	var added []string
+	for _, name := range names {
+		if i, ok := current[name]; ok {
+			ans[name] = &pcpInstance{name: name, id: i.id}
+			ids[i.id] = true
+		} else {
+			added = append(added, name)
+		}
+	}
+
+	sort.Strings(added)
+	for _, name := range added {
+		i := newpcpInstance(name)
+		for ids[i.id] {
+			i.id++
+		}
+
+		ids[i.id] = true
+		ans[name] = i
+	}
+
+	return ans
+}
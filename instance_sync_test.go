@@ -0,0 +1,374 @@
+package speed
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestInstanceSync(t *testing.T) {
+	c, err := NewPCPClient("sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indom, err := NewPCPInstanceDomain("backends", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := NewPCPInstanceMetric(Instances{"a": "up", "b": "up"}, "test.status", indom, StringType, DiscreteSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(status)
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0, "b": 0}, "test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(vector)
+	c.MustStart()
+	defer c.MustStop()
+
+	vector.MustInc(3, "b")
+
+	h, _, _, _, _, _, _, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+	gen := h.G1
+
+	instances := []string{"b", "c"}
+	source := func() ([]string, error) { return instances, nil }
+
+	s, err := NewInstanceSync(c, vector.Indom(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var added, retired []string
+	s.OnChange = func(a, r []string) { added, retired = a, r }
+
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(added, []string{"c"}) || !reflect.DeepEqual(retired, []string{"a"}) {
+		t.Errorf("expected c to be added and a to be retired, got %v and %v", added, retired)
+	}
+
+	if v, err := vector.Val("b"); err != nil || v != 3 {
+		t.Errorf("expected the retained instance b to keep 3, got %v, %v", v, err)
+	}
+
+	if v, err := vector.Val("c"); err != nil || v != 0 {
+		t.Errorf("expected the added instance c to start at 0, got %v, %v", v, err)
+	}
+
+	if err = vector.Inc(1, "a"); err == nil {
+		t.Error("expected an error updating a retired instance")
+	}
+
+	vector.MustInc(2, "c")
+
+	h, _, metrics, values, ins, _, strs, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	if h.G1 <= gen {
+		t.Errorf("expected the generation to be bumped from %v, got %v", gen, h.G1)
+	}
+
+	matchMetricsAndValues(metrics, values, ins, strs, c, t)
+
+	// an unchanged source changes nothing
+	added, retired = nil, nil
+	if err = s.Sync(); err != nil || added != nil || retired != nil {
+		t.Errorf("expected no change syncing the same instances, got %v, %v and %v", err, added, retired)
+	}
+
+	// metrics using a shared instance domain change together, strings included
+	s, err = NewInstanceSync(c, indom, func() ([]string, error) { return []string{"a", "b", "c"}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	status.MustSetInstance("down", "c")
+
+	_, _, metrics, values, ins, _, strs, err = mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, ins, strs, c, t)
+
+	if v, err := status.ValInstance("a"); err != nil || v != "up" {
+		t.Errorf("expected the retained instance a to keep up, got %v, %v", v, err)
+	}
+
+	if _, err = NewInstanceSync(c, indom, nil); err == nil {
+		t.Error("expected an error creating a sync without a source")
+	}
+}
+
+func TestInstanceSyncRemap(t *testing.T) {
+	c, err := NewPCPClient("sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col := &testCollector{}
+	if err = c.RegisterCollector(col, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0, "b": 0}, "test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indom := vector.Indom()
+
+	// as if the id of b was moved on a collision, which a new set of instances could resolve differently
+	indom.instances["b"].id = 12345
+
+	c.MustRegister(vector)
+	c.MustStart()
+	defer c.MustStop()
+
+	s, err := NewInstanceSync(c, indom, func() ([]string, error) { return []string{"b", "c"}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// readers of the instances run alongside syncs
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = indom.Instances()
+			_ = indom.HasInstance("c")
+		}
+	}()
+
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if id := indom.instances["b"].id; id != 12345 {
+		t.Errorf("expected the retained instance b to keep its id, got %v", id)
+	}
+
+	_, _, metrics, values, ins, _, strs, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, ins, strs, c, t)
+
+	// a restart of the client would have collected again
+	if n := atomic.LoadInt64(&col.collections); n != 1 {
+		t.Errorf("expected the client not to be restarted, got %v collections", n)
+	}
+}
+
+func TestInstanceSyncConcurrentUpdates(t *testing.T) {
+	c, err := NewPCPClient("sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0, "b": 0}, "test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegister(vector)
+	c.MustStart()
+	defer c.MustStop()
+
+	var n int
+	s, err := NewInstanceSync(c, vector.Indom(), func() ([]string, error) {
+		n++
+		if n%2 == 0 {
+			return []string{"a", "b"}, nil
+		}
+		return []string{"b", "c"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// updates of the metrics carry on while every sync remaps the client
+	done, stopped := make(chan struct{}), make(chan int64)
+	go func() {
+		var incs int64
+		for {
+			select {
+			case <-done:
+				stopped <- incs
+				return
+			default:
+				counter.Up()
+				vector.MustInc(1, "b")
+				incs++
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		if err = s.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(done)
+	incs := <-stopped
+
+	if v := counter.Val(); v != incs {
+		t.Errorf("expected the counter to be %v, got %v", incs, v)
+	}
+
+	if v, err := vector.Val("b"); err != nil || v != incs {
+		t.Errorf("expected b to be %v, got %v, %v", incs, v, err)
+	}
+
+	_, _, metrics, values, ins, _, strs, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, ins, strs, c, t)
+}
+
+func TestNextInstances(t *testing.T) {
+	current := newpcpInstances([]string{"a", "b"})
+
+	// a retained instance holding the id an added one hashes to keeps it
+	current["a"].id = hash("c", 0)
+
+	next := nextInstances(current, []string{"a", "c"})
+
+	if len(next) != 2 || next["a"].id != hash("c", 0) {
+		t.Errorf("expected a to keep its id, got %v", next)
+	}
+
+	if next["c"].id != hash("c", 0)+1 {
+		t.Errorf("expected c to get the next free id, got %v", next["c"].id)
+	}
+
+	if next["a"] == current["a"] {
+		t.Error("expected the instances not to be shared with the current ones")
+	}
+}
+
+func TestInstanceSyncErrors(t *testing.T) {
+	c, err := NewPCPClient("sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indom, err := NewPCPInstanceDomain("backends", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := func() ([]string, error) { return []string{"a", "b"}, nil }
+
+	if _, err = NewInstanceSync(c, indom, source); err == nil {
+		t.Error("expected an error syncing an instance domain that is not registered")
+	}
+
+	h, err := NewPCPHistogram("test.latency", 0, 100, 3, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(h)
+	c.MustStart()
+	defer c.MustStop()
+
+	s, err := NewInstanceSync(c, h.Indom(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Sync(); err == nil {
+		t.Error("expected an error changing the instances of a histogram")
+	}
+
+	s, err = NewInstanceSync(c, h.Indom(), func() ([]string, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Sync(); err == nil {
+		t.Error("expected an error syncing to no instances")
+	}
+
+	failing := errors.New("discovery is down")
+	s, err = NewInstanceSync(c, h.Indom(), func() ([]string, error) { return nil, failing })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported error
+	s.OnError = func(err error) { reported = err }
+	s.Collect(nil)
+
+	if reported != failing {
+		t.Errorf("expected the failure of the source to be reported, got %v", reported)
+	}
+
+	if err = s.Start(0); err == nil {
+		t.Error("expected an error starting a sync without an interval")
+	}
+}
+
+func TestFileInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backends")
+	if err = ioutil.WriteFile(path, []byte("# backends\n10.0.0.1\n\n  10.0.0.2  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := FileInstances(path)()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(instances, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("expected the instances in the file, got %v", instances)
+	}
+
+	if _, err = FileInstances(filepath.Join(dir, "missing"))(); err == nil {
+		t.Error("expected an error reading a missing file")
+	}
+}
@@ -0,0 +1,86 @@
+package speed
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TaggedInstance formats the passed tags as a structured instance name of the form
+// "key1=val1,key2=val2", sorted by key, so the same tags always make the same instance.
+//
+// Exporters supporting labels, like InfluxExporter and DogStatsDExporter, send the
+// tags of tagged instances as labels of their own, along with the instance name.
+// Neither keys nor values can contain '=' or ',', and keys cannot be empty.
+func TaggedInstance(tags map[string]string) (string, error) {
+	if len(tags) == 0 {
+		return "", errors.New("tagged instance needs at least one tag")
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if k == "" {
+			return "", errors.New("instance tag keys cannot be empty")
+		}
+
+		if strings.ContainsAny(k, "=,") || strings.ContainsAny(v, "=,") {
+			return "", errors.Errorf("instance tag %v=%v cannot contain '=' or ','", k, v)
+		}
+
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+tags[k])
+	}
+
+	return strings.Join(parts, ","), nil
+}
+
+// MustTaggedInstance is a TaggedInstance that panics.
+func MustTaggedInstance(tags map[string]string) string {
+	instance, err := TaggedInstance(tags)
+	if err != nil {
+		panic(err)
+	}
+	return instance
+}
+
+// ParseTaggedInstance parses a structured instance name of the form "key1=val1,key2=val2"
+// back into its tags, returning an *InstanceNameError for names of any other form.
+func ParseTaggedInstance(instance string) (map[string]string, error) {
+	parts := strings.Split(instance, ",")
+	tags := make(map[string]string, len(parts))
+
+	for _, part := range parts {
+		kv := strings.Split(part, "=")
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, &InstanceNameError{instance, "name is not a list of key=value tags"}
+		}
+
+		if _, ok := tags[kv[0]]; ok {
+			return nil, &InstanceNameError{instance, "tag " + kv[0] + " is repeated"}
+		}
+
+		tags[kv[0]] = kv[1]
+	}
+
+	return tags, nil
+}
+
+// instanceTags returns the tags of a tagged instance, and nil for any other instance
+func instanceTags(instance string) map[string]string {
+	if !strings.Contains(instance, "=") {
+		return nil
+	}
+
+	tags, err := ParseTaggedInstance(instance)
+	if err != nil {
+		return nil
+	}
+
+	return tags
+}
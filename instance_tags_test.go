@@ -0,0 +1,90 @@
+package speed
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTaggedInstance(t *testing.T) {
+	instance, err := TaggedInstance(map[string]string{"status": "200", "method": "GET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if instance != "method=GET,status=200" {
+		t.Errorf("expected the tags sorted by key, got %v", instance)
+	}
+
+	tags, err := ParseTaggedInstance(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(tags, map[string]string{"method": "GET", "status": "200"}) {
+		t.Errorf("expected the tags to be parsed back, got %v", tags)
+	}
+
+	// tagged instances are valid instance names
+	if err = validateInstanceNames([]string{instance}); err != nil {
+		t.Errorf("expected a tagged instance to be valid, got %v", err)
+	}
+
+	invalid := []map[string]string{
+		nil,
+		{"": "GET"},
+		{"method": "GET,POST"},
+		{"a=b": "c"},
+	}
+
+	for _, tags := range invalid {
+		if _, err = TaggedInstance(tags); err == nil {
+			t.Errorf("expected an error formatting %v", tags)
+		}
+	}
+}
+
+func TestParseTaggedInstance(t *testing.T) {
+	cases := []struct {
+		instance string
+		tags     map[string]string
+	}{
+		{"a=1", map[string]string{"a": "1"}},
+		{"a=,b=2", map[string]string{"a": "", "b": "2"}},
+		{"GET", nil},
+		{"a=1,b", nil},
+		{"=1", nil},
+		{"a=1=2", nil},
+		{"a=1,a=2", nil},
+	}
+
+	for _, c := range cases {
+		tags, err := ParseTaggedInstance(c.instance)
+		if c.tags == nil {
+			if _, ok := err.(*InstanceNameError); !ok {
+				t.Errorf("expected an InstanceNameError parsing %q, got %v", c.instance, err)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(tags, c.tags) {
+			t.Errorf("expected %q to be parsed as %v, got %v, %v", c.instance, c.tags, tags, err)
+		}
+	}
+
+	if tags := instanceTags("GET /a b"); tags != nil {
+		t.Errorf("expected no tags for a plain instance, got %v", tags)
+	}
+}
+
+func TestDogStatsDInstanceTags(t *testing.T) {
+	e := &DogStatsDExporter{
+		namespace:    "app.",
+		instanceTags: make(map[string]string),
+		counters:     make(map[string]float64),
+	}
+
+	lines := e.lines([]Sample{{"latency", "status=200,method=GET", 1.5}}, nil)
+	if string(lines) != "app.latency:1.5|g|#instance:status=200_method=GET,method:GET,status:200\n" {
+		t.Errorf("expected the instance tags to be sent, got %q", lines)
+	}
+}
@@ -0,0 +1,164 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JobRecorder instruments scheduled jobs, like cron jobs, exporting per job the time
+// its last run started as seconds since the epoch, the duration of its last run in
+// nanoseconds, the number of consecutive failed runs and the total number of runs,
+// so alerts can be raised for jobs that stopped running or keep failing.
+//
+// Every job is expected to have a single run at a time, which starts with Start and
+// completes with either Success or Failure. The jobs have to be declared on
+// construction, as instances cannot be added once a mapping is active.
+type JobRecorder struct {
+	mutex   sync.Mutex
+	started map[string]time.Time // start of the current run of every job
+
+	lastRun, lastDuration, failures *PCPInstanceMetric
+	runs                            *PCPCounterVector
+
+	now func() time.Time
+}
+
+// NewJobRecorder creates a new JobRecorder with all metrics under the passed prefix.
+func NewJobRecorder(prefix string, jobs ...string) (*JobRecorder, error) {
+	if prefix == "" {
+		return nil, errors.New("job recorder prefix cannot be empty")
+	}
+
+	if len(jobs) == 0 {
+		return nil, errors.New("job recorder needs at least one job")
+	}
+
+	indom, err := NewPCPInstanceDomain(prefix+".job.indom", jobs, "scheduled jobs")
+	if err != nil {
+		return nil, err
+	}
+
+	j := &JobRecorder{started: make(map[string]time.Time, len(jobs)), now: time.Now}
+
+	if j.lastRun, err = NewPCPInstanceMetric(
+		zeroInstances(jobs, int64(0)), prefix+".last_run",
+		indom, Int64Type, InstantSemantics, SecondUnit,
+		"time the last run of the job started, in seconds since the epoch",
+	); err != nil {
+		return nil, err
+	}
+
+	if j.lastDuration, err = NewPCPInstanceMetric(
+		zeroInstances(jobs, uint64(0)), prefix+".last_duration",
+		indom, Uint64Type, InstantSemantics, NanosecondUnit,
+		"duration of the last completed run of the job",
+	); err != nil {
+		return nil, err
+	}
+
+	if j.failures, err = NewPCPInstanceMetric(
+		zeroInstances(jobs, uint64(0)), prefix+".consecutive_failures",
+		indom, Uint64Type, InstantSemantics, OneUnit,
+		"number of consecutive failed runs of the job",
+	); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(jobs))
+	for _, job := range jobs {
+		counts[job] = 0
+	}
+
+	if j.runs, err = NewPCPCounterVector(counts, prefix+".runs", "number of completed runs of the job"); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Metrics returns all the metrics exported by the recorder.
+func (j *JobRecorder) Metrics() []Metric {
+	return []Metric{j.lastRun, j.lastDuration, j.failures, j.runs}
+}
+
+// Register registers all metrics of the recorder with the passed client.
+func (j *JobRecorder) Register(c Client) error {
+	for _, m := range j.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Start records the start of a run of a job.
+func (j *JobRecorder) Start(job string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if !j.lastRun.Indom().HasInstance(job) {
+		return errors.Errorf("%v is not a declared job", job)
+	}
+
+	if _, ok := j.started[job]; ok {
+		return errors.Errorf("job %v is already running", job)
+	}
+
+	now := j.now()
+	if err := j.lastRun.SetInstance(now.Unix(), job); err != nil {
+		return err
+	}
+
+	j.started[job] = now
+	return nil
+}
+
+// Success records the successful completion of the current run of a job.
+func (j *JobRecorder) Success(job string) error {
+	return j.complete(job, false)
+}
+
+// Failure records the failed completion of the current run of a job.
+func (j *JobRecorder) Failure(job string) error {
+	return j.complete(job, true)
+}
+
+func (j *JobRecorder) complete(job string, failed bool) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	start, ok := j.started[job]
+	if !ok {
+		return errors.Errorf("job %v is not running", job)
+	}
+
+	delete(j.started, job)
+
+	d := j.now().Sub(start)
+	if d < 0 {
+		d = 0
+	}
+
+	if err := j.lastDuration.SetInstance(uint64(d), job); err != nil {
+		return err
+	}
+
+	failures := uint64(0)
+	if failed {
+		v, err := j.failures.ValInstance(job)
+		if err != nil {
+			return err
+		}
+
+		failures = v.(uint64) + 1
+	}
+
+	if err := j.failures.SetInstance(failures, job); err != nil {
+		return err
+	}
+
+	return j.runs.Inc(1, job)
+}
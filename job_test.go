@@ -0,0 +1,94 @@
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobRecorder(t *testing.T) {
+	j, err := NewJobRecorder("test.jobs", "backup", "cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000, 0)
+	j.now = func() time.Time { return now }
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = j.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = j.Start("unknown"); err == nil {
+		t.Error("expected an error starting an undeclared job")
+	}
+
+	if err = j.Success("backup"); err == nil {
+		t.Error("expected an error completing a job that is not running")
+	}
+
+	run := func(failed bool, d time.Duration) {
+		if err := j.Start("backup"); err != nil {
+			t.Fatal(err)
+		}
+
+		now = now.Add(d)
+
+		complete := j.Success
+		if failed {
+			complete = j.Failure
+		}
+
+		if err := complete("backup"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(true, time.Second)
+
+	if err = j.Start("backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = j.Start("backup"); err == nil {
+		t.Error("expected an error starting a job that is already running")
+	}
+
+	now = now.Add(2 * time.Second)
+	if err = j.Failure("backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := j.failures.ValInstance("backup"); v.(uint64) != 2 {
+		t.Errorf("expected 2 consecutive failures, got %v", v)
+	}
+
+	run(false, 3*time.Second)
+
+	if v, _ := j.failures.ValInstance("backup"); v.(uint64) != 0 {
+		t.Errorf("expected the failures to be reset by a success, got %v", v)
+	}
+
+	if v, _ := j.lastRun.ValInstance("backup"); v.(int64) != 1003 {
+		t.Errorf("expected the last run to start at 1003, got %v", v)
+	}
+
+	if v, _ := j.lastDuration.ValInstance("backup"); v.(uint64) != uint64(3*time.Second) {
+		t.Errorf("expected the last run to take 3s, got %v", v)
+	}
+
+	if v, _ := j.runs.Val("backup"); v != 3 {
+		t.Errorf("expected 3 runs, got %v", v)
+	}
+
+	if v, _ := j.runs.Val("cleanup"); v != 0 {
+		t.Errorf("expected no runs of cleanup, got %v", v)
+	}
+}
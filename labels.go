@@ -0,0 +1,101 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WithLabels attaches labels to all metrics of the client, which exporters like
+// InfluxExporter and DogStatsDExporter send as tags.
+//
+// The MMV format written by the client has no labels, so they are not part of
+// the MMV file.
+func WithLabels(labels map[string]string) ClientOption {
+	return func(c *PCPClient) error {
+		for k := range labels {
+			if k == "" {
+				return errors.New("label names cannot be empty")
+			}
+		}
+
+		if c.labels == nil {
+			c.labels = make(map[string]string, len(labels))
+		}
+
+		for k, v := range labels {
+			c.labels[k] = v
+		}
+
+		return nil
+	}
+}
+
+// Labels returns the labels attached to all metrics of the client.
+func (c *PCPClient) Labels() map[string]string {
+	ans := make(map[string]string, len(c.labels))
+	for k, v := range c.labels {
+		ans[k] = v
+	}
+	return ans
+}
+
+// kubernetesNamespaceFile holds the namespace of a pod with a mounted service account
+const kubernetesNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// KubernetesLabels returns the "namespace", "pod" and "node" of the current pod,
+// read from the POD_NAMESPACE, POD_NAME and NODE_NAME environment variables,
+// which are usually set using the downward API, like
+//
+//	env:
+//	- name: NODE_NAME
+//	  valueFrom:
+//	    fieldRef:
+//	      fieldPath: spec.nodeName
+//
+// Without them, the namespace is read from the service account, and the pod
+// name from HOSTNAME. Labels that cannot be found are left out.
+func KubernetesLabels() map[string]string {
+	return kubernetesLabels(os.Getenv, ioutil.ReadFile)
+}
+
+func kubernetesLabels(getenv func(string) string, readFile func(string) ([]byte, error)) map[string]string {
+	ans := make(map[string]string)
+
+	set := func(label string, vals ...string) {
+		for _, v := range vals {
+			if v = strings.TrimSpace(v); v != "" {
+				ans[label] = v
+				return
+			}
+		}
+	}
+
+	namespace := getenv("POD_NAMESPACE")
+	if namespace == "" {
+		if data, err := readFile(kubernetesNamespaceFile); err == nil {
+			namespace = string(data)
+		}
+	}
+
+	set("namespace", namespace)
+	set("pod", getenv("POD_NAME"), getenv("HOSTNAME"))
+	set("node", getenv("NODE_NAME"))
+
+	return ans
+}
+
+// WithKubernetesLabels attaches the KubernetesLabels of the current pod to all metrics
+// of the client. Outside of kubernetes, it attaches nothing.
+func WithKubernetesLabels() ClientOption {
+	return func(c *PCPClient) error {
+		// HOSTNAME is set everywhere, so it only names a pod inside kubernetes
+		if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+			return nil
+		}
+
+		return WithLabels(KubernetesLabels())(c)
+	}
+}
@@ -0,0 +1,65 @@
+package speed
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestKubernetesLabels(t *testing.T) {
+	cases := []struct {
+		env       map[string]string
+		namespace string
+		expected  map[string]string
+	}{
+		{
+			map[string]string{"POD_NAMESPACE": "prod", "POD_NAME": "web-1", "NODE_NAME": "node-a", "HOSTNAME": "host"},
+			"default\n",
+			map[string]string{"namespace": "prod", "pod": "web-1", "node": "node-a"},
+		},
+		{
+			map[string]string{"HOSTNAME": "web-2"},
+			"default\n",
+			map[string]string{"namespace": "default", "pod": "web-2"},
+		},
+		{
+			map[string]string{},
+			"",
+			map[string]string{},
+		},
+	}
+
+	for _, c := range cases {
+		readFile := func(name string) ([]byte, error) {
+			if name != kubernetesNamespaceFile || c.namespace == "" {
+				return nil, os.ErrNotExist
+			}
+			return []byte(c.namespace), nil
+		}
+
+		getenv := func(key string) string { return c.env[key] }
+
+		if labels := kubernetesLabels(getenv, readFile); !reflect.DeepEqual(labels, c.expected) {
+			t.Errorf("expected labels %v, got %v", c.expected, labels)
+		}
+	}
+}
+
+func TestWithLabels(t *testing.T) {
+	if _, err := NewPCPClient("test", WithLabels(map[string]string{"": "x"})); err == nil {
+		t.Error("expected an error passing an empty label name")
+	}
+
+	labels := map[string]string{"pod": "web-1"}
+
+	c, err := NewPCPClient("test", WithLabels(labels), WithLabels(map[string]string{"node": "a"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels["pod"] = "web-2"
+
+	if expected := map[string]string{"pod": "web-1", "node": "a"}; !reflect.DeepEqual(c.Labels(), expected) {
+		t.Errorf("expected labels %v, got %v", expected, c.Labels())
+	}
+}
@@ -0,0 +1,116 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LatencyPair exports the cumulative time spent in an operation along with the
+// number of times it completed, as "<name>.time" in nanoseconds and "<name>.count",
+// which is how PMDAs export latencies, for example, disk.dev.read_rawactive and
+// disk.dev.read. PCP derives the average latency over any interval from the
+// rates of the two counters, for example
+//
+//	pmval -x 'delta(app.request.time) / delta(app.request.count)'
+//
+// Both counters are updated together, so they are always consistent.
+type LatencyPair struct {
+	mutex sync.Mutex
+	time  *PCPSingletonMetric
+	count *PCPCounter
+}
+
+// NewLatencyPair creates a new LatencyPair with the counters "<name>.time" and "<name>.count".
+// It can optionally take a description of the operation, used in the descriptions of both.
+func NewLatencyPair(name string, desc ...string) (*LatencyPair, error) {
+	if name == "" {
+		return nil, errors.New("latency pair name cannot be empty")
+	}
+
+	if len(desc) > 1 {
+		return nil, errors.New("only an optional description of the operation is allowed")
+	}
+
+	op := name
+	if len(desc) > 0 {
+		op = desc[0]
+	}
+
+	t, err := NewPCPSingletonMetric(
+		uint64(0), name+".time", Uint64Type, CounterSemantics, NanosecondUnit,
+		"cumulative time spent in "+op,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := NewPCPCounter(0, name+".count", "number of completed "+op)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LatencyPair{time: t, count: count}, nil
+}
+
+// Metrics returns both counters of the pair.
+func (p *LatencyPair) Metrics() []Metric {
+	return []Metric{p.time, p.count}
+}
+
+// Register registers both counters of the pair with the passed client.
+func (p *LatencyPair) Register(c Client) error {
+	for _, m := range p.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Record records a completed operation that took the passed duration.
+func (p *LatencyPair) Record(d time.Duration) error {
+	if d < 0 {
+		return errors.Errorf("cannot record a negative duration %v", d)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.time.Set(p.time.Val().(uint64) + uint64(d)); err != nil {
+		return err
+	}
+
+	return p.count.Inc(1)
+}
+
+// MustRecord is Record that panics on failure.
+func (p *LatencyPair) MustRecord(d time.Duration) {
+	if err := p.Record(d); err != nil {
+		p.count.fail(err)
+	}
+}
+
+// Since records a completed operation that started at the passed time,
+// for example, deferring pair.Since(time.Now()) at the start of the operation.
+func (p *LatencyPair) Since(start time.Time) error {
+	return p.Record(time.Since(start))
+}
+
+// Time returns the cumulative time of all recorded operations.
+func (p *LatencyPair) Time() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return time.Duration(p.time.Val().(uint64))
+}
+
+// Count returns the number of recorded operations.
+func (p *LatencyPair) Count() int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.count.Val()
+}
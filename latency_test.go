@@ -0,0 +1,66 @@
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyPair(t *testing.T) {
+	p, err := NewLatencyPair("test.request", "requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	p.MustRecord(3 * time.Millisecond)
+	p.MustRecord(5 * time.Millisecond)
+
+	if p.Time() != 8*time.Millisecond || p.Count() != 2 {
+		t.Errorf("expected 8ms over 2 operations, got %v over %v", p.Time(), p.Count())
+	}
+
+	samples, err := c.Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"test.request.time":  uint64(8 * time.Millisecond),
+		"test.request.count": int64(2),
+	}
+
+	for _, s := range samples {
+		if v, ok := expected[s.Metric]; ok && v != s.Value {
+			t.Errorf("expected %v to be %v, got %v", s.Metric, v, s.Value)
+		}
+	}
+
+	if p.time.Unit().String() != NanosecondUnit.String() || p.time.Semantics() != CounterSemantics {
+		t.Errorf("expected a nanosecond counter, got %v and %v", p.time.Unit(), p.time.Semantics())
+	}
+
+	if err = p.Record(-time.Second); err == nil {
+		t.Error("expected an error recording a negative duration")
+	}
+}
+
+func TestLatencyPairErrors(t *testing.T) {
+	if _, err := NewLatencyPair(""); err == nil {
+		t.Error("expected an error creating a pair without a name")
+	}
+
+	if _, err := NewLatencyPair("test.request", "a", "b"); err == nil {
+		t.Error("expected an error creating a pair with two descriptions")
+	}
+}
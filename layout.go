@@ -0,0 +1,74 @@
+package speed
+
+import (
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// The MMV format stores every string, i.e. string values, descriptions and
+// version 2 names, in a block of StringLength bytes, including the terminating
+// null byte. The block size is fixed by the format, so it cannot be changed per
+// client, but a client can limit the length of the strings it writes, and omit
+// descriptions altogether to shrink the file.
+
+// WithMaxStringLength limits the strings written by the client, i.e. string values
+// and descriptions, to n bytes, truncating longer ones on a character boundary.
+//
+// The default, and the maximum the format allows, is StringLength-1.
+// Names are not truncated, as they identify metrics and instances.
+func WithMaxStringLength(n int) ClientOption {
+	return func(c *PCPClient) error {
+		if n < 1 || n > StringLength-1 {
+			return errors.Errorf("maximum string length must be between 1 and %v, got %v", StringLength-1, n)
+		}
+
+		c.maxStringLength = n
+		return nil
+	}
+}
+
+// WithoutHelpText omits the short and long descriptions of all metrics and
+// instance domains from the MMV file, which saves StringLength bytes per
+// description, for memory constrained environments.
+func WithoutHelpText() ClientOption {
+	return func(c *PCPClient) error {
+		c.noHelp = true
+		return nil
+	}
+}
+
+// stringCount returns the number of string blocks written by the client.
+func (c *PCPClient) stringCount() int {
+	if c.noHelp {
+		return c.r.StringCount() - c.r.helpcount
+	}
+
+	return c.r.StringCount()
+}
+
+// truncate shortens a string to the maximum string length of the client,
+// without splitting a multibyte character.
+func (c *PCPClient) truncate(s string) string {
+	if len(s) <= c.maxStringLength {
+		return s
+	}
+
+	n := c.maxStringLength
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// truncating makes an update closure for a string value truncate the written value.
+func (c *PCPClient) truncating(update updateClosure) updateClosure {
+	return func(val interface{}) error {
+		if s, ok := val.(string); ok {
+			val = c.truncate(s)
+		}
+
+		return update(val)
+	}
+}
@@ -0,0 +1,117 @@
+package speed
+
+import (
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestMaxStringLength(t *testing.T) {
+	for _, n := range []int{0, StringLength} {
+		if _, err := NewPCPClient("test", WithMaxStringLength(n)); err == nil {
+			t.Errorf("expected an error setting the maximum string length to %v", n)
+		}
+	}
+
+	c, err := NewPCPClient("test", WithMaxStringLength(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct{ s, expected string }{
+		{"abé", "abé"},
+		{"abcé", "abc"},
+		{"héllo", "hél"},
+	}
+
+	for _, tc := range cases {
+		if s := c.truncate(tc.s); s != tc.expected {
+			t.Errorf("expected %v to be truncated to %v, got %v", tc.s, tc.expected, s)
+		}
+	}
+
+	m, err := NewPCPSingletonMetric("kirkland", "test.str", StringType, InstantSemantics, OneUnit, "a string")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(m)
+	c.MustStart()
+	defer c.MustStop()
+
+	str := func() (value, help string) {
+		_, _, metrics, values, _, _, strings, err := mmvdump.Dump(c.writer.Bytes())
+		if err != nil {
+			t.Fatalf("cannot get dump, error: %v", err)
+		}
+
+		off, dm := findMetric(m, metrics)
+		_, val := findSingletonValue(off, values)
+		return cString(strings[uint64(val.Extra)].Payload[:]), cString(strings[dm.ShortText()].Payload[:])
+	}
+
+	if v, h := str(); v != "kirk" || h != "a st" {
+		t.Errorf("expected the value and help to be truncated to kirk and a st, got %v and %v", v, h)
+	}
+
+	m.MustSet("spockish")
+	if v, _ := str(); v != "spoc" {
+		t.Errorf("expected the value to be truncated to spoc, got %v", v)
+	}
+
+	if m.Val() != "spockish" {
+		t.Errorf("expected the full value to be kept in memory, got %v", m.Val())
+	}
+}
+
+func TestWithoutHelpText(t *testing.T) {
+	register := func(c *PCPClient) *PCPCounter {
+		counter, err := NewPCPCounter(0, "test.counter", "a counter", "a counter for testing")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.MustRegister(counter)
+		return counter
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	register(c)
+
+	nc, err := NewPCPClient("test", WithoutHelpText())
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := register(nc)
+
+	// no strings also means no strings toc
+	if expected := c.Length() - 2*StringLength - TocLength; nc.Length() != expected {
+		t.Errorf("expected the length without help text to be %v, got %v", expected, nc.Length())
+	}
+
+	nc.MustStart()
+	defer nc.MustStop()
+
+	counter.Up()
+
+	_, _, metrics, values, _, _, strings, err := mmvdump.Dump(nc.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	off, m := findMetric(counter, metrics)
+	if m.ShortText() != 0 || m.LongText() != 0 {
+		t.Errorf("expected no help text to be written, got offsets %v and %v", m.ShortText(), m.LongText())
+	}
+
+	if len(strings) != 0 {
+		t.Errorf("expected no strings to be written, got %v", len(strings))
+	}
+
+	if _, val := findSingletonValue(off, values); val.Val != 1 {
+		t.Errorf("expected the counter to be 1, got %v", val.Val)
+	}
+}
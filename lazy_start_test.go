@@ -0,0 +1,169 @@
+package speed
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestLazyStart(t *testing.T) {
+	c, err := NewPCPClient("lazy", WithLazyStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0, "b": 0}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegister(vector)
+
+	os.Remove(c.loc)
+
+	// stopping a client that was never written to leaves no file behind
+	c.MustStart()
+	c.MustStop()
+
+	if _, err = os.Stat(c.loc); !os.IsNotExist(err) {
+		t.Fatalf("expected no MMV file to be created, got %v", err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if c.writer != nil {
+		t.Fatal("expected the client not to be mapped before the first write")
+	}
+
+	gauge, err := NewPCPGauge(0, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Register(gauge); err == nil {
+		t.Error("expected an error registering a metric after Start")
+	}
+
+	vector.MustInc(2, "b")
+	counter.Up()
+
+	if _, err = os.Stat(c.loc); err != nil {
+		t.Fatalf("expected the MMV file to be created on the first write, got %v", err)
+	}
+
+	_, _, metrics, values, instances, _, strings, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, instances, strings, c, t)
+}
+
+func TestLazyStartConcurrentUpdates(t *testing.T) {
+	c, err := NewPCPClient("lazy", WithLazyStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewPCPCounter(0, "test.a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewPCPCounter(0, "test.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(a)
+	c.MustRegister(b)
+
+	// the first updates of both counters map the client at the same time
+	for i := 0; i < 20; i++ {
+		c.MustStart()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+
+		ready := make(chan struct{})
+		for _, counter := range []*PCPCounter{a, b} {
+			go func(counter *PCPCounter) {
+				defer wg.Done()
+				<-ready
+				counter.Up()
+			}(counter)
+		}
+
+		close(ready)
+		wg.Wait()
+
+		_, _, metrics, values, instances, _, strings, err := mmvdump.Dump(c.writer.Bytes())
+		if err != nil {
+			t.Fatalf("cannot get dump, error: %v", err)
+		}
+
+		matchMetricsAndValues(metrics, values, instances, strings, c, t)
+		c.MustStop()
+	}
+
+	if a.Val() != 20 || b.Val() != 20 {
+		t.Errorf("expected both counters to be 20, got %v and %v", a.Val(), b.Val())
+	}
+}
+
+func TestLazyStartInstanceSync(t *testing.T) {
+	c, err := NewPCPClient("lazy", WithLazyStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0, "b": 0}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(vector)
+
+	var n int
+	s, err := NewInstanceSync(c, vector.Indom(), func() ([]string, error) {
+		n++
+		if n%2 == 0 {
+			return []string{"a", "b"}, nil
+		}
+		return []string{"b", "c"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first update of the vector maps the client while its instances change
+	for i := 0; i < 20; i++ {
+		c.MustStart()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			vector.MustInc(1, "b")
+		}()
+
+		if err = s.Sync(); err != nil {
+			t.Fatal(err)
+		}
+
+		<-done
+		c.MustStop()
+	}
+
+	if v, err := vector.Val("b"); err != nil || v != 20 {
+		t.Errorf("expected b to be 20, got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,194 @@
+package speed
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// MetricLevel is the verbosity of a metric. A client only writes and exports the
+// values of metrics up to its own level, see SetLevel.
+type MetricLevel int32
+
+// Possible values for a MetricLevel, from the least to the most verbose
+const (
+	// CriticalLevel is for metrics that are always needed, like error counts
+	CriticalLevel MetricLevel = iota + 1
+
+	// NormalLevel is the level of metrics without WithLevel, and of clients
+	// without SetLevel
+	NormalLevel
+
+	// DebugLevel is for verbose, often high cardinality, metrics only needed
+	// while investigating a problem
+	DebugLevel
+)
+
+var levelNames = map[MetricLevel]string{
+	CriticalLevel: "critical",
+	NormalLevel:   "normal",
+	DebugLevel:    "debug",
+}
+
+func (l MetricLevel) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "MetricLevel(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseMetricLevel parses a MetricLevel from its name, like "debug".
+func ParseMetricLevel(s string) (MetricLevel, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return l, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown metric level %q", s)
+}
+
+// WithLevel sets the level of the metric, which is NormalLevel by default.
+func WithLevel(l MetricLevel) MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if _, ok := levelNames[l]; !ok {
+			return errors.Errorf("invalid metric level %d", l)
+		}
+
+		md.level = l
+		return nil
+	}
+}
+
+// Level returns the level of the metric.
+func (md *pcpMetricDesc) Level() MetricLevel {
+	if md.level == 0 {
+		return NormalLevel
+	}
+	return md.level
+}
+
+// leveledMetric is implemented by all metrics with a pcpMetricDesc
+type leveledMetric interface {
+	Level() MetricLevel
+}
+
+// metricLevel returns the level of the passed metric
+func metricLevel(m Metric) MetricLevel {
+	if lm, ok := m.(leveledMetric); ok {
+		return lm.Level()
+	}
+	return NormalLevel
+}
+
+// SetLevel sets the most verbose level of the metrics of the client that have their
+// values written and exported. Like SetFilter, it can be changed at any time, with
+// the same effect on the metrics it disables.
+func (c *PCPClient) SetLevel(l MetricLevel) error {
+	if _, ok := levelNames[l]; !ok {
+		return errors.Errorf("invalid metric level %d", l)
+	}
+
+	atomic.StoreInt32(&c.level, int32(l))
+	return nil
+}
+
+// Level returns the most verbose level of metrics written by the client.
+func (c *PCPClient) Level() MetricLevel {
+	if l := MetricLevel(atomic.LoadInt32(&c.level)); l != 0 {
+		return l
+	}
+	return NormalLevel
+}
+
+// ToggleDebugOnSignal makes the client switch to DebugLevel when it receives any of
+// the passed signals, usually syscall.SIGUSR2, and back to its previous level when
+// it receives one again. The returned function stops listening for the signals.
+func (c *PCPClient) ToggleDebugOnSignal(sigs ...os.Signal) (stop func()) {
+	toggle := c.debugToggle()
+
+	handlers := make(map[os.Signal]func(), len(sigs))
+	for _, sig := range sigs {
+		handlers[sig] = toggle
+	}
+
+	return onSignals(handlers)
+}
+
+// debugToggle returns a function switching the client to DebugLevel, or back to
+// the level it had before
+func (c *PCPClient) debugToggle() func() {
+	previous := c.Level()
+
+	return func() {
+		if l := c.Level(); l == DebugLevel {
+			_ = c.SetLevel(previous)
+		} else {
+			previous = l
+			_ = c.SetLevel(DebugLevel)
+		}
+	}
+}
+
+// onSignals calls the handler of every signal received, one at a time, until the
+// returned function is called
+func onSignals(handlers map[os.Signal]func()) (stop func()) {
+	sigs := make([]os.Signal, 0, len(handlers))
+	for sig := range handlers {
+		sigs = append(sigs, sig)
+	}
+
+	ch, done := make(chan os.Signal, 1), make(chan struct{})
+	signal.Notify(ch, sigs...)
+
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				handlers[sig]()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// LevelHandler returns a handler for an admin endpoint, returning the level of the
+// client on GET, and setting it to the level named in the body on PUT.
+func (c *PCPClient) LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(c.Level().String() + "\n"))
+		case http.MethodPut:
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64))
+			if err != nil {
+				http.Error(w, "cannot read the level: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			l, err := ParseMetricLevel(string(body))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			_ = c.SetLevel(l)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+			http.Error(w, "only GET and PUT are supported", http.StatusMethodNotAllowed)
+		}
+	})
+}
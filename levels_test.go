@@ -0,0 +1,125 @@
+package speed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	c, err := NewPCPClient("levels", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := c.MustRegisterString("app.errors", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	if err = errs.Apply(WithLevel(CriticalLevel)); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := c.MustRegisterString("app.requests", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+
+	queue := c.MustRegisterString("app.queue", int64(0), Int64Type, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+	if err = queue.Apply(WithLevel(DebugLevel)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = queue.Apply(WithLevel(MetricLevel(42))); err == nil {
+		t.Error("expected an error applying an invalid level")
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	exported := func() []string {
+		samples, err := c.Samples()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ans []string
+		for _, s := range samples {
+			ans = append(ans, s.Metric)
+		}
+		return ans
+	}
+
+	if c.Level() != NormalLevel {
+		t.Errorf("expected the default level to be normal, got %v", c.Level())
+	}
+
+	if e := strings.Join(exported(), ","); e != "app.errors,app.requests" {
+		t.Errorf("expected debug metrics not to be exported by default, got %v", e)
+	}
+
+	if err = c.SetLevel(CriticalLevel); err != nil {
+		t.Fatal(err)
+	}
+
+	requests.MustSet(int64(4))
+	if e := strings.Join(exported(), ","); e != "app.errors" {
+		t.Errorf("expected only critical metrics to be exported, got %v", e)
+	}
+
+	if err = c.SetLevel(DebugLevel); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.MustSet(int64(7))
+	samples, _ := c.Samples()
+	if len(samples) != 3 || samples[1].Value != int64(7) || samples[2].Value != int64(0) {
+		t.Errorf("expected all metrics, with only the enabled ones updated, got %v", samples)
+	}
+
+	if err = c.SetLevel(0); err == nil {
+		t.Error("expected an error setting an invalid level")
+	}
+}
+
+func TestParseMetricLevel(t *testing.T) {
+	for _, l := range []MetricLevel{CriticalLevel, NormalLevel, DebugLevel} {
+		if p, err := ParseMetricLevel(" " + strings.ToUpper(l.String()) + "\n"); err != nil || p != l {
+			t.Errorf("expected to parse %v, got %v, %v", l, p, err)
+		}
+	}
+
+	if _, err := ParseMetricLevel("verbose"); err == nil {
+		t.Error("expected an error parsing an unknown level")
+	}
+
+	if s := MetricLevel(7).String(); s != "MetricLevel(7)" {
+		t.Errorf("unexpected name of an invalid level %v", s)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	c, err := NewPCPClient("levels", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := c.LevelHandler()
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/level", strings.NewReader(body)))
+		return w
+	}
+
+	if w := serve(http.MethodGet, ""); w.Code != http.StatusOK || w.Body.String() != "normal\n" {
+		t.Errorf("expected the normal level, got %v %q", w.Code, w.Body.String())
+	}
+
+	if w := serve(http.MethodPut, "debug"); w.Code != http.StatusNoContent || c.Level() != DebugLevel {
+		t.Errorf("expected the level to be set to debug, got %v, %v", w.Code, c.Level())
+	}
+
+	if w := serve(http.MethodPut, "verbose"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown level to be rejected, got %v", w.Code)
+	}
+
+	if w := serve(http.MethodPost, "debug"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to be rejected, got %v", w.Code)
+	}
+}
@@ -0,0 +1,281 @@
+package speed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WeightedSemaphore defines the methods of a weighted semaphore,
+// which golang.org/x/sync/semaphore's *Weighted implements.
+type WeightedSemaphore interface {
+	Acquire(ctx context.Context, n int64) error
+	TryAcquire(n int64) bool
+	Release(n int64)
+}
+
+// TokenLimiter defines the methods of a token bucket rate limiter,
+// which golang.org/x/time/rate's *Limiter implements.
+type TokenLimiter interface {
+	Wait(ctx context.Context) error
+	Allow() bool
+	Burst() int
+}
+
+// SaturationMetrics exports the saturation of named semaphores and rate limiters,
+// exporting per limiter its capacity, the number of units currently acquired,
+// semaphores only, the number of goroutines currently waiting, the cumulative
+// time spent waiting in nanoseconds along with the number of waits, so PCP can
+// derive the average wait like with a LatencyPair, and the number of attempts
+// rejected by TryAcquire or Allow.
+//
+// The limiters have to be declared on construction, as instances cannot be added
+// once a mapping is active, and are then wrapped with Semaphore or Limiter.
+type SaturationMetrics struct {
+	mutex   sync.Mutex
+	inUse   map[string]int64
+	waiting map[string]int64
+	wrapped map[string]bool
+
+	capacity, acquired, waiters *PCPInstanceMetric
+	waitTime                    *PCPInstanceMetric
+	waits, rejected             *PCPCounterVector
+}
+
+// NewSaturationMetrics creates a new SaturationMetrics for the passed limiters,
+// with all metrics under the passed prefix.
+func NewSaturationMetrics(prefix string, limiters ...string) (*SaturationMetrics, error) {
+	if prefix == "" {
+		return nil, errors.New("saturation metrics prefix cannot be empty")
+	}
+
+	if len(limiters) == 0 {
+		return nil, errors.New("saturation metrics need at least one limiter")
+	}
+
+	indom, err := NewPCPInstanceDomain(prefix+".limiter.indom", limiters, "semaphores and rate limiters")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SaturationMetrics{
+		inUse:   make(map[string]int64, len(limiters)),
+		waiting: make(map[string]int64, len(limiters)),
+		wrapped: make(map[string]bool, len(limiters)),
+	}
+
+	newGauge := func(name, desc string) (*PCPInstanceMetric, error) {
+		return NewPCPInstanceMetric(
+			zeroInstances(limiters, int64(0)), prefix+"."+name,
+			indom, Int64Type, InstantSemantics, OneUnit, desc,
+		)
+	}
+
+	if s.capacity, err = newGauge("capacity", "capacity of the limiter"); err != nil {
+		return nil, err
+	}
+
+	if s.acquired, err = newGauge("in_use", "number of units acquired from the semaphore"); err != nil {
+		return nil, err
+	}
+
+	if s.waiters, err = newGauge("waiters", "number of goroutines waiting on the limiter"); err != nil {
+		return nil, err
+	}
+
+	if s.waitTime, err = NewPCPInstanceMetric(
+		zeroInstances(limiters, uint64(0)), prefix+".wait.time",
+		indom, Uint64Type, CounterSemantics, NanosecondUnit,
+		"cumulative time spent waiting on the limiter",
+	); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(limiters))
+	for _, l := range limiters {
+		counts[l] = 0
+	}
+
+	if s.waits, err = NewPCPCounterVector(counts, prefix+".wait.count", "number of waits on the limiter"); err != nil {
+		return nil, err
+	}
+
+	if s.rejected, err = NewPCPCounterVector(counts, prefix+".rejected", "number of attempts rejected by the limiter"); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Metrics returns all the metrics exported.
+func (s *SaturationMetrics) Metrics() []Metric {
+	return []Metric{s.capacity, s.acquired, s.waiters, s.waitTime, s.waits, s.rejected}
+}
+
+// Register registers all the metrics with the passed client.
+func (s *SaturationMetrics) Register(c Client) error {
+	for _, m := range s.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// wrap checks a limiter can be wrapped under a name, and records its capacity
+func (s *SaturationMetrics) wrap(name string, capacity int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.capacity.Indom().HasInstance(name) {
+		return errors.Errorf("%v is not a declared limiter", name)
+	}
+
+	if s.wrapped[name] {
+		return errors.Errorf("limiter %v is already wrapped", name)
+	}
+
+	if capacity <= 0 {
+		return errors.Errorf("capacity of limiter %v must be positive", name)
+	}
+
+	if err := s.capacity.SetInstance(capacity, name); err != nil {
+		return err
+	}
+
+	s.wrapped[name] = true
+	return nil
+}
+
+// wait records the start of a wait
+func (s *SaturationMetrics) wait(name string) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.waiting[name]++
+	_ = s.waiters.SetInstance(s.waiting[name], name)
+
+	return time.Now()
+}
+
+// waited records the end of a wait started at start
+func (s *SaturationMetrics) waited(name string, start time.Time) {
+	d := time.Since(start)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.waiting[name]--
+	_ = s.waiters.SetInstance(s.waiting[name], name)
+
+	t, _ := s.waitTime.ValInstance(name)
+	_ = s.waitTime.SetInstance(t.(uint64)+uint64(d), name)
+	_ = s.waits.Inc(1, name)
+}
+
+// use records n units being acquired, or released if n is negative
+func (s *SaturationMetrics) use(name string, n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.inUse[name] += n
+	_ = s.acquired.SetInstance(s.inUse[name], name)
+}
+
+// Semaphore wraps a semaphore with the passed capacity, recording it under name.
+func (s *SaturationMetrics) Semaphore(name string, capacity int64, sem WeightedSemaphore) (*InstrumentedSemaphore, error) {
+	if sem == nil {
+		return nil, errors.New("cannot wrap a nil semaphore")
+	}
+
+	if err := s.wrap(name, capacity); err != nil {
+		return nil, err
+	}
+
+	return &InstrumentedSemaphore{name: name, sem: sem, metrics: s}, nil
+}
+
+// Limiter wraps a rate limiter with its burst as capacity, recording it under name.
+func (s *SaturationMetrics) Limiter(name string, l TokenLimiter) (*InstrumentedLimiter, error) {
+	if l == nil {
+		return nil, errors.New("cannot wrap a nil limiter")
+	}
+
+	if err := s.wrap(name, int64(l.Burst())); err != nil {
+		return nil, err
+	}
+
+	return &InstrumentedLimiter{name: name, limiter: l, metrics: s}, nil
+}
+
+// InstrumentedSemaphore is a WeightedSemaphore recording its saturation.
+type InstrumentedSemaphore struct {
+	name    string
+	sem     WeightedSemaphore
+	metrics *SaturationMetrics
+}
+
+// Acquire acquires n units of the semaphore, blocking until they are available
+// or ctx is done, recording the time spent waiting.
+func (s *InstrumentedSemaphore) Acquire(ctx context.Context, n int64) error {
+	start := s.metrics.wait(s.name)
+	err := s.sem.Acquire(ctx, n)
+	s.metrics.waited(s.name, start)
+
+	if err != nil {
+		return err
+	}
+
+	s.metrics.use(s.name, n)
+	return nil
+}
+
+// TryAcquire acquires n units of the semaphore without blocking,
+// recording a rejection if they are not available.
+func (s *InstrumentedSemaphore) TryAcquire(n int64) bool {
+	if !s.sem.TryAcquire(n) {
+		_ = s.metrics.rejected.Inc(1, s.name)
+		return false
+	}
+
+	s.metrics.use(s.name, n)
+	return true
+}
+
+// Release releases n units of the semaphore.
+func (s *InstrumentedSemaphore) Release(n int64) {
+	s.metrics.use(s.name, -n)
+	s.sem.Release(n)
+}
+
+// InstrumentedLimiter is a TokenLimiter recording its saturation.
+type InstrumentedLimiter struct {
+	name    string
+	limiter TokenLimiter
+	metrics *SaturationMetrics
+}
+
+// Wait blocks until the limiter permits an event or ctx is done,
+// recording the time spent waiting.
+func (l *InstrumentedLimiter) Wait(ctx context.Context) error {
+	start := l.metrics.wait(l.name)
+	defer l.metrics.waited(l.name, start)
+
+	return l.limiter.Wait(ctx)
+}
+
+// Allow reports whether an event may happen now, recording a rejection if not.
+func (l *InstrumentedLimiter) Allow() bool {
+	if !l.limiter.Allow() {
+		_ = l.metrics.rejected.Inc(1, l.name)
+		return false
+	}
+
+	return true
+}
+
+// Burst returns the burst size of the limiter.
+func (l *InstrumentedLimiter) Burst() int { return l.limiter.Burst() }
@@ -0,0 +1,148 @@
+package speed
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testSemaphore is a WeightedSemaphore of capacity 2 acquiring a unit at a time
+type testSemaphore chan struct{}
+
+func (s testSemaphore) Acquire(ctx context.Context, n int64) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s testSemaphore) TryAcquire(n int64) bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s testSemaphore) Release(n int64) { <-s }
+
+type testLimiter struct{ tokens int }
+
+func (l *testLimiter) Wait(ctx context.Context) error {
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+func (l *testLimiter) Allow() bool {
+	if l.tokens == 0 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+func (l *testLimiter) Burst() int { return 5 }
+
+func TestSaturationMetrics(t *testing.T) {
+	s, err := NewSaturationMetrics("test.limits", "pool", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sem, err := s.Semaphore("pool", 2, make(testSemaphore, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Semaphore("pool", 2, make(testSemaphore, 2)); err == nil {
+		t.Error("expected an error wrapping a limiter twice")
+	}
+
+	if _, err = s.Semaphore("unknown", 2, make(testSemaphore, 2)); err == nil {
+		t.Error("expected an error wrapping an undeclared limiter")
+	}
+
+	l, err := s.Limiter("api", &testLimiter{tokens: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = sem.Acquire(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if !sem.TryAcquire(1) {
+		t.Fatal("expected to acquire the second unit")
+	}
+
+	if sem.TryAcquire(1) {
+		t.Fatal("expected the semaphore to be exhausted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = sem.Acquire(ctx, 1); err == nil {
+		t.Fatal("expected acquiring an exhausted semaphore to time out")
+	}
+
+	if v, _ := s.acquired.ValInstance("pool"); v.(int64) != 2 {
+		t.Errorf("expected 2 units in use, got %v", v)
+	}
+
+	sem.Release(1)
+	if v, _ := s.acquired.ValInstance("pool"); v.(int64) != 1 {
+		t.Errorf("expected 1 unit in use, got %v", v)
+	}
+
+	if v, _ := s.waits.Val("pool"); v != 2 {
+		t.Errorf("expected 2 waits, got %v", v)
+	}
+
+	if v, _ := s.waitTime.ValInstance("pool"); v.(uint64) < uint64(10*time.Millisecond) {
+		t.Errorf("expected at least 10ms spent waiting, got %v", v)
+	}
+
+	if v, _ := s.waiters.ValInstance("pool"); v.(int64) != 0 {
+		t.Errorf("expected no waiters, got %v", v)
+	}
+
+	if v, _ := s.rejected.Val("pool"); v != 1 {
+		t.Errorf("expected 1 rejection, got %v", v)
+	}
+
+	if err = l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !l.Allow() || l.Allow() {
+		t.Error("expected the limiter to allow a single event")
+	}
+
+	if v, _ := s.capacity.ValInstance("api"); v.(int64) != 5 {
+		t.Errorf("expected a capacity of 5, got %v", v)
+	}
+
+	if v, _ := s.rejected.Val("api"); v != 1 {
+		t.Errorf("expected 1 rejection, got %v", v)
+	}
+
+	if v, _ := s.waitTime.ValInstance("api"); v.(uint64) < uint64(time.Millisecond) {
+		t.Errorf("expected at least 1ms spent waiting, got %v", v)
+	}
+}
@@ -0,0 +1,81 @@
+package speed
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Capacity limits of the MMV format, as read by pmdammv.
+const (
+	// MaxMetrics is the maximum number of metrics in an MMV file,
+	// as pmdammv exports them with PCPMetricItemBitLength bit item ids
+	MaxMetrics = 1 << PCPMetricItemBitLength
+
+	// MaxInstanceDomains is the maximum number of instance domains in an MMV file,
+	// as instance domain ids have PCPInstanceDomainBitLength bits
+	MaxInstanceDomains = 1 << PCPInstanceDomainBitLength
+
+	// MaxInstances is the maximum number of instances in an MMV file,
+	// as the counts of the sections of an MMV file are 32 bit integers
+	MaxInstances = math.MaxInt32
+
+	// MaxValues is the maximum number of values in an MMV file
+	MaxValues = math.MaxInt32
+
+	// MaxFileSize is the default maximum size of an MMV file, the largest
+	// file that can be mapped on all platforms, see WithMaxFileSize
+	MaxFileSize = math.MaxInt32
+)
+
+// LimitError is returned when adding to a registry or mapping a client would
+// exceed a capacity limit of the MMV format.
+type LimitError struct {
+	Limit     string // the exceeded limit, for example "metrics"
+	Max       int    // the maximum allowed
+	Requested int    // the number that would be needed
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v would exceed the limit of the MMV format, %v needed, at most %v allowed", e.Limit, e.Requested, e.Max)
+}
+
+// Capacity is the number of metrics, instance domains, instances and values
+// that can still be added to a registry.
+type Capacity struct {
+	Metrics, InstanceDomains, Instances, Values int
+}
+
+// RemainingCapacity returns how much can still be added to the registry.
+func (r *PCPRegistry) RemainingCapacity() Capacity {
+	return Capacity{
+		Metrics:         MaxMetrics - r.MetricCount(),
+		InstanceDomains: MaxInstanceDomains - r.InstanceDomainCount(),
+		Instances:       MaxInstances - r.InstanceCount(),
+		Values:          MaxValues - r.ValuesCount(),
+	}
+}
+
+// checkLimit returns a LimitError if count plus n exceeds max
+func checkLimit(limit string, count, n, max int) error {
+	if n > max-count {
+		return &LimitError{Limit: limit, Max: max, Requested: count + n}
+	}
+
+	return nil
+}
+
+// WithMaxFileSize limits the size of the MMV file of the client, so Start fails
+// with a LimitError rather than creating a file monitors cannot map, for example
+// on memory constrained hosts. The default, and the maximum, is MaxFileSize.
+func WithMaxFileSize(n int) ClientOption {
+	return func(c *PCPClient) error {
+		if n < HeaderLength || n > MaxFileSize {
+			return errors.Errorf("maximum file size must be between %v and %v, got %v", HeaderLength, MaxFileSize, n)
+		}
+
+		c.maxFileSize = n
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package speed
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMetricLimit(t *testing.T) {
+	r := NewPCPRegistry()
+
+	for i := 0; i < MaxMetrics; i++ {
+		m, err := NewPCPCounter(0, fmt.Sprintf("test.m%v", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = r.AddMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if c := r.RemainingCapacity(); c.Metrics != 0 || c.Values != MaxValues-MaxMetrics {
+		t.Errorf("unexpected remaining capacity %+v", c)
+	}
+
+	m, err := NewPCPCounter(0, "test.one_too_many")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.AddMetric(m)
+	lerr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("expected a LimitError, got %v", err)
+	}
+
+	if lerr.Limit != "metrics" || lerr.Max != MaxMetrics || lerr.Requested != MaxMetrics+1 {
+		t.Errorf("unexpected limit error %+v", lerr)
+	}
+
+	if r.HasMetric("test.one_too_many") {
+		t.Error("expected the metric not to be added")
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	if _, err := NewPCPClient("test", WithMaxFileSize(1)); err == nil {
+		t.Error("expected an error for a maximum file size smaller than the header")
+	}
+
+	c, err := NewPCPClient("test", WithMaxFileSize(HeaderLength+TocLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.a", 1, Int32Type, InstantSemantics, OneUnit)
+
+	err = c.Start()
+	if _, ok := err.(*LimitError); !ok {
+		t.Fatalf("expected a LimitError starting a client larger than its maximum file size, got %v", err)
+	}
+
+	c, err = NewPCPClient("test", WithMaxFileSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.a", 1, Int32Type, InstantSemantics, OneUnit)
+	c.MustStart()
+	c.MustStop()
+}
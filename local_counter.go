@@ -0,0 +1,121 @@
+package speed
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LocalCounter is a goroutine local handle to a shared Counter.
+//
+// Increments on a LocalCounter are plain integer additions with no synchronization,
+// so a LocalCounter **must not** be shared between goroutines. The accumulated delta
+// is added to the shared counter on Merge.
+type LocalCounter struct {
+	c     Counter
+	delta int64
+}
+
+// NewLocalCounter creates a new LocalCounter for the passed Counter.
+func NewLocalCounter(c Counter) *LocalCounter {
+	return &LocalCounter{c: c}
+}
+
+// Inc increments the local delta, negative increments are ignored.
+func (l *LocalCounter) Inc(val int64) {
+	if val > 0 {
+		l.delta += val
+	}
+}
+
+// Up increments the local delta by 1.
+func (l *LocalCounter) Up() { l.delta++ }
+
+// Pending returns the delta accumulated since the last merge.
+func (l *LocalCounter) Pending() int64 { return l.delta }
+
+// Merge adds the accumulated delta to the shared counter and resets it.
+func (l *LocalCounter) Merge() error {
+	if l.delta == 0 {
+		return nil
+	}
+
+	if err := l.c.Inc(l.delta); err != nil {
+		return err
+	}
+
+	l.delta = 0
+	return nil
+}
+
+// LocalCounterMerger periodically merges a set of local counters into their shared
+// counters. Local counters are only read by the merger in between calls to Run,
+// so increments stay synchronization free.
+//
+// A goroutine owning local counters calls Run in its loop, which merges all its
+// counters once a ticker marks the merge interval as elapsed. Run only does an
+// atomic load otherwise, it neither locks nor reads the clock.
+type LocalCounterMerger struct {
+	due      int32 // set by the ticker once the merge interval elapsed
+	counters []*LocalCounter
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewLocalCounterMerger creates a new merger that merges at the passed interval.
+// Its ticker runs until Flush is called.
+func NewLocalCounterMerger(interval time.Duration, counters ...*LocalCounter) (*LocalCounterMerger, error) {
+	if interval <= 0 {
+		return nil, errors.New("merge interval must be positive")
+	}
+
+	m := &LocalCounterMerger{counters: counters, stop: make(chan struct{})}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				atomic.StoreInt32(&m.due, 1)
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	return m, nil
+}
+
+// Run merges all counters if the merge interval has elapsed,
+// returning whether a merge happened.
+func (m *LocalCounterMerger) Run() (bool, error) {
+	if atomic.LoadInt32(&m.due) == 0 {
+		return false, nil
+	}
+
+	atomic.StoreInt32(&m.due, 0)
+	return true, m.merge()
+}
+
+// Flush merges all counters regardless of the interval and stops the ticker,
+// it is meant to be called by the owning goroutine before it exits.
+func (m *LocalCounterMerger) Flush() error {
+	m.once.Do(func() { close(m.stop) })
+
+	atomic.StoreInt32(&m.due, 0)
+	return m.merge()
+}
+
+func (m *LocalCounterMerger) merge() error {
+	for _, c := range m.counters {
+		if err := c.Merge(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
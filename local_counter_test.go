@@ -0,0 +1,157 @@
+package speed
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalCounter(t *testing.T) {
+	c, err := NewPCPCounter(0, "test.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer wg.Done()
+
+			l := NewLocalCounter(c)
+			m, err := NewLocalCounterMerger(time.Millisecond, l)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			for j := 0; j < 1000; j++ {
+				l.Up()
+				if _, err := m.Run(); err != nil {
+					t.Error(err)
+				}
+			}
+
+			if err := m.Flush(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if c.Val() != 4000 {
+		t.Errorf("expected the shared counter to be 4000, got %v", c.Val())
+	}
+}
+
+func TestLocalCounterMerge(t *testing.T) {
+	c, err := NewPCPCounter(0, "test.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLocalCounter(c)
+	l.Inc(5)
+	l.Inc(-3)
+
+	if l.Pending() != 5 {
+		t.Errorf("expected 5 pending, got %v", l.Pending())
+	}
+
+	if c.Val() != 0 {
+		t.Error("expected the shared counter to be untouched before a merge")
+	}
+
+	if err = l.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Val() != 5 || l.Pending() != 0 {
+		t.Errorf("expected 5 merged and nothing pending, got %v and %v", c.Val(), l.Pending())
+	}
+
+	if _, err = NewLocalCounterMerger(0); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
+
+func TestLocalCounterMergerTicker(t *testing.T) {
+	c, err := NewPCPCounter(0, "test.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLocalCounter(c)
+	l.Up()
+
+	// nothing is merged until the ticker marks the interval as elapsed
+	idle, err := NewLocalCounterMerger(time.Hour, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged, err := idle.Run(); merged || err != nil || c.Val() != 0 {
+		t.Errorf("expected no merge before the first tick, got %v, %v", merged, err)
+	}
+
+	m, err := NewLocalCounterMerger(time.Millisecond, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		merged, err := m.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if merged {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if c.Val() != 1 || l.Pending() != 0 {
+		t.Errorf("expected the tick to merge 1, got %v with %v pending", c.Val(), l.Pending())
+	}
+
+	l.Inc(2)
+	if err = m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Val() != 3 {
+		t.Errorf("expected flushing to merge 2 more, got %v", c.Val())
+	}
+
+	// flushing again after the ticker stopped is fine
+	if err = m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = idle.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkLocalCounterMergerRun(b *testing.B) {
+	c, err := NewPCPCounter(0, "test.local")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	l := NewLocalCounter(c)
+	m, err := NewLocalCounterMerger(time.Millisecond, l)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer m.Flush()
+
+	for i := 0; i < b.N; i++ {
+		l.Up()
+		_, _ = m.Run()
+	}
+}
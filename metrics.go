@@ -5,6 +5,7 @@ import (
 	"math"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	histogram "github.com/codahale/hdrhistogram"
@@ -62,9 +63,27 @@ func (m MetricType) isCompatibleFloat(val float64) bool {
 	}
 }
 
+// widen converts 8 and 16 bit integers to int and uint,
+// so they can be resolved like untyped integer constants.
+func widen(val interface{}) interface{} {
+	switch v := val.(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case uint8:
+		return uint(v)
+	case uint16:
+		return uint(v)
+	}
+	return val
+}
+
 // IsCompatible checks if the passed value is compatible with the current MetricType.
+//
+// 8 and 16 bit integers are compatible with any integer type that can hold their value.
 func (m MetricType) IsCompatible(val interface{}) bool {
-	switch v := val.(type) {
+	switch v := widen(val).(type) {
 	case int:
 		return m.isCompatibleInt(v)
 	case int32:
@@ -122,7 +141,7 @@ func (m MetricType) resolveFloat(val interface{}) interface{} {
 }
 
 func (m MetricType) resolve(val interface{}) interface{} {
-	val = m.resolveInt(val)
+	val = m.resolveInt(widen(val))
 	val = m.resolveFloat(val)
 
 	return val
@@ -169,7 +188,8 @@ func (m *metricUnit) Space(s SpaceUnit, dimension int8) MetricUnit {
 		panic("dimension has to be between -8 and 7 inclusive")
 	}
 
-	m.repr |= uint32(s)
+	// the unit constants carry a dimension of 1, which is replaced by the passed one
+	m.repr |= uint32(s) &^ (0xF << 28)
 	m.repr |= (uint32(dimension) & 0xF) << 28
 	return m
 }
@@ -180,7 +200,7 @@ func (m *metricUnit) Time(t TimeUnit, dimension int8) MetricUnit {
 		panic("dimension has to be between -8 and 7 inclusive")
 	}
 
-	m.repr |= uint32(t)
+	m.repr |= uint32(t) &^ (0xF << 24)
 	m.repr |= (uint32(dimension) & 0xF) << 24
 	return m
 }
@@ -191,7 +211,7 @@ func (m *metricUnit) Count(c CountUnit, dimension int8) MetricUnit {
 		panic("dimension has to be between -8 and 7 inclusive")
 	}
 
-	m.repr |= uint32(c)
+	m.repr |= uint32(c) &^ (0xF << 20)
 	m.repr |= (uint32(dimension) & 0xF) << 20
 	return m
 }
@@ -467,12 +487,32 @@ const PCPMetricItemBitLength = 10
 //
 // when writing, this type is supposed to map directly to the pmDesc struct as defined in PCP core.
 type pcpMetricDesc struct {
+	callbackGoroutine                 int64           // see callback, first for the alignment of atomic operations
 	id                                uint32          // unique metric id
 	name                              string          // the name
 	t                                 MetricType      // the type of a metric
 	sem                               MetricSemantics // the semantics
 	u                                 MetricUnit      // the unit
+	coercion                          CoercionPolicy  // how values passed to Set are converted
 	shortDescription, longDescription string
+	history                           *historyRing // optional value history
+	epoch                             *PCPSingletonMetric
+	dropped                           *PCPCounter // counts updates dropped by TrySet
+	ttl                               *ttlTracker // optional staleness tracking
+	offset                            int         // offset of the metric in the MMV file, once written
+	panicHandler                      func(error) // handles failures of Must methods instead of panicking
+	companions                        []PCPMetric // registered along with the metric
+	noInitialValue                    bool        // see WithNoInitialValue
+	level                             MetricLevel // see WithLevel, 0 for NormalLevel
+	commitMutex                       *sync.Mutex // serializes the commits of batches mutating the metric
+	registered                        int32       // 1 once registered with a client, accessed atomically
+
+	rollup         *rollupTracker            // optional aggregates of all instances
+	weighted       *weightedAverage          // optional weighted average of all instances
+	weighting      []*weightedAverage        // weighted averages of other metrics this metric weights
+	instanceValues map[string]*instanceValue // values of an instance metric, nil for singletons
+
+	lazyStart atomic.Value // holds a lazyStart, see prepare
 }
 
 // newpcpMetricDesc creates a new Metric Description wrapper type.
@@ -500,9 +540,14 @@ func newpcpMetricDesc(n string, t MetricType, s MetricSemantics, u MetricUnit, d
 	}
 
 	return &pcpMetricDesc{
-		hash(n, PCPMetricItemBitLength),
-		n, t, s, u,
-		shortdesc, longdesc,
+		id:               hash(n, PCPMetricItemBitLength),
+		name:             n,
+		t:                t,
+		sem:              s,
+		u:                u,
+		shortDescription: shortdesc,
+		longDescription:  longdesc,
+		commitMutex:      new(sync.Mutex),
 	}, nil
 }
 
@@ -534,6 +579,50 @@ func (md *pcpMetricDesc) Description() string {
 	return md.shortDescription + "\n" + md.longDescription
 }
 
+func (md *pcpMetricDesc) desc() *pcpMetricDesc { return md }
+
+// describedMetric is implemented by all metrics embedding a pcpMetricDesc
+type describedMetric interface {
+	desc() *pcpMetricDesc
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// boundMetric is a metric whose values are written to its client through
+// update closures, that are replaced when the client is started or stopped.
+type boundMetric interface {
+	// drops the update closures when the client is stopped
+	detach()
+}
+
+// lazyStart maps a lazily started client that is not mapped yet, nil once it is
+type lazyStart struct {
+	start func() error
+}
+
+// setLazyStart sets the function mapping the client of the metric on its next
+// update, or clears it when passed nil
+func (md *pcpMetricDesc) setLazyStart(start func() error) {
+	md.lazyStart.Store(lazyStart{start})
+}
+
+// prepare has to be called by updates before locking the metric. Like reentrant, it
+// fails updates from callbacks of updates of the metric, and it maps the client of the
+// metric if it was started lazily, which locks all its metrics one by one, so it cannot
+// happen under the lock of one of them. Values set while the client is not mapped are
+// kept in memory, and written when it is.
+func (md *pcpMetricDesc) prepare() error {
+	if err := md.reentrant(); err != nil {
+		return err
+	}
+
+	if l, ok := md.lazyStart.Load().(lazyStart); ok && l.start != nil {
+		return l.start()
+	}
+
+	return nil
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 // updateClosure is a closure that will write the modified value of a metric on disk.
@@ -542,10 +631,6 @@ type updateClosure func(interface{}) error
 // newupdateClosure creates a new update closure for an offset, type and buffer.
 func newupdateClosure(offset int, writer bytewriter.Writer) updateClosure {
 	return func(val interface{}) error {
-		if _, isString := val.(string); isString {
-			writer.MustWrite(make([]byte, StringLength), offset)
-		}
-
 		_, err := writer.WriteVal(val, offset)
 		return err
 	}
@@ -556,8 +641,10 @@ func newupdateClosure(offset int, writer bytewriter.Writer) updateClosure {
 // pcpSingletonMetric defines an embeddable base singleton metric.
 type pcpSingletonMetric struct {
 	*pcpMetricDesc
-	val    interface{}
-	update updateClosure
+	val      interface{}
+	update   updateClosure
+	offset   int  // offset of the value in the MMV file, once written
+	assigned bool // set since registration, see WithNoInitialValue
 }
 
 // newpcpSingletonMetric creates a new instance of pcpSingletonMetric.
@@ -567,18 +654,17 @@ func newpcpSingletonMetric(val interface{}, desc *pcpMetricDesc) (*pcpSingletonM
 	}
 
 	val = desc.t.resolve(val)
-	return &pcpSingletonMetric{desc, val, nil}, nil
+	return &pcpSingletonMetric{desc, val, nil, 0, false}, nil
 }
 
 // set Sets the current value of pcpSingletonMetric.
 func (m *pcpSingletonMetric) set(val interface{}) error {
-	if !m.t.IsCompatible(val) {
-		return errors.Errorf("value %v is incompatible with MetricType %v", val, m.t)
+	val, err := m.coerce(val)
+	if err != nil {
+		return err
 	}
 
-	val = m.t.resolve(val)
-
-	if val != m.val {
+	if val != m.val || m.unassigned() {
 		if m.update != nil {
 			err := m.update(val)
 			if err != nil {
@@ -586,13 +672,18 @@ func (m *pcpSingletonMetric) set(val interface{}) error {
 			}
 		}
 		m.val = val
+		m.assigned = true
 	}
 
+	m.recordHistory("", val)
+	m.touch("")
 	return nil
 }
 
 func (m *pcpSingletonMetric) Indom() *PCPInstanceDomain { return nil }
 
+func (m *pcpSingletonMetric) detach() { m.update = nil }
+
 ///////////////////////////////////////////////////////////////////////////////
 
 // PCPSingletonMetric defines a singleton metric with no instance domain
@@ -629,6 +720,10 @@ func (m *PCPSingletonMetric) Val() interface{} {
 
 // Set Sets the current value of PCPSingletonMetric.
 func (m *PCPSingletonMetric) Set(val interface{}) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -638,14 +733,10 @@ func (m *PCPSingletonMetric) Set(val interface{}) error {
 // MustSet is a Set that panics on failure.
 func (m *PCPSingletonMetric) MustSet(val interface{}) {
 	if err := m.Set(val); err != nil {
-		panic(err)
+		m.fail(err)
 	}
 }
 
-func (m *PCPSingletonMetric) String() string {
-	return fmt.Sprintf("Val: %v\n%v", m.val, m.Description())
-}
-
 ///////////////////////////////////////////////////////////////////////////////
 
 // Counter defines a metric that holds a single value that can only be incremented.
@@ -699,6 +790,10 @@ func (c *PCPCounter) Val() int64 {
 
 // Set sets the value of the counter.
 func (c *PCPCounter) Set(val int64) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -713,14 +808,22 @@ func (c *PCPCounter) Set(val int64) error {
 
 // Inc increases the stored counter's value by the passed increment.
 func (c *PCPCounter) Inc(val int64) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	return c.inc(val)
+}
+
+func (c *PCPCounter) inc(val int64) error {
 	if val < 0 {
 		return errors.New("cannot decrement a counter")
 	}
 
-	if val == 0 {
+	if val == 0 && !c.unassigned() {
 		return nil
 	}
 
@@ -732,7 +835,7 @@ func (c *PCPCounter) Inc(val int64) error {
 // MustInc is Inc that panics on failure.
 func (c *PCPCounter) MustInc(val int64) {
 	if err := c.Inc(val); err != nil {
-		panic(err)
+		c.fail(err)
 	}
 }
 
@@ -795,6 +898,10 @@ func (g *PCPGauge) Val() float64 {
 
 // Set sets the current value of the Gauge.
 func (g *PCPGauge) Set(val float64) error {
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 	return g.set(val)
@@ -803,12 +910,16 @@ func (g *PCPGauge) Set(val float64) error {
 // MustSet will panic if Set fails.
 func (g *PCPGauge) MustSet(val float64) {
 	if err := g.Set(val); err != nil {
-		panic(err)
+		g.fail(err)
 	}
 }
 
 // Inc adds a value to the existing Gauge value.
 func (g *PCPGauge) Inc(val float64) error {
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
@@ -823,7 +934,7 @@ func (g *PCPGauge) Inc(val float64) error {
 // MustInc will panic if Inc fails.
 func (g *PCPGauge) MustInc(val float64) {
 	if err := g.Inc(val); err != nil {
-		panic(err)
+		g.fail(err)
 	}
 }
 
@@ -835,7 +946,7 @@ func (g *PCPGauge) Dec(val float64) error {
 // MustDec will panic if Dec fails.
 func (g *PCPGauge) MustDec(val float64) {
 	if err := g.Dec(val); err != nil {
-		panic(err)
+		g.fail(err)
 	}
 }
 
@@ -883,6 +994,10 @@ func NewPCPTimer(name string, unit TimeUnit, desc ...string) (*PCPTimer, error)
 
 // Reset resets the timer to 0
 func (t *PCPTimer) Reset() error {
+	if err := t.prepare(); err != nil {
+		return err
+	}
+
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -890,11 +1005,19 @@ func (t *PCPTimer) Reset() error {
 		return errors.New("trying to reset an already started timer")
 	}
 
-	return t.set(float64(0))
+	if err := t.set(float64(0)); err != nil {
+		return err
+	}
+
+	return t.bumpEpoch()
 }
 
 // Start signals the timer to start monitoring.
 func (t *PCPTimer) Start() error {
+	if err := t.prepare(); err != nil {
+		return err
+	}
+
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -909,6 +1032,10 @@ func (t *PCPTimer) Start() error {
 
 // Stop signals the timer to end monitoring and return elapsed time so far.
 func (t *PCPTimer) Stop() (float64, error) {
+	if err := t.prepare(); err != nil {
+		return 0, err
+	}
+
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -916,7 +1043,32 @@ func (t *PCPTimer) Stop() (float64, error) {
 		return 0, errors.New("trying to stop a stopped timer")
 	}
 
-	d := time.Since(t.since)
+	v, err := t.add(time.Since(t.since))
+	if err != nil {
+		return -1, err
+	}
+
+	t.started = false
+	return v, nil
+}
+
+// Add adds a duration measured elsewhere to the timer, for example, by concurrent
+// operations that cannot share the timer's Start and Stop, and returns the new value.
+func (t *PCPTimer) Add(d time.Duration) (float64, error) {
+	if err := t.prepare(); err != nil {
+		return 0, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.add(d)
+}
+
+func (t *PCPTimer) add(d time.Duration) (float64, error) {
+	if d < 0 {
+		return -1, errors.Errorf("cannot add a negative duration %v", d)
+	}
 
 	var inc float64
 	switch t.pcpMetricDesc.Unit() {
@@ -941,19 +1093,20 @@ func (t *PCPTimer) Stop() (float64, error) {
 		return -1, err
 	}
 
-	t.started = false
 	return v + inc, nil
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
 type instanceValue struct {
-	val    interface{}
-	update updateClosure
+	val      interface{}
+	update   updateClosure
+	offset   int  // offset of the value in the MMV file, once written
+	assigned bool // set since registration, see WithNoInitialValue
 }
 
 func newinstanceValue(val interface{}) *instanceValue {
-	return &instanceValue{val, nil}
+	return &instanceValue{val, nil, 0, false}
 }
 
 // pcpInstanceMetric represents a PCPMetric that can have multiple values
@@ -972,7 +1125,7 @@ func newpcpInstanceMetric(vals Instances, indom *PCPInstanceDomain, desc *pcpMet
 
 	mvals := make(map[string]*instanceValue)
 
-	for name := range indom.instances {
+	for _, name := range indom.Instances() {
 		val, present := vals[name]
 		if !present {
 			return nil, errors.Errorf("Instance %v not initialized", name)
@@ -986,6 +1139,7 @@ func newpcpInstanceMetric(vals Instances, indom *PCPInstanceDomain, desc *pcpMet
 		mvals[name] = newinstanceValue(val)
 	}
 
+	desc.instanceValues = mvals
 	return &pcpInstanceMetric{desc, indom, mvals}, nil
 }
 
@@ -999,33 +1153,55 @@ func (m *pcpInstanceMetric) valInstance(instance string) (interface{}, error) {
 
 // setInstance sets the value for a particular instance of the metric.
 func (m *pcpInstanceMetric) setInstance(val interface{}, instance string) error {
-	if !m.t.IsCompatible(val) {
-		return errors.New("the value is incompatible with this metrics MetricType")
+	val, err := m.coerce(val)
+	if err != nil {
+		return err
 	}
 
 	if !m.indom.HasInstance(instance) {
 		return errors.Errorf("%v is not an instance of this metric", instance)
 	}
 
-	val = m.t.resolve(val)
-
-	if m.vals[instance].val != val {
-		if m.vals[instance].update != nil {
-			err := m.vals[instance].update(val)
+	v := m.vals[instance]
+	if v.val != val || (m.noInitialValue && !v.assigned) {
+		if v.update != nil {
+			err := v.update(val)
 			if err != nil {
 				return err
 			}
 		}
 
-		m.vals[instance].val = val
+		old := v.val
+		v.val = val
+		v.assigned = true
+
+		if m.rollup != nil {
+			m.rollup.update(old, val)
+		}
+
+		if m.weighted != nil {
+			m.weighted.setValue(instance, val)
+		}
+
+		for _, a := range m.weighting {
+			a.setWeight(instance, val)
+		}
 	}
 
+	m.recordHistory(instance, val)
+	m.touch(instance)
 	return nil
 }
 
 // Indom returns the instance domain for the metric.
 func (m *pcpInstanceMetric) Indom() *PCPInstanceDomain { return m.indom }
 
+func (m *pcpInstanceMetric) detach() {
+	for _, v := range m.vals {
+		v.update = nil
+	}
+}
+
 // Instances returns a slice containing all instances in the InstanceMetric.
 // Basically a shorthand for metric.Indom().Instances().
 func (m *pcpInstanceMetric) Instances() []string { return m.indom.Instances() }
@@ -1066,6 +1242,10 @@ func (m *PCPInstanceMetric) ValInstance(instance string) (interface{}, error) {
 
 // SetInstance sets the value for a particular instance of the metric.
 func (m *PCPInstanceMetric) SetInstance(val interface{}, instance string) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -1075,7 +1255,7 @@ func (m *PCPInstanceMetric) SetInstance(val interface{}, instance string) error
 // MustSetInstance is a SetInstance that panics.
 func (m *PCPInstanceMetric) MustSetInstance(val interface{}, instance string) {
 	if err := m.SetInstance(val, instance); err != nil {
-		panic(err)
+		m.fail(err)
 	}
 }
 
@@ -1156,6 +1336,10 @@ func (c *PCPCounterVector) Val(instance string) (int64, error) {
 
 // Set sets the value of a particular instance of PCPCounterVector.
 func (c *PCPCounterVector) Set(val int64, instance string) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -1174,19 +1358,23 @@ func (c *PCPCounterVector) Set(val int64, instance string) error {
 // MustSet panics if Set fails.
 func (c *PCPCounterVector) MustSet(val int64, instance string) {
 	if err := c.Set(val, instance); err != nil {
-		panic(err)
+		c.fail(err)
 	}
 }
 
 // SetAll sets all instances to the same value and panics on an error.
 func (c *PCPCounterVector) SetAll(val int64) {
-	for ins := range c.indom.instances {
+	for _, ins := range c.indom.Instances() {
 		c.MustSet(val, ins)
 	}
 }
 
 // Inc increments the value of a particular instance of PCPCounterVector.
 func (c *PCPCounterVector) Inc(inc int64, instance string) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -1209,13 +1397,13 @@ func (c *PCPCounterVector) Inc(inc int64, instance string) error {
 // MustInc panics if Inc fails.
 func (c *PCPCounterVector) MustInc(inc int64, instance string) {
 	if err := c.Inc(inc, instance); err != nil {
-		panic(err)
+		c.fail(err)
 	}
 }
 
 // IncAll increments all instances by the same value and panics on an error.
 func (c *PCPCounterVector) IncAll(val int64) {
-	for ins := range c.indom.instances {
+	for _, ins := range c.indom.Instances() {
 		c.MustInc(val, ins)
 	}
 }
@@ -1288,6 +1476,10 @@ func (g *PCPGaugeVector) Val(instance string) (float64, error) {
 
 // Set sets the value of a particular instance of PCPGaugeVector
 func (g *PCPGaugeVector) Set(val float64, instance string) error {
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 	return g.setInstance(val, instance)
@@ -1296,19 +1488,23 @@ func (g *PCPGaugeVector) Set(val float64, instance string) error {
 // MustSet panics if Set fails
 func (g *PCPGaugeVector) MustSet(val float64, instance string) {
 	if err := g.Set(val, instance); err != nil {
-		panic(err)
+		g.fail(err)
 	}
 }
 
 // SetAll sets all instances to the same value and panics on an error
 func (g *PCPGaugeVector) SetAll(val float64) {
-	for ins := range g.indom.instances {
+	for _, ins := range g.indom.Instances() {
 		g.MustSet(val, ins)
 	}
 }
 
 // Inc increments the value of a particular instance of PCPGaugeVector
 func (g *PCPGaugeVector) Inc(inc float64, instance string) error {
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
@@ -1323,13 +1519,13 @@ func (g *PCPGaugeVector) Inc(inc float64, instance string) error {
 // MustInc panics if Inc fails
 func (g *PCPGaugeVector) MustInc(inc float64, instance string) {
 	if err := g.Inc(inc, instance); err != nil {
-		panic(err)
+		g.fail(err)
 	}
 }
 
 // IncAll increments all instances by the same value and panics on an error
 func (g *PCPGaugeVector) IncAll(val float64) {
-	for ins := range g.indom.instances {
+	for _, ins := range g.indom.Instances() {
 		g.MustInc(val, ins)
 	}
 }
@@ -1372,7 +1568,7 @@ type Histogram interface {
 type PCPHistogram struct {
 	*pcpInstanceMetric
 	mutex sync.RWMutex
-	h     *histogram.Histogram
+	h     histogramBackend
 }
 
 // the maximum and minimum values that can be recorded by a histogram
@@ -1424,19 +1620,54 @@ func NewPCPHistogram(name string, low, high int64, sigfigures int, unit MetricUn
 
 	low, high, sigfigures = normalize(low, high, sigfigures)
 
-	h := histogram.New(low, high, sigfigures)
+	return newPCPHistogram(name, histogram.New(low, high, sigfigures), unit, desc...)
+}
+
+// DefaultTDigestCompression is a compression for a t-digest backed histogram
+// that keeps quantile errors within a fraction of a percent.
+const DefaultTDigestCompression = 100
+
+// NewPCPTDigestHistogram returns a new instance of PCPHistogram backed by a t-digest
+// instead of a HDR histogram.
+// A t-digest keeps a bounded number of centroids, controlled by `compression`,
+// so memory stays constant for long tailed distributions while
+// high quantiles stay accurate, at the cost of approximate results.
+// `low` and `high` are normalized the same way as in NewPCPHistogram.
+func NewPCPTDigestHistogram(name string, low, high int64, compression float64, unit MetricUnit, desc ...string) (*PCPHistogram, error) {
+	if low > high {
+		return nil, errors.New("low cannot be larger than high")
+	}
+
+	if compression < 10 {
+		return nil, errors.New("t-digest compression cannot be less than 10")
+	}
+
+	low, high, _ = normalize(low, high, 1)
+
+	return newPCPHistogram(name, newtdigest(low, high, compression), unit, desc...)
+}
 
+var histogramInstances = []string{"min", "max", "mean", "variance", "standard_deviation"}
+
+func newPCPHistogram(name string, h histogramBackend, unit MetricUnit, desc ...string) (*PCPHistogram, error) {
 	vals := make(Instances)
 	for _, s := range histogramInstances {
 		vals[s] = float64(0)
 	}
 
+	// every histogram gets its own copy of the indom, a registry
+	// only writes the first one it sees for all its histograms
+	indom, err := NewPCPInstanceDomain("histogram", histogramInstances)
+	if err != nil {
+		return nil, err
+	}
+
 	d, err := newpcpMetricDesc(name, DoubleType, InstantSemantics, unit, desc...)
 	if err != nil {
 		return nil, err
 	}
 
-	m, err := newpcpInstanceMetric(vals, histogramIndom, d)
+	m, err := newpcpInstanceMetric(vals, indom, d)
 	if err != nil {
 		return nil, err
 	}
@@ -1499,6 +1730,10 @@ func (h *PCPHistogram) update() error {
 
 // Record records a new value.
 func (h *PCPHistogram) Record(val int64) error {
+	if err := h.prepare(); err != nil {
+		return err
+	}
+
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
@@ -1513,12 +1748,16 @@ func (h *PCPHistogram) Record(val int64) error {
 // MustRecord panics if Record fails.
 func (h *PCPHistogram) MustRecord(val int64) {
 	if err := h.Record(val); err != nil {
-		panic(err)
+		h.fail(err)
 	}
 }
 
 // RecordN records multiple instances of the same value.
 func (h *PCPHistogram) RecordN(val, n int64) error {
+	if err := h.prepare(); err != nil {
+		return err
+	}
+
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
@@ -1533,7 +1772,7 @@ func (h *PCPHistogram) RecordN(val, n int64) error {
 // MustRecordN panics if RecordN fails.
 func (h *PCPHistogram) MustRecordN(val, n int64) {
 	if err := h.RecordN(val, n); err != nil {
-		panic(err)
+		h.fail(err)
 	}
 }
 
@@ -1559,7 +1798,12 @@ func (h *PCPHistogram) Variance() float64 {
 }
 
 // Percentile returns the value at the passed percentile.
-func (h *PCPHistogram) Percentile(p float64) int64 { return h.h.ValueAtQuantile(p) }
+// It takes a write lock, as a t-digest backend compacts itself on reads.
+func (h *PCPHistogram) Percentile(p float64) int64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.h.ValueAtQuantile(p)
+}
 
 // HistogramBucket is a single histogram bucket within a fixed range.
 type HistogramBucket struct {
@@ -1568,7 +1812,10 @@ type HistogramBucket struct {
 
 // Buckets returns a list of histogram buckets.
 func (h *PCPHistogram) Buckets() []*HistogramBucket {
+	h.mutex.Lock()
 	b := h.h.Distribution()
+	h.mutex.Unlock()
+
 	buckets := make([]*HistogramBucket, len(b))
 	for i := 0; i < len(b); i++ {
 		buckets[i] = &HistogramBucket{b[i].From, b[i].To, b[i].Count}
@@ -63,6 +63,15 @@ func TestIsCompatible(t *testing.T) {
 		{FloatType, float64(-math.MaxFloat32), true},
 		{DoubleType, float64(-math.MaxFloat32), true},
 
+		{Int32Type, int8(-1), true},
+		{Int64Type, int16(math.MinInt16), true},
+		{Uint32Type, int8(-1), false},
+		{Uint64Type, int16(10), true},
+		{Uint32Type, uint8(math.MaxUint8), true},
+		{Uint64Type, uint16(math.MaxUint16), true},
+		{Int32Type, uint16(10), false},
+		{FloatType, int8(1), false},
+
 		{StringType, 10, false},
 		{StringType, 10.10, false},
 		{StringType, "10", true},
@@ -94,6 +103,12 @@ func TestResolve(t *testing.T) {
 		{Uint32Type, uint(10), uint32(10)},
 		{Uint64Type, uint(10), uint64(10)},
 
+		{Int32Type, int8(10), int32(10)},
+		{Int64Type, int16(10), int64(10)},
+		{Uint32Type, uint8(10), uint32(10)},
+		{Uint64Type, uint16(10), uint64(10)},
+		{Uint64Type, int8(10), uint64(10)},
+
 		{Uint32Type, uint32(10), uint32(10)},
 		{Uint64Type, uint64(10), uint64(10)},
 
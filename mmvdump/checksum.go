@@ -0,0 +1,83 @@
+package mmvdump
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumMagic tags the optional checksum trailer written after the last section of a file.
+//
+// The MMV header has no unused space, so the checksum is written as a trailer of
+// ChecksumLength bytes, holding the magic followed by a little endian CRC-32,
+// which readers that do not know about it ignore like any trailing bytes.
+const ChecksumMagic = "MMVC"
+
+// ChecksumLength is the byte length of the checksum trailer
+const ChecksumLength uint64 = 8
+
+// Checksum computes the CRC-32 of the metadata of a file, i.e. the header, the toc,
+// instance domains, instances and metrics, which are everything before the passed
+// offset of the values section, and which do not change once the file is written.
+//
+// The second generation number and the flags in the header are excluded, as the
+// former is written last and the latter can be changed by receivers of the file.
+func Checksum(data []byte, end uint64) uint32 {
+	crc := crc32.ChecksumIEEE(data[:16])
+	crc = crc32.Update(crc, crc32.IEEETable, data[24:28])
+	return crc32.Update(crc, crc32.IEEETable, data[32:end])
+}
+
+// sectionLength returns the byte length of a block of the passed section
+func sectionLength(t TocType, version int32) uint64 {
+	switch t {
+	case TocIndoms:
+		return InstanceDomainLength
+	case TocInstances:
+		if version == 2 {
+			return Instance2Length
+		}
+		return Instance1Length
+	case TocMetrics:
+		if version == 2 {
+			return Metric2Length
+		}
+		return Metric1Length
+	case TocValues:
+		return ValueLength
+	case TocStrings:
+		return StringLength
+	}
+
+	return 0
+}
+
+// verifyChecksum verifies the checksum trailer of a file, if it has one
+func verifyChecksum(data []byte, h *Header, tocs []*Toc) error {
+	end, values := HeaderLength+uint64(len(tocs))*TocLength, uint64(0)
+	for _, t := range tocs {
+		if e := t.Offset + uint64(t.Count)*sectionLength(t.Type, h.Version); e > end {
+			end = e
+		}
+
+		if t.Type == TocValues {
+			values = t.Offset
+		}
+	}
+
+	if uint64(len(data)) < end+ChecksumLength || string(data[end:end+4]) != ChecksumMagic {
+		return nil
+	}
+
+	if values == 0 || values > end {
+		return errors.New("file with a checksum has no values section")
+	}
+
+	expected := binary.LittleEndian.Uint32(data[end+4:])
+	if crc := Checksum(data, values); crc != expected {
+		return errors.Errorf("checksum mismatch, expected %#08x, got %#08x, the file is corrupted", expected, crc)
+	}
+
+	return nil
+}
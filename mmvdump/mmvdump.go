@@ -304,6 +304,10 @@ func Dump(data []byte) (
 		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 
+	if err = verifyChecksum(data, h, tocs); err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, err
+	}
+
 	var ierr, inerr, merr, verr, serr error
 
 	metrics, values, instances, indoms, strings, ierr, inerr, merr, verr, serr = readComponents(data, tocs, h.Version)
@@ -137,6 +137,11 @@ func writeValue(
 	strings map[uint64]*String,
 ) error {
 	v := values[offset]
+	if v.Metric == 0 {
+		_, err := fmt.Fprintf(w, "\t[-/%v] (no value)\n", offset)
+		return err
+	}
+
 	m := metrics[v.Metric]
 
 	if _, err := fmt.Fprintf(w, "\t[%v/%v] %v", m.Item(), offset, metricName(m, header, strings)); err != nil {
@@ -0,0 +1,209 @@
+package speed
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Dimension is a dimension of a MultiDimMetric, like the method of a request,
+// with all the values it can take.
+type Dimension struct {
+	Name   string
+	Values []string
+}
+
+// MultiDimMetric implements a metric with values keyed by an ordered tuple of
+// dimension values, for example requests by method and status, as
+//
+//	m, err := speed.NewMultiDimMetric(int64(0), "http.requests", []speed.Dimension{
+//		{"method", []string{"GET", "POST"}},
+//		{"status", []string{"200", "404", "500"}},
+//	}, speed.Int64Type, speed.CounterSemantics, speed.OneUnit)
+//
+//	m.MustSet(int64(1), "GET", "200")
+//
+// Internally it is an instance metric on an instance domain holding every tuple,
+// named like "method=GET,status=200", in the order of the dimensions. These are
+// tagged instances, see ParseTaggedInstance, so exporters supporting labels send
+// the dimensions as labels.
+type MultiDimMetric struct {
+	*pcpInstanceMetric
+	mutex  sync.RWMutex
+	dims   []Dimension
+	values []map[string]bool // the values of every dimension, for validating tuples
+}
+
+// NewMultiDimMetric creates a new MultiDimMetric with the passed initial value for
+// every tuple of the passed dimensions. Dimension names and values cannot contain
+// '=' or ',', and the values of a dimension must be unique.
+// It can optionally take a couple of description strings that are used as short
+// and long descriptions respectively.
+func NewMultiDimMetric(val interface{}, name string, dims []Dimension, t MetricType, s MetricSemantics, u MetricUnit, desc ...string) (*MultiDimMetric, error) {
+	if len(dims) == 0 {
+		return nil, errors.New("a multi-dimensional metric needs at least one dimension")
+	}
+
+	names := make(map[string]bool, len(dims))
+	values := make([]map[string]bool, len(dims))
+	count := 1
+
+	for i, d := range dims {
+		if d.Name == "" || strings.ContainsAny(d.Name, "=,") {
+			return nil, errors.Errorf("invalid dimension name %q", d.Name)
+		}
+
+		if names[d.Name] {
+			return nil, errors.Errorf("dimension %v is repeated", d.Name)
+		}
+		names[d.Name] = true
+
+		if len(d.Values) == 0 {
+			return nil, errors.Errorf("dimension %v has no values", d.Name)
+		}
+
+		values[i] = make(map[string]bool, len(d.Values))
+		for _, v := range d.Values {
+			if strings.ContainsAny(v, "=,") {
+				return nil, errors.Errorf("value %v of dimension %v cannot contain '=' or ','", v, d.Name)
+			}
+
+			if values[i][v] {
+				return nil, errors.Errorf("value %v of dimension %v is repeated", v, d.Name)
+			}
+			values[i][v] = true
+		}
+
+		if count > MaxInstances/len(d.Values) {
+			return nil, errors.Errorf("the dimensions of %v have more than %v tuples", name, MaxInstances)
+		}
+		count *= len(d.Values)
+	}
+
+	m := &MultiDimMetric{dims: copyDimensions(dims), values: values}
+
+	instances := make([]string, 0, count)
+	m.tuples(nil, func(tuple []string) {
+		instances = append(instances, m.instance(tuple))
+	})
+
+	vals := make(Instances, len(instances))
+	for _, i := range instances {
+		vals[i] = val
+	}
+
+	im, err := generateInstanceMetric(vals, name, instances, t, s, u, desc...)
+	if err != nil {
+		return nil, err
+	}
+
+	m.pcpInstanceMetric = im
+	return m, nil
+}
+
+func copyDimensions(dims []Dimension) []Dimension {
+	ans := make([]Dimension, len(dims))
+	for i, d := range dims {
+		ans[i] = Dimension{d.Name, append([]string(nil), d.Values...)}
+	}
+	return ans
+}
+
+// tuples calls the passed function with every tuple of the dimensions following prefix
+func (m *MultiDimMetric) tuples(prefix []string, f func([]string)) {
+	if len(prefix) == len(m.dims) {
+		f(prefix)
+		return
+	}
+
+	for _, v := range m.dims[len(prefix)].Values {
+		m.tuples(append(prefix[:len(prefix):len(prefix)], v), f)
+	}
+}
+
+// instance returns the name of the instance of a valid tuple
+func (m *MultiDimMetric) instance(tuple []string) string {
+	parts := make([]string, len(tuple))
+	for i, v := range tuple {
+		parts[i] = m.dims[i].Name + "=" + v
+	}
+	return strings.Join(parts, ",")
+}
+
+// Dimensions returns the dimensions of the metric.
+func (m *MultiDimMetric) Dimensions() []Dimension { return copyDimensions(m.dims) }
+
+// Instance returns the name of the instance holding the value of the passed tuple,
+// with one value per dimension, in the order of the dimensions.
+func (m *MultiDimMetric) Instance(tuple ...string) (string, error) {
+	if len(tuple) != len(m.dims) {
+		return "", errors.Errorf("expected a value for each of the %v dimensions, got %v", len(m.dims), len(tuple))
+	}
+
+	for i, v := range tuple {
+		if !m.values[i][v] {
+			return "", errors.Errorf("%v is not a value of dimension %v", v, m.dims[i].Name)
+		}
+	}
+
+	return m.instance(tuple), nil
+}
+
+// Tuple returns the tuple of dimension values of an instance of the metric.
+func (m *MultiDimMetric) Tuple(instance string) ([]string, error) {
+	if !m.indom.HasInstance(instance) {
+		return nil, errors.Errorf("%v is not an instance of this metric", instance)
+	}
+
+	parts := strings.Split(instance, ",")
+	ans := make([]string, len(parts))
+	for i, p := range parts {
+		ans[i] = strings.TrimPrefix(p, m.dims[i].Name+"=")
+	}
+
+	return ans, nil
+}
+
+// Val returns the value of the passed tuple, which always has the go type of the
+// MetricType of the metric, i.e. int32, int64, uint32, uint64, float32, float64 or
+// string for Int32Type, Int64Type, Uint32Type, Uint64Type, FloatType, DoubleType and
+// StringType respectively, so it can be asserted to that type.
+func (m *MultiDimMetric) Val(tuple ...string) (interface{}, error) {
+	instance, err := m.Instance(tuple...)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.valInstance(instance)
+}
+
+// Set sets the value of the passed tuple. The value is converted to the MetricType of
+// the metric following its CoercionPolicy, see WithCoercion, so by default it has to
+// be of the go type Val returns, or an untyped constant, i.e. an int, uint or float64,
+// or an 8 or 16 bit integer, that fits in it. Other values fail.
+func (m *MultiDimMetric) Set(val interface{}, tuple ...string) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	instance, err := m.Instance(tuple...)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.setInstance(val, instance)
+}
+
+// MustSet is a Set that panics.
+func (m *MultiDimMetric) MustSet(val interface{}, tuple ...string) {
+	if err := m.Set(val, tuple...); err != nil {
+		m.fail(err)
+	}
+}
@@ -0,0 +1,152 @@
+package speed
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestMultiDimMetric(t *testing.T) {
+	m, err := NewMultiDimMetric(int64(0), "http.requests", []Dimension{
+		{"method", []string{"GET", "POST"}},
+		{"status", []string{"200", "404", "500"}},
+	}, Int64Type, CounterSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(m.Instances()); n != 6 {
+		t.Errorf("expected an instance per tuple, got %v", n)
+	}
+
+	instance, err := m.Instance("POST", "404")
+	if err != nil || instance != "method=POST,status=404" {
+		t.Errorf("expected the instance method=POST,status=404, got %v, %v", instance, err)
+	}
+
+	if tuple, err := m.Tuple(instance); err != nil || !reflect.DeepEqual(tuple, []string{"POST", "404"}) {
+		t.Errorf("expected the tuple [POST 404], got %v, %v", tuple, err)
+	}
+
+	if tags := instanceTags(instance); !reflect.DeepEqual(tags, map[string]string{"method": "POST", "status": "404"}) {
+		t.Errorf("expected the instance to be tagged with the dimensions, got %v", tags)
+	}
+
+	c, err := NewPCPClient("multidim")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(m)
+	c.MustStart()
+	defer c.MustStop()
+
+	m.MustSet(int64(3), "GET", "200")
+
+	if v, err := m.Val("GET", "200"); err != nil || v != int64(3) {
+		t.Errorf("expected GET 200 to be 3, got %v, %v", v, err)
+	}
+
+	if v, err := m.Val("POST", "500"); err != nil || v != int64(0) {
+		t.Errorf("expected POST 500 to be 0, got %v, %v", v, err)
+	}
+
+	if err = m.Set(int64(1), "GET"); err == nil {
+		t.Error("expected an error setting a tuple missing a dimension")
+	}
+
+	if err = m.Set(int64(1), "PUT", "200"); err == nil {
+		t.Error("expected an error setting a value that is not in a dimension")
+	}
+
+	if err = m.Set("many", "GET", "200"); err == nil {
+		t.Error("expected an error setting a value of the wrong type")
+	}
+
+	_, _, metrics, values, instances, _, strings, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dump, error: %v", err)
+	}
+
+	matchMetricsAndValues(metrics, values, instances, strings, c, t)
+}
+
+func TestMultiDimMetricErrors(t *testing.T) {
+	cases := [][]Dimension{
+		nil,
+		{{"", []string{"a"}}},
+		{{"a,b", []string{"a"}}},
+		{{"method", []string{"GET"}}, {"method", []string{"POST"}}},
+		{{"method", nil}},
+		{{"method", []string{"GET", "GET"}}},
+		{{"method", []string{"a=b"}}},
+	}
+
+	for _, dims := range cases {
+		if _, err := NewMultiDimMetric(int64(0), "test.multidim", dims, Int64Type, CounterSemantics, OneUnit); err == nil {
+			t.Errorf("expected an error creating a metric with dimensions %v", dims)
+		}
+	}
+}
+
+func TestMultiDimMetricValueTypes(t *testing.T) {
+	dims := []Dimension{{"queue", []string{"a"}}}
+
+	cases := []struct {
+		t        MetricType
+		accepted []interface{}
+		rejected []interface{}
+		val      interface{} // Val after setting each accepted value to 1
+	}{
+		{Int32Type, []interface{}{int32(1), 1, int8(1), int16(1)}, []interface{}{int64(1), 1.0, "1", 1 << 40}, int32(1)},
+		{Int64Type, []interface{}{int64(1), 1, int8(1)}, []interface{}{int32(1), uint64(1), 1.0, "1"}, int64(1)},
+		{Uint32Type, []interface{}{uint32(1), 1, uint(1), uint8(1)}, []interface{}{-1, uint64(1), "1"}, uint32(1)},
+		{Uint64Type, []interface{}{uint64(1), 1, uint(1)}, []interface{}{-1, int64(1), "1"}, uint64(1)},
+		{FloatType, []interface{}{float32(1), 1.0}, []interface{}{1, int32(1), "1"}, float32(1)},
+		{DoubleType, []interface{}{1.0}, []interface{}{float32(1), int64(1), "1"}, 1.0},
+		{StringType, []interface{}{"1"}, []interface{}{1, 1.0, []byte("1")}, "1"},
+	}
+
+	for _, c := range cases {
+		m, err := NewMultiDimMetric(c.val, "test.multidim", dims, c.t, InstantSemantics, OneUnit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, v := range c.accepted {
+			if err = m.Set(v, "a"); err != nil {
+				t.Errorf("expected %v to accept %v(%T), got %v", c.t, v, v, err)
+				continue
+			}
+
+			if got, _ := m.Val("a"); got != c.val {
+				t.Errorf("expected %v(%T) to be stored as %v(%T) in %v, got %v(%T)", v, v, c.val, c.val, c.t, got, got)
+			}
+		}
+
+		for _, v := range c.rejected {
+			if err = m.Set(v, "a"); err == nil {
+				t.Errorf("expected %v to reject %v(%T)", c.t, v, v)
+			}
+		}
+	}
+
+	// other conversions follow the coercion policy of the metric
+	m, err := NewMultiDimMetric(int64(0), "test.multidim", dims, Int64Type, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Apply(WithCoercion(NumericCoercion)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Set(2.0, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := m.Val("a"); v != int64(2) {
+		t.Errorf("expected 2.0 to be converted to int64(2), got %v(%T)", v, v)
+	}
+}
@@ -0,0 +1,193 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newLockHistogram creates a histogram for lock timings in microseconds
+func newLockHistogram(name, desc string) (*PCPHistogram, error) {
+	return NewPCPHistogram(name, HistogramMin, HistogramMax, 3, MicrosecondUnit, desc)
+}
+
+// recordLockDuration records a lock timing, ignoring failures, like all updates
+// of lock metrics, as they cannot be reported from Lock and Unlock
+func recordLockDuration(h *PCPHistogram, d time.Duration) {
+	us := int64(d / time.Microsecond)
+	if us > HistogramMax {
+		us = HistogramMax
+	}
+
+	_ = h.Record(us)
+}
+
+// InstrumentedMutex is a sync.Mutex that exports the number of acquisitions
+// along with histograms of the time spent waiting for and holding the lock,
+// as "<name>.acquisitions", "<name>.wait" and "<name>.hold".
+type InstrumentedMutex struct {
+	mutex    sync.Mutex
+	acquired time.Time
+
+	acquisitions *PCPCounter
+	wait, hold   *PCPHistogram
+}
+
+// NewInstrumentedMutex creates a new InstrumentedMutex exporting metrics under the passed name.
+func NewInstrumentedMutex(name string) (*InstrumentedMutex, error) {
+	if name == "" {
+		return nil, errors.New("mutex name cannot be empty")
+	}
+
+	m := &InstrumentedMutex{}
+
+	var err error
+	if m.acquisitions, err = NewPCPCounter(0, name+".acquisitions", "number of times the lock was acquired"); err != nil {
+		return nil, err
+	}
+
+	if m.wait, err = newLockHistogram(name+".wait", "time spent waiting for the lock"); err != nil {
+		return nil, err
+	}
+
+	if m.hold, err = newLockHistogram(name+".hold", "time the lock was held"); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Lock locks the mutex.
+func (m *InstrumentedMutex) Lock() {
+	start := time.Now()
+	m.mutex.Lock()
+	m.acquired = time.Now()
+
+	_ = m.acquisitions.Inc(1)
+	recordLockDuration(m.wait, m.acquired.Sub(start))
+}
+
+// Unlock unlocks the mutex.
+func (m *InstrumentedMutex) Unlock() {
+	held := time.Since(m.acquired)
+	m.mutex.Unlock()
+
+	recordLockDuration(m.hold, held)
+}
+
+// Metrics returns all the metrics exported by the mutex.
+func (m *InstrumentedMutex) Metrics() []Metric {
+	return []Metric{m.acquisitions, m.wait, m.hold}
+}
+
+// Register registers all metrics of the mutex with the passed client.
+func (m *InstrumentedMutex) Register(c Client) error {
+	for _, metric := range m.Metrics() {
+		if err := c.Register(metric); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InstrumentedRWMutex is a sync.RWMutex that exports the number of read and write
+// acquisitions as "<name>.acquisitions", along with histograms of the time spent
+// waiting for the lock as "<name>.read.wait" and "<name>.write.wait", and of the
+// time the write lock was held as "<name>.write.hold".
+//
+// The time read locks are held is not tracked, as readers can overlap.
+type InstrumentedRWMutex struct {
+	mutex    sync.RWMutex
+	acquired time.Time
+
+	acquisitions                   *PCPCounterVector
+	readWait, writeWait, writeHold *PCPHistogram
+}
+
+// NewInstrumentedRWMutex creates a new InstrumentedRWMutex exporting metrics under the passed name.
+func NewInstrumentedRWMutex(name string) (*InstrumentedRWMutex, error) {
+	if name == "" {
+		return nil, errors.New("mutex name cannot be empty")
+	}
+
+	m := &InstrumentedRWMutex{}
+
+	var err error
+	m.acquisitions, err = NewPCPCounterVector(
+		map[string]int64{"read": 0, "write": 0}, name+".acquisitions",
+		"number of times the lock was acquired",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.readWait, err = newLockHistogram(name+".read.wait", "time spent waiting for the read lock"); err != nil {
+		return nil, err
+	}
+
+	if m.writeWait, err = newLockHistogram(name+".write.wait", "time spent waiting for the write lock"); err != nil {
+		return nil, err
+	}
+
+	if m.writeHold, err = newLockHistogram(name+".write.hold", "time the write lock was held"); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Lock locks the mutex for writing.
+func (m *InstrumentedRWMutex) Lock() {
+	start := time.Now()
+	m.mutex.Lock()
+	m.acquired = time.Now()
+
+	_ = m.acquisitions.Inc(1, "write")
+	recordLockDuration(m.writeWait, m.acquired.Sub(start))
+}
+
+// Unlock unlocks the mutex for writing.
+func (m *InstrumentedRWMutex) Unlock() {
+	held := time.Since(m.acquired)
+	m.mutex.Unlock()
+
+	recordLockDuration(m.writeHold, held)
+}
+
+// RLock locks the mutex for reading.
+func (m *InstrumentedRWMutex) RLock() {
+	start := time.Now()
+	m.mutex.RLock()
+
+	_ = m.acquisitions.Inc(1, "read")
+	recordLockDuration(m.readWait, time.Since(start))
+}
+
+// RUnlock undoes a single RLock call.
+func (m *InstrumentedRWMutex) RUnlock() { m.mutex.RUnlock() }
+
+// RLocker returns a Locker interface that implements Lock and Unlock using RLock and RUnlock.
+func (m *InstrumentedRWMutex) RLocker() sync.Locker { return (*rlocker)(m) }
+
+type rlocker InstrumentedRWMutex
+
+func (r *rlocker) Lock()   { (*InstrumentedRWMutex)(r).RLock() }
+func (r *rlocker) Unlock() { (*InstrumentedRWMutex)(r).RUnlock() }
+
+// Metrics returns all the metrics exported by the mutex.
+func (m *InstrumentedRWMutex) Metrics() []Metric {
+	return []Metric{m.acquisitions, m.readWait, m.writeWait, m.writeHold}
+}
+
+// Register registers all metrics of the mutex with the passed client.
+func (m *InstrumentedRWMutex) Register(c Client) error {
+	for _, metric := range m.Metrics() {
+		if err := c.Register(metric); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
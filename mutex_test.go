@@ -0,0 +1,79 @@
+package speed
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedMutex(t *testing.T) {
+	m, err := NewInstrumentedMutex("test.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	m.Lock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.Lock()
+		m.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	m.Unlock()
+	wg.Wait()
+
+	if m.acquisitions.Val() != 2 {
+		t.Errorf("expected 2 acquisitions, got %v", m.acquisitions.Val())
+	}
+
+	if m.wait.Max() < int64(5*time.Millisecond/time.Microsecond) {
+		t.Errorf("expected the second acquisition to wait at least 5ms, got %vus", m.wait.Max())
+	}
+
+	if m.hold.Max() < int64(5*time.Millisecond/time.Microsecond) {
+		t.Errorf("expected the lock to be held at least 5ms, got %vus", m.hold.Max())
+	}
+}
+
+func TestInstrumentedRWMutex(t *testing.T) {
+	m, err := NewInstrumentedRWMutex("test.rwlock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.RLock()
+	m.RLocker().Lock()
+	m.RUnlock()
+	m.RLocker().Unlock()
+
+	m.Lock()
+	m.Unlock()
+
+	if v, _ := m.acquisitions.Val("read"); v != 2 {
+		t.Errorf("expected 2 read acquisitions, got %v", v)
+	}
+
+	if v, _ := m.acquisitions.Val("write"); v != 1 {
+		t.Errorf("expected 1 write acquisition, got %v", v)
+	}
+
+	if len(m.Metrics()) != 4 {
+		t.Errorf("expected 4 metrics, got %v", len(m.Metrics()))
+	}
+}
@@ -0,0 +1,58 @@
+package speed
+
+// WithNoInitialValue makes the metric report no values to PCP until its value,
+// or the value of one of its instances, is first set, instead of a misleading
+// initial value, for example, a latency that has not been measured yet.
+//
+// Values that were not set are left detached from their metric in the MMV file,
+// so pmdammv has no values for them, and they are skipped by ReadSamples.
+// The value passed to the constructor is still returned by Val until then.
+//
+// The option has no effect on constant metrics, which are only ever set on construction.
+func WithNoInitialValue() MetricOption {
+	return func(md *pcpMetricDesc) error {
+		md.noInitialValue = true
+		return nil
+	}
+}
+
+// unassigned returns whether the metric has no value to report yet
+func (m *pcpSingletonMetric) unassigned() bool { return m.noInitialValue && !m.assigned }
+
+// attachedMetric returns the metric offset written in a value block,
+// 0 for a value that is not reported yet
+func attachedMetric(unassigned bool, doff int) int {
+	if unassigned {
+		return 0
+	}
+
+	return doff
+}
+
+// attacher returns a function attaching the value block at off to the metric
+// at doff, or nil if the value is reported already
+func (c *PCPClient) attacher(unassigned bool, off, doff int) func() {
+	if !unassigned {
+		return nil
+	}
+
+	writer, attached := c.writer, false
+	return func() {
+		if !attached {
+			attached = true
+			_ = writer.MustWriteInt64(int64(doff), off+MaxDataValueSize)
+		}
+	}
+}
+
+// attaching makes an update closure attach its value block once it is first written
+func attaching(update updateClosure, attach func()) updateClosure {
+	return func(val interface{}) error {
+		if err := update(val); err != nil {
+			return err
+		}
+
+		attach()
+		return nil
+	}
+}
@@ -0,0 +1,151 @@
+package speed
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+// sampled returns the samples of the client for the passed metric
+func sampled(t *testing.T, c *PCPClient, metric string) []Sample {
+	samples, err := c.Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ans []Sample
+	for _, s := range samples {
+		if s.Metric == metric {
+			ans = append(ans, s)
+		}
+	}
+
+	return ans
+}
+
+func TestNoInitialValue(t *testing.T) {
+	c, err := NewPCPClient("test", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = counter.Apply(WithNoInitialValue()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustStart()
+	defer c.MustStop()
+
+	if s := sampled(t, c, "test.counter"); len(s) != 0 {
+		t.Errorf("expected no values before the first Set, got %v", s)
+	}
+
+	var b bytes.Buffer
+	h, tocs, m, v, i, ind, s, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = mmvdump.Write(&b, h, tocs, m, v, i, ind, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(b.Bytes(), []byte("(no value)")) {
+		t.Errorf("expected the dump to show the value is missing, got\n%s", b.Bytes())
+	}
+
+	// setting the initial value reports it
+	if err = counter.Set(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := sampled(t, c, "test.counter"); len(s) != 1 || s[0].Value != int64(0) {
+		t.Errorf("expected a value of 0 after the first Set, got %v", s)
+	}
+
+	l, err := c.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = l.Check(c.writer.Bytes()); err != nil {
+		t.Error(err)
+	}
+
+	// the value stays reported over restarts
+	c.MustStop()
+	c.MustStart()
+
+	if s := sampled(t, c, "test.counter"); len(s) != 1 {
+		t.Errorf("expected a value after restarting, got %v", s)
+	}
+}
+
+func TestNoInitialValueInstances(t *testing.T) {
+	c, err := NewPCPClient("test", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPGaugeVector(map[string]float64{"a": 0, "b": 0}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = vector.Apply(WithNoInitialValue()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(vector)
+	c.MustStart()
+	defer c.MustStop()
+
+	vector.MustSet(2.5, "b")
+
+	s := sampled(t, c, "test.vector")
+	if len(s) != 1 || s[0].Instance != "b" || s[0].Value != 2.5 {
+		t.Errorf("expected only instance b to have a value, got %v", s)
+	}
+
+	l, err := c.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = l.Check(c.writer.Bytes()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNoInitialValueSetBeforeStart(t *testing.T) {
+	c, err := NewPCPClient("test", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gauge, err := NewPCPGauge(0, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = gauge.Apply(WithNoInitialValue()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(gauge)
+	gauge.MustSet(1)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if s := sampled(t, c, "test.gauge"); len(s) != 1 || s[0].Value != float64(1) {
+		t.Errorf("expected the value set before starting, got %v", s)
+	}
+}
@@ -0,0 +1,239 @@
+package speed
+
+import (
+	"github.com/performancecopilot/speed/mmvdump"
+	"github.com/pkg/errors"
+)
+
+// LayoutSection describes a section of an MMV file.
+type LayoutSection struct {
+	Name      string `json:"name"` // header, toc, indoms, instances, metrics, values, strings or checksum
+	Offset    int    `json:"offset"`
+	Count     int    `json:"count"`      // number of blocks in the section
+	BlockSize int    `json:"block_size"` // size of a single block in bytes
+}
+
+// End returns the offset right after the section.
+func (s LayoutSection) End() int { return s.Offset + s.Count*s.BlockSize }
+
+// InstanceLayout describes where an instance was written.
+type InstanceLayout struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"`
+}
+
+// IndomLayout describes where an instance domain and its instances were written.
+type IndomLayout struct {
+	Name      string           `json:"name"`
+	Offset    int              `json:"offset"`
+	Instances []InstanceLayout `json:"instances"`
+}
+
+// ValueLayout describes where a value was written, along with the offset of its
+// instance, which is 0 for singleton metrics.
+type ValueLayout struct {
+	Instance       string `json:"instance,omitempty"`
+	Offset         int    `json:"offset"`
+	InstanceOffset int    `json:"instance_offset,omitempty"`
+}
+
+// MetricLayout describes where a metric and its values were written.
+type MetricLayout struct {
+	Name   string        `json:"name"`
+	Offset int           `json:"offset"`
+	Values []ValueLayout `json:"values"`
+}
+
+// Layout describes where everything was written in the MMV file of a client,
+// for debugging differences between speed and readers like pmdammv.
+// Instance domains, metrics and instances are sorted by name.
+type Layout struct {
+	Size            int             `json:"size"`
+	Sections        []LayoutSection `json:"sections"`
+	InstanceDomains []IndomLayout   `json:"indoms"`
+	Metrics         []MetricLayout  `json:"metrics"`
+}
+
+// Layout returns the layout of the MMV file of a mapped client.
+func (c *PCPClient) Layout() (*Layout, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.r.mapped {
+		return nil, errors.New("cannot get the layout of a client that is not mapped")
+	}
+
+	return c.layout()
+}
+
+func (c *PCPClient) layout() (*Layout, error) {
+	b, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Layout{Size: b.Len()}
+
+	for _, s := range b.Sections() {
+		switch s.Name {
+		case "indoms", "instances":
+			// written only along with instances, like their tocs
+			if c.r.InstanceCount() == 0 {
+				continue
+			}
+		case "strings":
+			if s.Count == 0 {
+				continue
+			}
+		}
+
+		l.Sections = append(l.Sections, LayoutSection{s.Name, s.Offset, s.Count, s.Size})
+	}
+
+	for _, indom := range c.r.sortedInstanceDomains() {
+		il := IndomLayout{Name: indom.name, Offset: indom.offset}
+		for _, i := range indom.sortedInstances() {
+			il.Instances = append(il.Instances, InstanceLayout{i.name, i.offset})
+		}
+		l.InstanceDomains = append(l.InstanceDomains, il)
+	}
+
+	for _, m := range c.r.sortedMetrics() {
+		var ml MetricLayout
+
+		switch metric := m.(type) {
+		case *PCPConstMetric:
+			ml = MetricLayout{metric.name, metric.pcpMetricDesc.offset, []ValueLayout{{"", metric.offset, 0}}}
+		case singletonMetric:
+			sm := metric.singleton()
+			ml = MetricLayout{sm.name, sm.pcpMetricDesc.offset, []ValueLayout{{"", sm.offset, 0}}}
+		case instanceMetric:
+			im := metric.instances()
+			ml = MetricLayout{Name: im.name, Offset: im.pcpMetricDesc.offset}
+
+			indom := c.r.instanceDomain(im.indom.name)
+			for _, i := range indom.sortedInstances() {
+				ml.Values = append(ml.Values, ValueLayout{i.name, im.vals[i.name].offset, i.offset})
+			}
+		default:
+			return nil, errors.Errorf("cannot get the layout of metric %v of type %T", m.Name(), m)
+		}
+
+		l.Metrics = append(l.Metrics, ml)
+	}
+
+	return l, nil
+}
+
+// singletonMetric is implemented by all metrics embedding a pcpSingletonMetric
+type singletonMetric interface {
+	singleton() *pcpSingletonMetric
+}
+
+func (m *pcpSingletonMetric) singleton() *pcpSingletonMetric { return m }
+
+// instanceMetric is implemented by all metrics embedding a pcpInstanceMetric
+type instanceMetric interface {
+	instances() *pcpInstanceMetric
+}
+
+func (m *pcpInstanceMetric) instances() *pcpInstanceMetric { return m }
+
+var tocTypes = map[string]mmvdump.TocType{
+	"indoms":    mmvdump.TocIndoms,
+	"instances": mmvdump.TocInstances,
+	"metrics":   mmvdump.TocMetrics,
+	"values":    mmvdump.TocValues,
+	"strings":   mmvdump.TocStrings,
+}
+
+// Check cross-checks the layout against the passed MMV file contents as read by
+// mmvdump, returning an error describing the first mismatch.
+func (l *Layout) Check(data []byte) error {
+	if len(data) != l.Size {
+		return errors.Errorf("expected a file of %v bytes, got %v", l.Size, len(data))
+	}
+
+	_, tocs, metrics, values, instances, indoms, strs, err := mmvdump.Dump(data)
+	if err != nil {
+		return errors.Wrap(err, "cannot read the MMV file")
+	}
+
+	for _, s := range l.Sections {
+		typ, ok := tocTypes[s.Name]
+		if !ok {
+			continue
+		}
+
+		var toc *mmvdump.Toc
+		for _, t := range tocs {
+			if t.Type == typ {
+				toc = t
+			}
+		}
+
+		switch {
+		case toc == nil:
+			return errors.Errorf("no toc entry for the %v section", s.Name)
+		case int(toc.Offset) != s.Offset:
+			return errors.Errorf("expected the %v section at %v, the toc has %v", s.Name, s.Offset, toc.Offset)
+		case int(toc.Count) != s.Count:
+			return errors.Errorf("expected %v blocks in the %v section, the toc has %v", s.Count, s.Name, toc.Count)
+		}
+	}
+
+	for _, il := range l.InstanceDomains {
+		indom, ok := indoms[uint64(il.Offset)]
+		if !ok {
+			return errors.Errorf("no instance domain %v at %v", il.Name, il.Offset)
+		}
+
+		if int(indom.Count) != len(il.Instances) {
+			return errors.Errorf("expected %v instances in instance domain %v, got %v", len(il.Instances), il.Name, indom.Count)
+		}
+
+		for _, i := range il.Instances {
+			ins, ok := instances[uint64(i.Offset)]
+			if !ok {
+				return errors.Errorf("no instance %v of %v at %v", i.Name, il.Name, i.Offset)
+			}
+
+			if ins.Indom() != uint64(il.Offset) {
+				return errors.Errorf("instance %v of %v points to an instance domain at %v", i.Name, il.Name, ins.Indom())
+			}
+
+			if name := instanceName(ins, strs); name != i.Name {
+				return errors.Errorf("expected instance %v at %v, got %v", i.Name, i.Offset, name)
+			}
+		}
+	}
+
+	for _, ml := range l.Metrics {
+		m, ok := metrics[uint64(ml.Offset)]
+		if !ok {
+			return errors.Errorf("no metric %v at %v", ml.Name, ml.Offset)
+		}
+
+		if name := metricName(m, strs); name != ml.Name {
+			return errors.Errorf("expected metric %v at %v, got %v", ml.Name, ml.Offset, name)
+		}
+
+		for _, vl := range ml.Values {
+			v, ok := values[uint64(vl.Offset)]
+			if !ok {
+				return errors.Errorf("no value of %v at %v", ml.Name, vl.Offset)
+			}
+
+			// values without a value yet are not attached to their metric
+			if v.Metric != uint64(ml.Offset) && v.Metric != 0 {
+				return errors.Errorf("value of %v at %v points to a metric at %v", ml.Name, vl.Offset, v.Metric)
+			}
+
+			if v.Instance != uint64(vl.InstanceOffset) {
+				return errors.Errorf("value of %v at %v points to an instance at %v, expected %v", ml.Name, vl.Offset, v.Instance, vl.InstanceOffset)
+			}
+		}
+	}
+
+	return nil
+}
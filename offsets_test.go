@@ -0,0 +1,67 @@
+package speed
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	for _, prefix := range []string{"test", "test." + strings.Repeat("x", MaxV1NameLength)} {
+		c, err := NewPCPClient("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = c.Layout(); err == nil {
+			t.Error("expected an error getting the layout of an unmapped client")
+		}
+
+		c.MustRegisterString(prefix+".a[x,y]", Instances{"x": 1, "y": 2}, Int32Type, InstantSemantics, OneUnit)
+		c.MustRegisterString(prefix+".b", "hello", StringType, InstantSemantics, OneUnit)
+
+		k, err := NewConstMetric(prefix+".c", 3, Int32Type, OneUnit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.MustRegister(k)
+
+		c.MustStart()
+
+		l, err := c.Layout()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = l.Check(c.writer.Bytes()); err != nil {
+			t.Errorf("expected the layout to match the file, got %v", err)
+		}
+
+		names := make([]string, len(l.Sections))
+		for i, s := range l.Sections {
+			names[i] = s.Name
+			if i > 0 && s.Offset != l.Sections[i-1].End() {
+				t.Errorf("expected section %v to start at %v, got %v", s.Name, l.Sections[i-1].End(), s.Offset)
+			}
+		}
+
+		if strings.Join(names, ",") != "header,toc,indoms,instances,metrics,values,strings" {
+			t.Errorf("unexpected sections %v", names)
+		}
+
+		if last := l.Sections[len(l.Sections)-1]; last.End() != l.Size {
+			t.Errorf("expected the sections to end at %v, got %v", l.Size, last.End())
+		}
+
+		if len(l.Metrics) != 3 || len(l.Metrics[0].Values) != 2 || l.Metrics[0].Values[1].Instance != "y" {
+			t.Errorf("unexpected metrics %+v", l.Metrics)
+		}
+
+		// a layout that does not match the file is reported
+		l.Metrics[1].Values[0].Offset = l.Metrics[0].Values[0].Offset
+		if err = l.Check(c.writer.Bytes()); err == nil {
+			t.Error("expected an error checking a layout that does not match the file")
+		}
+
+		c.MustStop()
+	}
+}
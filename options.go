@@ -0,0 +1,31 @@
+package speed
+
+import "github.com/pkg/errors"
+
+// MetricOption configures optional behaviour of a metric.
+//
+// Options are applied using the Apply method available on all metrics, as the
+// metric constructors already use their variadic arguments for descriptions.
+type MetricOption func(*pcpMetricDesc) error
+
+// Apply applies the passed options to the metric, stopping at the first failure.
+func (md *pcpMetricDesc) Apply(opts ...MetricOption) error {
+	for _, opt := range opts {
+		if err := opt(md); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fail handles the failure of a Must method, by calling the panic handler
+// of the client the metric is registered with, or panicking if there is none.
+func (md *pcpMetricDesc) fail(err error) {
+	if md.panicHandler != nil {
+		md.panicHandler(errors.Wrapf(err, "metric %v", md.name))
+		return
+	}
+
+	panic(err)
+}
@@ -0,0 +1,170 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// overheadBudget limits the time a client spends writing values to its MMV file
+// every second. Once a second's budget is spent, writes are deferred, keeping only
+// the latest value for each one, and flushed at the start of the next second.
+type overheadBudget struct {
+	mutex  sync.Mutex
+	budget time.Duration
+
+	window   time.Time     // start of the current second
+	spent    time.Duration // time spent writing in the current second
+	degraded bool
+	pending  map[int]pendingWrite // deferred writes by value offset
+	flush    *time.Timer
+
+	degradedMetric *PCPSingletonMetric
+	spentMetric    *PCPSingletonMetric
+
+	now func() time.Time
+}
+
+type pendingWrite struct {
+	update updateClosure
+	val    interface{}
+}
+
+// WithOverheadBudget limits the time the client spends writing updated values to its
+// MMV file to the passed budget per second, protecting latency critical services.
+//
+// Once the budget for a second is spent, writes are deferred until the next second,
+// only writing the latest value set on every metric then. The client exports
+// "speed.overhead.degraded", which is 1 while writes are deferred, and
+// "speed.overhead.spent", the time spent writing in the last complete second.
+func WithOverheadBudget(budget time.Duration) ClientOption {
+	return func(c *PCPClient) error {
+		if budget <= 0 || budget >= time.Second {
+			return errors.New("overhead budget has to be between 0 and a second")
+		}
+
+		b := &overheadBudget{budget: budget, pending: make(map[int]pendingWrite), now: time.Now}
+
+		var err error
+		b.degradedMetric, err = NewPCPSingletonMetric(
+			uint32(0), "speed.overhead.degraded", Uint32Type, InstantSemantics, OneUnit,
+			"1 if metric writes are deferred as the overhead budget is spent",
+		)
+		if err != nil {
+			return err
+		}
+
+		b.spentMetric, err = NewPCPSingletonMetric(
+			int64(0), "speed.overhead.spent", Int64Type, InstantSemantics, MicrosecondUnit,
+			"time spent writing metric values in the last second",
+		)
+		if err != nil {
+			return err
+		}
+
+		if err = c.r.AddMetric(b.degradedMetric); err != nil {
+			return err
+		}
+
+		if err = c.r.AddMetric(b.spentMetric); err != nil {
+			return err
+		}
+
+		c.budget = b
+		return nil
+	}
+}
+
+// wrap makes an update closure of the value at the passed offset respect the budget
+func (b *overheadBudget) wrap(name string, offset int, update updateClosure) updateClosure {
+	// the meta metrics are updated while holding the lock
+	if name == b.degradedMetric.Name() || name == b.spentMetric.Name() {
+		return update
+	}
+
+	return func(val interface{}) error {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		b.roll()
+
+		if b.degraded {
+			b.pending[offset] = pendingWrite{update, val}
+			return nil
+		}
+
+		return b.write(update, val)
+	}
+}
+
+// write performs a write, degrading if it exhausts the budget
+func (b *overheadBudget) write(update updateClosure, val interface{}) error {
+	start := b.now()
+	err := update(val)
+	b.spent += b.now().Sub(start)
+
+	if b.spent > b.budget && !b.degraded {
+		b.degraded = true
+		_ = b.degradedMetric.Set(uint32(1))
+
+		// flush the deferred writes even if nothing is written later
+		b.flush = time.AfterFunc(b.window.Add(time.Second).Sub(b.now()), func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+
+			b.roll()
+		})
+	}
+
+	return err
+}
+
+// roll starts a new window if the current one is over, flushing deferred writes
+func (b *overheadBudget) roll() {
+	now := b.now()
+	if now.Sub(b.window) < time.Second {
+		return
+	}
+
+	_ = b.spentMetric.Set(int64(b.spent / time.Microsecond))
+	b.window, b.spent = now, 0
+
+	if !b.degraded {
+		return
+	}
+
+	b.degraded = false
+	_ = b.degradedMetric.Set(uint32(0))
+
+	if b.flush != nil {
+		b.flush.Stop()
+		b.flush = nil
+	}
+
+	pending := b.pending
+	b.pending = make(map[int]pendingWrite)
+
+	for _, p := range pending {
+		_ = b.write(p.update, p.val)
+	}
+}
+
+// stop discards deferred writes when the client is stopped, the values are
+// written again from the metrics when it is restarted
+func (b *overheadBudget) stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.flush != nil {
+		b.flush.Stop()
+		b.flush = nil
+	}
+
+	if b.degraded {
+		_ = b.degradedMetric.Set(uint32(0))
+	}
+
+	b.pending = make(map[int]pendingWrite)
+	b.window, b.spent, b.degraded = time.Time{}, 0, false
+}
@@ -0,0 +1,81 @@
+package speed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestOverheadBudget(t *testing.T) {
+	c, err := NewPCPClient("test", WithOverheadBudget(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every reading of the clock advances it by 3ms,
+	// so every write costs 3ms of the budget
+	now := time.Now()
+	c.budget.now = func() time.Time {
+		now = now.Add(3 * time.Millisecond)
+		return now
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustStart()
+	defer c.MustStop()
+
+	written := func() int64 {
+		_, _, m, v, _, _, _, err := mmvdump.Dump(c.writer.Bytes())
+		if err != nil {
+			t.Fatalf("cannot create dump, error: %v", err)
+		}
+
+		off, _ := findMetric(counter, m)
+		_, val := findSingletonValue(off, v)
+		return int64(val.Val)
+	}
+
+	for i := 0; i < 5; i++ {
+		counter.Up()
+	}
+
+	if counter.Val() != 5 {
+		t.Errorf("expected the counter to be 5 in memory, got %v", counter.Val())
+	}
+
+	if v := written(); v >= 5 {
+		t.Errorf("expected writes to be deferred once the budget is spent, got %v written", v)
+	}
+
+	if c.budget.degradedMetric.Val() != uint32(1) {
+		t.Error("expected the client to be degraded")
+	}
+
+	// the next second flushes the latest value
+	now = now.Add(time.Second)
+	counter.Up()
+
+	if v := written(); v != 6 {
+		t.Errorf("expected 6 to be written after the flush, got %v", v)
+	}
+
+	if c.budget.degradedMetric.Val() != uint32(0) {
+		t.Error("expected the client not to be degraded anymore")
+	}
+
+	if c.budget.spentMetric.Val().(int64) == 0 {
+		t.Error("expected the time spent in the last second to be exported")
+	}
+}
+
+func TestOverheadBudgetValidation(t *testing.T) {
+	if _, err := NewPCPClient("test", WithOverheadBudget(2*time.Second)); err == nil {
+		t.Error("expected an error passing a budget longer than a second")
+	}
+}
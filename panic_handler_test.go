@@ -0,0 +1,51 @@
+package speed
+
+import "testing"
+
+func TestWithPanicHandler(t *testing.T) {
+	var handled []error
+
+	c, err := NewPCPClient("test", WithPanicHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPGaugeVector(map[string]float64{"a": 0}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegister(vector)
+
+	counter.MustInc(-1)
+	vector.MustSet(1, "b")
+
+	if len(handled) != 2 {
+		t.Errorf("expected 2 handled failures, got %v", handled)
+	}
+
+	unregistered, err := NewPCPCounter(0, "test.unregistered")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected metrics not registered with the client to keep panicking")
+		}
+	}()
+
+	unregistered.MustInc(-1)
+}
+
+func TestWithPanicHandlerNil(t *testing.T) {
+	if _, err := NewPCPClient("test", WithPanicHandler(nil)); err == nil {
+		t.Error("expected an error passing a nil panic handler")
+	}
+}
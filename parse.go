@@ -0,0 +1,176 @@
+package speed
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type unitComponent int
+
+const (
+	spaceComponent unitComponent = iota
+	timeComponent
+	countComponent
+)
+
+type unitName struct {
+	component unitComponent
+	scale     int8
+}
+
+// unitNames maps lowercased unit names, as used by pmParseUnitsStr
+// along with common abbreviations, to their component and scale
+var unitNames = map[string]unitName{
+	"byte": {spaceComponent, 0}, "b": {spaceComponent, 0},
+	"kbyte": {spaceComponent, 1}, "kb": {spaceComponent, 1}, "kib": {spaceComponent, 1},
+	"mbyte": {spaceComponent, 2}, "mb": {spaceComponent, 2}, "mib": {spaceComponent, 2},
+	"gbyte": {spaceComponent, 3}, "gb": {spaceComponent, 3}, "gib": {spaceComponent, 3},
+	"tbyte": {spaceComponent, 4}, "tb": {spaceComponent, 4}, "tib": {spaceComponent, 4},
+	"pbyte": {spaceComponent, 5}, "pb": {spaceComponent, 5}, "pib": {spaceComponent, 5},
+	"ebyte": {spaceComponent, 6}, "eb": {spaceComponent, 6}, "eib": {spaceComponent, 6},
+
+	"nanosec": {timeComponent, 0}, "nsec": {timeComponent, 0}, "ns": {timeComponent, 0},
+	"microsec": {timeComponent, 1}, "usec": {timeComponent, 1}, "us": {timeComponent, 1},
+	"millisec": {timeComponent, 2}, "msec": {timeComponent, 2}, "ms": {timeComponent, 2},
+	"sec": {timeComponent, 3}, "second": {timeComponent, 3}, "s": {timeComponent, 3},
+	"min": {timeComponent, 4}, "minute": {timeComponent, 4},
+	"hour": {timeComponent, 5}, "hr": {timeComponent, 5}, "h": {timeComponent, 5},
+
+	"count": {countComponent, 0}, "one": {countComponent, 0},
+}
+
+// ParseUnit parses a human readable unit string, like "Kbyte/sec", "millisec"
+// or "count / sec", into a MetricUnit.
+//
+// The grammar follows PCP's pmParseUnitsStr, terms are separated by spaces
+// or '*', can have an integer power like "byte^2", and terms after a '/'
+// get their dimension negated. Names are case insensitive and a trailing 's' is
+// ignored, so "Kbytes" and "kbyte" are the same.
+//
+// Units with a single component of dimension 1 are returned as the matching
+// SpaceUnit, TimeUnit or CountUnit constant.
+func ParseUnit(s string) (MetricUnit, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) > 2 {
+		return nil, errors.Errorf("invalid unit %q, more than one '/'", s)
+	}
+
+	var (
+		dims   [3]int8
+		scales [3]int8
+		seen   [3]bool
+	)
+
+	for i, part := range parts {
+		terms := strings.FieldsFunc(part, func(r rune) bool { return r == ' ' || r == '*' || r == '\t' })
+		if len(terms) == 0 && (i > 0 || len(parts) > 1) {
+			return nil, errors.Errorf("invalid unit %q, empty term", s)
+		}
+
+		for _, term := range terms {
+			name, dim := term, int64(1)
+
+			if j := strings.IndexByte(term, '^'); j != -1 {
+				var err error
+				if dim, err = strconv.ParseInt(term[j+1:], 10, 8); err != nil {
+					return nil, errors.Errorf("invalid power in unit term %q", term)
+				}
+				name = term[:j]
+			}
+
+			u, err := lookupUnitName(name)
+			if err != nil {
+				return nil, err
+			}
+
+			if seen[u.component] && scales[u.component] != u.scale {
+				return nil, errors.Errorf("invalid unit %q, same dimension with different scales", s)
+			}
+
+			if i > 0 {
+				dim = -dim
+			}
+
+			seen[u.component] = true
+			scales[u.component] = u.scale
+			dims[u.component] += int8(dim)
+		}
+	}
+
+	for _, d := range dims {
+		if d < -8 || d > 7 {
+			return nil, errors.Errorf("invalid unit %q, dimension has to be between -8 and 7", s)
+		}
+	}
+
+	return newParsedUnit(dims, scales), nil
+}
+
+func lookupUnitName(name string) (unitName, error) {
+	n := strings.ToLower(name)
+
+	if u, ok := unitNames[n]; ok {
+		return u, nil
+	}
+
+	if u, ok := unitNames[strings.TrimSuffix(n, "s")]; ok && n != "s" {
+		return u, nil
+	}
+
+	return unitName{}, errors.Errorf("unknown unit %q", name)
+}
+
+func newParsedUnit(dims, scales [3]int8) MetricUnit {
+	nonzero := 0
+	for _, d := range dims {
+		if d != 0 {
+			nonzero++
+		}
+	}
+
+	// return the plain constants for simple units, so they compare equal
+	if nonzero == 1 {
+		switch {
+		case dims[spaceComponent] == 1:
+			return SpaceUnit(1<<28 | uint32(scales[spaceComponent])<<16)
+		case dims[timeComponent] == 1:
+			return TimeUnit(1<<24 | uint32(scales[timeComponent])<<12)
+		case dims[countComponent] == 1:
+			return CountUnit(1<<20 | uint32(scales[countComponent]&0xF)<<8)
+		}
+	}
+
+	var repr uint32
+	if dims[spaceComponent] != 0 {
+		repr |= (uint32(dims[spaceComponent])&0xF)<<28 | uint32(scales[spaceComponent])<<16
+	}
+
+	if dims[timeComponent] != 0 {
+		repr |= (uint32(dims[timeComponent])&0xF)<<24 | uint32(scales[timeComponent])<<12
+	}
+
+	if dims[countComponent] != 0 {
+		repr |= (uint32(dims[countComponent])&0xF)<<20 | (uint32(scales[countComponent])&0xF)<<8
+	}
+
+	return &metricUnit{repr}
+}
+
+// ParseSemantics parses a human readable semantics string, one of
+// "counter", "instant", "discrete" or "none", case insensitive.
+func ParseSemantics(s string) (MetricSemantics, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "counter":
+		return CounterSemantics, nil
+	case "instant":
+		return InstantSemantics, nil
+	case "discrete":
+		return DiscreteSemantics, nil
+	case "none", "":
+		return NoSemantics, nil
+	}
+
+	return NoSemantics, errors.Errorf("unknown semantics %q", s)
+}
@@ -0,0 +1,66 @@
+package speed
+
+import "testing"
+
+func TestParseUnit(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected MetricUnit
+	}{
+		{"byte", ByteUnit},
+		{"Kbyte", KilobyteUnit},
+		{"mbytes", MegabyteUnit},
+		{"millisec", MillisecondUnit},
+		{"hour", HourUnit},
+		{"count", OneUnit},
+		{"Kbyte/sec", KilobyteUnit.Time(SecondUnit, -1)},
+		{"Kbyte / sec", KilobyteUnit.Time(SecondUnit, -1)},
+		{"count / sec", OneUnit.Time(SecondUnit, -1)},
+		{"byte * sec", ByteUnit.Time(SecondUnit, 1)},
+		{"byte^2", NewMetricUnit().Space(ByteUnit, 2)},
+		{"/sec", nil},
+		{"furlong", nil},
+		{"byte/sec/sec", nil},
+		{"byte Kbyte", nil},
+		{"byte^x", nil},
+	}
+
+	for _, c := range cases {
+		u, err := ParseUnit(c.s)
+		if c.expected == nil {
+			if err == nil {
+				t.Errorf("expected an error parsing %q, got %v", c.s, u)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("cannot parse %q, error: %v", c.s, err)
+		} else if u.PMAPI() != c.expected.PMAPI() {
+			t.Errorf("expected %q to be %b, got %b", c.s, c.expected.PMAPI(), u.PMAPI())
+		}
+	}
+
+	if u, _ := ParseUnit("Kbyte"); u != MetricUnit(KilobyteUnit) {
+		t.Errorf("expected Kbyte to be parsed into the KilobyteUnit constant, got %T", u)
+	}
+}
+
+func TestParseSemantics(t *testing.T) {
+	cases := map[string]MetricSemantics{
+		"counter":  CounterSemantics,
+		"Instant":  InstantSemantics,
+		"DISCRETE": DiscreteSemantics,
+		"none":     NoSemantics,
+	}
+
+	for s, expected := range cases {
+		if sem, err := ParseSemantics(s); err != nil || sem != expected {
+			t.Errorf("expected %q to be %v, got %v, error: %v", s, expected, sem, err)
+		}
+	}
+
+	if _, err := ParseSemantics("gauge"); err == nil {
+		t.Error("expected an error parsing unknown semantics")
+	}
+}
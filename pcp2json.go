@@ -0,0 +1,211 @@
+package speed
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PCP2JSONEncoder writes the values of the metrics of a client in the format of
+// pcp2json, so pipelines consuming pcp2json output can ingest them without pmcd.
+//
+// The output is a single document holding one entry in "@metrics" per call to
+// Encode, with the metrics nested by the components of their names, like
+//
+//	{"@pcp": {"@hosts": [{"@host": "web-1", "@metrics": [{
+//	    "@timestamp": "2017-01-01 00:00:00",
+//	    "app": {"requests": {"@unit": "count", "@instances": [{"name": "GET", "value": 42}]}}
+//	}]}]}}
+//
+// Like in pcp2json, floating point values are written as strings with a precision
+// of 3 decimals, and units are written like pmUnitsStr(3) formats them.
+type PCP2JSONEncoder struct {
+	mutex   sync.Mutex
+	w       io.Writer
+	host    string
+	entries int
+	closed  bool
+}
+
+// NewPCP2JSONEncoder creates a new encoder writing to the passed writer,
+// reporting the metrics for the passed host.
+func NewPCP2JSONEncoder(w io.Writer, host string) *PCP2JSONEncoder {
+	return &PCP2JSONEncoder{w: w, host: host}
+}
+
+// pcp2jsonPrecision is the default precision of pcp2json for floating point values
+const pcp2jsonPrecision = 3
+
+func pcp2jsonValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', pcp2jsonPrecision, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', pcp2jsonPrecision, 64)
+	}
+
+	return val
+}
+
+// Encode writes the current values of all metrics of the passed client,
+// with the passed time as their timestamp.
+func (e *PCP2JSONEncoder) Encode(c *PCPClient, t time.Time) error {
+	samples, err := c.Samples()
+	if err != nil {
+		return err
+	}
+
+	entry := map[string]interface{}{
+		"@timestamp": t.Format("2006-01-02 15:04:05"),
+	}
+
+	for _, s := range samples {
+		node := entry
+		for _, part := range strings.Split(s.Metric, ".") {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+			node = child
+		}
+
+		if _, ok := node["@unit"]; !ok {
+			unit := "none"
+			c.r.metricslock.RLock()
+			if m, ok := c.r.metrics[s.Metric]; ok {
+				unit = pmUnitsString(m.Unit())
+			}
+			c.r.metricslock.RUnlock()
+
+			node["@unit"] = unit
+		}
+
+		if s.Instance == "" {
+			node["value"] = pcp2jsonValue(s.Value)
+			continue
+		}
+
+		instances, _ := node["@instances"].([]interface{})
+		node["@instances"] = append(instances, map[string]interface{}{
+			"name":  s.Instance,
+			"value": pcp2jsonValue(s.Value),
+		})
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode the metrics")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return errors.New("encoder is closed")
+	}
+
+	prefix := ","
+	if e.entries == 0 {
+		host, err := json.Marshal(e.host)
+		if err != nil {
+			return err
+		}
+
+		prefix = `{"@pcp":{"@hosts":[{"@host":` + string(host) + `,"@metrics":[`
+	}
+
+	if _, err := io.WriteString(e.w, prefix+string(data)); err != nil {
+		return err
+	}
+
+	e.entries++
+	return nil
+}
+
+// Close completes the document. Nothing is written if nothing was encoded.
+func (e *PCP2JSONEncoder) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	if e.entries == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(e.w, "]}]}}\n")
+	return err
+}
+
+var (
+	pmSpaceNames = []string{"byte", "Kbyte", "Mbyte", "Gbyte", "Tbyte", "Pbyte", "Ebyte"}
+	pmTimeNames  = []string{"nanosec", "microsec", "millisec", "sec", "min", "hour"}
+)
+
+// pmUnitsString formats a unit like pmUnitsStr(3), for example "Kbyte / sec",
+// returning "none" for dimensionless units.
+func pmUnitsString(u MetricUnit) string {
+	if u == nil {
+		return "none"
+	}
+
+	d := decodeUnit(u)
+
+	term := func(dim int8, name string) string {
+		if dim < 0 {
+			dim = -dim
+		}
+
+		if dim == 1 {
+			return name
+		}
+
+		return name + "^" + strconv.Itoa(int(dim))
+	}
+
+	var pos, neg []string
+	add := func(dim int8, name string) {
+		switch {
+		case dim > 0:
+			pos = append(pos, term(dim, name))
+		case dim < 0:
+			neg = append(neg, term(dim, name))
+		}
+	}
+
+	if d.spaceDim != 0 && int(d.spaceScale) < len(pmSpaceNames) {
+		add(d.spaceDim, pmSpaceNames[d.spaceScale])
+	}
+
+	if d.timeDim != 0 && int(d.timeScale) < len(pmTimeNames) {
+		add(d.timeDim, pmTimeNames[d.timeScale])
+	}
+
+	if d.countDim != 0 {
+		name := "count"
+		if d.countScale != 0 {
+			name += " x 10^" + strconv.Itoa(int(d.countScale))
+		}
+		add(d.countDim, name)
+	}
+
+	switch {
+	case len(pos) == 0 && len(neg) == 0:
+		return "none"
+	case len(neg) == 0:
+		return strings.Join(pos, " ")
+	case len(pos) == 0:
+		return "/ " + strings.Join(neg, " ")
+	}
+
+	return strings.Join(pos, " ") + " / " + strings.Join(neg, " ")
+}
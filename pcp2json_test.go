@@ -0,0 +1,109 @@
+package speed
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPMUnitsString(t *testing.T) {
+	cases := []struct {
+		u        MetricUnit
+		expected string
+	}{
+		{NewMetricUnit(), "none"},
+		{OneUnit, "count"},
+		{ByteUnit, "byte"},
+		{KilobyteUnit.Time(SecondUnit, -1), "Kbyte / sec"},
+		{OneUnit.Time(SecondUnit, -1), "count / sec"},
+		{MillisecondUnit, "millisec"},
+		{NewMetricUnit().Space(ByteUnit, 2), "byte^2"},
+		{NewMetricUnit().Time(SecondUnit, -1), "/ sec"},
+		{CountUnit(1<<20 | 3<<8), "count x 10^3"},
+	}
+
+	for _, c := range cases {
+		if s := pmUnitsString(c.u); s != c.expected {
+			t.Errorf("expected %v to be formatted as %q, got %q", c.u, c.expected, s)
+		}
+	}
+}
+
+func TestPCP2JSONEncoder(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("app.requests[GET,POST]", Instances{"GET": int64(42), "POST": int64(7)}, Int64Type, CounterSemantics, OneUnit)
+	c.MustRegisterString("app.load", 0.5, DoubleType, InstantSemantics, OneUnit)
+	c.MustRegisterString("app.sent", uint64(1024), Uint64Type, CounterSemantics, ByteUnit)
+	c.MustRegisterString("version", "1.0", StringType, DiscreteSemantics, OneUnit)
+
+	var buf bytes.Buffer
+	e := NewPCP2JSONEncoder(&buf, "web-1")
+
+	if err = e.Encode(c, time.Now()); err == nil {
+		t.Error("expected an error encoding a client that is not started")
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err = e.Encode(c, now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = e.Encode(c, now); err == nil {
+		t.Error("expected an error encoding after close")
+	}
+
+	var doc struct {
+		PCP struct {
+			Hosts []struct {
+				Host    string                   `json:"@host"`
+				Metrics []map[string]interface{} `json:"@metrics"`
+			} `json:"@hosts"`
+		} `json:"@pcp"`
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("cannot decode %v: %v", buf.String(), err)
+	}
+
+	if len(doc.PCP.Hosts) != 1 || doc.PCP.Hosts[0].Host != "web-1" {
+		t.Fatalf("expected a single host web-1, got %v", buf.String())
+	}
+
+	entries := doc.PCP.Hosts[0].Metrics
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", len(entries))
+	}
+
+	if ts := entries[1]["@timestamp"]; ts != "2017-01-01 00:00:01" {
+		t.Errorf("expected the timestamp 2017-01-01 00:00:01, got %v", ts)
+	}
+
+	entry, err := json.Marshal(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"@timestamp":"2017-01-01 00:00:00",` +
+		`"app":{"load":{"@unit":"count","value":"0.500"},` +
+		`"requests":{"@instances":[{"name":"GET","value":42},{"name":"POST","value":7}],"@unit":"count"},` +
+		`"sent":{"@unit":"byte","value":1024}},` +
+		`"version":{"@unit":"count","value":"1.0"}}`
+
+	if string(entry) != expected {
+		t.Errorf("expected entry\n%v\ngot\n%v", expected, string(entry))
+	}
+}
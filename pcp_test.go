@@ -0,0 +1,188 @@
+//go:build pcp
+// +build pcp
+
+// The tests in this file cross-validate the files written by speed against the
+// tools of an installed PCP, catching drift from the upstream MMV format.
+// Run them with
+//
+//	go test -tags pcp -run PCP
+//
+// pminfo needs a running pmcd with the mmv PMDA enabled.
+
+package speed
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+// lookPath returns the location of a PCP tool, skipping the test if it is not installed
+func lookPath(t *testing.T, tool string) string {
+	loc, err := exec.LookPath(tool)
+	if err != nil {
+		t.Skipf("%v is not installed, skipping", tool)
+	}
+
+	return loc
+}
+
+var mmvdumpValue = regexp.MustCompile(`^\s*\[\d+/\d+\] ([^\[=]+?)\s*(?:\[-?\d+ or "([^"]*)"\])?\s*= (.*)$`)
+
+// dumpedValues parses the values in the output of mmvdump by name and instance
+func dumpedValues(out []byte) map[string]string {
+	ans := make(map[string]string)
+
+	for _, line := range strings.Split(string(bytes.Replace(out, []byte{0}, nil, -1)), "\n") {
+		if m := mmvdumpValue.FindStringSubmatch(line); m != nil {
+			ans[m[1]+"["+m[2]+"]"] = strings.Trim(strings.TrimSpace(m[3]), `"`)
+		}
+	}
+
+	return ans
+}
+
+// sameValue compares numbers numerically, as the tools format them differently
+func sameValue(a, b string) bool {
+	x, errx := strconv.ParseFloat(a, 64)
+	y, erry := strconv.ParseFloat(b, 64)
+	if errx == nil && erry == nil {
+		return x == y
+	}
+
+	return a == b
+}
+
+func TestPCPMMVDump(t *testing.T) {
+	tool := lookPath(t, "mmvdump")
+
+	dir, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range goldenFixtures {
+		data := goldenFile(t, f.metrics)
+
+		loc := filepath.Join(dir, f.name+".mmv")
+		if err = ioutil.WriteFile(loc, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := exec.Command(tool, loc).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v failed for %v, error: %v\n%s", tool, f.name, err, out)
+		}
+
+		var b bytes.Buffer
+		h, tocs, metrics, values, instances, indoms, strs, err := mmvdump.Dump(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = mmvdump.Write(&b, h, tocs, metrics, values, instances, indoms, strs); err != nil {
+			t.Fatal(err)
+		}
+
+		expected, actual := dumpedValues(b.Bytes()), dumpedValues(out)
+		if len(expected) == 0 || len(expected) != len(actual) {
+			t.Errorf("expected %v values in %v, got %v\n%s", len(expected), f.name, len(actual), out)
+		}
+
+		for k, v := range expected {
+			if !sameValue(v, actual[k]) {
+				t.Errorf("expected %v in %v to be %v, got %v", k, f.name, v, actual[k])
+			}
+		}
+	}
+}
+
+var (
+	pminfoValue    = regexp.MustCompile(`^\s*value (.*)$`)
+	pminfoInstance = regexp.MustCompile(`^\s*inst \[\d+ or "([^"]*)"\] value (.*)$`)
+)
+
+// fetch runs pminfo -f on a metric, returning its values by instance
+func fetch(tool, metric string) (map[string]string, error) {
+	out, err := exec.Command(tool, "-f", metric).CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	ans := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if m := pminfoInstance.FindStringSubmatch(line); m != nil {
+			ans[m[1]] = strings.Trim(m[2], `"`)
+		} else if m := pminfoValue.FindStringSubmatch(line); m != nil {
+			ans[""] = strings.Trim(m[1], `"`)
+		}
+	}
+
+	return ans, nil
+}
+
+func TestPCPMInfo(t *testing.T) {
+	tool := lookPath(t, "pminfo")
+
+	c, err := NewPCPClient("speedtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(42, "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	str, err := NewPCPSingletonMetric("hello", "string", StringType, DiscreteSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPGaugeVector(map[string]float64{"a": 1.5, "b": -2}, "vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegister(str)
+	c.MustRegister(vector)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	for metric, expected := range map[string]map[string]string{
+		"mmv.speedtest.counter": {"": "42"},
+		"mmv.speedtest.string":  {"": "hello"},
+		"mmv.speedtest.vector":  {"a": "1.5", "b": "-2"},
+	} {
+		// the mmv PMDA picks up new files on its next scan of the directory
+		var actual map[string]string
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+			if actual, err = fetch(tool, metric); err == nil && len(actual) == len(expected) {
+				break
+			}
+		}
+
+		if len(actual) != len(expected) {
+			t.Errorf("expected %v values for %v, got %v, error: %v", len(expected), metric, actual, err)
+			continue
+		}
+
+		for i, v := range expected {
+			if !sameValue(v, actual[i]) {
+				t.Errorf("expected %v[%v] to be %v, got %v", metric, i, v, actual[i])
+			}
+		}
+	}
+}
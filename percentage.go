@@ -0,0 +1,112 @@
+package speed
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PCPPercentage implements a metric holding a percentage, a double in [0, 100].
+//
+// PCP has no percent unit, so like the percentages exported by the PCP agents,
+// it is dimensionless (OneUnit) with InstantSemantics.
+type PCPPercentage struct {
+	*pcpSingletonMetric
+	mutex sync.RWMutex
+}
+
+// NewPCPPercentage creates a new PCPPercentage instance with an initial value in [0, 100].
+// Optionally it can also take a couple of description strings that are used as
+// short and long descriptions respectively.
+// Internally it creates a PCP SingletonMetric with DoubleType, InstantSemantics
+// and OneUnit.
+func NewPCPPercentage(val float64, name string, desc ...string) (*PCPPercentage, error) {
+	if err := checkPercentage(val); err != nil {
+		return nil, err
+	}
+
+	d, err := newpcpMetricDesc(name, DoubleType, InstantSemantics, OneUnit, desc...)
+	if err != nil {
+		return nil, err
+	}
+
+	sm, err := newpcpSingletonMetric(val, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PCPPercentage{pcpSingletonMetric: sm}, nil
+}
+
+func checkPercentage(val float64) error {
+	if math.IsNaN(val) || val < 0 || val > 100 {
+		return errors.Errorf("percentage %v is not in [0, 100]", val)
+	}
+
+	return nil
+}
+
+// Val returns the current value of the percentage.
+func (p *PCPPercentage) Val() float64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.val.(float64)
+}
+
+// Set sets the percentage, returning an error for values out of [0, 100].
+func (p *PCPPercentage) Set(val float64) error {
+	if err := p.prepare(); err != nil {
+		return err
+	}
+
+	if err := checkPercentage(val); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.set(val)
+}
+
+// MustSet is a Set that panics on failure.
+func (p *PCPPercentage) MustSet(val float64) {
+	if err := p.Set(val); err != nil {
+		p.fail(err)
+	}
+}
+
+// SetRatio sets the percentage to num out of den, for example 3 out of 4 sets 75.
+//
+// A zero denominator sets 0 if the numerator is also zero, as in no failed requests
+// out of no requests at all, and returns an error otherwise.
+func (p *PCPPercentage) SetRatio(num, den float64) error {
+	if den == 0 {
+		if num != 0 {
+			return errors.Errorf("cannot compute the percentage of %v out of 0", num)
+		}
+
+		return p.Set(0)
+	}
+
+	return p.Set(num / den * 100)
+}
+
+// MustSetRatio is a SetRatio that panics on failure.
+func (p *PCPPercentage) MustSetRatio(num, den float64) {
+	if err := p.SetRatio(num, den); err != nil {
+		p.fail(err)
+	}
+}
+
+// Format implements fmt.Formatter, writing the value as a percentage.
+func (p *PCPPercentage) Format(f fmt.State, verb rune) {
+	formatVerb(f, verb, p.name, func(plus bool) string {
+		return p.formatWith(fmt.Sprintf("%v%%", p.Val()), plus)
+	})
+}
+
+func (p *PCPPercentage) String() string { return fmt.Sprint(p) }
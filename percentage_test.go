@@ -0,0 +1,78 @@
+package speed
+
+import (
+	"math"
+	"testing"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestPercentage(t *testing.T) {
+	if _, err := NewPCPPercentage(101, "test.percentage"); err == nil {
+		t.Error("expected an error creating a percentage out of range")
+	}
+
+	p, err := NewPCPPercentage(0, "test.percentage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(p)
+	c.MustStart()
+	defer c.MustStop()
+
+	for _, val := range []float64{-1, 100.5, math.NaN(), math.Inf(1)} {
+		if err = p.Set(val); err == nil {
+			t.Errorf("expected an error setting the percentage to %v", val)
+		}
+	}
+
+	cases := []struct {
+		num, den, expected float64
+		fails              bool
+	}{
+		{3, 4, 75, false},
+		{0, 0, 0, false},
+		{1, 0, 0, true},
+		{5, 4, 0, true},
+		{-1, 4, 0, true},
+	}
+
+	for _, c := range cases {
+		err := p.SetRatio(c.num, c.den)
+		if c.fails {
+			if err == nil {
+				t.Errorf("expected an error setting the ratio %v/%v", c.num, c.den)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("cannot set the ratio %v/%v, error: %v", c.num, c.den, err)
+		} else if p.Val() != c.expected {
+			t.Errorf("expected the ratio %v/%v to set %v, got %v", c.num, c.den, c.expected, p.Val())
+		}
+	}
+
+	p.MustSetRatio(1, 8)
+
+	_, _, m, v, _, _, _, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatalf("cannot create dump, error: %v", err)
+	}
+
+	off, _ := findMetric(p, m)
+	_, val := findSingletonValue(off, v)
+	if val == nil {
+		t.Fatal("expected the percentage to be written")
+	}
+
+	if f, _ := mmvdump.FixedVal(val.Val, mmvdump.DoubleType); f != float64(12.5) {
+		t.Errorf("expected the written value to be 12.5, got %v", f)
+	}
+}
@@ -0,0 +1,208 @@
+package speed
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCheckpointInterval is how often a client created with WithPersistence
+// checkpoints its counters while it is started.
+const DefaultCheckpointInterval = 10 * time.Second
+
+// WithPersistence makes the client checkpoint the values of all metrics with
+// CounterSemantics to the passed file every DefaultCheckpointInterval while it is
+// started, as well as on Stop, and restore them on the first Start, so counters used
+// for long window rates, or billing, do not reset when the process restarts.
+//
+// The epochs of restored counters with WithEpoch are restored and incremented,
+// so readers can tell a restart with restored values apart from a regular one.
+func WithPersistence(path string) ClientOption {
+	return func(c *PCPClient) error {
+		if path == "" {
+			return errors.New("persistence path cannot be empty")
+		}
+
+		p := &persister{client: c, path: path}
+		c.persistence = &collectorRunner{collector: p, interval: DefaultCheckpointInterval, metrics: make(map[string]PCPMetric)}
+		return nil
+	}
+}
+
+// checkpointValue is a persisted value of a counter, or of the epoch of one
+type checkpointValue struct {
+	Metric   string      `json:"metric"`
+	Instance string      `json:"instance,omitempty"`
+	Type     MetricType  `json:"type"`
+	Value    json.Number `json:"value"`
+}
+
+// persister checkpoints the counters of a client, on every collection
+type persister struct {
+	client   *PCPClient
+	path     string
+	restored bool // restore only once, values are kept in memory across restarts
+}
+
+// Describe sends nothing, the persister has no metrics of its own
+func (p *persister) Describe(chan<- Desc) {}
+
+func (p *persister) Collect(Recorder) {
+	if err := p.client.Checkpoint(); err != nil && p.client.r.panicHandler != nil {
+		p.client.r.panicHandler(err)
+	}
+}
+
+// Checkpoint writes the current values of the counters of a client created with
+// WithPersistence to its persistence file. Clients that are not mapped yet, like
+// lazily started ones before their first update, have nothing to checkpoint.
+func (c *PCPClient) Checkpoint() error {
+	if c.persistence == nil {
+		return errors.New("client has no persistence, see WithPersistence")
+	}
+
+	// counters disabled by the filter keep the values written before they were disabled
+	samples, err := c.allSamples()
+	if err == errNotMapped {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "cannot checkpoint the counters")
+	}
+
+	persisted := c.persistedTypes()
+
+	var vals []checkpointValue
+	for _, s := range samples {
+		t, ok := persisted[s.Metric]
+		if !ok {
+			continue
+		}
+
+		data, err := json.Marshal(s.Value)
+		if err != nil {
+			return errors.Wrapf(err, "cannot encode the value of %v", s.Metric)
+		}
+
+		vals = append(vals, checkpointValue{s.Metric, s.Instance, t, json.Number(data)})
+	}
+
+	data, err := json.Marshal(vals)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode the checkpoint")
+	}
+
+	return writeFileAtomically(c.persistence.collector.(*persister).path, data)
+}
+
+// persistedTypes returns the types of all counters and their epochs, by name
+func (c *PCPClient) persistedTypes() map[string]MetricType {
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	ans := make(map[string]MetricType)
+	for name, m := range c.r.metrics {
+		if m.Semantics() != CounterSemantics {
+			continue
+		}
+
+		ans[name] = m.Type()
+
+		if dm, ok := m.(describedMetric); ok && dm.desc().epoch != nil {
+			ans[dm.desc().epoch.name] = Uint32Type
+		}
+	}
+
+	return ans
+}
+
+// restoreCheckpoint restores the counters of the client from its persistence file,
+// if it has one, and it was not restored before
+func (c *PCPClient) restoreCheckpoint() error {
+	p := c.persistence.collector.(*persister)
+	if p.restored {
+		return nil
+	}
+	p.restored = true
+
+	data, err := ioutil.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "cannot read the checkpoint")
+	}
+
+	var vals []checkpointValue
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err = d.Decode(&vals); err != nil {
+		return errors.Wrap(err, "cannot decode the checkpoint")
+	}
+
+	persisted := c.persistedTypes()
+
+	samples := make([]Sample, 0, len(vals))
+	for _, v := range vals {
+		// counters changing type start over
+		if t, ok := persisted[v.Metric]; !ok || t != v.Type {
+			continue
+		}
+
+		val, err := parseCheckpointValue(v)
+		if err != nil {
+			return err
+		}
+
+		samples = append(samples, Sample{v.Metric, v.Instance, val})
+	}
+
+	c.restore(samples)
+	return c.bumpRestoredEpochs(samples)
+}
+
+// parseCheckpointValue converts a persisted value back to its type
+func parseCheckpointValue(v checkpointValue) (interface{}, error) {
+	var n interface{}
+	if i, err := strconv.ParseInt(string(v.Value), 10, 64); err == nil {
+		n = i
+	} else if u, err := strconv.ParseUint(string(v.Value), 10, 64); err == nil {
+		n = u
+	} else if f, err := v.Value.Float64(); err == nil {
+		n = f
+	}
+
+	val, ok := v.Type.convert(n)
+	if !ok {
+		return nil, errors.Errorf("invalid checkpointed value %v of %v for type %v", v.Value, v.Metric, v.Type)
+	}
+
+	return val, nil
+}
+
+// bumpRestoredEpochs increments the epochs of all counters with restored values
+func (c *PCPClient) bumpRestoredEpochs(samples []Sample) error {
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	bumped := make(map[string]bool)
+	for _, s := range samples {
+		dm, ok := c.r.metrics[s.Metric].(describedMetric)
+		if !ok || bumped[s.Metric] || dm.desc().epoch == nil {
+			continue
+		}
+
+		bumped[s.Metric] = true
+		if err := dm.desc().bumpEpoch(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
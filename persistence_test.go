@@ -0,0 +1,167 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed-persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint.json")
+
+	if _, err = NewPCPClient("persistence", WithPersistence("")); err == nil {
+		t.Error("expected an error creating a client with an empty persistence path")
+	}
+
+	run := func() (*PCPClient, *PCPCounter, *PCPCounterVector, *PCPGauge) {
+		c, err := NewPCPClient("persistence", WithPersistence(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counter, err := NewPCPCounter(0, "test.counter")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = counter.Apply(WithEpoch()); err != nil {
+			t.Fatal(err)
+		}
+
+		vector, err := NewPCPCounterVector(map[string]int64{"a": 0, "b": 0}, "test.vector")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gauge, err := NewPCPGauge(0, "test.gauge")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.MustRegister(counter)
+		c.MustRegister(vector)
+		c.MustRegister(gauge)
+		c.MustStart()
+
+		return c, counter, vector, gauge
+	}
+
+	c, counter, vector, gauge := run()
+	if counter.Epoch() != 0 {
+		t.Errorf("expected no epoch bump without a checkpoint, got %v", counter.Epoch())
+	}
+
+	counter.MustInc(5)
+	vector.MustInc(3, "b")
+	gauge.MustSet(2.5)
+
+	if err = c.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	counter.MustInc(2)
+	c.MustStop()
+
+	c, counter, vector, gauge = run()
+	defer c.MustStop()
+
+	if v := counter.Val(); v != 7 {
+		t.Errorf("expected the counter to be restored to 7, got %v", v)
+	}
+
+	if counter.Epoch() != 1 {
+		t.Errorf("expected the epoch of the restored counter to be 1, got %v", counter.Epoch())
+	}
+
+	if v, err := vector.Val("b"); err != nil || v != 3 {
+		t.Errorf("expected the instance b to be restored to 3, got %v, %v", v, err)
+	}
+
+	if v := gauge.Val(); v != 0 {
+		t.Errorf("expected the gauge not to be persisted, got %v", v)
+	}
+
+	matchSingleDump(int64(7), counter.pcpSingletonMetric, c, t)
+}
+
+func TestPersistenceTypeChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed-persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint.json")
+
+	c, err := NewPCPClient("persistence", WithPersistence(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric).MustSet(int64(4))
+	c.MustStart()
+	c.MustStop()
+
+	c, err = NewPCPClient("persistence", WithPersistence(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterString("test.counter", uint64(0), Uint64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+	defer c.MustStop()
+
+	if m.Val() != uint64(0) {
+		t.Errorf("expected a counter changing type to start over, got %v", m.Val())
+	}
+}
+
+func TestCheckpointWithoutPersistence(t *testing.T) {
+	c, err := NewPCPClient("persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Checkpoint(); err == nil {
+		t.Error("expected an error checkpointing a client without persistence")
+	}
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed-persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewPCPClient("persistence", WithPersistence(filepath.Join(dir, "checkpoint.json")), WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit)
+
+	// a client that is not mapped has nothing to checkpoint
+	if err = c.Checkpoint(); err != nil {
+		t.Errorf("expected no error checkpointing a client that is not mapped, got %v", err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	// a mapping that cannot be read cannot be checkpointed
+	data := c.writer.Bytes()
+	copy(data, "XXX")
+	defer copy(data, "MMV")
+
+	if err = c.Checkpoint(); err == nil {
+		t.Error("expected an error checkpointing an invalid mapping")
+	}
+}
@@ -0,0 +1,133 @@
+package speed
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MMVDomain is the PMDA domain number of the MMV PMDA, which serves the metrics
+// of all MMV files.
+const MMVDomain = 70
+
+// PMNSName returns the name under which PCP exposes a metric of the client, which is
+// "mmv.<client>.<metric>", or "mmv.<metric>" if the client has the NoPrefixFlag set.
+func (c *PCPClient) PMNSName(metric string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.flag&NoPrefixFlag != 0 {
+		return "mmv." + metric
+	}
+
+	return "mmv." + filepath.Base(c.loc) + "." + metric
+}
+
+// PMID returns the PCP metric identifier of a metric of the client
+// in the "domain:cluster:item" notation used in PMNS files.
+func (c *PCPClient) PMID(m Metric) string {
+	return fmt.Sprintf("%d:%d:%d", MMVDomain, c.clusterID, m.ID())
+}
+
+var pmnsRoot = regexp.MustCompile(`\A[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)*\z`)
+
+// WritePMNS writes a PMNS fragment that makes all metrics of the client available
+// under the passed root, for example "myapp", in addition to their mmv name.
+//
+// The fragment maps names to the identifiers of the metrics in the MMV PMDA, so it has
+// to be regenerated when metrics are renamed. It can be loaded with pmnsadd(1), or
+// passed to PCP clients using the -n option, see pmns(5).
+func (c *PCPClient) WritePMNS(w io.Writer, root string) error {
+	if !pmnsRoot.MatchString(root) {
+		return errors.Errorf("invalid PMNS root %q", root)
+	}
+
+	// maps a non leaf node to its children, with leaves mapping to their pmid
+	nodes := map[string]map[string]string{"root": {}}
+
+	addChild := func(parent, child, pmid string) error {
+		if _, present := nodes[parent]; !present {
+			nodes[parent] = make(map[string]string)
+		}
+
+		if old, present := nodes[parent][child]; present && (old != "" || pmid != "") {
+			return errors.Errorf("%v.%v is both a metric and a subtree", parent, child)
+		}
+
+		nodes[parent][child] = pmid
+		return nil
+	}
+
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	for _, m := range c.r.metrics {
+		parts := append(strings.Split(root, "."), strings.Split(m.Name(), ".")...)
+
+		parent := "root"
+		for i, part := range parts {
+			pmid := ""
+			if i == len(parts)-1 {
+				pmid = c.PMID(m)
+			}
+
+			if err := addChild(parent, part, pmid); err != nil {
+				return err
+			}
+
+			if parent == "root" {
+				parent = part
+			} else {
+				parent = parent + "." + part
+			}
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		if name != "root" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if _, err := fmt.Fprintf(w, "/*\n * metrics of %v under %v, see pmns(5)\n */\n", c.PMNSName("*"), root); err != nil {
+		return err
+	}
+
+	for _, name := range append([]string{"root"}, names...) {
+		children := make([]string, 0, len(nodes[name]))
+		for child := range nodes[name] {
+			children = append(children, child)
+		}
+		sort.Strings(children)
+
+		if _, err := fmt.Fprintf(w, "\n%v {\n", name); err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			var err error
+			if pmid := nodes[name][child]; pmid != "" {
+				_, err = fmt.Fprintf(w, "\t%v\t%v\n", child, pmid)
+			} else {
+				_, err = fmt.Fprintf(w, "\t%v\n", child)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(w, "}"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
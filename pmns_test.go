@@ -0,0 +1,84 @@
+package speed
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestWritePMNS(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests, err := NewPCPCounter(0, "http.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := NewPCPGauge(0, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(requests)
+	c.MustRegister(up)
+
+	var b bytes.Buffer
+	if err = c.WritePMNS(&b, "acme.app"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf(`/*
+ * metrics of mmv.test.* under acme.app, see pmns(5)
+ */
+
+root {
+	acme
+}
+
+acme {
+	app
+}
+
+acme.app {
+	http
+	up	70:%[1]v:%[3]v
+}
+
+acme.app.http {
+	requests	70:%[1]v:%[2]v
+}
+`, c.clusterID, requests.ID(), up.ID())
+
+	if b.String() != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, b.String())
+	}
+
+	if name := c.PMNSName("up"); name != "mmv.test.up" {
+		t.Errorf("expected mmv.test.up, got %v", name)
+	}
+
+	if err = c.SetFlag(NoPrefixFlag); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := c.PMNSName("up"); name != "mmv.up" {
+		t.Errorf("expected mmv.up with NoPrefixFlag, got %v", name)
+	}
+
+	if err = c.WritePMNS(&b, "1acme"); err == nil {
+		t.Error("expected an error writing a PMNS with an invalid root")
+	}
+
+	leaf, err := NewPCPGauge(0, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(leaf)
+	if err = c.WritePMNS(&b, "acme"); err == nil {
+		t.Error("expected an error writing a PMNS with a metric that is also a subtree")
+	}
+}
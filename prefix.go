@@ -0,0 +1,129 @@
+package speed
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// WithPrefix prefixes the names of all metrics registered with the client with the
+// passed components, for example, passing "checkout" and "prod" registers "requests"
+// as "checkout.prod.requests", so constructors do not have to concatenate the names.
+//
+// The names are prefixed in place on registration, like with Contribute, so Name
+// returns the prefixed name once a metric is registered. The metrics exported by
+// the client itself, like the ones of WithOverheadBudget, and contributed metrics
+// are not prefixed.
+func WithPrefix(components ...string) ClientOption {
+	return func(c *PCPClient) error {
+		for _, comp := range components {
+			if !libraryPattern.MatchString(comp) {
+				return errors.Errorf("invalid prefix %q, it has to be a single component of a metric name", comp)
+			}
+		}
+
+		c.prefix = prefixOf(c.prefix, components)
+		return nil
+	}
+}
+
+// WithEnvPrefix is WithPrefix with the values of the passed environment variables,
+// for example, WithEnvPrefix("SERVICE", "ENVIRONMENT"). All of them have to be set.
+func WithEnvPrefix(vars ...string) ClientOption {
+	return func(c *PCPClient) error {
+		components := make([]string, 0, len(vars))
+		for _, v := range vars {
+			val, ok := os.LookupEnv(v)
+			if !ok || val == "" {
+				return errors.Errorf("environment variable %v for the metric prefix is not set", v)
+			}
+
+			components = append(components, val)
+		}
+
+		return WithPrefix(components...)(c)
+	}
+}
+
+// prefixOf appends components to a prefix
+func prefixOf(prefix string, components []string) string {
+	if len(components) == 0 {
+		return prefix
+	}
+
+	return prefix + strings.Join(components, ".") + "."
+}
+
+// registered checks whether the passed metric itself is registered under its name,
+// which it is after a failure to add one of its companions
+func (c *PCPClient) registered(m Metric) bool {
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	pm, ok := m.(PCPMetric)
+	return ok && c.r.metrics[m.Name()] == pm
+}
+
+// descs returns the descriptions of a metric and its companions,
+// or false if the metric does not have any
+func descs(m Metric) ([]*pcpMetricDesc, bool) {
+	dm, ok := m.(describedMetric)
+	if !ok {
+		return nil, false
+	}
+
+	ans := []*pcpMetricDesc{dm.desc()}
+	for _, cm := range dm.desc().companions {
+		ans = append(ans, cm.(describedMetric).desc())
+	}
+
+	return ans, true
+}
+
+// rename changes the name of a metric, along with its id
+func (md *pcpMetricDesc) rename(name string) {
+	md.name = name
+	md.id = hash(name, PCPMetricItemBitLength)
+}
+
+// registerPrefixed registers a metric with its name, and the names of its companions,
+// prefixed with the prefix of the client, restoring them if the registration fails.
+//
+// The names are changed in place, so metrics registered with any client already,
+// which would see their names change, cannot be registered with a prefix, but a
+// Clone of them can.
+func (c *PCPClient) registerPrefixed(m Metric) error {
+	ds, ok := descs(m)
+	if !ok {
+		return errors.Errorf("metric %v of type %T cannot be prefixed", m.Name(), m)
+	}
+
+	names := make([]string, len(ds))
+	for i, md := range ds {
+		names[i] = md.name
+
+		if atomic.LoadInt32(&md.registered) != 0 {
+			return errors.Errorf("metric %v is already registered with a client, so it cannot be prefixed", md.name)
+		}
+
+		// names are written with a terminating NUL
+		if len(c.prefix+md.name) >= StringLength {
+			return errors.Errorf("prefixed metric name %v is too long", c.prefix+md.name)
+		}
+	}
+
+	for _, md := range ds {
+		md.rename(c.prefix + md.name)
+	}
+
+	err := c.r.AddMetric(m)
+	if err != nil && !c.registered(m) {
+		for i, md := range ds {
+			md.rename(names[i])
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,121 @@
+package speed
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithPrefix(t *testing.T) {
+	c, err := NewPCPClient("test", WithPrefix("checkout", "prod"), WithOverheadBudget(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = counter.Apply(WithEpoch()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegisterString("latency[a,b]", Instances{"a": 1.0, "b": 2.0}, DoubleType, InstantSemantics, OneUnit)
+
+	for _, name := range []string{
+		"checkout.prod.requests",
+		"checkout.prod.requests.epoch",
+		"checkout.prod.latency",
+		"speed.overhead.degraded",
+	} {
+		if !c.r.HasMetric(name) {
+			t.Errorf("expected %v to be registered", name)
+		}
+	}
+
+	if counter.Name() != "checkout.prod.requests" {
+		t.Errorf("expected the metric to be renamed, got %v", counter.Name())
+	}
+
+	if counter.ID() != hash("checkout.prod.requests", PCPMetricItemBitLength) {
+		t.Error("expected the id to be derived from the prefixed name")
+	}
+
+	// a failed registration leaves the name alone
+	other, err := NewPCPCounter(0, "requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Register(other); err == nil {
+		t.Error("expected an error registering a metric twice")
+	}
+
+	if other.Name() != "requests" {
+		t.Errorf("expected the name of the unregistered metric to be kept, got %v", other.Name())
+	}
+
+	// a metric registered with another client keeps its name there
+	shared, err := NewPCPCounter(0, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unprefixed, err := NewPCPClient("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unprefixed.MustRegister(shared)
+
+	if err = c.ValidateRegistration(shared); err == nil {
+		t.Error("expected validating a metric registered with another client to fail")
+	}
+
+	if err = c.Register(shared); err == nil {
+		t.Error("expected an error prefixing a metric registered with another client")
+	}
+
+	if shared.Name() != "shared" {
+		t.Errorf("expected the name of the shared metric to be kept, got %v", shared.Name())
+	}
+
+	if err = c.Register(shared.Clone()); err != nil {
+		t.Errorf("expected a clone of the shared metric to be registered, got %v", err)
+	}
+
+	// prefixed names need room for the terminating NUL
+	long, err := NewPCPCounter(0, strings.Repeat("x", StringLength-len("checkout.prod.")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Register(long); err == nil {
+		t.Errorf("expected an error registering a prefixed name of %v bytes", StringLength)
+	}
+}
+
+func TestWithEnvPrefix(t *testing.T) {
+	os.Setenv("SPEED_TEST_SERVICE", "checkout")
+	defer os.Unsetenv("SPEED_TEST_SERVICE")
+
+	c, err := NewPCPClient("test", WithEnvPrefix("SPEED_TEST_SERVICE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.prefix != "checkout." {
+		t.Errorf("expected the prefix to be taken from the environment, got %q", c.prefix)
+	}
+
+	if _, err = NewPCPClient("test", WithEnvPrefix("SPEED_TEST_UNSET")); err == nil {
+		t.Error("expected an error for an unset environment variable")
+	}
+
+	if _, err = NewPCPClient("test", WithPrefix("a.b")); err == nil {
+		t.Error("expected an error for a prefix with more than one component")
+	}
+}
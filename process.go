@@ -0,0 +1,136 @@
+package speed
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// processStats is a snapshot of the resource usage of the current process
+type processStats struct {
+	rss                    uint64 // resident set size in bytes
+	fds                    uint32 // number of open file descriptors
+	utime, stime           uint64 // user and system cpu time in milliseconds
+	voluntary, involuntary int64  // context switches
+}
+
+// ProcessCollector exports resource usage of the current process,
+// i.e. resident memory, open file descriptors, cpu time and context switches.
+//
+// All metrics are created under the subtree passed to NewProcessCollector,
+// and are updated on every call to Collect.
+type ProcessCollector struct {
+	mutex sync.Mutex
+
+	rss         *PCPSingletonMetric
+	fds         *PCPSingletonMetric
+	cpu         *PCPInstanceMetric
+	ctxSwitches *PCPCounterVector
+}
+
+var processCPUInstances = []string{"user", "sys"}
+
+// NewProcessCollector creates a new ProcessCollector with all metrics
+// created under the passed prefix, for example, passing "app.process"
+// creates "app.process.rss", "app.process.fds", "app.process.cpu"
+// and "app.process.context_switches".
+func NewProcessCollector(prefix string) (*ProcessCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("process collector prefix cannot be empty")
+	}
+
+	rss, err := NewPCPSingletonMetric(
+		uint64(0), prefix+".rss", Uint64Type, InstantSemantics, ByteUnit,
+		"resident set size of the process",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	fds, err := NewPCPSingletonMetric(
+		uint32(0), prefix+".fds", Uint32Type, InstantSemantics, OneUnit,
+		"number of open file descriptors",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cpuIndom, err := NewPCPInstanceDomain(prefix+".cpu.indom", processCPUInstances)
+	if err != nil {
+		return nil, err
+	}
+
+	cpu, err := NewPCPInstanceMetric(
+		Instances{"user": uint64(0), "sys": uint64(0)},
+		prefix+".cpu", cpuIndom, Uint64Type, CounterSemantics, MillisecondUnit,
+		"cpu time consumed by the process",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctxSwitches, err := NewPCPCounterVector(
+		map[string]int64{"voluntary": 0, "involuntary": 0},
+		prefix+".context_switches",
+		"context switches of the process",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProcessCollector{
+		rss:         rss,
+		fds:         fds,
+		cpu:         cpu,
+		ctxSwitches: ctxSwitches,
+	}, nil
+}
+
+// Metrics returns all the metrics exported by the collector.
+func (p *ProcessCollector) Metrics() []Metric {
+	return []Metric{p.rss, p.fds, p.cpu, p.ctxSwitches}
+}
+
+// Register registers all metrics of the collector with the passed client.
+func (p *ProcessCollector) Register(c Client) error {
+	for _, m := range p.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Collect reads the current resource usage of the process and updates the metrics.
+func (p *ProcessCollector) Collect() error {
+	s, err := readProcessStats()
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.rss.Set(s.rss); err != nil {
+		return err
+	}
+
+	if err := p.fds.Set(s.fds); err != nil {
+		return err
+	}
+
+	if err := p.cpu.SetInstance(s.utime, "user"); err != nil {
+		return err
+	}
+
+	if err := p.cpu.SetInstance(s.stime, "sys"); err != nil {
+		return err
+	}
+
+	if err := p.ctxSwitches.Set(s.voluntary, "voluntary"); err != nil {
+		return err
+	}
+
+	return p.ctxSwitches.Set(s.involuntary, "involuntary")
+}
@@ -0,0 +1,100 @@
+package speed
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// userHZ is the fixed clock tick rate used by the kernel when
+// reporting times in /proc
+const userHZ = 100
+
+func readProcessStats() (*processStats, error) {
+	s := &processStats{}
+
+	stat, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return nil, err
+	}
+
+	if s.utime, s.stime, err = parseProcStat(string(stat)); err != nil {
+		return nil, err
+	}
+
+	status, err := os.Open("/proc/self/status")
+	if err != nil {
+		return nil, err
+	}
+	defer status.Close()
+
+	if err = parseProcStatus(bufio.NewScanner(status), s); err != nil {
+		return nil, err
+	}
+
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil, err
+	}
+	s.fds = uint32(len(fds))
+
+	return s, nil
+}
+
+// parseProcStat returns the user and system time in milliseconds
+// from the contents of /proc/[pid]/stat
+func parseProcStat(stat string) (utime, stime uint64, err error) {
+	// the command name can contain spaces, so only look after its closing paren
+	i := strings.LastIndexByte(stat, ')')
+	if i == -1 {
+		return 0, 0, errors.New("invalid /proc stat format")
+	}
+
+	// fields start from the 3rd field (state), utime and stime are the 14th and 15th
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 13 {
+		return 0, 0, errors.New("invalid /proc stat format")
+	}
+
+	if utime, err = strconv.ParseUint(fields[11], 10, 64); err != nil {
+		return 0, 0, err
+	}
+
+	if stime, err = strconv.ParseUint(fields[12], 10, 64); err != nil {
+		return 0, 0, err
+	}
+
+	return utime * 1000 / userHZ, stime * 1000 / userHZ, nil
+}
+
+// parseProcStatus reads the resident set size and context switches
+// from the contents of /proc/[pid]/status
+func parseProcStatus(scanner *bufio.Scanner, s *processStats) error {
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "VmRSS:":
+			s.rss, err = strconv.ParseUint(fields[1], 10, 64)
+			s.rss *= 1024
+		case "voluntary_ctxt_switches:":
+			s.voluntary, err = strconv.ParseInt(fields[1], 10, 64)
+		case "nonvoluntary_ctxt_switches:":
+			s.involuntary, err = strconv.ParseInt(fields[1], 10, 64)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,76 @@
+package speed
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat := "4649 (cat (x) y) R 4645 4649 4645 0 -1 4194304 79 0 0 0 250 30 0 0 20 0 1 0 43714"
+
+	utime, stime, err := parseProcStat(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if utime != 2500 {
+		t.Errorf("expected utime to be 2500ms, got %v", utime)
+	}
+
+	if stime != 300 {
+		t.Errorf("expected stime to be 300ms, got %v", stime)
+	}
+
+	if _, _, err = parseProcStat("4649 cat R"); err == nil {
+		t.Error("expected an error parsing an invalid stat")
+	}
+}
+
+func TestParseProcStatus(t *testing.T) {
+	status := "Name:\tcat\nVmRSS:\t    1796 kB\nvoluntary_ctxt_switches:\t3\nnonvoluntary_ctxt_switches:\t1\n"
+
+	s := &processStats{}
+	if err := parseProcStatus(bufio.NewScanner(strings.NewReader(status)), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.rss != 1796*1024 {
+		t.Errorf("expected rss to be %v, got %v", 1796*1024, s.rss)
+	}
+
+	if s.voluntary != 3 || s.involuntary != 1 {
+		t.Errorf("expected context switches to be 3 and 1, got %v and %v", s.voluntary, s.involuntary)
+	}
+}
+
+func TestProcessCollector(t *testing.T) {
+	p, err := NewProcessCollector("test.process")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = p.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.rss.Val().(uint64) == 0 {
+		t.Error("expected a non zero rss")
+	}
+
+	if p.fds.Val().(uint32) == 0 {
+		t.Error("expected a non zero number of open file descriptors")
+	}
+}
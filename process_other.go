@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package speed
+
+import "github.com/pkg/errors"
+
+func readProcessStats() (*processStats, error) {
+	return nil, errors.New("process statistics are only supported on linux")
+}
@@ -0,0 +1,157 @@
+package speed
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Profiles captured by ProfileArtifacts, which are always declared
+const (
+	HeapProfile = "heap"
+	CPUProfile  = "cpu"
+)
+
+// ProfileArtifacts records where the latest captured pprof profiles can be found,
+// exporting per profile its location, a path or a URL, as the string metric
+// "<prefix>.location" and the unix time it was captured at as "<prefix>.captured",
+// so operators looking at PCP know where to find the artifacts for a deep dive.
+//
+// The heap and cpu profiles are always declared, other profiles, for example
+// profiles captured by an external agent, have to be declared on construction.
+// Locations longer than a string metric can hold are truncated.
+type ProfileArtifacts struct {
+	mutex    sync.Mutex
+	location *PCPInstanceMetric
+	captured *PCPInstanceMetric
+	now      func() time.Time
+}
+
+// NewProfileArtifacts creates a new ProfileArtifacts with all metrics under the passed prefix.
+func NewProfileArtifacts(prefix string, profiles ...string) (*ProfileArtifacts, error) {
+	if prefix == "" {
+		return nil, errors.New("profile artifacts prefix cannot be empty")
+	}
+
+	instances := []string{HeapProfile, CPUProfile}
+	for _, p := range profiles {
+		if p == HeapProfile || p == CPUProfile {
+			continue
+		}
+		instances = append(instances, p)
+	}
+
+	indom, err := NewPCPInstanceDomain(prefix+".profile.indom", instances, "pprof profiles")
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ProfileArtifacts{now: time.Now}
+
+	if a.location, err = NewPCPInstanceMetric(
+		zeroInstances(instances, ""), prefix+".location",
+		indom, StringType, DiscreteSemantics, OneUnit,
+		"location of the latest captured profile",
+	); err != nil {
+		return nil, err
+	}
+
+	if a.captured, err = NewPCPInstanceMetric(
+		zeroInstances(instances, int64(0)), prefix+".captured",
+		indom, Int64Type, DiscreteSemantics, SecondUnit,
+		"unix time the latest profile was captured at",
+	); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Metrics returns all the metrics exported.
+func (a *ProfileArtifacts) Metrics() []Metric {
+	return []Metric{a.location, a.captured}
+}
+
+// Register registers all the metrics with the passed client.
+func (a *ProfileArtifacts) Register(c Client) error {
+	for _, m := range a.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Record records the location of a profile captured now.
+func (a *ProfileArtifacts) Record(profile, location string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !a.location.Indom().HasInstance(profile) {
+		return errors.Errorf("%v is not a declared profile", profile)
+	}
+
+	if err := a.location.SetInstance(location, profile); err != nil {
+		return err
+	}
+
+	return a.captured.SetInstance(a.now().Unix(), profile)
+}
+
+// create creates the file for a profile captured now in dir
+func (a *ProfileArtifacts) create(dir, profile string) (*os.File, error) {
+	name := profile + "-" + strconv.FormatInt(a.now().UnixNano(), 10) + ".pprof"
+	return os.Create(filepath.Join(dir, name))
+}
+
+// CaptureHeap writes a heap profile to a new file in dir, running a GC first
+// so it is up to date, and records its path.
+func (a *ProfileArtifacts) CaptureHeap(dir string) (string, error) {
+	f, err := a.create(dir, HeapProfile)
+	if err != nil {
+		return "", err
+	}
+
+	runtime.GC()
+	err = pprof.WriteHeapProfile(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return f.Name(), a.Record(HeapProfile, f.Name())
+}
+
+// CaptureCPU profiles the cpu for d into a new file in dir, and records its path.
+// It fails if the cpu is already being profiled.
+func (a *ProfileArtifacts) CaptureCPU(dir string, d time.Duration) (string, error) {
+	f, err := a.create(dir, CPUProfile)
+	if err != nil {
+		return "", err
+	}
+
+	if err = pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	time.Sleep(d)
+	pprof.StopCPUProfile()
+
+	if err = f.Close(); err != nil {
+		return "", err
+	}
+
+	return f.Name(), a.Record(CPUProfile, f.Name())
+}
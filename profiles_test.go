@@ -0,0 +1,71 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProfileArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := NewProfileArtifacts("test.profiles", "goroutine", HeapProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000, 0)
+	a.now = func() time.Time { return now }
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	heap, err := a.CaptureHeap(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(heap); err != nil || fi.Size() == 0 {
+		t.Errorf("expected a heap profile at %v", heap)
+	}
+
+	if v, _ := a.location.ValInstance(HeapProfile); v.(string) != heap {
+		t.Errorf("expected the heap profile at %v, got %v", heap, v)
+	}
+
+	if v, _ := a.captured.ValInstance(HeapProfile); v.(int64) != 1000 {
+		t.Errorf("expected the heap profile to be captured at 1000, got %v", v)
+	}
+
+	now = now.Add(time.Second)
+	cpu, err := a.CaptureCPU(dir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := a.location.ValInstance(CPUProfile); v.(string) != cpu {
+		t.Errorf("expected the cpu profile at %v, got %v", cpu, v)
+	}
+
+	if err = a.Record("goroutine", "http://example.com/goroutine.pprof"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Record("block", "/tmp/block.pprof"); err == nil {
+		t.Error("expected an error for an undeclared profile")
+	}
+}
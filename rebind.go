@@ -0,0 +1,139 @@
+package speed
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/performancecopilot/speed/mmvdump"
+	"github.com/pkg/errors"
+)
+
+// LayoutFileSuffix is appended to the location of the MMV file of a client created
+// with WithPersistedLayout to get the location of its layout file.
+const LayoutFileSuffix = ".layout"
+
+// WithPersistedLayout makes the client write its Layout as JSON next to its MMV file
+// on Start, so the next run can find the values of its metrics in the file with
+// RebindExistingFile. The layout file is left in place on Stop, unless the MMV file
+// is erased as well.
+func WithPersistedLayout() ClientOption {
+	return func(c *PCPClient) error {
+		c.layoutFile = true
+		return nil
+	}
+}
+
+func (c *PCPClient) layoutPath() string {
+	return c.loc + LayoutFileSuffix
+}
+
+func (c *PCPClient) writeLayoutFile() error {
+	l, err := c.layout()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode the layout")
+	}
+
+	return writeFileAtomically(c.layoutPath(), data)
+}
+
+// ReadLayout reads a layout file written by a client created with WithPersistedLayout.
+func ReadLayout(path string) (*Layout, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the layout file")
+	}
+
+	var l Layout
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, errors.Wrap(err, "cannot decode the layout file")
+	}
+
+	return &l, nil
+}
+
+// rebind restores the values of the metrics in the registry from the passed MMV file,
+// found at the offsets in the persisted layout of the file. Without a layout, or with
+// a layout of another file, there is nothing to restore.
+func (c *PCPClient) rebind(data []byte) error {
+	l, err := ReadLayout(c.layoutPath())
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if l.Check(data) != nil {
+		return nil
+	}
+
+	samples, err := l.samples(data, c.r.Catalog())
+	if err != nil {
+		return errors.Wrap(err, "cannot read the values at the persisted layout")
+	}
+
+	c.restore(samples)
+	return nil
+}
+
+// samples reads the values of all metrics in the layout that are also in the passed
+// catalog, with the same type, semantics and unit, from the passed MMV file contents
+func (l *Layout) samples(data []byte, catalog []CatalogEntry) ([]Sample, error) {
+	existing, err := ReadCatalog(data)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, metrics, values, _, _, strs, err := mmvdump.Dump(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the MMV file")
+	}
+
+	current := make(map[string]CatalogEntry, len(catalog))
+	for _, e := range catalog {
+		current[e.Name] = e
+	}
+
+	compatible := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		m, ok := current[e.Name]
+		compatible[e.Name] = ok && e.Type == m.Type && e.Semantics == m.Semantics && e.Unit == m.Unit
+	}
+
+	var ans []Sample
+	for _, ml := range l.Metrics {
+		if !compatible[ml.Name] {
+			continue
+		}
+
+		m := metrics[uint64(ml.Offset)]
+
+		for _, vl := range ml.Values {
+			v := values[uint64(vl.Offset)]
+
+			// values without a value yet are not attached to their metric
+			if v.Metric == 0 {
+				continue
+			}
+
+			s := Sample{Metric: ml.Name, Instance: vl.Instance}
+
+			if m.Typ() == mmvdump.StringType {
+				s.Value = mmvString(strs, uint64(v.Extra))
+			} else if s.Value, err = mmvdump.FixedVal(v.Val, m.Typ()); err != nil {
+				return nil, errors.Wrapf(err, "cannot read the value of metric %v", ml.Name)
+			}
+
+			ans = append(ans, s)
+		}
+	}
+
+	return ans, nil
+}
@@ -0,0 +1,180 @@
+package speed
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRebindExistingFile(t *testing.T) {
+	c, err := NewPCPClient("rebind", WithPersistedLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	vector := c.MustRegisterString("test.vector[a,b]", Instances{"a": 0.0, "b": 0.0}, DoubleType, InstantSemantics, OneUnit).(*PCPInstanceMetric)
+	changed := c.MustRegisterString("test.changed", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+
+	counter.MustSet(int64(7))
+	vector.MustSetInstance(2.5, "b")
+	changed.MustSet(int64(3))
+
+	l, err := c.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	persisted, err := ReadLayout(c.loc + LayoutFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(l, persisted) {
+		t.Errorf("expected the persisted layout to be %+v, got %+v", l, persisted)
+	}
+
+	// as if the process crashed without stopping the client
+	data := append([]byte(nil), c.writer.Bytes()...)
+	c.MustStop()
+
+	if err = ioutil.WriteFile(c.loc, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(c.loc)
+	defer os.Remove(c.loc + LayoutFileSuffix)
+
+	// the next run adds a metric and changes the semantics of another
+	c, err = NewPCPClient("rebind", WithExistingFilePolicy(RebindExistingFile), WithPersistedLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added := c.MustRegisterString("test.added", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	counter = c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	vector = c.MustRegisterString("test.vector[a,b]", Instances{"a": 0.0, "b": 0.0}, DoubleType, InstantSemantics, OneUnit).(*PCPInstanceMetric)
+	changed = c.MustRegisterString("test.changed", int64(0), Int64Type, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+
+	if counter.Val() != int64(7) {
+		t.Errorf("expected the counter to be rebound to 7, got %v", counter.Val())
+	}
+
+	matchSingleDump(int64(7), counter, c, t)
+
+	if b, err := vector.ValInstance("b"); err != nil || b != 2.5 {
+		t.Errorf("expected the instance b to be rebound to 2.5, got %v", b)
+	}
+
+	if changed.Val() != int64(0) {
+		t.Errorf("expected a metric with different semantics to start over, got %v", changed.Val())
+	}
+
+	if added.Val() != int64(0) {
+		t.Errorf("expected an added metric to start at 0, got %v", added.Val())
+	}
+
+	// the layout is persisted again for the new set of metrics
+	l, _ = c.Layout()
+	if persisted, err = ReadLayout(c.loc + LayoutFileSuffix); err != nil || !reflect.DeepEqual(l, persisted) {
+		t.Errorf("expected the layout to be persisted again, got %v", err)
+	}
+
+	c.MustStop()
+}
+
+func TestRebindWithoutLayout(t *testing.T) {
+	loc := leaveBehind(t, 5)
+	defer os.Remove(loc)
+
+	c, err := NewPCPClient("existing", WithExistingFilePolicy(RebindExistingFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+	defer c.MustStop()
+
+	if m.Val() != int64(0) {
+		t.Errorf("expected the counter to start over without a layout, got %v", m.Val())
+	}
+
+	if _, err := os.Stat(loc + LayoutFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected no layout file without WithPersistedLayout, got %v", err)
+	}
+}
+
+func TestRebindWithUnreadableLayout(t *testing.T) {
+	loc := leaveBehind(t, 5)
+	defer os.Remove(loc)
+
+	if err := ioutil.WriteFile(loc+LayoutFileSuffix, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(loc + LayoutFileSuffix)
+
+	c, err := NewPCPClient("existing", WithExistingFilePolicy(RebindExistingFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit)
+
+	if err = c.Start(); err == nil {
+		c.MustStop()
+		t.Error("expected an error rebinding with an unreadable layout file")
+	}
+}
+
+func TestRebindLazily(t *testing.T) {
+	c, err := NewPCPClient("rebind", WithPersistedLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+	m.MustSet(int64(7))
+
+	data := append([]byte(nil), c.writer.Bytes()...)
+	c.MustStop()
+
+	if err = ioutil.WriteFile(c.loc, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(c.loc)
+	defer os.Remove(c.loc + LayoutFileSuffix)
+
+	c, err = NewPCPClient("rebind", WithExistingFilePolicy(RebindExistingFile), WithPersistedLayout(), WithLazyStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+
+	if m.Val() != int64(7) {
+		t.Errorf("expected the counter to be rebound to 7 on Start, got %v", m.Val())
+	}
+
+	// the first update maps the client, holding the lock of the metric
+	done := make(chan error)
+	go func() { done <- m.Set(int64(8)) }()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		// not stopping the client, which is locked by the update
+		t.Fatal("expected mapping a lazily started client not to deadlock")
+	}
+
+	matchSingleDump(int64(8), m, c, t)
+	c.MustStop()
+}
@@ -0,0 +1,57 @@
+package speed
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ErrReentrantUpdate is returned by updates of a metric from a callback running while
+// the same metric is updated, the report function of WithSemanticsVerifier or the
+// OnError function of a WritePolicy, as waiting for the lock of the metric held by the
+// update running the callback would never return.
+//
+// Updating other metrics from such callbacks is fine.
+var ErrReentrantUpdate = errors.New("metric updated from a callback of its own update")
+
+// goroutineID returns the id of the calling goroutine, as printed in its stack trace
+func goroutineID() int64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+
+	if i := bytes.IndexByte(b, ' '); i != -1 {
+		b = b[:i]
+	}
+
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// callback runs a callback of an update of the metric, which holds its lock,
+// marking the calling goroutine so updates of the metric from it fail instead of
+// deadlocking. The metric can be nil, for metrics that are not registered.
+func (md *pcpMetricDesc) callback(f func()) {
+	if md == nil {
+		f()
+		return
+	}
+
+	prev := atomic.SwapInt64(&md.callbackGoroutine, goroutineID())
+	defer atomic.StoreInt64(&md.callbackGoroutine, prev)
+
+	f()
+}
+
+// reentrant returns ErrReentrantUpdate if called from a callback of an update of the
+// metric, and has to be checked before locking it. Only the goroutine holding the lock
+// can run a callback, so other goroutines only pay for an atomic load.
+func (md *pcpMetricDesc) reentrant() error {
+	if g := atomic.LoadInt64(&md.callbackGoroutine); g != 0 && g == goroutineID() {
+		return ErrReentrantUpdate
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package speed
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReentrantUpdate(t *testing.T) {
+	var (
+		m, other *PCPSingletonMetric
+		errs     []error
+	)
+
+	c, err := NewPCPClient("reentrant", WithSemanticsVerifier(func(w SemanticsWarning) {
+		// updating the reported metric would wait for its own update
+		errs = append(errs, m.Set(int64(0)), other.Set(int64(1)))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = c.MustRegisterString("test.counter", int64(5), Int64Type, CounterSemantics, OneUnit).(*PCPSingletonMetric)
+	other = c.MustRegisterString("test.other", int64(0), Int64Type, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+	defer c.MustStop()
+
+	// decreasing counters are reported
+	done := make(chan error)
+	go func() {
+		for _, v := range []int64{4, 3, 2, 1} {
+			if err := m.Set(v); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an update from the report function not to deadlock")
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 2 || errs[0] != ErrReentrantUpdate || errs[1] != nil {
+		t.Errorf("expected only the update of the reported metric to fail, got %v", errs)
+	}
+
+	if v := other.Val(); v != int64(1) {
+		t.Errorf("expected the other metric to be updated, got %v", v)
+	}
+
+	// once the update returns, the metric can be updated again
+	if err = m.Set(int64(6)); err != nil {
+		t.Errorf("expected the metric to be updated after the callback, got %v", err)
+	}
+}
+
+func TestReentrantUpdateFromWritePolicy(t *testing.T) {
+	md, err := newpcpMetricDesc("test.metric", Int64Type, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reentrant error
+	p := WritePolicy{OnError: func(string, error) { reentrant = md.reentrant() }}
+
+	var dropped uint64
+	_ = p.wrap("test.metric", md, func(interface{}) error { return errors.New("failed") }, &dropped)(1)
+
+	if reentrant != ErrReentrantUpdate {
+		t.Errorf("expected updates from OnError to be reentrant, got %v", reentrant)
+	}
+
+	if err = md.reentrant(); err != nil {
+		t.Errorf("expected updates after OnError not to be reentrant, got %v", err)
+	}
+}
+
+func TestGoroutineID(t *testing.T) {
+	id := goroutineID()
+	if id <= 0 {
+		t.Fatalf("expected a positive goroutine id, got %v", id)
+	}
+
+	other := make(chan int64)
+	go func() { other <- goroutineID() }()
+
+	if o := <-other; o == id || o <= 0 {
+		t.Errorf("expected another goroutine to have another id, got %v and %v", id, o)
+	}
+}
+
+func TestReentrantResets(t *testing.T) {
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := NewPCPCounterVector(map[string]int64{"a": 0}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewPCPHistogram("test.histogram", 0, 100, 3, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slo, err := NewPCPSLO("test.slo", 0.99, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		md     *pcpMetricDesc
+		update func() error
+	}{
+		{"PCPCounter.Reset", counter.pcpMetricDesc, counter.Reset},
+		{"PCPCounterVector.Reset", vector.pcpMetricDesc, vector.Reset},
+		{"PCPHistogram.Reset", h.pcpMetricDesc, h.Reset},
+		{"PCPSLO.Success", slo.pcpMetricDesc, slo.Success},
+		{"PCPSLO.Failure", slo.pcpMetricDesc, slo.Failure},
+		{"PCPSLO.Observe", slo.pcpMetricDesc, func() error { return slo.Observe(time.Millisecond) }},
+	}
+
+	for _, c := range cases {
+		// as if called from a callback of an update, holding the lock of the metric
+		done := make(chan error)
+		go c.md.callback(func() { done <- c.update() })
+
+		select {
+		case err := <-done:
+			if err != ErrReentrantUpdate {
+				t.Errorf("expected %v from a callback to fail with ErrReentrantUpdate, got %v", c.name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %v from a callback not to deadlock", c.name)
+		}
+
+		if err := c.update(); err != nil {
+			t.Errorf("expected %v outside of a callback to succeed, got %v", c.name, err)
+		}
+	}
+}
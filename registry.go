@@ -3,7 +3,9 @@ package speed
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 )
@@ -42,6 +44,9 @@ type Registry interface {
 
 	// adds a Metric object after parsing the passed string for Instances and InstanceDomains
 	AddMetricByString(name string, val interface{}, t MetricType, s MetricSemantics, u MetricUnit) (Metric, error)
+
+	// returns a description of all metrics in the current registry
+	Catalog() []CatalogEntry
 }
 
 // PCPRegistry implements a registry for PCP as the client
@@ -64,9 +69,12 @@ type PCPRegistry struct {
 	instanceCount int
 	valueCount    int
 	stringcount   int
+	helpcount     int // number of strings used for short and long descriptions
 
 	mapped   bool
 	version2 bool // a flag that maintains whether we need to write mmv version 2
+
+	panicHandler func(error) // set on all added metrics, see WithPanicHandler
 }
 
 // NewPCPRegistry creates a new PCPRegistry object
@@ -107,10 +115,38 @@ func (r *PCPRegistry) ValuesCount() int { return r.valueCount }
 // StringCount returns the number of strings in the registry
 func (r *PCPRegistry) StringCount() int {
 	if r.version2 {
-		return r.stringcount + r.MetricCount() + r.InstanceCount()
+		return r.stringcount + r.helpcount + r.MetricCount() + r.InstanceCount()
+	}
+
+	return r.stringcount + r.helpcount
+}
+
+// sortedInstanceDomains returns the instance domains in the registry sorted by name
+func (r *PCPRegistry) sortedInstanceDomains() []*PCPInstanceDomain {
+	r.indomlock.RLock()
+	defer r.indomlock.RUnlock()
+
+	ans := make([]*PCPInstanceDomain, 0, len(r.instanceDomains))
+	for _, indom := range r.instanceDomains {
+		ans = append(ans, indom)
 	}
 
-	return r.stringcount
+	sort.Slice(ans, func(i, j int) bool { return ans[i].name < ans[j].name })
+	return ans
+}
+
+// sortedMetrics returns the metrics in the registry sorted by name
+func (r *PCPRegistry) sortedMetrics() []PCPMetric {
+	r.metricslock.RLock()
+	defer r.metricslock.RUnlock()
+
+	ans := make([]PCPMetric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		ans = append(ans, m)
+	}
+
+	sort.Slice(ans, func(i, j int) bool { return ans[i].Name() < ans[j].Name() })
+	return ans
 }
 
 // HasInstanceDomain returns true if the registry already has an indom of the specified name
@@ -122,6 +158,17 @@ func (r *PCPRegistry) HasInstanceDomain(name string) bool {
 	return present
 }
 
+// instanceDomain returns the indom registered under the passed name, if any.
+//
+// Metrics can hold an equivalent copy of the registered indom, so the registered
+// one is the one that is written, and that has to be used for instance offsets.
+func (r *PCPRegistry) instanceDomain(name string) *PCPInstanceDomain {
+	r.indomlock.RLock()
+	defer r.indomlock.RUnlock()
+
+	return r.instanceDomains[name]
+}
+
 // HasMetric returns true if the registry already has a metric of the specified name
 func (r *PCPRegistry) HasMetric(name string) bool {
 	r.metricslock.RLock()
@@ -144,6 +191,23 @@ func (r *PCPRegistry) AddInstanceDomain(indom InstanceDomain) error {
 		return errors.New("Cannot add an indom when a mapping is active")
 	}
 
+	if err := checkLimit("instance domains", len(r.instanceDomains), 1, MaxInstanceDomains); err != nil {
+		return err
+	}
+
+	if err := checkLimit("instances", r.instanceCount, indom.InstanceCount(), MaxInstances); err != nil {
+		return err
+	}
+
+	for _, other := range r.instanceDomains {
+		if other.ID() == indom.ID() {
+			return errors.Errorf(
+				"InstanceDomain %v has the same id %v as %v, use NewPCPInstanceDomainWithID to assign a different one",
+				indom.Name(), indom.ID(), other.Name(),
+			)
+		}
+	}
+
 	r.instanceDomains[indom.Name()] = indom.(*PCPInstanceDomain)
 	r.instanceCount += indom.InstanceCount()
 
@@ -156,11 +220,11 @@ func (r *PCPRegistry) AddInstanceDomain(indom InstanceDomain) error {
 	}
 
 	if indom.(*PCPInstanceDomain).shortDescription != "" {
-		r.stringcount++
+		r.helpcount++
 	}
 
 	if indom.(*PCPInstanceDomain).longDescription != "" {
-		r.stringcount++
+		r.helpcount++
 	}
 
 	return nil
@@ -169,6 +233,14 @@ func (r *PCPRegistry) AddInstanceDomain(indom InstanceDomain) error {
 func (r *PCPRegistry) addMetric(m PCPMetric) {
 	r.metrics[m.Name()] = m
 
+	if dm, ok := m.(describedMetric); ok {
+		atomic.StoreInt32(&dm.desc().registered, 1)
+
+		if r.panicHandler != nil {
+			dm.desc().panicHandler = r.panicHandler
+		}
+	}
+
 	if len(m.Name()) > MaxV1NameLength && !r.version2 {
 		r.version2 = true
 	}
@@ -180,15 +252,15 @@ func (r *PCPRegistry) addMetric(m PCPMetric) {
 
 	r.valueCount += currentValues
 	if m.Type() == StringType {
-		r.stringcount += currentValues
+		r.stringcount += stringBlocks * currentValues
 	}
 
 	if m.ShortDescription() != "" {
-		r.stringcount++
+		r.helpcount++
 	}
 
 	if m.LongDescription() != "" {
-		r.stringcount++
+		r.helpcount++
 	}
 }
 
@@ -204,18 +276,42 @@ func (r *PCPRegistry) AddMetric(m Metric) error {
 
 	pcpm := m.(PCPMetric)
 
+	values := 1
+	if indom := pcpm.Indom(); indom != nil {
+		values = indom.InstanceCount()
+	}
+
+	if err := checkLimit("metrics", r.MetricCount(), 1, MaxMetrics); err != nil {
+		return err
+	}
+
+	if err := checkLimit("values", r.ValuesCount(), values, MaxValues); err != nil {
+		return err
+	}
+
 	// if it is an indom metric
-	if pcpm.Indom() != nil && !r.HasInstanceDomain(pcpm.Indom().Name()) {
-		err := r.AddInstanceDomain(pcpm.Indom())
-		if err != nil {
-			return err
+	if indom := pcpm.Indom(); indom != nil {
+		if other := r.instanceDomain(indom.Name()); other == nil {
+			if err := r.AddInstanceDomain(indom); err != nil {
+				return err
+			}
+		} else if other != indom && (other.ID() != indom.ID() || !other.MatchInstances(indom.Instances())) {
+			return errors.Errorf("a different InstanceDomain named %v is already defined for the current registry", indom.Name())
 		}
 	}
 
 	r.metricslock.Lock()
-	defer r.metricslock.Unlock()
-
 	r.addMetric(pcpm)
+	r.metricslock.Unlock()
+
+	if dm, ok := m.(describedMetric); ok {
+		for _, cm := range dm.desc().companions {
+			if err := r.AddMetric(cm); err != nil {
+				return errors.Wrapf(err, "cannot add companion metric %v", cm.Name())
+			}
+		}
+	}
+
 	return nil
 }
 
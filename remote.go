@@ -0,0 +1,250 @@
+package speed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+	"github.com/pkg/errors"
+)
+
+// RemoteWriteNameHeader is the HTTP header holding the name of a pushed MMV file.
+const RemoteWriteNameHeader = "X-MMV-Name"
+
+// RemoteWritePrefix prefixes the names of the files written by RemoteWriteHandler, so
+// pushed files cannot replace the files of local clients in the same directory.
+const RemoteWritePrefix = "remote_"
+
+// maxRemoteWriteSize is the maximum size of an MMV file accepted by RemoteWriteHandler
+const maxRemoteWriteSize = 64 << 20
+
+// remoteWriter periodically pushes the MMV file of a client over HTTP
+type remoteWriter struct {
+	mutex    sync.Mutex
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	quit, done chan struct{}
+}
+
+// WithRemoteWrite makes the client push its complete MMV file to the passed URL on the
+// passed interval while it is started, and once more on Stop, for containers where the
+// MMV directory is not shared with the pmcd of the host.
+//
+// Every push is a PUT with the file as the body, and the name of the client in the
+// RemoteWriteNameHeader header. On the host, RemoteWriteHandler places pushed files in
+// the MMV directory, under the name prefixed with RemoteWritePrefix, for example
+// behind pmproxy, or as a standalone agent.
+func WithRemoteWrite(url string, interval time.Duration) ClientOption {
+	return func(c *PCPClient) error {
+		if url == "" {
+			return errors.New("remote write needs a URL")
+		}
+
+		if interval <= 0 {
+			return errors.New("remote write interval must be positive")
+		}
+
+		c.remote = &remoteWriter{
+			url:      url,
+			interval: interval,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}
+		return nil
+	}
+}
+
+// WithoutLocalFile keeps the MMV file of the client in memory instead of mapping
+// a file in the MMV directory, for clients that only push it with WithRemoteWrite.
+func WithoutLocalFile() ClientOption {
+	return func(c *PCPClient) error {
+		c.noFile = true
+		return nil
+	}
+}
+
+// start starts pushing the MMV file of the passed client, which is locked.
+func (w *remoteWriter) start(c *PCPClient) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.quit != nil {
+		return
+	}
+
+	quit, done := make(chan struct{}), make(chan struct{})
+	w.quit, w.done = quit, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(w.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				_ = c.Push()
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops pushing periodically, if running.
+func (w *remoteWriter) stop() {
+	w.mutex.Lock()
+	quit, done := w.quit, w.done
+	w.quit, w.done = nil, nil
+	w.mutex.Unlock()
+
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+}
+
+func (w *remoteWriter) push(name string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, w.url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "cannot create the remote write request")
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(RemoteWriteNameHeader, name)
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot push the MMV file")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return errors.Errorf("remote write responded with %v", res.Status)
+	}
+
+	return nil
+}
+
+// Push pushes the MMV file of a started client created with WithRemoteWrite right away.
+func (c *PCPClient) Push() error {
+	c.mutex.Lock()
+	name, data, err := c.remoteSnapshot()
+	c.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// the client is not locked while pushing, so a slow endpoint does not block it
+	return c.remote.push(name, data)
+}
+
+// remoteSnapshot returns the name and a copy of the contents of the MMV file to push,
+// and has to be called with the client locked
+func (c *PCPClient) remoteSnapshot() (string, []byte, error) {
+	if c.remote == nil {
+		return "", nil, errors.New("client was not created with WithRemoteWrite")
+	}
+
+	if c.writer == nil {
+		return "", nil, errors.New("cannot push the MMV file of a client that is not mapped")
+	}
+
+	return filepath.Base(c.loc), append([]byte(nil), c.writer.Bytes()...), nil
+}
+
+// RemoteWriteHandler returns a handler receiving MMV files pushed by clients created
+// with WithRemoteWrite, and placing them in the passed directory, usually the mmv
+// directory under PCP_TMP_DIR, where pmdammv picks them up.
+//
+// Pushed files are named after the RemoteWriteNameHeader header prefixed with
+// RemoteWritePrefix, so a file pushed as "app" is written as "remote_app", and never
+// replaces the file of a local client. Files are replaced atomically. The ProcessFlag
+// is cleared from pushed files, as the processes that pushed them are usually not
+// visible to pmdammv on the host.
+//
+// All requests go through the passed auth middleware, which should reject the ones
+// from clients that are not allowed to push, like for AdminHandler. It is required,
+// a handler accepting files from anyone who can reach it has to be asked for
+// explicitly with InsecureNoAuth.
+func RemoteWriteHandler(dir string, auth func(http.Handler) http.Handler) (http.Handler, error) {
+	if auth == nil {
+		return nil, errors.New("the remote write handler needs an auth middleware, pass InsecureNoAuth to allow all requests")
+	}
+
+	return auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.Header().Set("Allow", http.MethodPut)
+			http.Error(w, "only PUT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.Header.Get(RemoteWriteNameHeader)
+		if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+			http.Error(w, "invalid MMV file name", http.StatusBadRequest)
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRemoteWriteSize))
+		if err != nil {
+			http.Error(w, "cannot read the MMV file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, _, _, _, _, _, _, err = mmvdump.Dump(data); err != nil {
+			http.Error(w, "invalid MMV file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the flags follow the tag, version, both generations and the toc count
+		flag := binary.LittleEndian.Uint32(data[28:])
+		binary.LittleEndian.PutUint32(data[28:], flag&^uint32(ProcessFlag))
+
+		if err = writeFileAtomically(filepath.Join(dir, RemoteWritePrefix+name), data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})), nil
+}
+
+// writeFileAtomically writes a file by renaming a temporary file in the same directory
+func writeFileAtomically(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+
+	f, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return errors.Wrap(err, "cannot create the MMV file")
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrap(err, "cannot write the MMV file")
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package speed
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := RemoteWriteHandler(dir, InsecureNoAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c, err := NewPCPClient("remote", WithRemoteWrite(s.URL, time.Hour), WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+
+	os.Remove(c.loc)
+	c.MustStart()
+
+	counter.MustInc(2)
+	if err = c.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func() int64 {
+		data, err := ioutil.ReadFile(filepath.Join(dir, RemoteWritePrefix+"remote"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h, _, _, _, _, _, _, err := mmvdump.Dump(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.Flag&int32(ProcessFlag) != 0 {
+			t.Error("expected the process flag to be cleared")
+		}
+
+		samples, err := ReadSamples(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return samples[0].Value.(int64)
+	}
+
+	if v := read(); v != 2 {
+		t.Errorf("expected the pushed counter to be 2, got %v", v)
+	}
+
+	// stopping pushes the latest values
+	counter.MustInc(3)
+	c.MustStop()
+
+	if v := read(); v != 5 {
+		t.Errorf("expected the pushed counter to be 5, got %v", v)
+	}
+
+	if _, err = os.Stat(c.loc); !os.IsNotExist(err) {
+		t.Errorf("expected no local MMV file, got %v", err)
+	}
+}
+
+func TestRemoteWriteHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err = RemoteWriteHandler(dir, nil); err == nil {
+		t.Error("expected an error creating a remote write handler without auth")
+	}
+
+	authorized := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	h, err := RemoteWriteHandler(dir, authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("app", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit)
+	c.MustStart()
+	defer c.MustStop()
+
+	data := append([]byte(nil), c.writer.Bytes()...)
+
+	cases := []struct {
+		method, name string
+		body         []byte
+		status       int
+	}{
+		{http.MethodPut, "app", data, http.StatusUnauthorized},
+		{http.MethodGet, "app", nil, http.StatusMethodNotAllowed},
+		{http.MethodPut, "", []byte("MMV"), http.StatusBadRequest},
+		{http.MethodPut, "../app", []byte("MMV"), http.StatusBadRequest},
+		{http.MethodPut, ".app", []byte("MMV"), http.StatusBadRequest},
+		{http.MethodPut, "app", []byte("not an mmv file"), http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/", bytes.NewReader(c.body))
+		req.Header.Set(RemoteWriteNameHeader, c.name)
+		if c.status != http.StatusUnauthorized {
+			req.Header.Set("Authorization", "secret")
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("expected %v for a %v of %q, got %v", c.status, c.method, c.name, w.Code)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected no files to be written, got %v", len(files))
+	}
+
+	// a pushed file cannot replace the file of a local client with the same name
+	local := []byte("local")
+	if err = ioutil.WriteFile(filepath.Join(dir, "app"), local, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(data))
+	req.Header.Set(RemoteWriteNameHeader, "app")
+	req.Header.Set("Authorization", "secret")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected the file to be written, got %v %v", w.Code, w.Body.String())
+	}
+
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "app")); !bytes.Equal(b, local) {
+		t.Error("expected the file of the local client to be left alone")
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, RemoteWritePrefix+"app")); err != nil {
+		t.Errorf("expected the pushed file to be prefixed, got %v", err)
+	}
+}
+
+func TestPushDoesNotBlockClient(t *testing.T) {
+	received, release := make(chan struct{}), make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer s.Close()
+
+	c, err := NewPCPClient("remote", WithRemoteWrite(s.URL, time.Hour), WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("test.counter", int64(0), Int64Type, CounterSemantics, OneUnit)
+	c.MustStart()
+
+	for _, push := range []func() error{c.Push, c.Flush} {
+		pushed := make(chan error)
+		go func() { pushed <- push() }()
+		<-received
+
+		// the client is not locked while the endpoint is responding
+		locked := make(chan struct{})
+		go func() {
+			c.RefreshInterval()
+			close(locked)
+		}()
+
+		select {
+		case <-locked:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the client not to be locked while pushing")
+		}
+
+		release <- struct{}{}
+		if err = <-pushed; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the final push on stop happens without the client locked too
+	stopped := make(chan error)
+	go func() { stopped <- c.Stop() }()
+	<-received
+	release <- struct{}{}
+
+	if err = <-stopped; err != nil {
+		t.Fatal(err)
+	}
+}
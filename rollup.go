@@ -0,0 +1,348 @@
+package speed
+
+import (
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RollupKind is an enumerated type for the aggregations of all instances
+// of an instance metric, see WithRollup.
+type RollupKind int
+
+// Possible values for a RollupKind
+const (
+	SumRollup RollupKind = iota
+	MaxRollup
+	MinRollup
+	AvgRollup
+)
+
+func (k RollupKind) String() string {
+	switch k {
+	case SumRollup:
+		return "sum"
+	case MaxRollup:
+		return "max"
+	case MinRollup:
+		return "min"
+	case AvgRollup:
+		return "avg"
+	}
+
+	return "RollupKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// rollup is a companion singleton aggregating all instances of a metric
+type rollup struct {
+	kind   RollupKind
+	metric *PCPSingletonMetric
+}
+
+// rollupTracker maintains the roll ups of an instance metric
+type rollupTracker struct {
+	mutex    sync.Mutex
+	vals     map[string]*instanceValue
+	sum      float64
+	max, min float64
+	rollups  []rollup
+}
+
+func newrollupTracker(vals map[string]*instanceValue, rollups []rollup) *rollupTracker {
+	t := &rollupTracker{vals: vals, rollups: rollups}
+	t.recompute()
+	t.write()
+	return t
+}
+
+// recompute aggregates all instances from scratch
+func (t *rollupTracker) recompute() {
+	t.sum, t.max, t.min = 0, math.Inf(-1), math.Inf(1)
+
+	for _, v := range t.vals {
+		f, _ := sampleFloat(v.val)
+		t.sum += f
+		t.max = math.Max(t.max, f)
+		t.min = math.Min(t.min, f)
+	}
+}
+
+// refresh aggregates all instances after their values were replaced
+func (t *rollupTracker) refresh() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.recompute()
+	t.write()
+}
+
+// update updates the aggregates for an instance that changed from old to val,
+// only going over all instances when the instance holding the max or min moves away from it
+func (t *rollupTracker) update(old, val interface{}) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	o, _ := sampleFloat(old)
+	f, _ := sampleFloat(val)
+
+	t.sum += f - o
+
+	if (o == t.max && f < o) || (o == t.min && f > o) {
+		t.recompute()
+	} else {
+		t.max = math.Max(t.max, f)
+		t.min = math.Min(t.min, f)
+	}
+
+	t.write()
+}
+
+// write sets the values of the companions
+func (t *rollupTracker) write() {
+	for _, r := range t.rollups {
+		var f float64
+
+		switch r.kind {
+		case SumRollup:
+			f = t.sum
+		case MaxRollup:
+			f = t.max
+		case MinRollup:
+			f = t.min
+		case AvgRollup:
+			f = t.sum / float64(len(t.vals))
+		}
+
+		r.metric.mutex.Lock()
+		_ = r.metric.set(f)
+		r.metric.mutex.Unlock()
+	}
+}
+
+// WithRollup creates a companion instant singleton metric named "<name>.<kind>",
+// for example "<name>.sum", for each passed kind, aggregating all instances of
+// an instance metric, so dashboards get totals without aggregating on the server.
+// The companions are updated along with the instances of the metric.
+//
+// The companions are DoubleType metrics with the unit of the metric, so sums of
+// 64 bit integers are exact up to 2^53. They are registered along with the metric,
+// so the option has to be applied before registering the metric with a client.
+func WithRollup(kinds ...RollupKind) MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if md.instanceValues == nil {
+			return errors.Errorf("metric %v has no instances to roll up", md.name)
+		}
+
+		if md.t == StringType {
+			return errors.Errorf("cannot roll up string metric %v", md.name)
+		}
+
+		if md.rollup != nil {
+			return errors.Errorf("metric %v already has roll ups", md.name)
+		}
+
+		if len(kinds) == 0 {
+			return errors.New("no roll ups passed")
+		}
+
+		seen := make(map[RollupKind]bool)
+		rollups := make([]rollup, 0, len(kinds))
+		for _, k := range kinds {
+			if k < SumRollup || k > AvgRollup {
+				return errors.Errorf("invalid roll up %v", k)
+			}
+
+			if seen[k] {
+				return errors.Errorf("roll up %v passed twice", k)
+			}
+			seen[k] = true
+
+			m, err := NewPCPSingletonMetric(
+				float64(0), md.name+"."+k.String(), DoubleType, InstantSemantics, md.u,
+				k.String()+" of all instances of "+md.name,
+			)
+			if err != nil {
+				return err
+			}
+
+			rollups = append(rollups, rollup{k, m})
+		}
+
+		md.rollup = newrollupTracker(md.instanceValues, rollups)
+		for _, r := range rollups {
+			md.companions = append(md.companions, r.metric)
+		}
+
+		return nil
+	}
+}
+
+// Rollup returns the companion of the passed kind created by WithRollup, or nil.
+func (md *pcpMetricDesc) Rollup(kind RollupKind) *PCPSingletonMetric {
+	if md.rollup == nil {
+		return nil
+	}
+
+	for _, r := range md.rollup.rollups {
+		if r.kind == kind {
+			return r.metric
+		}
+	}
+
+	return nil
+}
+
+// weightedAverage maintains the average of the instances of a metric,
+// weighted by the same instances of a sibling metric
+type weightedAverage struct {
+	mutex           sync.Mutex
+	values, weights map[string]float64
+	sum, total      float64 // sum of the weighted values and of the weights
+	metric          *PCPSingletonMetric
+}
+
+func newweightedAverage(values, weights map[string]float64, metric *PCPSingletonMetric) *weightedAverage {
+	a := &weightedAverage{values: values, weights: weights, metric: metric}
+
+	for i, v := range values {
+		a.sum += v * weights[i]
+		a.total += weights[i]
+	}
+
+	a.write()
+	return a
+}
+
+// floats returns the values of all instances as float64
+func floats(vals map[string]*instanceValue) map[string]float64 {
+	ans := make(map[string]float64, len(vals))
+	for i, v := range vals {
+		ans[i], _ = sampleFloat(v.val)
+	}
+	return ans
+}
+
+func (a *weightedAverage) clone() *weightedAverage {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	values, weights := make(map[string]float64), make(map[string]float64)
+	for i := range a.values {
+		values[i], weights[i] = a.values[i], a.weights[i]
+	}
+
+	return newweightedAverage(values, weights, a.metric.Clone())
+}
+
+// setValue updates the average for a changed value of an instance
+func (a *weightedAverage) setValue(instance string, val interface{}) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, _ := sampleFloat(val)
+	a.sum += (f - a.values[instance]) * a.weights[instance]
+	a.values[instance] = f
+
+	a.write()
+}
+
+// setWeight updates the average for a changed weight of an instance
+func (a *weightedAverage) setWeight(instance string, val interface{}) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, _ := sampleFloat(val)
+	a.sum += a.values[instance] * (f - a.weights[instance])
+	a.total += f - a.weights[instance]
+	a.weights[instance] = f
+
+	a.write()
+}
+
+// write sets the value of the companion, which is 0 while all weights are 0
+func (a *weightedAverage) write() {
+	var f float64
+	if a.total != 0 {
+		f = a.sum / a.total
+	}
+
+	a.metric.mutex.Lock()
+	_ = a.metric.set(f)
+	a.metric.mutex.Unlock()
+}
+
+// WithWeightedAverage creates a companion instant singleton metric named "<name>.weighted_avg",
+// with the average of all instances of an instance metric weighted by the same instances of
+// the passed sibling metric, for example, the average latency across shards weighted by the
+// number of requests to each shard. The companion is updated along with either metric.
+//
+// Both metrics need the same instances. A clone of the metric keeps a companion
+// of its own, which only follows the values of the clone, with the weights at the
+// time it was cloned.
+//
+// The companion is a DoubleType metric with the unit of the metric. It is registered
+// along with the metric, so the option has to be applied before registering the metric
+// with a client.
+func WithWeightedAverage(weights Metric) MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if md.instanceValues == nil {
+			return errors.Errorf("metric %v has no instances to average", md.name)
+		}
+
+		if md.t == StringType {
+			return errors.Errorf("cannot average string metric %v", md.name)
+		}
+
+		if md.weighted != nil {
+			return errors.Errorf("metric %v already has a weighted average", md.name)
+		}
+
+		w, ok := weights.(instanceMetric)
+		if !ok {
+			return errors.Errorf("weights %v are not an instance metric", weights.Name())
+		}
+
+		wm := w.instances()
+		if wm.pcpMetricDesc == md {
+			return errors.Errorf("metric %v cannot be weighted by itself", md.name)
+		}
+
+		if wm.t == StringType {
+			return errors.Errorf("cannot weight by string metric %v", wm.name)
+		}
+
+		if len(wm.vals) != len(md.instanceValues) {
+			return errors.Errorf("weights %v do not have the instances of %v", wm.name, md.name)
+		}
+
+		for i := range md.instanceValues {
+			if _, ok := wm.vals[i]; !ok {
+				return errors.Errorf("weights %v do not have instance %v of %v", wm.name, i, md.name)
+			}
+		}
+
+		m, err := NewPCPSingletonMetric(
+			float64(0), md.name+".weighted_avg", DoubleType, InstantSemantics, md.u,
+			"average of all instances of "+md.name+" weighted by "+wm.name,
+		)
+		if err != nil {
+			return err
+		}
+
+		md.weighted = newweightedAverage(floats(md.instanceValues), floats(wm.vals), m)
+		wm.weighting = append(wm.weighting, md.weighted)
+		md.companions = append(md.companions, m)
+		return nil
+	}
+}
+
+// WeightedAverage returns the companion created by WithWeightedAverage, or nil.
+func (md *pcpMetricDesc) WeightedAverage() *PCPSingletonMetric {
+	if md.weighted == nil {
+		return nil
+	}
+
+	return md.weighted.metric
+}
@@ -0,0 +1,176 @@
+package speed
+
+import "testing"
+
+func TestRollup(t *testing.T) {
+	m, err := NewPCPGaugeVector(map[string]float64{"a": 1, "b": 2, "c": 3}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Apply(WithRollup(SumRollup, MaxRollup, MinRollup, AvgRollup)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(m)
+
+	for _, name := range []string{"test.vector.sum", "test.vector.max", "test.vector.min", "test.vector.avg"} {
+		if !c.r.HasMetric(name) {
+			t.Errorf("expected %v to be registered along with the metric", name)
+		}
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	check := func(sum, max, min, avg float64) {
+		t.Helper()
+
+		for k, v := range map[RollupKind]float64{SumRollup: sum, MaxRollup: max, MinRollup: min, AvgRollup: avg} {
+			if r := m.Rollup(k).Val(); r != v {
+				t.Errorf("expected the %v to be %v, got %v", k, v, r)
+			}
+		}
+	}
+
+	check(6, 3, 1, 2)
+
+	m.MustSet(9, "a")
+	check(14, 9, 2, 14.0/3)
+
+	// the max moving down finds the new max
+	m.MustSet(0, "a")
+	check(5, 3, 0, 5.0/3)
+
+	samples, err := c.Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range samples {
+		if s.Metric == "test.vector.sum" && s.Value != float64(5) {
+			t.Errorf("expected a written sum of 5, got %v", s.Value)
+		}
+	}
+
+	clone := m.Clone()
+	if clone.Rollup(SumRollup) == m.Rollup(SumRollup) {
+		t.Error("expected the clone to have its own roll ups")
+	}
+
+	clone.MustSet(1, "a")
+	if clone.Rollup(SumRollup).Val() != float64(6) || m.Rollup(SumRollup).Val() != float64(5) {
+		t.Errorf("expected the roll ups of the clone to be independent, got %v and %v",
+			clone.Rollup(SumRollup).Val(), m.Rollup(SumRollup).Val())
+	}
+}
+
+func TestRollupErrors(t *testing.T) {
+	g, err := NewPCPGauge(0, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.Apply(WithRollup(SumRollup)); err == nil {
+		t.Error("expected an error rolling up a singleton metric")
+	}
+
+	m, err := NewPCPGaugeVector(map[string]float64{"a": 1}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Apply(WithRollup(SumRollup, SumRollup)); err == nil {
+		t.Error("expected an error passing a roll up twice")
+	}
+
+	if err = m.Apply(WithRollup(RollupKind(7))); err == nil {
+		t.Error("expected an error passing an invalid roll up")
+	}
+}
+
+func TestWeightedAverage(t *testing.T) {
+	latency, err := NewPCPGaugeVector(map[string]float64{"a": 10, "b": 20}, "test.latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests, err := NewPCPCounterVector(map[string]int64{"a": 3, "b": 1}, "test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = latency.Apply(WithWeightedAverage(requests)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(latency)
+	c.MustRegister(requests)
+
+	if !c.r.HasMetric("test.latency.weighted_avg") {
+		t.Error("expected the weighted average to be registered along with the metric")
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	avg := latency.WeightedAverage()
+	if avg.Val() != 12.5 {
+		t.Errorf("expected a weighted average of 12.5, got %v", avg.Val())
+	}
+
+	latency.MustSet(30, "b")
+	if avg.Val() != 15.0 {
+		t.Errorf("expected a weighted average of 15 after a value changed, got %v", avg.Val())
+	}
+
+	requests.MustInc(2, "b")
+	if avg.Val() != 20.0 {
+		t.Errorf("expected a weighted average of 20 after a weight changed, got %v", avg.Val())
+	}
+
+	// updating a clone of the weights leaves the average alone
+	requests.Clone().MustInc(10, "a")
+	if avg.Val() != 20.0 {
+		t.Errorf("expected a weighted average of 20 after a clone of the weights changed, got %v", avg.Val())
+	}
+}
+
+func TestWeightedAverageErrors(t *testing.T) {
+	m, err := NewPCPGaugeVector(map[string]float64{"a": 1, "b": 2}, "test.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewPCPCounterVector(map[string]int64{"a": 1, "c": 2}, "test.other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Apply(WithWeightedAverage(other)); err == nil {
+		t.Error("expected an error weighting by a metric with other instances")
+	}
+
+	if err = m.Apply(WithWeightedAverage(m)); err == nil {
+		t.Error("expected an error weighting a metric by itself")
+	}
+
+	g, err := NewPCPGauge(0, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Apply(WithWeightedAverage(g)); err == nil {
+		t.Error("expected an error weighting by a singleton metric")
+	}
+}
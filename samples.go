@@ -0,0 +1,108 @@
+package speed
+
+import (
+	"sort"
+
+	"github.com/performancecopilot/speed/mmvdump"
+	"github.com/pkg/errors"
+)
+
+// Sample is the value of a singleton metric, or of one instance of an instance metric.
+type Sample struct {
+	Metric   string
+	Instance string // blank for singleton metrics
+	Value    interface{}
+}
+
+// Samples returns the current values of all metrics of a started client, as they are
+// written to its MMV file, sorted by metric and instance.
+//
+// Metrics disabled by the level or the filter of the client are left out,
+// see SetLevel and SetFilter.
+func (c *PCPClient) Samples() ([]Sample, error) {
+	samples, err := c.allSamples()
+	if err != nil {
+		return nil, err
+	}
+
+	c.r.metricslock.RLock()
+	defer c.r.metricslock.RUnlock()
+
+	ans := samples[:0]
+	for _, s := range samples {
+		level := NormalLevel
+		if m, ok := c.r.metrics[s.Metric]; ok {
+			level = metricLevel(m)
+		}
+
+		if c.enabled(s.Metric, level) {
+			ans = append(ans, s)
+		}
+	}
+
+	return ans, nil
+}
+
+// errNotMapped is returned by allSamples for clients that are not mapped
+var errNotMapped = errors.New("cannot read the samples of a client that is not mapped")
+
+// allSamples returns the current values of all metrics, regardless of the filter
+func (c *PCPClient) allSamples() ([]Sample, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.writer == nil {
+		return nil, errNotMapped
+	}
+
+	return ReadSamples(c.writer.Bytes())
+}
+
+// ReadSamples returns the values of all metrics in the passed MMV file contents,
+// sorted by metric and instance.
+func ReadSamples(data []byte) ([]Sample, error) {
+	_, _, metrics, values, instances, _, strs, err := mmvdump.Dump(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the MMV file")
+	}
+
+	ans := make([]Sample, 0, len(values))
+	for _, v := range values {
+		// values without a value yet are not attached to their metric
+		if v.Metric == 0 {
+			continue
+		}
+
+		m, ok := metrics[v.Metric]
+		if !ok {
+			return nil, errors.Errorf("value of an unknown metric at %v", v.Metric)
+		}
+
+		s := Sample{Metric: metricName(m, strs)}
+
+		if v.Instance != 0 {
+			i, ok := instances[v.Instance]
+			if !ok {
+				return nil, errors.Errorf("value of metric %v has an unknown instance at %v", s.Metric, v.Instance)
+			}
+			s.Instance = instanceName(i, strs)
+		}
+
+		if m.Typ() == mmvdump.StringType {
+			s.Value = mmvString(strs, uint64(v.Extra))
+		} else if s.Value, err = mmvdump.FixedVal(v.Val, m.Typ()); err != nil {
+			return nil, errors.Wrapf(err, "cannot read the value of metric %v", s.Metric)
+		}
+
+		ans = append(ans, s)
+	}
+
+	sort.Slice(ans, func(i, j int) bool {
+		if ans[i].Metric != ans[j].Metric {
+			return ans[i].Metric < ans[j].Metric
+		}
+		return ans[i].Instance < ans[j].Instance
+	})
+
+	return ans, nil
+}
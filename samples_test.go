@@ -0,0 +1,42 @@
+package speed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSamples(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.Samples(); err == nil {
+		t.Error("expected an error reading samples of a client that is not started")
+	}
+
+	// a long name makes the client write MMV version 2
+	long := "test." + strings.Repeat("x", MaxV1NameLength)
+
+	c.MustRegisterString("test.str", "kirk", StringType, InstantSemantics, OneUnit)
+	c.MustRegisterString(long+"[a,b]", Instances{"a": 4.2, "b": 4.2}, DoubleType, InstantSemantics, OneUnit)
+
+	c.MustStart()
+	defer c.MustStop()
+
+	samples, err := c.Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Sample{
+		{"test.str", "", "kirk"},
+		{long, "a", 4.2},
+		{long, "b", 4.2},
+	}
+
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("expected samples %v, got %v", expected, samples)
+	}
+}
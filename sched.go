@@ -0,0 +1,163 @@
+//go:build go1.17
+// +build go1.17
+
+package speed
+
+import (
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const schedLatencyMetric = "/sched/latencies:seconds"
+
+// SchedLatencyCollector exports the time goroutines spend runnable before running,
+// as reported by the runtime/metrics package, as a histogram in microseconds.
+//
+// The runtime reports cumulative bucket counts, every Collect records the
+// observations made since the previous one at the midpoint of their bucket.
+type SchedLatencyCollector struct {
+	mutex   sync.Mutex
+	latency *PCPHistogram
+	sample  []metrics.Sample
+	counts  []uint64 // bucket counts as of the last Collect
+
+	stop, done chan struct{}
+}
+
+// NewSchedLatencyCollector creates a new SchedLatencyCollector exporting
+// the histogram "<prefix>.latency".
+func NewSchedLatencyCollector(prefix string) (*SchedLatencyCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("scheduler latency collector prefix cannot be empty")
+	}
+
+	sample := []metrics.Sample{{Name: schedLatencyMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil, errors.Errorf("%v is not supported by the runtime", schedLatencyMetric)
+	}
+
+	h, err := NewPCPHistogram(
+		prefix+".latency", HistogramMin, HistogramMax, 3, MicrosecondUnit,
+		"time goroutines spend runnable before running",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SchedLatencyCollector{
+		latency: h,
+		sample:  sample,
+		counts:  append([]uint64(nil), sample[0].Value.Float64Histogram().Counts...),
+	}, nil
+}
+
+// Metrics returns all the metrics exported by the collector.
+func (s *SchedLatencyCollector) Metrics() []Metric { return []Metric{s.latency} }
+
+// Register registers all metrics of the collector with the passed client.
+func (s *SchedLatencyCollector) Register(c Client) error { return c.Register(s.latency) }
+
+// Collect reads the scheduler latencies from the runtime and updates the histogram.
+func (s *SchedLatencyCollector) Collect() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	metrics.Read(s.sample)
+	h := s.sample[0].Value.Float64Histogram()
+
+	for i, count := range h.Counts {
+		delta := count
+		if i < len(s.counts) {
+			delta -= s.counts[i]
+		}
+
+		if delta == 0 {
+			continue
+		}
+
+		if err := s.latency.RecordN(bucketMicroseconds(h.Buckets[i], h.Buckets[i+1]), int64(delta)); err != nil {
+			return err
+		}
+	}
+
+	s.counts = append(s.counts[:0], h.Counts...)
+	return nil
+}
+
+// bucketMicroseconds returns the value recorded for a bucket of a runtime histogram,
+// the midpoint of its boundaries in seconds, converted to microseconds
+func bucketMicroseconds(low, high float64) int64 {
+	v := (low + high) / 2
+	switch {
+	case math.IsInf(low, -1):
+		v = high
+	case math.IsInf(high, 1):
+		v = low
+	}
+
+	us := v * float64(time.Second/time.Microsecond)
+	switch {
+	case us < HistogramMin:
+		return HistogramMin
+	case us > HistogramMax:
+		return HistogramMax
+	}
+
+	return int64(us)
+}
+
+// Start starts collecting at the passed interval.
+func (s *SchedLatencyCollector) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("collection interval must be positive")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stop != nil {
+		return errors.New("scheduler latency collector is already running")
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.stop, s.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				_ = s.Collect()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops collecting periodically.
+func (s *SchedLatencyCollector) Stop() error {
+	s.mutex.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mutex.Unlock()
+
+	if stop == nil {
+		return errors.New("scheduler latency collector is not running")
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
@@ -0,0 +1,67 @@
+//go:build go1.17
+// +build go1.17
+
+package speed
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestSchedLatencyCollector(t *testing.T) {
+	s, err := NewSchedLatencyCollector("test.sched")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Start(0); err == nil {
+		t.Error("expected an error starting with a zero interval")
+	}
+
+	sum := func() (ans uint64) {
+		for _, c := range s.counts {
+			ans += c
+		}
+		return
+	}
+	before := sum()
+
+	// schedule a bunch of goroutines so there is something to observe
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.Gosched()
+		}()
+	}
+	wg.Wait()
+
+	if err = s.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sum() <= before {
+		t.Error("expected scheduler latencies to be recorded")
+	}
+}
+
+func TestBucketMicroseconds(t *testing.T) {
+	cases := []struct {
+		low, high float64
+		us        int64
+	}{
+		{0.001, 0.003, 2000},
+		{math.Inf(-1), 0, 0},
+		{10, math.Inf(1), 10000000},
+		{1e6, 2e6, HistogramMax},
+	}
+
+	for _, c := range cases {
+		if us := bucketMicroseconds(c.low, c.high); us != c.us {
+			t.Errorf("expected bucket [%v, %v) to be %vus, got %v", c.low, c.high, c.us, us)
+		}
+	}
+}
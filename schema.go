@@ -0,0 +1,123 @@
+package speed
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaMismatch describes a metric whose description differs from the schema.
+type SchemaMismatch struct {
+	Name     string // the metric name
+	Field    string // one of type, semantics, unit or instances
+	Expected string
+	Actual   string
+}
+
+// SchemaError is returned by VerifySchema when a registry does not match a schema.
+type SchemaError struct {
+	Missing    []string // metrics in the schema but not in the registry
+	Extra      []string // metrics in the registry but not in the schema
+	Mismatched []SchemaMismatch
+}
+
+func (e *SchemaError) Error() string {
+	var parts []string
+
+	if len(e.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing metrics %v", e.Missing))
+	}
+
+	if len(e.Extra) > 0 {
+		parts = append(parts, fmt.Sprintf("extra metrics %v", e.Extra))
+	}
+
+	for _, m := range e.Mismatched {
+		parts = append(parts, fmt.Sprintf("%v has %v %v, expected %v", m.Name, m.Field, m.Actual, m.Expected))
+	}
+
+	return "registry does not match the schema: " + strings.Join(parts, ", ")
+}
+
+// VerifySchema compares the metrics in a registry against an expected schema in the
+// format returned by Catalog, for example decoded from the JSON printed by speedcat.
+//
+// The type, semantics, unit and instances of every metric are compared, descriptions
+// are ignored, as are instances for schema entries without an instance domain.
+// It returns a *SchemaError if the registry does not match.
+func VerifySchema(r Registry, schema []CatalogEntry) error {
+	actual := make(map[string]CatalogEntry)
+	for _, e := range r.Catalog() {
+		actual[e.Name] = e
+	}
+
+	err := &SchemaError{}
+	for _, expected := range schema {
+		e, present := actual[expected.Name]
+		if !present {
+			err.Missing = append(err.Missing, expected.Name)
+			continue
+		}
+
+		delete(actual, expected.Name)
+
+		mismatch := func(field string, expected, actual interface{}) {
+			err.Mismatched = append(err.Mismatched, SchemaMismatch{
+				e.Name, field, fmt.Sprint(expected), fmt.Sprint(actual),
+			})
+		}
+
+		if e.Type != expected.Type {
+			mismatch("type", expected.Type, e.Type)
+		}
+
+		if e.Semantics != expected.Semantics {
+			mismatch("semantics", expected.Semantics, e.Semantics)
+		}
+
+		if e.Unit != expected.Unit {
+			mismatch("unit", expected.Unit, e.Unit)
+		}
+
+		if expected.Indom != nil {
+			if e.Indom == nil {
+				mismatch("instances", expected.Indom.Instances, "none")
+			} else if !sameInstances(e.Indom.Instances, expected.Indom.Instances) {
+				mismatch("instances", expected.Indom.Instances, e.Indom.Instances)
+			}
+		}
+	}
+
+	for name := range actual {
+		err.Extra = append(err.Extra, name)
+	}
+
+	sort.Strings(err.Missing)
+	sort.Strings(err.Extra)
+
+	if len(err.Missing) == 0 && len(err.Extra) == 0 && len(err.Mismatched) == 0 {
+		return nil
+	}
+
+	return err
+}
+
+// sameInstances checks if two lists hold the same instances in any order
+func sameInstances(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[string]bool, len(a))
+	for _, i := range a {
+		set[i] = true
+	}
+
+	for _, i := range b {
+		if !set[i] {
+			return false
+		}
+	}
+
+	return true
+}
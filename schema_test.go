@@ -0,0 +1,62 @@
+package speed
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVerifySchema(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+
+	if _, err = c.RegisterString("test.latency[p50, p99]", Instances{"p50": 0.0, "p99": 0.0}, DoubleType, InstantSemantics, MillisecondUnit); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.RegisterString("test.extra", int32(0), Int32Type, InstantSemantics, OneUnit); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := []CatalogEntry{}
+	err = json.Unmarshal([]byte(`[
+		{"name": "test.requests", "type": "Int64Type", "semantics": "CounterSemantics", "unit": "OneUnit"},
+		{"name": "test.latency", "type": "FloatType", "semantics": "InstantSemantics", "unit": "MillisecondUnit",
+		 "indom": {"id": 0, "instances": ["p50", "p90"]}},
+		{"name": "test.missing", "type": "Int32Type", "semantics": "InstantSemantics", "unit": "OneUnit"}
+	]`), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = VerifySchema(c.Registry(), schema)
+
+	serr, ok := err.(*SchemaError)
+	if !ok {
+		t.Fatalf("expected a SchemaError, got %v", err)
+	}
+
+	if len(serr.Missing) != 1 || serr.Missing[0] != "test.missing" {
+		t.Errorf("expected test.missing to be missing, got %v", serr.Missing)
+	}
+
+	if len(serr.Extra) != 1 || serr.Extra[0] != "test.extra" {
+		t.Errorf("expected test.extra to be extra, got %v", serr.Extra)
+	}
+
+	if len(serr.Mismatched) != 2 || serr.Mismatched[0].Field != "type" || serr.Mismatched[1].Field != "instances" {
+		t.Errorf("expected test.latency to mismatch on type and instances, got %v", serr.Mismatched)
+	}
+
+	if err = VerifySchema(c.Registry(), c.Registry().Catalog()); err != nil {
+		t.Errorf("expected a registry to match its own catalog, got %v", err)
+	}
+}
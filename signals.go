@@ -0,0 +1,48 @@
+package speed
+
+import (
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// WithLogger sets the logger the client writes registry snapshots to, see
+// EnableSignalControl. Without it, they go to the standard logger.
+func WithLogger(l *log.Logger) ClientOption {
+	return func(c *PCPClient) error {
+		if l == nil {
+			return errors.New("logger cannot be nil")
+		}
+
+		c.logger = l
+		return nil
+	}
+}
+
+// EnableSignalControl makes the client log a snapshot of all its metrics and their
+// values when it receives SIGUSR1, and toggle DebugLevel when it receives SIGUSR2,
+// see ToggleDebugOnSignal, for controlling it without an admin endpoint, see
+// AdminHandler. The returned function stops handling the signals.
+//
+// It fails on platforms without these signals, like Windows.
+func (c *PCPClient) EnableSignalControl() (stop func(), err error) {
+	if dumpSignal == nil {
+		return nil, errors.New("signal control is not supported on this platform")
+	}
+
+	return onSignals(map[os.Signal]func(){
+		dumpSignal:  c.logSnapshot,
+		debugSignal: c.debugToggle(),
+	}), nil
+}
+
+// logSnapshot logs the client with all its metrics and their values
+func (c *PCPClient) logSnapshot() {
+	if c.logger != nil {
+		c.logger.Print(c)
+		return
+	}
+
+	log.Print(c)
+}
@@ -0,0 +1,105 @@
+package speed
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestToggleDebugOnSignal(t *testing.T) {
+	c, err := NewPCPClient("levels", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.SetLevel(CriticalLevel); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := c.ToggleDebugOnSignal(syscall.SIGUSR2)
+	defer stop()
+
+	waitLevel := func(l MetricLevel) {
+		for i := 0; i < 100 && c.Level() != l; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if c.Level() != l {
+			t.Fatalf("expected the level to be %v, got %v", l, c.Level())
+		}
+	}
+
+	if err = syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	waitLevel(DebugLevel)
+
+	if err = syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	waitLevel(CriticalLevel)
+}
+
+func TestEnableSignalControl(t *testing.T) {
+	var buf syncBuffer
+	c, err := NewPCPClient("signals", WithoutLocalFile(), WithLogger(log.New(&buf, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegisterString("app.requests", int64(42), Int64Type, CounterSemantics, OneUnit)
+	c.MustStart()
+	defer c.MustStop()
+
+	stop, err := c.EnableSignalControl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	if err = syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100 && !strings.Contains(buf.String(), "app.requests"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if s := buf.String(); !strings.Contains(s, "app.requests") || !strings.Contains(s, "42") {
+		t.Errorf("expected a snapshot with the metric and its value to be logged, got %q", s)
+	}
+
+	if err = syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100 && c.Level() != DebugLevel; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if c.Level() != DebugLevel {
+		t.Errorf("expected SIGUSR2 to switch to the debug level, got %v", c.Level())
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be written and read concurrently
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,9 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package speed
+
+import "os"
+
+// no signals for EnableSignalControl
+var dumpSignal, debugSignal os.Signal
@@ -0,0 +1,12 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package speed
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals handled by EnableSignalControl
+var dumpSignal, debugSignal os.Signal = syscall.SIGUSR1, syscall.SIGUSR2
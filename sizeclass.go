@@ -0,0 +1,100 @@
+package speed
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SizeClassCollector is a Collector exporting the number of allocations and frees per
+// size class of the Go allocator, as reported in runtime.MemStats.BySize, with an
+// instance for every size class named by its size in bytes, giving a breakdown of
+// allocations by size. Allocations larger than the largest size class are not included.
+//
+// Reading the statistics stops the world, so this collector is opt-in and
+// is best collected at a relaxed interval.
+type SizeClassCollector struct {
+	prefix    string
+	sizes     []string // instance of each entry of BySize, empty for unused entries
+	instances []string
+
+	mutex sync.Mutex
+	stats runtime.MemStats
+	err   error
+}
+
+// NewSizeClassCollector creates a new SizeClassCollector exporting the metrics
+// "<prefix>.mallocs" and "<prefix>.frees".
+func NewSizeClassCollector(prefix string) (*SizeClassCollector, error) {
+	if prefix == "" {
+		return nil, errors.New("size class collector prefix cannot be empty")
+	}
+
+	col := &SizeClassCollector{prefix: prefix}
+
+	runtime.ReadMemStats(&col.stats)
+
+	col.sizes = make([]string, len(col.stats.BySize))
+	for i, c := range col.stats.BySize {
+		// the first size class is for zero sized allocations, which are never counted
+		if c.Size == 0 {
+			continue
+		}
+
+		col.sizes[i] = strconv.FormatUint(uint64(c.Size), 10)
+		col.instances = append(col.instances, col.sizes[i])
+	}
+
+	return col, nil
+}
+
+// Describe describes the metrics exported by the collector.
+func (col *SizeClassCollector) Describe(ch chan<- Desc) {
+	ch <- Desc{
+		Name: col.prefix + ".mallocs", Type: Uint64Type, Semantics: CounterSemantics, Unit: OneUnit,
+		Instances: col.instances, ShortHelp: "number of heap objects allocated in the size class",
+	}
+
+	ch <- Desc{
+		Name: col.prefix + ".frees", Type: Uint64Type, Semantics: CounterSemantics, Unit: OneUnit,
+		Instances: col.instances, ShortHelp: "number of heap objects freed in the size class",
+	}
+}
+
+// Collect reads the allocator statistics and records them.
+func (col *SizeClassCollector) Collect(r Recorder) {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	col.err = col.collect(r)
+}
+
+func (col *SizeClassCollector) collect(r Recorder) error {
+	runtime.ReadMemStats(&col.stats)
+
+	for i, c := range col.stats.BySize {
+		if col.sizes[i] == "" {
+			continue
+		}
+
+		if err := r.RecordInstance(col.prefix+".mallocs", col.sizes[i], c.Mallocs); err != nil {
+			return err
+		}
+
+		if err := r.RecordInstance(col.prefix+".frees", col.sizes[i], c.Frees); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Err returns the error encountered during the last collection, if any.
+func (col *SizeClassCollector) Err() error {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+
+	return col.err
+}
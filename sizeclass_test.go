@@ -0,0 +1,52 @@
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+var sizeClassSink [][]byte
+
+func TestSizeClassCollector(t *testing.T) {
+	col, err := NewSizeClassCollector("test.alloc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.RegisterCollector(col, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = col.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	mallocs := c.r.metrics["test.alloc.mallocs"].(*PCPInstanceMetric)
+	if !mallocs.Indom().HasInstance("8") {
+		t.Fatal("expected an instance for the 8 byte size class")
+	}
+
+	before, _ := mallocs.ValInstance("128")
+
+	for i := 0; i < 1000; i++ {
+		sizeClassSink = append(sizeClassSink, make([]byte, 128))
+	}
+	sizeClassSink = nil
+
+	col.Collect(c.collectors[0])
+	if err = col.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if after, _ := mallocs.ValInstance("128"); after.(uint64) < before.(uint64)+1000 {
+		t.Errorf("expected at least 1000 more allocations of 128 bytes, got %v then %v", before, after)
+	}
+}
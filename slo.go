@@ -0,0 +1,231 @@
+package speed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sloBucketCount is the number of buckets each burn rate window is divided into
+const sloBucketCount = 60
+
+// DefaultSLOWindows are the burn rate windows used when none are passed to NewPCPSLO
+var DefaultSLOWindows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
+
+type sloBucket struct {
+	idx       int64
+	good, bad int64
+}
+
+// sloWindow tracks observations over a sliding window using a ring of buckets
+type sloWindow struct {
+	name    string
+	width   int64 // bucket width in nanoseconds
+	buckets []sloBucket
+}
+
+func newsloWindow(d time.Duration) *sloWindow {
+	width := int64(d) / sloBucketCount
+	if width == 0 {
+		width = 1
+	}
+
+	return &sloWindow{
+		name:    "burn_rate_" + formatWindow(d),
+		width:   width,
+		buckets: make([]sloBucket, sloBucketCount),
+	}
+}
+
+func (w *sloWindow) record(now time.Time, ok bool) {
+	idx := now.UnixNano() / w.width
+	b := &w.buckets[idx%sloBucketCount]
+
+	if b.idx != idx {
+		*b = sloBucket{idx: idx}
+	}
+
+	if ok {
+		b.good++
+	} else {
+		b.bad++
+	}
+}
+
+func (w *sloWindow) counts(now time.Time) (good, bad int64) {
+	idx := now.UnixNano() / w.width
+	for _, b := range w.buckets {
+		if b.idx > idx-sloBucketCount && b.idx <= idx {
+			good += b.good
+			bad += b.bad
+		}
+	}
+	return
+}
+
+// formatWindow formats a window duration into an instance name friendly string
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// PCPSLO tracks compliance with a service level objective, like
+// 99.9% of requests completing in under 200ms.
+//
+// # It is exported as an instance metric with the instances
+//
+// - compliance: percentage of good observations since creation
+//
+// - budget_remaining: fraction of the error budget left, going negative once overspent
+//
+// - burn_rate_<window>: rate of consuming the error budget over a window,
+// where 1 means the budget is being consumed exactly at the allowed rate
+type PCPSLO struct {
+	*pcpInstanceMetric
+	mutex sync.Mutex
+
+	target    float64
+	threshold time.Duration
+	good, bad int64
+	windows   []*sloWindow
+
+	now func() time.Time
+}
+
+// NewPCPSLO creates a new PCPSLO.
+// The target is the fraction of observations that should be good, between 0 and 1
+// exclusive, and the threshold is the maximum latency of a good observation passed
+// to Observe. The burn rate is exported for every passed window, defaulting to
+// DefaultSLOWindows.
+func NewPCPSLO(name string, target float64, threshold time.Duration, windows ...time.Duration) (*PCPSLO, error) {
+	if target <= 0 || target >= 1 {
+		return nil, errors.Errorf("SLO target %v must be between 0 and 1", target)
+	}
+
+	if len(windows) == 0 {
+		windows = DefaultSLOWindows
+	}
+
+	s := &PCPSLO{target: target, threshold: threshold, now: time.Now}
+
+	vals := Instances{"compliance": float64(100), "budget_remaining": float64(1)}
+	for _, d := range windows {
+		if d < time.Second {
+			return nil, errors.Errorf("SLO window %v is shorter than a second", d)
+		}
+
+		w := newsloWindow(d)
+		if _, present := vals[w.name]; present {
+			return nil, errors.Errorf("SLO window %v passed twice", d)
+		}
+
+		vals[w.name] = float64(0)
+		s.windows = append(s.windows, w)
+	}
+
+	im, err := generateInstanceMetric(
+		vals, name, vals.Keys(), DoubleType, InstantSemantics, OneUnit,
+		fmt.Sprintf("SLO compliance for a %v%% target", target*100),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pcpInstanceMetric = im
+	return s, nil
+}
+
+// Observe records an observation with the passed latency,
+// which is good if it is under the threshold.
+func (s *PCPSLO) Observe(d time.Duration) error { return s.record(d < s.threshold) }
+
+// Success records a good observation.
+func (s *PCPSLO) Success() error { return s.record(true) }
+
+// Failure records a bad observation.
+func (s *PCPSLO) Failure() error { return s.record(false) }
+
+func (s *PCPSLO) record(ok bool) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+
+	if ok {
+		s.good++
+	} else {
+		s.bad++
+	}
+
+	for _, w := range s.windows {
+		w.record(now, ok)
+	}
+
+	return s.update(now)
+}
+
+func (s *PCPSLO) update(now time.Time) error {
+	allowed := 1 - s.target
+	total := float64(s.good + s.bad)
+
+	if err := s.setInstance(float64(s.good)*100/total, "compliance"); err != nil {
+		return err
+	}
+
+	if err := s.setInstance(1-float64(s.bad)/(allowed*total), "budget_remaining"); err != nil {
+		return err
+	}
+
+	for _, w := range s.windows {
+		good, bad := w.counts(now)
+
+		rate := float64(0)
+		if good+bad > 0 {
+			rate = float64(bad) / float64(good+bad) / allowed
+		}
+
+		if err := s.setInstance(rate, w.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compliance returns the percentage of good observations so far.
+func (s *PCPSLO) Compliance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.vals["compliance"].val.(float64)
+}
+
+// BudgetRemaining returns the fraction of the error budget left.
+func (s *PCPSLO) BudgetRemaining() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.vals["budget_remaining"].val.(float64)
+}
+
+// BurnRate returns the burn rate over the passed window.
+func (s *PCPSLO) BurnRate(window time.Duration) (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, err := s.valInstance("burn_rate_" + formatWindow(window))
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(float64), nil
+}
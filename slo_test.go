@@ -0,0 +1,94 @@
+package speed
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/performancecopilot/speed/mmvdump"
+)
+
+func TestSLO(t *testing.T) {
+	s, err := NewPCPSLO("test.slo", 0.9, 200*time.Millisecond, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000000, 0)
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 18; i++ {
+		if err = s.Observe(100 * time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = s.Observe(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Failure(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := s.Compliance(); c != 90 {
+		t.Errorf("expected compliance to be 90, got %v", c)
+	}
+
+	if b := s.BudgetRemaining(); math.Abs(b) > 1e-9 {
+		t.Errorf("expected no budget to remain, got %v", b)
+	}
+
+	if r, _ := s.BurnRate(time.Minute); math.Abs(r-1) > 1e-9 {
+		t.Errorf("expected a burn rate of 1, got %v", r)
+	}
+
+	// after two minutes only the hour window remembers the failures
+	now = now.Add(2 * time.Minute)
+	if err = s.Success(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := s.BurnRate(time.Minute); r != 0 {
+		t.Errorf("expected a burn rate of 0 over a minute, got %v", r)
+	}
+
+	if r, _ := s.BurnRate(time.Hour); r == 0 {
+		t.Error("expected a non zero burn rate over an hour")
+	}
+
+	if _, err = s.BurnRate(time.Second); err == nil {
+		t.Error("expected an error getting the burn rate of an unknown window")
+	}
+
+	if _, err = NewPCPSLO("test.slo", 1, time.Second); err == nil {
+		t.Error("expected an error for a target of 1")
+	}
+}
+
+func TestSLOWriting(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewPCPSLO("test.slo", 0.99, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(s)
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = s.Failure(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, m, v, i, _, str, err := mmvdump.Dump(c.writer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matchInstanceMetricAndValues(s.pcpInstanceMetric, m, v, i, str, t)
+}
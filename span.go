@@ -0,0 +1,134 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Span defines the subset of a finished tracing span needed to record metrics.
+//
+// It mirrors the accessors on OpenTelemetry's ReadOnlySpan, so a span processor's
+// OnEnd can forward spans to a SpanAdapter through a thin wrapper that maps the
+// span status to Failed.
+type Span interface {
+	Name() string
+	StartTime() time.Time
+	EndTime() time.Time
+	Failed() bool
+}
+
+// SpanAdapter records finished spans as per operation latency histograms
+// and error counters.
+//
+// The set of operations has to be declared on construction, as instances and
+// metrics cannot be added once a mapping is active. Spans for operations that
+// were not declared are counted under the "unknown" instance of the span counter.
+type SpanAdapter struct {
+	mutex     sync.Mutex
+	latencies map[string]*PCPHistogram
+	spans     *PCPCounterVector
+	errors    *PCPCounterVector
+}
+
+// UnknownOperation is the instance that spans of undeclared operations are counted under
+const UnknownOperation = "unknown"
+
+// NewSpanAdapter creates a new SpanAdapter for the passed operations,
+// creating a latency histogram in microseconds at "<prefix>.<operation>.latency"
+// for each operation and the counters "<prefix>.spans" and "<prefix>.errors".
+func NewSpanAdapter(prefix string, operations ...string) (*SpanAdapter, error) {
+	if prefix == "" {
+		return nil, errors.New("span adapter prefix cannot be empty")
+	}
+
+	if len(operations) == 0 {
+		return nil, errors.New("span adapter needs at least one operation")
+	}
+
+	a := &SpanAdapter{latencies: make(map[string]*PCPHistogram)}
+
+	counts := map[string]int64{UnknownOperation: 0}
+	for _, op := range operations {
+		if _, present := a.latencies[op]; present {
+			return nil, errors.Errorf("operation %v declared twice", op)
+		}
+
+		h, err := NewPCPHistogram(
+			prefix+"."+op+".latency", HistogramMin, HistogramMax, 3, MicrosecondUnit,
+			"latency of "+op+" spans",
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		a.latencies[op] = h
+		counts[op] = 0
+	}
+
+	var err error
+	if a.spans, err = NewPCPCounterVector(counts, prefix+".spans", "number of finished spans"); err != nil {
+		return nil, err
+	}
+
+	if a.errors, err = NewPCPCounterVector(counts, prefix+".errors", "number of failed spans"); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Metrics returns all the metrics exported by the adapter.
+func (a *SpanAdapter) Metrics() []Metric {
+	ans := []Metric{a.spans, a.errors}
+	for _, h := range a.latencies {
+		ans = append(ans, h)
+	}
+	return ans
+}
+
+// Register registers all metrics of the adapter with the passed client.
+func (a *SpanAdapter) Register(c Client) error {
+	for _, m := range a.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnEnd records a finished span.
+func (a *SpanAdapter) OnEnd(s Span) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	op := s.Name()
+	h, present := a.latencies[op]
+	if !present {
+		op = UnknownOperation
+	}
+
+	if err := a.spans.Inc(1, op); err != nil {
+		return err
+	}
+
+	if s.Failed() {
+		if err := a.errors.Inc(1, op); err != nil {
+			return err
+		}
+	}
+
+	d := s.EndTime().Sub(s.StartTime())
+	if d < 0 {
+		return errors.Errorf("span %v ends before it starts", s.Name())
+	}
+
+	// spans of undeclared operations have no latency histogram
+	if h == nil {
+		return nil
+	}
+
+	return h.Record(int64(d / time.Microsecond))
+}
@@ -0,0 +1,62 @@
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+type testSpan struct {
+	name       string
+	start, end time.Time
+	failed     bool
+}
+
+func (s *testSpan) Name() string         { return s.name }
+func (s *testSpan) StartTime() time.Time { return s.start }
+func (s *testSpan) EndTime() time.Time   { return s.end }
+func (s *testSpan) Failed() bool         { return s.failed }
+
+func TestSpanAdapter(t *testing.T) {
+	a, err := NewSpanAdapter("test.spans", "get", "put")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	spans := []*testSpan{
+		{"get", now, now.Add(2 * time.Millisecond), false},
+		{"get", now, now.Add(4 * time.Millisecond), true},
+		{"delete", now, now.Add(time.Millisecond), false},
+		{"delete", now, now.Add(time.Millisecond), true},
+	}
+
+	for _, s := range spans {
+		if err = a.OnEnd(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v, _ := a.spans.Val("get"); v != 2 {
+		t.Errorf("expected 2 get spans, got %v", v)
+	}
+
+	if v, _ := a.errors.Val("get"); v != 1 {
+		t.Errorf("expected 1 failed get span, got %v", v)
+	}
+
+	if v, _ := a.spans.Val(UnknownOperation); v != 2 {
+		t.Errorf("expected 2 unknown spans, got %v", v)
+	}
+
+	if v, _ := a.errors.Val(UnknownOperation); v != 1 {
+		t.Errorf("expected 1 failed unknown span, got %v", v)
+	}
+
+	if m := a.latencies["get"].Mean(); m < 2999 || m > 3001 {
+		t.Errorf("expected a mean get latency of 3000us, got %v", m)
+	}
+
+	if _, err = NewSpanAdapter("test.spans", "get", "get"); err == nil {
+		t.Error("expected an error declaring the same operation twice")
+	}
+}
@@ -6,6 +6,21 @@
 //
 // Some examples on using the API are implemented as executable go programs in the
 // `examples` subdirectory.
+//
+// Monitors read the MMV file while the client writes it, which gives them these guarantees:
+//
+// - a mapping is complete once the two generation numbers in its header are equal,
+// as the second one is written last, with an atomic store that orders all the
+// writes before it
+//
+// - numeric values are written with single atomic stores, so they are never
+// partially written
+//
+// - string values are double buffered, so they are never partially written for
+// monitors copying a string faster than it is updated twice
+//
+// Values are updated independently, so a monitor can read an update of one value
+// and not yet of another one, even if they were updated together.
 package speed
 
 import (
@@ -19,21 +34,12 @@ import (
 // Version is the last tagged version of the package
 const Version = "3.0.1"
 
-var histogramInstances = []string{"min", "max", "mean", "variance", "standard_deviation"}
-var histogramIndom *PCPInstanceDomain
-
 // init maintains a central location of all things that happen when the package is initialized
 // instead of everything being scattered in multiple source files
 func init() {
 	if err := initConfig(); err != nil {
 		fmt.Fprintln(os.Stderr, errors.Errorf("error initializing config. maybe PCP isn't installed properly"))
 	}
-
-	var err error
-	histogramIndom, err = NewPCPInstanceDomain("histogram", histogramInstances)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, errors.Errorf("could not initialize an instance domain for histograms"))
-	}
 }
 
 // generate a unique hash for a string of the specified bit length
@@ -0,0 +1,76 @@
+package speed
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/performancecopilot/speed/bytewriter"
+)
+
+// String values are double buffered. Every string value has two string blocks, and
+// its value block points at the one holding the current value. An update writes the
+// whole of the other block, padded with null bytes, and then points the value block
+// at it, so monitors following the pointer never read a partially written string.
+//
+// A monitor that is still reading the previous block when the one after that is
+// written can read a mix of two values, so the guarantee holds for readers taking
+// less than an update interval to copy a string, which is what monitors do.
+
+// stringBlocks is the number of string blocks allocated for every string value
+const stringBlocks = 2
+
+// stringSlot writes a string value to alternating string blocks
+type stringSlot struct {
+	writer bytewriter.Writer
+	pos    int // offset of the pointer to the current block in the value block
+	blocks [stringBlocks]int
+	active int // index of the block holding the current value
+}
+
+// newStringSlot allocates the string blocks for the string value at offset,
+// pointing its value block at the first one once it is written
+func (c *PCPClient) newStringSlot(offset int) *stringSlot {
+	s := &stringSlot{writer: c.writer, active: 1}
+	s.pos = c.writer.MustWriteUint64(StringLength-1, offset)
+
+	for i := range s.blocks {
+		s.blocks[i] = <-c.stringoffsetc
+		c.stringoffsetc <- s.blocks[i] + StringLength
+	}
+
+	return s
+}
+
+func (s *stringSlot) update(val interface{}) error {
+	str, ok := val.(string)
+	if !ok {
+		return errors.Errorf("cannot write %v(%T) as a string", val, val)
+	}
+
+	if len(str) > StringLength-1 {
+		return errors.Errorf("string of %v bytes does not fit in a string block", len(str))
+	}
+
+	next := 1 - s.active
+
+	block := make([]byte, StringLength)
+	copy(block, str)
+	if _, err := s.writer.Write(block, s.blocks[next]); err != nil {
+		return err
+	}
+
+	if _, err := s.writer.WriteUint64(uint64(s.blocks[next]), s.pos); err != nil {
+		return err
+	}
+
+	s.active = next
+	return nil
+}
+
+// valueUpdate returns the update closure writing a value of the passed type at offset.
+func (c *PCPClient) valueUpdate(t MetricType, offset int) updateClosure {
+	if t == StringType {
+		return c.truncating(c.newStringSlot(offset).update)
+	}
+
+	return newupdateClosure(offset, c.writer)
+}
@@ -0,0 +1,50 @@
+package speed
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestStringSlots(t *testing.T) {
+	c, err := NewPCPClient("test", WithoutLocalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterString("test.str", "first", StringType, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+	defer c.MustStop()
+
+	// the pointer to the string block follows the length in the value block
+	current := func() (int, string) {
+		data := c.writer.Bytes()
+		off := int(binary.LittleEndian.Uint64(data[m.offset+8:]))
+		return off, cString(data[off : off+StringLength])
+	}
+
+	first, s := current()
+	if s != "first" {
+		t.Fatalf("expected %q, got %q", "first", s)
+	}
+
+	m.MustSet("a much longer second value")
+	second, s := current()
+	if s != "a much longer second value" || second == first {
+		t.Fatalf("expected the second value in the other block, got %q at %v", s, second)
+	}
+
+	// the previous value is left intact for readers that are still reading it
+	if old := cString(c.writer.Bytes()[first : first+StringLength]); old != "first" {
+		t.Errorf("expected the previous block to be intact, got %q", old)
+	}
+
+	m.MustSet("third")
+	third, s := current()
+	if s != "third" || third != first {
+		t.Errorf("expected the third value in the first block, got %q at %v", s, third)
+	}
+
+	if c.stringCount() != 2 {
+		t.Errorf("expected 2 string blocks for the value, got %v", c.stringCount())
+	}
+}
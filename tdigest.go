@@ -0,0 +1,228 @@
+package speed
+
+import (
+	"math"
+	"sort"
+
+	histogram "github.com/codahale/hdrhistogram"
+	"github.com/pkg/errors"
+)
+
+// histogramBackend defines the data structure recording values for a PCPHistogram,
+// the method set is the one of codahale's hdrhistogram.
+type histogramBackend interface {
+	RecordValue(int64) error
+	RecordValues(int64, int64) error
+
+	Min() int64
+	Max() int64
+	Mean() float64
+	StdDev() float64
+
+	ValueAtQuantile(float64) int64
+	Distribution() []histogram.Bar
+
+	LowestTrackableValue() int64
+	HighestTrackableValue() int64
+
+	Reset()
+}
+
+type centroid struct {
+	mean, count float64
+}
+
+// tdigest implements a merging t-digest, as described in
+// https://github.com/tdunning/t-digest/blob/master/docs/t-digest-paper/histo.pdf
+//
+// it keeps a bounded number of centroids, with the smallest ones at the tails,
+// so memory stays constant while high quantiles stay accurate.
+type tdigest struct {
+	compression float64
+	low, high   int64
+
+	centroids []centroid
+	buffer    []centroid
+
+	count      float64
+	sum, sumsq float64
+	min, max   int64
+}
+
+func newtdigest(low, high int64, compression float64) *tdigest {
+	return &tdigest{
+		compression: compression,
+		low:         low,
+		high:        high,
+		buffer:      make([]centroid, 0, int(compression)*5),
+		min:         math.MaxInt64,
+		max:         math.MinInt64,
+	}
+}
+
+func (t *tdigest) RecordValue(v int64) error { return t.RecordValues(v, 1) }
+
+func (t *tdigest) RecordValues(v, n int64) error {
+	if v < t.low || v > t.high {
+		return errors.Errorf("value %v is outside the trackable range [%v, %v]", v, t.low, t.high)
+	}
+
+	if n <= 0 {
+		return nil
+	}
+
+	f, c := float64(v), float64(n)
+	t.count += c
+	t.sum += f * c
+	t.sumsq += f * f * c
+
+	if v < t.min {
+		t.min = v
+	}
+
+	if v > t.max {
+		t.max = v
+	}
+
+	t.buffer = append(t.buffer, centroid{f, c})
+	if len(t.buffer) == cap(t.buffer) {
+		t.merge()
+	}
+
+	return nil
+}
+
+// k is the k1 scale function, limiting centroid sizes near the tails
+func (t *tdigest) k(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// merge folds the buffered values into the centroids
+func (t *tdigest) merge() {
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	all := append(t.centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	seen := float64(0)
+	klimit := t.k(0) + 1
+
+	for _, c := range all[1:] {
+		q := (seen + cur.count + c.count) / t.count
+		if t.k(q) <= klimit {
+			cur.mean += (c.mean - cur.mean) * c.count / (cur.count + c.count)
+			cur.count += c.count
+			continue
+		}
+
+		seen += cur.count
+		merged = append(merged, cur)
+		klimit = t.k(seen/t.count) + 1
+		cur = c
+	}
+
+	t.centroids = append(merged, cur)
+	t.buffer = t.buffer[:0]
+}
+
+func (t *tdigest) Min() int64 {
+	if t.count == 0 {
+		return 0
+	}
+	return t.min
+}
+
+func (t *tdigest) Max() int64 {
+	if t.count == 0 {
+		return 0
+	}
+	return t.max
+}
+
+func (t *tdigest) Mean() float64 {
+	if t.count == 0 {
+		return 0
+	}
+	return t.sum / t.count
+}
+
+func (t *tdigest) StdDev() float64 {
+	if t.count == 0 {
+		return 0
+	}
+
+	mean := t.Mean()
+	return math.Sqrt(math.Max(t.sumsq/t.count-mean*mean, 0))
+}
+
+// ValueAtQuantile returns the estimated value at the passed quantile (0..100),
+// interpolating between centroids.
+func (t *tdigest) ValueAtQuantile(q float64) int64 {
+	t.merge()
+
+	if t.count == 0 {
+		return 0
+	}
+
+	q = math.Max(0, math.Min(q, 100)) / 100
+	target := q * t.count
+
+	if len(t.centroids) == 1 || target <= t.centroids[0].count/2 {
+		return t.interpolate(float64(t.min), t.centroids[0].mean, target/(t.centroids[0].count/2))
+	}
+
+	cum := float64(0)
+	for i := 0; i < len(t.centroids)-1; i++ {
+		c, next := t.centroids[i], t.centroids[i+1]
+		mid := cum + c.count/2
+		nextmid := cum + c.count + next.count/2
+
+		if target <= nextmid {
+			return t.interpolate(c.mean, next.mean, (target-mid)/(nextmid-mid))
+		}
+
+		cum += c.count
+	}
+
+	last := t.centroids[len(t.centroids)-1]
+	lastmid := t.count - last.count/2
+	return t.interpolate(last.mean, float64(t.max), (target-lastmid)/(last.count/2))
+}
+
+func (t *tdigest) interpolate(from, to, frac float64) int64 {
+	frac = math.Max(0, math.Min(frac, 1))
+	return int64(math.Round(from + (to-from)*frac))
+}
+
+// Distribution returns one bar per centroid, with boundaries halfway between
+// neighbouring centroids.
+func (t *tdigest) Distribution() []histogram.Bar {
+	t.merge()
+
+	ans := make([]histogram.Bar, len(t.centroids))
+	for i, c := range t.centroids {
+		from, to := float64(t.min), float64(t.max)
+		if i > 0 {
+			from = (t.centroids[i-1].mean + c.mean) / 2
+		}
+		if i < len(t.centroids)-1 {
+			to = (c.mean + t.centroids[i+1].mean) / 2
+		}
+
+		ans[i] = histogram.Bar{From: int64(from), To: int64(to), Count: int64(math.Round(c.count))}
+	}
+
+	return ans
+}
+
+func (t *tdigest) Reset() {
+	*t = *newtdigest(t.low, t.high, t.compression)
+}
+
+func (t *tdigest) LowestTrackableValue() int64 { return t.low }
+
+func (t *tdigest) HighestTrackableValue() int64 { return t.high }
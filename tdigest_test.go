@@ -0,0 +1,74 @@
+package speed
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTDigestQuantiles(t *testing.T) {
+	d := newtdigest(0, 1000000, DefaultTDigestCompression)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		if err := d.RecordValue(r.Int63n(1000000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, q := range []float64{1, 10, 50, 90, 99, 99.9} {
+		v := d.ValueAtQuantile(q)
+		expected := q * 10000
+		if math.Abs(float64(v)-expected) > 5000 {
+			t.Errorf("expected value at quantile %v to be close to %v, got %v", q, expected, v)
+		}
+	}
+
+	if l := len(d.centroids); l > 5*DefaultTDigestCompression {
+		t.Errorf("expected centroids to be bounded, got %v", l)
+	}
+
+	if d.Min() < 0 || d.Max() >= 1000000 {
+		t.Errorf("unexpected min %v, max %v", d.Min(), d.Max())
+	}
+
+	var total int64
+	for _, b := range d.Distribution() {
+		total += b.Count
+	}
+
+	if total != 100000 {
+		t.Errorf("expected distribution to add up to 100000, got %v", total)
+	}
+
+	if err := d.RecordValue(1000001); err == nil {
+		t.Error("expected an error recording a value outside the trackable range")
+	}
+}
+
+func TestTDigestHistogram(t *testing.T) {
+	h, err := NewPCPTDigestHistogram("test.tdigest", 0, 1000, DefaultTDigestCompression, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int64(1); i <= 100; i++ {
+		h.MustRecord(i)
+	}
+
+	if h.Min() != 1 || h.Max() != 100 {
+		t.Errorf("expected min 1 and max 100, got %v and %v", h.Min(), h.Max())
+	}
+
+	if h.Mean() != 50.5 {
+		t.Errorf("expected mean 50.5, got %v", h.Mean())
+	}
+
+	if p := h.Percentile(50); p < 49 || p > 52 {
+		t.Errorf("expected median close to 50, got %v", p)
+	}
+
+	if _, err = NewPCPTDigestHistogram("test.tdigest", 0, 1000, 1, OneUnit); err == nil {
+		t.Error("expected an error for a tiny compression")
+	}
+}
@@ -0,0 +1,124 @@
+package speed
+
+import (
+	"context"
+	"runtime/trace"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TraceTimers wraps runtime/trace regions and tasks, recording the time spent in
+// them into a PCPTimer per region or task type, so ad hoc trace instrumentation
+// also exports continuous metrics, whether an execution trace is being taken or not.
+//
+// The types have to be declared on construction, as metrics cannot be added once a
+// mapping is active. Regions and tasks of types that were not declared are only traced.
+type TraceTimers struct {
+	timers map[string]*PCPTimer
+}
+
+// NewTraceTimers creates a new TraceTimers with a timer of the passed unit named
+// "<prefix>.<type>" for each passed region or task type.
+func NewTraceTimers(prefix string, unit TimeUnit, types ...string) (*TraceTimers, error) {
+	if prefix == "" {
+		return nil, errors.New("trace timers prefix cannot be empty")
+	}
+
+	if len(types) == 0 {
+		return nil, errors.New("trace timers need at least one region or task type")
+	}
+
+	t := &TraceTimers{timers: make(map[string]*PCPTimer, len(types))}
+	for _, typ := range types {
+		if _, present := t.timers[typ]; present {
+			return nil, errors.Errorf("type %v declared twice", typ)
+		}
+
+		timer, err := NewPCPTimer(prefix+"."+typ, unit, "time spent in "+typ+" trace regions")
+		if err != nil {
+			return nil, err
+		}
+
+		t.timers[typ] = timer
+	}
+
+	return t, nil
+}
+
+// Metrics returns the timers of all declared types.
+func (t *TraceTimers) Metrics() []Metric {
+	ans := make([]Metric, 0, len(t.timers))
+	for _, timer := range t.timers {
+		ans = append(ans, timer)
+	}
+	return ans
+}
+
+// Register registers the timers of all declared types with the passed client.
+func (t *TraceTimers) Register(c Client) error {
+	for _, m := range t.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Timer returns the timer of a declared type, or nil.
+func (t *TraceTimers) Timer(typ string) *PCPTimer { return t.timers[typ] }
+
+// record adds the time since start to the timer of a type, if it was declared
+func (t *TraceTimers) record(typ string, start time.Time) {
+	if timer, ok := t.timers[typ]; ok {
+		_, _ = timer.Add(time.Since(start))
+	}
+}
+
+// WithRegion is trace.WithRegion, also recording the time spent in fn.
+func (t *TraceTimers) WithRegion(ctx context.Context, regionType string, fn func()) {
+	start := time.Now()
+	defer t.record(regionType, start)
+
+	trace.WithRegion(ctx, regionType, fn)
+}
+
+// TimedRegion is a trace.Region recording its duration on End.
+type TimedRegion struct {
+	*trace.Region
+	timers *TraceTimers
+	typ    string
+	start  time.Time
+}
+
+// StartRegion is trace.StartRegion for a region recording its duration on End.
+func (t *TraceTimers) StartRegion(ctx context.Context, regionType string) *TimedRegion {
+	return &TimedRegion{trace.StartRegion(ctx, regionType), t, regionType, time.Now()}
+}
+
+// End ends the region, and records its duration.
+func (r *TimedRegion) End() {
+	r.Region.End()
+	r.timers.record(r.typ, r.start)
+}
+
+// TimedTask is a trace.Task recording its duration on End.
+type TimedTask struct {
+	*trace.Task
+	timers *TraceTimers
+	typ    string
+	start  time.Time
+}
+
+// NewTask is trace.NewTask for a task recording its duration on End.
+func (t *TraceTimers) NewTask(ctx context.Context, taskType string) (context.Context, *TimedTask) {
+	ctx, task := trace.NewTask(ctx, taskType)
+	return ctx, &TimedTask{task, t, taskType, time.Now()}
+}
+
+// End ends the task, and records its duration.
+func (task *TimedTask) End() {
+	task.Task.End()
+	task.timers.record(task.typ, task.start)
+}
@@ -0,0 +1,71 @@
+package speed
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTraceTimers(t *testing.T) {
+	tt, err := NewTraceTimers("test.trace", MillisecondUnit, "parse", "request")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tt.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	ctx, task := tt.NewTask(context.Background(), "request")
+
+	tt.WithRegion(ctx, "parse", func() { time.Sleep(2 * time.Millisecond) })
+
+	r := tt.StartRegion(ctx, "parse")
+	time.Sleep(2 * time.Millisecond)
+	r.End()
+
+	// undeclared types are only traced
+	tt.WithRegion(ctx, "other", func() {})
+
+	task.End()
+
+	parse, request := tt.Timer("parse").val.(float64), tt.Timer("request").val.(float64)
+	if parse < 4 {
+		t.Errorf("expected at least 4ms in parse regions, got %v", parse)
+	}
+
+	if request < parse {
+		t.Errorf("expected the request task to take at least as long as its regions, got %v", request)
+	}
+
+	if tt.Timer("other") != nil {
+		t.Error("expected no timer for an undeclared type")
+	}
+
+	if _, err = NewTraceTimers("test.trace", MillisecondUnit, "a", "a"); err == nil {
+		t.Error("expected an error declaring a type twice")
+	}
+}
+
+func TestTimerAdd(t *testing.T) {
+	timer, err := NewPCPTimer("test.timer", MicrosecondUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := timer.Add(3 * time.Millisecond); err != nil || v != 3000 {
+		t.Errorf("expected 3000us, got %v, %v", v, err)
+	}
+
+	if _, err = timer.Add(-time.Second); err == nil {
+		t.Error("expected an error adding a negative duration")
+	}
+}
@@ -0,0 +1,196 @@
+package speed
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OtherHost is the instance that requests to undeclared hosts are counted under
+const OtherHost = "other"
+
+// Transport is an http.RoundTripper instrumenting outbound requests per host,
+// exporting the number of requests and failed requests, and the cumulative time
+// spent in requests, resolving names, connecting and in TLS handshakes, in
+// nanoseconds, so PCP can derive average latencies by dividing them by the
+// number of requests, like with a LatencyPair.
+//
+// The time of a request is the time until its response headers are read.
+// The hosts have to be declared on construction, as instances cannot be added
+// once a mapping is active. Requests to other hosts are counted under OtherHost.
+type Transport struct {
+	next  http.RoundTripper
+	hosts map[string]bool
+
+	mutex                   sync.Mutex // serializes updates of the times
+	requests, errors        *PCPCounterVector
+	time, dns, connect, tls *PCPInstanceMetric
+}
+
+// NewTransport creates a new Transport with all metrics under the passed prefix,
+// sending requests using next, or http.DefaultTransport if it is nil.
+func NewTransport(prefix string, next http.RoundTripper, hosts ...string) (*Transport, error) {
+	if prefix == "" {
+		return nil, errors.New("transport prefix cannot be empty")
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	t := &Transport{next: next, hosts: make(map[string]bool, len(hosts))}
+
+	instances := []string{OtherHost}
+	for _, h := range hosts {
+		if h == OtherHost || t.hosts[h] {
+			return nil, errors.Errorf("host %v declared twice", h)
+		}
+
+		t.hosts[h] = true
+		instances = append(instances, h)
+	}
+
+	indom, err := NewPCPInstanceDomain(prefix+".host.indom", instances, "hosts requests are sent to")
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(instances))
+	for _, i := range instances {
+		counts[i] = 0
+	}
+
+	if t.requests, err = NewPCPCounterVector(counts, prefix+".requests", "number of requests sent"); err != nil {
+		return nil, err
+	}
+
+	if t.errors, err = NewPCPCounterVector(counts, prefix+".errors", "number of requests that failed without a response"); err != nil {
+		return nil, err
+	}
+
+	newTime := func(name, desc string) (*PCPInstanceMetric, error) {
+		return NewPCPInstanceMetric(
+			zeroInstances(instances, uint64(0)), prefix+"."+name,
+			indom, Uint64Type, CounterSemantics, NanosecondUnit, desc,
+		)
+	}
+
+	if t.time, err = newTime("time", "cumulative time until the response headers were read"); err != nil {
+		return nil, err
+	}
+
+	if t.dns, err = newTime("dns.time", "cumulative time spent resolving host names"); err != nil {
+		return nil, err
+	}
+
+	if t.connect, err = newTime("connect.time", "cumulative time spent connecting"); err != nil {
+		return nil, err
+	}
+
+	if t.tls, err = newTime("tls.time", "cumulative time spent in TLS handshakes"); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Metrics returns all the metrics exported by the transport.
+func (t *Transport) Metrics() []Metric {
+	return []Metric{t.requests, t.errors, t.time, t.dns, t.connect, t.tls}
+}
+
+// Register registers all metrics of the transport with the passed client.
+func (t *Transport) Register(c Client) error {
+	for _, m := range t.Metrics() {
+		if err := c.Register(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requestPhases collects the phase timings of a single request
+type requestPhases struct {
+	mutex                 sync.Mutex
+	dnsStart, tlsStart    time.Time
+	connectStart          map[string]time.Time // by address, connections can be attempted in parallel
+	dns, connect, tlsTime time.Duration
+}
+
+func (p *requestPhases) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.mutex.Lock()
+			p.dnsStart = time.Now()
+			p.mutex.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			p.mutex.Lock()
+			p.dns += time.Since(p.dnsStart)
+			p.mutex.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			p.mutex.Lock()
+			p.connectStart[addr] = time.Now()
+			p.mutex.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			p.mutex.Lock()
+			p.connect += time.Since(p.connectStart[addr])
+			p.mutex.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			p.mutex.Lock()
+			p.tlsStart = time.Now()
+			p.mutex.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.mutex.Lock()
+			p.tlsTime += time.Since(p.tlsStart)
+			p.mutex.Unlock()
+		},
+	}
+}
+
+// RoundTrip sends the request using the wrapped RoundTripper, recording its metrics.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if !t.hosts[host] {
+		host = OtherHost
+	}
+
+	p := &requestPhases{connectStart: make(map[string]time.Time)}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), p.trace()))
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	d := time.Since(start)
+
+	_ = t.requests.Inc(1, host)
+	if err != nil {
+		_ = t.errors.Inc(1, host)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, v := range []struct {
+		m *PCPInstanceMetric
+		d time.Duration
+	}{{t.time, d}, {t.dns, p.dns}, {t.connect, p.connect}, {t.tls, p.tlsTime}} {
+		if v.d > 0 {
+			cur, _ := v.m.ValInstance(host)
+			_ = v.m.SetInstance(cur.(uint64)+uint64(v.d), host)
+		}
+	}
+
+	return res, err
+}
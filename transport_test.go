@@ -0,0 +1,70 @@
+package speed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := NewTransport("test.http", nil, u.Hostname())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tr.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	if v, _ := tr.requests.Val(u.Hostname()); v != 2 {
+		t.Errorf("expected 2 requests to %v, got %v", u.Hostname(), v)
+	}
+
+	if v, _ := tr.time.ValInstance(u.Hostname()); v.(uint64) == 0 {
+		t.Error("expected the time of the requests to be recorded")
+	}
+
+	if v, _ := tr.connect.ValInstance(u.Hostname()); v.(uint64) == 0 {
+		t.Error("expected the time spent connecting to be recorded")
+	}
+
+	// a request to a closed port fails, and is counted under OtherHost
+	if res, err := client.Get("http://localhost:1"); err == nil {
+		res.Body.Close()
+		t.Fatal("expected the request to a closed port to fail")
+	}
+
+	if v, _ := tr.errors.Val(OtherHost); v != 1 {
+		t.Errorf("expected a failed request to another host, got %v", v)
+	}
+
+	if _, err = NewTransport("test.http", nil, "a", "a"); err == nil {
+		t.Error("expected an error declaring a host twice")
+	}
+}
@@ -0,0 +1,143 @@
+//go:build go1.18
+// +build go1.18
+
+package speed
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMetricBusy is returned by the TrySet family of methods
+// when an update is dropped as the metric is locked.
+var ErrMetricBusy = errors.New("metric is busy, update dropped")
+
+// WithDropCounter creates a companion counter named "<name>.dropped" that counts
+// updates dropped by the TrySet family of methods.
+//
+// The companion is registered along with the metric, so the option has to be
+// applied before registering the metric with a client.
+func WithDropCounter() MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if md.dropped != nil {
+			return errors.Errorf("metric %v already has a drop counter", md.name)
+		}
+
+		c, err := NewPCPCounter(0, md.name+".dropped", "number of updates to "+md.name+" dropped as it was busy")
+		if err != nil {
+			return err
+		}
+
+		md.dropped = c
+		md.companions = append(md.companions, c)
+		return nil
+	}
+}
+
+// drop records a dropped update
+func (md *pcpMetricDesc) drop() error {
+	if md.dropped != nil {
+		md.dropped.Up()
+	}
+
+	return ErrMetricBusy
+}
+
+type tryLocker interface {
+	TryLock() bool
+}
+
+// lockWithin tries to acquire a lock until the passed duration passes,
+// polling with an exponential backoff of up to a millisecond
+func lockWithin(l tryLocker, d time.Duration) bool {
+	if l.TryLock() {
+		return true
+	}
+
+	deadline := time.Now().Add(d)
+	for backoff := time.Microsecond; time.Now().Before(deadline); {
+		time.Sleep(backoff)
+
+		if l.TryLock() {
+			return true
+		}
+
+		if backoff < time.Millisecond {
+			backoff *= 2
+		}
+	}
+
+	return false
+}
+
+// TrySet is Set that returns ErrMetricBusy instead of blocking if the metric is locked.
+func (m *PCPSingletonMetric) TrySet(val interface{}) error { return m.SetTimeout(val, 0) }
+
+// SetTimeout is Set that returns ErrMetricBusy if the metric stays locked for the passed duration.
+func (m *PCPSingletonMetric) SetTimeout(val interface{}, d time.Duration) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	if !lockWithin(&m.mutex, d) {
+		return m.drop()
+	}
+	defer m.mutex.Unlock()
+
+	return m.set(val)
+}
+
+// TrySet is Set that returns ErrMetricBusy instead of blocking if the gauge is locked.
+func (g *PCPGauge) TrySet(val float64) error { return g.SetTimeout(val, 0) }
+
+// SetTimeout is Set that returns ErrMetricBusy if the gauge stays locked for the passed duration.
+func (g *PCPGauge) SetTimeout(val float64, d time.Duration) error {
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
+	if !lockWithin(&g.mutex, d) {
+		return g.drop()
+	}
+	defer g.mutex.Unlock()
+
+	return g.set(val)
+}
+
+// TryInc is Inc that returns ErrMetricBusy instead of blocking if the counter is locked.
+func (c *PCPCounter) TryInc(val int64) error { return c.IncTimeout(val, 0) }
+
+// IncTimeout is Inc that returns ErrMetricBusy if the counter stays locked for the passed duration.
+func (c *PCPCounter) IncTimeout(val int64, d time.Duration) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	if !lockWithin(&c.mutex, d) {
+		return c.drop()
+	}
+	defer c.mutex.Unlock()
+
+	return c.inc(val)
+}
+
+// TrySetInstance is SetInstance that returns ErrMetricBusy instead of blocking if the metric is locked.
+func (m *PCPInstanceMetric) TrySetInstance(val interface{}, instance string) error {
+	return m.SetInstanceTimeout(val, instance, 0)
+}
+
+// SetInstanceTimeout is SetInstance that returns ErrMetricBusy
+// if the metric stays locked for the passed duration.
+func (m *PCPInstanceMetric) SetInstanceTimeout(val interface{}, instance string, d time.Duration) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	if !lockWithin(&m.mutex, d) {
+		return m.drop()
+	}
+	defer m.mutex.Unlock()
+
+	return m.setInstance(val, instance)
+}
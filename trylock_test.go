@@ -0,0 +1,109 @@
+//go:build go1.18
+// +build go1.18
+
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrySet(t *testing.T) {
+	g, err := NewPCPGauge(0, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.Apply(WithDropCounter()); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(g)
+	if !c.Registry().HasMetric("test.gauge.dropped") {
+		t.Error("expected the drop counter to be registered along with the gauge")
+	}
+
+	if err = g.TrySet(1); err != nil {
+		t.Fatal(err)
+	}
+
+	g.mutex.Lock()
+
+	if err = g.TrySet(2); err != ErrMetricBusy {
+		t.Errorf("expected ErrMetricBusy setting a locked gauge, got %v", err)
+	}
+
+	start := time.Now()
+	if err = g.SetTimeout(2, 5*time.Millisecond); err != ErrMetricBusy {
+		t.Errorf("expected ErrMetricBusy setting a locked gauge with a timeout, got %v", err)
+	}
+
+	if time.Since(start) < 5*time.Millisecond {
+		t.Error("expected SetTimeout to wait for the timeout")
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		g.mutex.Unlock()
+	}()
+
+	if err = g.SetTimeout(3, time.Second); err != nil {
+		t.Errorf("expected SetTimeout to succeed once the gauge is unlocked, got %v", err)
+	}
+
+	if g.Val() != 3 {
+		t.Errorf("expected the gauge to be 3, got %v", g.Val())
+	}
+
+	if g.dropped.Val() != 2 {
+		t.Errorf("expected 2 dropped updates, got %v", g.dropped.Val())
+	}
+}
+
+func TestTrySetInstance(t *testing.T) {
+	indom, err := NewPCPInstanceDomain("test.indom", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewPCPInstanceMetric(Instances{"a": 0}, "test.instance", indom, Int32Type, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := NewPCPCounter(0, "test.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.TrySetInstance(1, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = counter.TryInc(1); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mutex.RLock()
+	counter.mutex.RLock()
+
+	if err = m.TrySetInstance(2, "a"); err != ErrMetricBusy {
+		t.Errorf("expected ErrMetricBusy setting a locked metric, got %v", err)
+	}
+
+	if err = counter.TryInc(1); err != ErrMetricBusy {
+		t.Errorf("expected ErrMetricBusy incrementing a locked counter, got %v", err)
+	}
+
+	m.mutex.RUnlock()
+	counter.mutex.RUnlock()
+
+	if v, _ := m.ValInstance("a"); v != int32(1) || counter.Val() != 1 {
+		t.Errorf("expected dropped updates not to be applied, got %v and %v", v, counter.Val())
+	}
+}
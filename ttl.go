@@ -0,0 +1,134 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ttlTracker tracks the time of the last update of every value of a metric,
+// marking values that were not updated within the ttl as stale
+type ttlTracker struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	updated map[string]time.Time
+	timers  map[string]*time.Timer
+	stale   map[string]bool
+	count   *PCPSingletonMetric // number of stale values
+}
+
+func newttlTracker(ttl time.Duration, count *PCPSingletonMetric) *ttlTracker {
+	return &ttlTracker{
+		ttl:     ttl,
+		updated: make(map[string]time.Time),
+		timers:  make(map[string]*time.Timer),
+		stale:   make(map[string]bool),
+		count:   count,
+	}
+}
+
+// setCount writes the number of stale values to the companion metric
+func (t *ttlTracker) setCount() {
+	t.count.mutex.Lock()
+	defer t.count.mutex.Unlock()
+
+	_ = t.count.set(uint32(len(t.stale)))
+}
+
+// touch records an update of an instance, clearing its staleness
+func (t *ttlTracker) touch(instance string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.updated[instance] = time.Now()
+
+	if t.stale[instance] {
+		delete(t.stale, instance)
+		t.setCount()
+	}
+
+	if timer, ok := t.timers[instance]; ok {
+		timer.Reset(t.ttl)
+		return
+	}
+
+	t.timers[instance] = time.AfterFunc(t.ttl, func() { t.expire(instance) })
+}
+
+// expire marks an instance as stale, unless it was updated
+// since its timer was scheduled
+func (t *ttlTracker) expire(instance string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if left := t.ttl - time.Since(t.updated[instance]); left > 0 {
+		t.timers[instance].Reset(left)
+		return
+	}
+
+	if !t.stale[instance] {
+		t.stale[instance] = true
+		t.setCount()
+	}
+}
+
+func (t *ttlTracker) isStale(instance string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.stale[instance]
+}
+
+// WithTTL marks the values of a metric that are not updated within the passed
+// duration as stale, so consumers can tell frozen values apart from current ones.
+//
+// The MMV format cannot withdraw a value once written, so the last value stays
+// in place, and the number of stale values is exported by a companion discrete
+// metric named "<name>.stale", which for singleton metrics is either 0 or 1.
+// For instance metrics, every instance is tracked separately.
+// A value is tracked from its first update onwards.
+//
+// The companion is registered along with the metric, so the option has to be
+// applied before registering the metric with a client.
+func WithTTL(ttl time.Duration) MetricOption {
+	return func(md *pcpMetricDesc) error {
+		if ttl <= 0 {
+			return errors.New("ttl must be positive")
+		}
+
+		if md.ttl != nil {
+			return errors.Errorf("metric %v already has a ttl", md.name)
+		}
+
+		count, err := NewPCPSingletonMetric(
+			uint32(0), md.name+".stale", Uint32Type, InstantSemantics, OneUnit,
+			"number of values of "+md.name+" not updated within "+ttl.String(),
+		)
+		if err != nil {
+			return err
+		}
+
+		md.ttl = newttlTracker(ttl, count)
+		md.companions = append(md.companions, count)
+		return nil
+	}
+}
+
+// touch records an update of the metric, if it has a ttl
+func (md *pcpMetricDesc) touch(instance string) {
+	if md.ttl != nil {
+		md.ttl.touch(instance)
+	}
+}
+
+// Stale reports whether the value of the passed instance was not updated within
+// the ttl of the metric, passing an empty instance for singleton metrics.
+// It is always false for metrics without WithTTL.
+func (md *pcpMetricDesc) Stale(instance string) bool {
+	if md.ttl == nil {
+		return false
+	}
+
+	return md.ttl.isStale(instance)
+}
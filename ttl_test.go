@@ -0,0 +1,113 @@
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+// waitFor polls the passed condition for up to a second
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return cond()
+}
+
+func TestSingletonTTL(t *testing.T) {
+	g, err := NewPCPGauge(0, "test.ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.Apply(WithTTL(0)); err == nil {
+		t.Error("expected an error applying a zero ttl")
+	}
+
+	if err = g.Apply(WithTTL(20 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.Apply(WithTTL(time.Second)); err == nil {
+		t.Error("expected an error applying WithTTL twice")
+	}
+
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(g)
+	if !c.Registry().HasMetric("test.ttl.stale") {
+		t.Error("expected the staleness metric to be registered with the gauge")
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	g.MustSet(1)
+	if g.Stale("") {
+		t.Error("expected a freshly updated gauge not to be stale")
+	}
+
+	if !waitFor(func() bool { return g.Stale("") }) {
+		t.Fatal("expected the gauge to become stale")
+	}
+
+	matchSingleDump(uint32(1), g.ttl.count, c, t)
+
+	g.MustSet(2)
+	if g.Stale("") {
+		t.Error("expected an update to clear the staleness")
+	}
+
+	matchSingleDump(uint32(0), g.ttl.count, c, t)
+
+	clone := g.Clone()
+	if clone.Stale("") || clone.ttl.count.Val() != uint32(0) {
+		t.Error("expected the clone not to be stale")
+	}
+}
+
+func TestInstanceTTL(t *testing.T) {
+	cv, err := NewPCPCounterVector(map[string]int64{"a": 0, "b": 0}, "test.ttl.vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cv.Apply(WithTTL(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	cv.MustInc(1, "a")
+	cv.MustInc(1, "b")
+
+	// keep a fresh, while b goes stale
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+				cv.MustInc(1, "a")
+			}
+		}
+	}()
+
+	if !waitFor(func() bool { return cv.Stale("b") }) {
+		t.Fatal("expected b to become stale")
+	}
+
+	if cv.Stale("a") {
+		t.Error("expected a not to be stale")
+	}
+
+	if v := cv.ttl.count.Val(); v != uint32(1) {
+		t.Errorf("expected 1 stale instance, got %v", v)
+	}
+}
@@ -0,0 +1,78 @@
+package speed
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// unitDims is a decoded PMAPI unit representation
+//
+// see: https://github.com/performancecopilot/pcp/blob/master/src/include/pcp/pmapi.h#L61-L101
+type unitDims struct {
+	spaceDim, timeDim, countDim       int8
+	spaceScale, timeScale, countScale int8
+}
+
+// nibble extracts a signed 4 bit value at the passed bit offset
+func nibble(v uint32, off uint) int8 {
+	return int8(v>>off<<4) >> 4
+}
+
+func decodeUnit(u MetricUnit) unitDims {
+	v := u.PMAPI()
+	return unitDims{
+		spaceDim:   nibble(v, 28),
+		timeDim:    nibble(v, 24),
+		countDim:   nibble(v, 20),
+		spaceScale: int8(v >> 16 & 0xF),
+		timeScale:  int8(v >> 12 & 0xF),
+		countScale: nibble(v, 8),
+	}
+}
+
+// timeScaleNanoseconds holds the length of each TimeUnit scale in nanoseconds
+var timeScaleNanoseconds = []float64{1, 1e3, 1e6, 1e9, 60e9, 3600e9}
+
+// size returns the size of one unit of the space, time and count scales,
+// in bytes, nanoseconds and ones respectively
+func (d unitDims) size() (space, time, count float64, err error) {
+	if int(d.timeScale) >= len(timeScaleNanoseconds) {
+		return 0, 0, 0, errors.Errorf("invalid time scale %v", d.timeScale)
+	}
+
+	space = math.Pow(1024, float64(d.spaceScale))
+	time = timeScaleNanoseconds[d.timeScale]
+	count = math.Pow(10, float64(d.countScale))
+	return
+}
+
+// ConvertValue converts a value from one unit to another, honoring the
+// space, time and count scales of both. For example converting 2048 from
+// ByteUnit to KilobyteUnit returns 2.
+//
+// The units must have the same dimensions, i.e. bytes per second can be converted
+// to megabytes per hour, but not to bytes.
+func ConvertValue(val float64, from, to MetricUnit) (float64, error) {
+	f, t := decodeUnit(from), decodeUnit(to)
+
+	if f.spaceDim != t.spaceDim || f.timeDim != t.timeDim || f.countDim != t.countDim {
+		return 0, errors.Errorf("cannot convert between units %v and %v with different dimensions", from, to)
+	}
+
+	fs, ft, fc, err := f.size()
+	if err != nil {
+		return 0, err
+	}
+
+	ts, tt, tc, err := t.size()
+	if err != nil {
+		return 0, err
+	}
+
+	factor := math.Pow(fs/ts, float64(f.spaceDim)) *
+		math.Pow(ft/tt, float64(f.timeDim)) *
+		math.Pow(fc/tc, float64(f.countDim))
+
+	return val * factor, nil
+}
@@ -0,0 +1,42 @@
+package speed
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvertValue(t *testing.T) {
+	cases := []struct {
+		val       float64
+		from, to  MetricUnit
+		expected  float64
+		shouldErr bool
+	}{
+		{2048, ByteUnit, KilobyteUnit, 2, false},
+		{1, GigabyteUnit, MegabyteUnit, 1024, false},
+		{1500, MillisecondUnit, SecondUnit, 1.5, false},
+		{2, HourUnit, MinuteUnit, 120, false},
+		{1, MicrosecondUnit, NanosecondUnit, 1000, false},
+		{5, OneUnit, OneUnit, 5, false},
+		{1024, ByteUnit.Time(SecondUnit, -1), KilobyteUnit.Time(MinuteUnit, -1), 60, false},
+		{1, SecondUnit.Count(OneUnit, -1), MillisecondUnit.Count(OneUnit, -1), 1000, false},
+		{1, ByteUnit, SecondUnit, 0, true},
+		{1, ByteUnit, OneUnit, 0, true},
+	}
+
+	for _, c := range cases {
+		v, err := ConvertValue(c.val, c.from, c.to)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("expected an error converting from %v to %v", c.from, c.to)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("cannot convert from %v to %v, error: %v", c.from, c.to, err)
+		} else if math.Abs(v-c.expected) > 1e-9 {
+			t.Errorf("expected %v %v to be %v %v, got %v", c.val, c.from, c.expected, c.to, v)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package speed
+
+// Update atomically replaces the value of the metric with the result of calling f
+// with its current value, so read-modify-write updates do not race like a Val followed
+// by a Set. f runs while the metric is locked, so it should be quick, and updating the
+// metric from it fails with ErrReentrantUpdate.
+func (m *PCPSingletonMetric) Update(f func(old interface{}) interface{}) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var val interface{}
+	m.callback(func() { val = f(m.val) })
+
+	return m.set(val)
+}
+
+// CompareAndSwap atomically sets the value of the metric to new if its current value
+// is old, returning whether it was set. Both values are coerced like values passed to Set.
+func (m *PCPSingletonMetric) CompareAndSwap(old, new interface{}) (bool, error) {
+	if err := m.prepare(); err != nil {
+		return false, err
+	}
+
+	old, err := m.coerce(old)
+	if err != nil {
+		return false, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.val != old {
+		return false, nil
+	}
+
+	if err = m.set(new); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpdateInstance is Update for a particular instance of the metric.
+func (m *PCPInstanceMetric) UpdateInstance(f func(old interface{}) interface{}, instance string) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	old, err := m.valInstance(instance)
+	if err != nil {
+		return err
+	}
+
+	var val interface{}
+	m.callback(func() { val = f(old) })
+
+	return m.setInstance(val, instance)
+}
+
+// CompareAndSwapInstance is CompareAndSwap for a particular instance of the metric.
+func (m *PCPInstanceMetric) CompareAndSwapInstance(old, new interface{}, instance string) (bool, error) {
+	if err := m.prepare(); err != nil {
+		return false, err
+	}
+
+	old, err := m.coerce(old)
+	if err != nil {
+		return false, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cur, err := m.valInstance(instance)
+	if err != nil {
+		return false, err
+	}
+
+	if cur != old {
+		return false, nil
+	}
+
+	if err = m.setInstance(new, instance); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,117 @@
+package speed
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	c, err := NewPCPClient("update")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.MustRegisterString("test.max", int64(0), Int64Type, InstantSemantics, OneUnit).(*PCPSingletonMetric)
+	c.MustStart()
+	defer c.MustStop()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(v int64) {
+			defer wg.Done()
+
+			err := m.Update(func(old interface{}) interface{} {
+				if v > old.(int64) {
+					return v
+				}
+				return old
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	if v := m.Val(); v != int64(100) {
+		t.Errorf("expected the maximum to be 100, got %v", v)
+	}
+
+	matchSingleDump(int64(100), m, c, t)
+
+	if err = m.Update(func(interface{}) interface{} { return "many" }); err == nil {
+		t.Error("expected an error updating to a value of the wrong type")
+	}
+
+	var reentrant error
+	_ = m.Update(func(old interface{}) interface{} {
+		reentrant = m.Set(int64(1))
+		return old
+	})
+
+	if reentrant != ErrReentrantUpdate {
+		t.Errorf("expected setting the metric from its update to fail, got %v", reentrant)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	m, err := NewPCPSingletonMetric(int64(1), "test.state", Int64Type, DiscreteSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := m.CompareAndSwap(int64(2), int64(3)); ok || err != nil {
+		t.Errorf("expected no swap for a different value, got %v, %v", ok, err)
+	}
+
+	if ok, err := m.CompareAndSwap(int64(1), int64(3)); !ok || err != nil || m.Val() != int64(3) {
+		t.Errorf("expected a swap to 3, got %v, %v and %v", ok, err, m.Val())
+	}
+
+	if ok, err := m.CompareAndSwap("3", int64(4)); ok || err == nil {
+		t.Errorf("expected an error comparing with a value of the wrong type, got %v", ok)
+	}
+}
+
+func TestUpdateInstance(t *testing.T) {
+	indom, err := NewPCPInstanceDomain("test.indom", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewPCPInstanceMetric(Instances{"a": 1.0, "b": 2.0}, "test.vector", indom, DoubleType, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	double := func(old interface{}) interface{} { return old.(float64) * 2 }
+
+	if err = m.UpdateInstance(double, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := m.ValInstance("b"); v != 4.0 {
+		t.Errorf("expected b to be doubled to 4, got %v", v)
+	}
+
+	if err = m.UpdateInstance(double, "c"); err == nil {
+		t.Error("expected an error updating an unknown instance")
+	}
+
+	if ok, err := m.CompareAndSwapInstance(1.0, 5.0, "b"); ok || err != nil {
+		t.Errorf("expected no swap for a different value, got %v, %v", ok, err)
+	}
+
+	if ok, err := m.CompareAndSwapInstance(1.0, 5.0, "a"); !ok || err != nil {
+		t.Errorf("expected a swap of a, got %v, %v", ok, err)
+	}
+
+	if v, _ := m.ValInstance("a"); v != 5.0 {
+		t.Errorf("expected a to be swapped to 5, got %v", v)
+	}
+
+	if _, err = m.CompareAndSwapInstance(1.0, 5.0, "c"); err == nil {
+		t.Error("expected an error swapping an unknown instance")
+	}
+}
@@ -0,0 +1,142 @@
+package speed
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ValidateRegistration checks whether the passed metric, along with its companion
+// metrics, can be registered with the client, without registering anything, so
+// applications building metrics dynamically, for example from configuration, can
+// reject invalid sets before committing to any of them.
+//
+// It performs the checks of Register, i.e. the names, prefixed with the prefix of the
+// client, must not be reserved, too long or registered, the instance domain must not
+// conflict with a registered one, and the capacity of the MMV format must not be
+// exceeded. It also reports metrics and instance domains whose ids collide with
+// registered ones, which Register accepts, but which PCP cannot tell apart.
+func (c *PCPClient) ValidateRegistration(m Metric) error {
+	if reserved(c.prefix + m.Name()) {
+		return errors.Errorf("metric %v is under the subtree reserved for contributed metrics", m.Name())
+	}
+
+	pm, ok := m.(PCPMetric)
+	if !ok {
+		return errors.Errorf("metric %v of type %T cannot be registered", m.Name(), m)
+	}
+
+	if c.r.mapped {
+		return errors.New("cannot add a metric when a mapping is active")
+	}
+
+	ms := []PCPMetric{pm}
+	if dm, ok := m.(describedMetric); ok {
+		if c.prefix != "" && atomic.LoadInt32(&dm.desc().registered) != 0 {
+			return errors.Errorf("metric %v is already registered with a client, so it cannot be prefixed", m.Name())
+		}
+
+		for _, cm := range dm.desc().companions {
+			ms = append(ms, cm.(PCPMetric))
+		}
+	} else if c.prefix != "" {
+		return errors.Errorf("metric %v of type %T cannot be prefixed", m.Name(), m)
+	}
+
+	values := 0
+	for _, cm := range ms {
+		if indom := cm.Indom(); indom != nil {
+			values += indom.InstanceCount()
+		} else {
+			values++
+		}
+	}
+
+	if err := checkLimit("metrics", c.r.MetricCount(), len(ms), MaxMetrics); err != nil {
+		return err
+	}
+
+	if err := checkLimit("values", c.r.ValuesCount(), values, MaxValues); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(ms))
+	ids := make(map[uint32]string, len(ms))
+
+	for _, cm := range ms {
+		name, id := cm.Name(), cm.ID()
+		if c.prefix != "" {
+			name = c.prefix + name
+			id = hash(name, PCPMetricItemBitLength)
+		}
+
+		switch {
+		case len(name) > StringLength, c.prefix != "" && len(name) >= StringLength:
+			return errors.Errorf("prefixed metric name %v is too long", name)
+		case names[name]:
+			return errors.Errorf("metric %v is defined more than once", name)
+		case c.r.HasMetric(name):
+			return errors.Errorf("metric %v is already defined for the current registry", name)
+		}
+
+		if other, ok := ids[id]; ok {
+			return errors.Errorf("metric %v has the same id %v as %v", name, id, other)
+		}
+
+		if other := c.r.metricWithID(id); other != "" {
+			return errors.Errorf("metric %v has the same id %v as the registered metric %v", name, id, other)
+		}
+
+		names[name], ids[id] = true, name
+
+		if err := c.r.validateInstanceDomain(cm.Indom()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// metricWithID returns the name of the registered metric with the passed id, if any
+func (r *PCPRegistry) metricWithID(id uint32) string {
+	r.metricslock.RLock()
+	defer r.metricslock.RUnlock()
+
+	for name, m := range r.metrics {
+		if m.ID() == id {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// validateInstanceDomain checks whether the instance domain of a metric
+// can be used alongside the registered ones
+func (r *PCPRegistry) validateInstanceDomain(indom *PCPInstanceDomain) error {
+	if indom == nil {
+		return nil
+	}
+
+	if other := r.instanceDomain(indom.Name()); other != nil {
+		if other != indom && (other.ID() != indom.ID() || !other.MatchInstances(indom.Instances())) {
+			return errors.Errorf("a different InstanceDomain named %v is already defined for the current registry", indom.Name())
+		}
+
+		return nil
+	}
+
+	r.indomlock.RLock()
+	defer r.indomlock.RUnlock()
+
+	for _, other := range r.instanceDomains {
+		if other.ID() == indom.ID() {
+			return errors.Errorf(
+				"InstanceDomain %v has the same id %v as %v, use NewPCPInstanceDomainWithID to assign a different one",
+				indom.Name(), indom.ID(), other.Name(),
+			)
+		}
+	}
+
+	return nil
+}
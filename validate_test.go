@@ -0,0 +1,137 @@
+package speed
+
+import "testing"
+
+func TestValidateRegistration(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := testCounterVector(t, "test.registered", "a", "b")
+	c.MustRegister(registered)
+
+	before := c.r.MetricCount()
+
+	valid, err := NewPCPCounter(0, "test.valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.ValidateRegistration(valid); err != nil {
+		t.Errorf("expected %v to be valid, got %v", valid.Name(), err)
+	}
+
+	if err = c.ValidateRegistration(registered); err == nil {
+		t.Error("expected an error validating a registered metric")
+	}
+
+	reserved, err := NewPCPCounter(0, "contrib.lib.count")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.ValidateRegistration(reserved); err == nil {
+		t.Error("expected an error validating a metric in the reserved subtree")
+	}
+
+	// same indom name, different instances
+	other := testCounterVector(t, "test.other", "a", "c")
+	other.indom.name = registered.Indom().Name()
+	if err = c.ValidateRegistration(other); err == nil {
+		t.Error("expected an error validating a metric with a conflicting instance domain")
+	}
+
+	// same metric id, different name
+	collision, err := NewPCPCounter(0, "test.collision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collision.id = valid.ID()
+	c.MustRegister(valid)
+
+	if err = c.ValidateRegistration(collision); err == nil {
+		t.Error("expected an error validating a metric with a colliding id")
+	}
+
+	gauge, err := NewPCPGaugeVector(map[string]float64{"x": 1, "y": 2}, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = gauge.Apply(WithRollup(SumRollup)); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := NewPCPCounter(0, "test.gauge.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MustRegister(sum)
+
+	if err = c.ValidateRegistration(gauge); err == nil {
+		t.Error("expected an error validating a metric whose companion is registered")
+	}
+
+	if c.r.MetricCount() != before+2 {
+		t.Errorf("expected validation not to register anything, got %v metrics", c.r.MetricCount())
+	}
+
+	c.MustStart()
+	defer c.MustStop()
+
+	late, err := NewPCPCounter(0, "test.late")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.ValidateRegistration(late); err == nil {
+		t.Error("expected an error validating a metric while a mapping is active")
+	}
+}
+
+func TestValidateRegistrationPrefix(t *testing.T) {
+	c, err := NewPCPClient("test", WithPrefix("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewPCPCounter(0, "requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.ValidateRegistration(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Name() != "requests" {
+		t.Errorf("expected validation not to prefix the name, got %v", m.Name())
+	}
+
+	c.MustRegister(m)
+
+	again, err := NewPCPCounter(0, "requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.ValidateRegistration(again); err == nil {
+		t.Error("expected an error validating a metric registered under the prefixed name")
+	}
+}
+
+// testCounterVector creates a counter vector with the passed instances
+func testCounterVector(t *testing.T, name string, instances ...string) *PCPCounterVector {
+	counts := make(map[string]int64, len(instances))
+	for _, i := range instances {
+		counts[i] = 0
+	}
+
+	m, err := NewPCPCounterVector(counts, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
@@ -0,0 +1,157 @@
+package speed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// number of decreases to a non zero value after which a counter is reported
+	verifierCounterDecreases = 3
+
+	// number of consecutive increases within verifierRisingWindow
+	// after which an instant metric is reported
+	verifierRisingRun    = 100
+	verifierRisingWindow = 10 * time.Second
+)
+
+// SemanticsWarning describes a metric whose updates do not look like its semantics.
+type SemanticsWarning struct {
+	Metric    string
+	Semantics MetricSemantics
+	Reason    string
+}
+
+func (w SemanticsWarning) String() string {
+	return w.Metric + " (" + w.Semantics.String() + "): " + w.Reason
+}
+
+// semanticsVerifier inspects the values written for every metric
+// and reports likely mismatches with its semantics.
+type semanticsVerifier struct {
+	mutex  sync.Mutex
+	report func(SemanticsWarning)
+	values map[int]*verifiedValue // state by value offset
+
+	warnings *PCPCounter
+
+	now func() time.Time
+}
+
+// verifiedValue is the update history of a single value
+type verifiedValue struct {
+	last      float64
+	decreases int
+	rising    int       // length of the current run of increases
+	since     time.Time // start of the current run of increases
+	warned    bool
+}
+
+// WithSemanticsVerifier makes the client inspect the updates of all registered metrics,
+// calling the passed function once for every metric that looks like it uses the wrong
+// semantics, for example, a counter that keeps decreasing, or an instant metric that
+// keeps rising at a high rate, i.e. a counter exported as a gauge. The function runs
+// while the metric is locked, so updating the metric from it fails with ErrReentrantUpdate.
+//
+// The number of reported metrics is also exported as "speed.semantics.warnings".
+// Checking every update has a cost, so this is meant for development and testing.
+func WithSemanticsVerifier(report func(SemanticsWarning)) ClientOption {
+	return func(c *PCPClient) error {
+		if report == nil {
+			return errors.New("semantics verifier needs a report function")
+		}
+
+		v := &semanticsVerifier{report: report, values: make(map[int]*verifiedValue), now: time.Now}
+
+		var err error
+		v.warnings, err = NewPCPCounter(0, "speed.semantics.warnings",
+			"number of metrics whose updates do not match their semantics")
+		if err != nil {
+			return err
+		}
+
+		if err = c.r.AddMetric(v.warnings); err != nil {
+			return err
+		}
+
+		c.verifier = v
+		return nil
+	}
+}
+
+// wrap makes an update closure of the value at the passed offset inspect written values
+func (v *semanticsVerifier) wrap(name string, md *pcpMetricDesc, sem MetricSemantics, offset int, update updateClosure) updateClosure {
+	if name == v.warnings.Name() || (sem != CounterSemantics && sem != InstantSemantics) {
+		return update
+	}
+
+	return func(val interface{}) error {
+		if err := update(val); err != nil {
+			return err
+		}
+
+		f, ok := sampleFloat(val)
+		if !ok {
+			return nil
+		}
+
+		if reason := v.inspect(offset, sem, f); reason != "" {
+			v.warnings.Up()
+			md.callback(func() { v.report(SemanticsWarning{name, sem, reason}) })
+		}
+
+		return nil
+	}
+}
+
+// inspect records a written value, returning why it does not match
+// the passed semantics the first time it becomes apparent
+func (v *semanticsVerifier) inspect(offset int, sem MetricSemantics, f float64) string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	s, ok := v.values[offset]
+	if !ok {
+		v.values[offset] = &verifiedValue{last: f, since: v.now()}
+		return ""
+	}
+
+	last := s.last
+	s.last = f
+
+	if s.warned {
+		return ""
+	}
+
+	switch sem {
+	case CounterSemantics:
+		// a drop to 0 is a reset, which counters are allowed to do
+		if f < last && f != 0 {
+			s.decreases++
+		}
+
+		if s.decreases >= verifierCounterDecreases {
+			s.warned = true
+			return "counter value decreased repeatedly, it may be a gauge with instant semantics"
+		}
+	case InstantSemantics:
+		if f <= last {
+			s.rising, s.since = 0, v.now()
+			return ""
+		}
+
+		s.rising++
+		if s.rising >= verifierRisingRun {
+			if v.now().Sub(s.since) <= verifierRisingWindow {
+				s.warned = true
+				return "instant value rises monotonically at a high rate, it may be a counter"
+			}
+
+			s.rising, s.since = 0, v.now()
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,86 @@
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSemanticsVerifier(t *testing.T) {
+	var warnings []SemanticsWarning
+	c, err := NewPCPClient("test", WithSemanticsVerifier(func(w SemanticsWarning) {
+		warnings = append(warnings, w)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	c.verifier.now = func() time.Time { return now }
+
+	counter, err := NewPCPSingletonMetric(int64(10), "test.counter", Int64Type, CounterSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gauge, err := NewPCPGauge(0, "test.gauge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(counter)
+	c.MustRegister(gauge)
+	c.MustStart()
+	defer c.MustStop()
+
+	// a reset is fine
+	counter.MustSet(int64(0))
+	counter.MustSet(int64(5))
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings after a counter reset, got %v", warnings)
+	}
+
+	for _, v := range []int64{4, 3, 2, 1} {
+		counter.MustSet(v)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("expected a single warning for the decreasing counter, got %v", warnings)
+	}
+
+	if w := warnings[0]; w.Metric != "test.counter" || w.Semantics != CounterSemantics {
+		t.Errorf("unexpected warning %v", w)
+	}
+
+	// rising slowly is fine
+	for i := 0; i < verifierRisingRun; i++ {
+		now = now.Add(time.Second)
+		gauge.MustInc(1)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("expected no warning for a slowly rising gauge, got %v", warnings)
+	}
+
+	gauge.MustSet(0)
+	for i := 0; i < verifierRisingRun; i++ {
+		gauge.MustInc(1)
+	}
+
+	if len(warnings) != 2 {
+		t.Fatalf("expected a warning for a quickly rising gauge, got %v", warnings)
+	}
+
+	if w := warnings[1]; w.Metric != "test.gauge" || w.Semantics != InstantSemantics {
+		t.Errorf("unexpected warning %v", w)
+	}
+
+	if c.verifier.warnings.Val() != 2 {
+		t.Errorf("expected 2 reported warnings, got %v", c.verifier.warnings.Val())
+	}
+}
+
+func TestSemanticsVerifierNeedsReport(t *testing.T) {
+	if _, err := NewPCPClient("test", WithSemanticsVerifier(nil)); err == nil {
+		t.Error("expected an error creating a verifier without a report function")
+	}
+}
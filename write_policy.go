@@ -0,0 +1,84 @@
+package speed
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WritePolicy defines how a client handles failures writing updated metric values
+// to its MMV file. The zero value returns the error to the caller of Set.
+type WritePolicy struct {
+	// Retries is the number of times a failed write is retried, waiting Backoff
+	// before the first retry and doubling the wait for every following one.
+	// The metric stays locked while retrying.
+	Retries int
+	Backoff time.Duration
+
+	// Drop makes updates that still fail after retrying succeed, so the value is
+	// updated in memory, and written again when the client is restarted.
+	// Dropped writes are counted, see DroppedWrites.
+	Drop bool
+
+	// OnError, if set, is called with the name of the metric for every write
+	// that still fails after retrying, so persistent failures can be reported.
+	// It runs while the metric is locked, so updating the metric from it fails
+	// with ErrReentrantUpdate.
+	OnError func(metric string, err error)
+}
+
+// SetWritePolicy sets the policy for handling failures writing updated metric values.
+// It has to be set before the client is started.
+func (c *PCPClient) SetWritePolicy(p WritePolicy) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.r.mapped {
+		return errors.New("cannot set the write policy for an active client")
+	}
+
+	if p.Retries < 0 || p.Backoff < 0 {
+		return errors.New("write retries and backoff cannot be negative")
+	}
+
+	c.writePolicy = p
+	return nil
+}
+
+// DroppedWrites returns the number of failed writes dropped by the write policy.
+func (c *PCPClient) DroppedWrites() uint64 { return atomic.LoadUint64(&c.droppedWrites) }
+
+// wrap applies the policy to an update closure of the passed metric
+func (p WritePolicy) wrap(metric string, md *pcpMetricDesc, update updateClosure, dropped *uint64) updateClosure {
+	if p.Retries == 0 && !p.Drop && p.OnError == nil {
+		return update
+	}
+
+	return func(val interface{}) error {
+		err := update(val)
+
+		backoff := p.Backoff
+		for i := 0; err != nil && i < p.Retries; i++ {
+			time.Sleep(backoff)
+			backoff *= 2
+
+			err = update(val)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if p.OnError != nil {
+			md.callback(func() { p.OnError(metric, err) })
+		}
+
+		if p.Drop {
+			atomic.AddUint64(dropped, 1)
+			return nil
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,85 @@
+package speed
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWritePolicy(t *testing.T) {
+	fails := 0
+	update := func(interface{}) error {
+		if fails > 0 {
+			fails--
+			return errors.New("write failed")
+		}
+		return nil
+	}
+
+	var dropped uint64
+
+	// the zero value returns errors as is
+	fails = 1
+	if err := (WritePolicy{}).wrap("test", nil, update, &dropped)(1); err == nil {
+		t.Error("expected the error to be returned")
+	}
+
+	// retrying recovers from transient failures
+	fails = 2
+	if err := (WritePolicy{Retries: 2}).wrap("test", nil, update, &dropped)(1); err != nil {
+		t.Errorf("expected the write to succeed after retrying, got %v", err)
+	}
+
+	// persistent failures are reported and dropped
+	var reported []string
+	p := WritePolicy{
+		Retries: 1,
+		Drop:    true,
+		OnError: func(metric string, err error) { reported = append(reported, metric) },
+	}
+
+	fails = 5
+	if err := p.wrap("test.metric", nil, update, &dropped)(1); err != nil {
+		t.Errorf("expected the failure to be dropped, got %v", err)
+	}
+
+	if dropped != 1 {
+		t.Errorf("expected 1 dropped write, got %v", dropped)
+	}
+
+	if len(reported) != 1 || reported[0] != "test.metric" {
+		t.Errorf("expected the failure to be reported for test.metric, got %v", reported)
+	}
+}
+
+func TestSetWritePolicy(t *testing.T) {
+	c, err := NewPCPClient("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.SetWritePolicy(WritePolicy{Retries: -1}); err == nil {
+		t.Error("expected an error setting negative retries")
+	}
+
+	if err = c.SetWritePolicy(WritePolicy{Drop: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewPCPSingletonMetric(int32(1), "test.metric", Int32Type, InstantSemantics, OneUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MustRegister(m)
+	c.MustStart()
+	defer c.MustStop()
+
+	if err = c.SetWritePolicy(WritePolicy{}); err == nil {
+		t.Error("expected an error setting the write policy of an active client")
+	}
+
+	m.MustSet(2)
+	if c.DroppedWrites() != 0 {
+		t.Errorf("expected no dropped writes, got %v", c.DroppedWrites())
+	}
+}